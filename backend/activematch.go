@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// The match each player last took a seat in, one object per player, so
+	// queueing can tell whether they are still playing on any node
+	activeMatchCollection = "active_match"
+	activeMatchKey        = "current"
+)
+
+// ActiveMatch represents the match a player last took a seat in
+type ActiveMatch struct {
+	MatchID  string `json:"match_id"`
+	SeatedAt int64  `json:"seated_at"`
+}
+
+// recordSeat notes the match a player took a seat in. Matches call it in a
+// goroutine so the write stays out of the match loop.
+func recordSeat(logger runtime.Logger, nk runtime.NakamaModule, matchID, userID string) {
+	if isBotAccount(userID) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+	defer cancel()
+
+	value, _ := json.Marshal(ActiveMatch{MatchID: matchID, SeatedAt: time.Now().Unix()})
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      activeMatchCollection,
+			Key:             activeMatchKey,
+			UserID:          userID,
+			Value:           string(value),
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Warn("Failed to record match %s as active for %s: %v", matchID, userID, err)
+	}
+}
+
+// clearSeat forgets the match a player gave up their seat in, unless they have
+// taken a seat in another match since. Like recordSeat it runs in a goroutine.
+func clearSeat(logger runtime.Logger, nk runtime.NakamaModule, matchID, userID string) {
+	if isBotAccount(userID) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+	defer cancel()
+
+	active, version, err := loadActiveMatch(ctx, nk, userID)
+	if err != nil || active == nil || active.MatchID != matchID {
+		return
+	}
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{
+		{Collection: activeMatchCollection, Key: activeMatchKey, UserID: userID, Version: version},
+	}); err != nil {
+		logger.Debug("Active match of %s changed before it was cleared: %v", userID, err)
+	}
+}
+
+// loadActiveMatch reads the match a player last took a seat in, or nil
+func loadActiveMatch(ctx context.Context, nk runtime.NakamaModule, userID string) (*ActiveMatch, string, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: activeMatchCollection, Key: activeMatchKey, UserID: userID},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read active match: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, "", nil
+	}
+	var active ActiveMatch
+	if err := json.Unmarshal([]byte(objects[0].Value), &active); err != nil {
+		return nil, "", fmt.Errorf("failed to parse active match: %w", err)
+	}
+	return &active, objects[0].Version, nil
+}
+
+// activeMatchOf returns the match a player is seated in, or "" if they aren't
+// in one still being played. A seat in a match that has since finished or
+// closed doesn't count, so a record left behind by a crash never blocks anyone.
+func activeMatchOf(ctx context.Context, nk runtime.NakamaModule, userID string) (string, error) {
+	matchID, _, err := activeMatchLabel(ctx, nk, userID)
+	return matchID, err
+}
+
+// activeMatchLabel is activeMatchOf with the label of the match
+func activeMatchLabel(ctx context.Context, nk runtime.NakamaModule, userID string) (string, *MatchLabel, error) {
+	active, _, err := loadActiveMatch(ctx, nk, userID)
+	if err != nil || active == nil {
+		return "", nil, err
+	}
+
+	match, err := nk.MatchGet(ctx, active.MatchID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look up match: %w", err)
+	}
+	if match == nil {
+		return "", nil, nil
+	}
+	var label MatchLabel
+	if err := json.Unmarshal([]byte(match.GetLabel().GetValue()), &label); err != nil || label.State == GameStateFinished {
+		return "", nil, nil
+	}
+	return active.MatchID, &label, nil
+}
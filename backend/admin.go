@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Matches returned by admin_list_matches, by default and at most
+	defaultAdminMatchesLimit = 50
+	maxAdminMatchesLimit     = 100
+
+	// Largest coin grant (or deduction) in one admin_grant_currency call
+	maxAdminCoinGrant = 1000000
+)
+
+// ListMatchesRequest represents admin_list_matches request
+type ListMatchesRequest struct {
+	Mode  string `json:"mode,omitempty"`
+	State string `json:"state,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// AdminMatch represents a running match as listed for admins
+type AdminMatch struct {
+	MatchID   string     `json:"match_id"`
+	Connected int        `json:"connected"` // presences in the match, spectators included
+	Label     MatchLabel `json:"label"`
+}
+
+// AdjustStatsRequest represents admin_adjust_stats request. Omitted fields keep
+// their current values.
+type AdjustStatsRequest struct {
+	UserID     string `json:"user_id"`
+	Reason     string `json:"reason"`
+	Rating     *int64 `json:"rating,omitempty"`
+	GamesWon   *int   `json:"games_won,omitempty"`
+	GamesLost  *int   `json:"games_lost,omitempty"`
+	GamesDrawn *int   `json:"games_drawn,omitempty"`
+	WinStreak  *int   `json:"win_streak,omitempty"`
+	LossStreak *int   `json:"loss_streak,omitempty"`
+}
+
+// GrantCurrencyRequest represents admin_grant_currency request
+type GrantCurrencyRequest struct {
+	UserID string `json:"user_id"`
+	Coins  int64  `json:"coins"` // negative to deduct
+	Reason string `json:"reason"`
+}
+
+// AdminCreateMatchRequest represents admin_create_match request
+type AdminCreateMatchRequest struct {
+	Mode          string `json:"mode"`
+	Size          int    `json:"size,omitempty"`
+	WinLength     int    `json:"win_length,omitempty"`
+	Ranked        bool   `json:"ranked"`
+	AllowSelfPlay bool   `json:"allow_self_play"` // let a seated player join again from a second session
+}
+
+// AdminQueueEntry represents a queued player as listed for admins
+type AdminQueueEntry struct {
+	UserID         string `json:"user_id"`
+	Queue          string `json:"queue"`
+	Mode           string `json:"mode"`
+	Size           int    `json:"size"`
+	WinLength      int    `json:"win_length"`
+	PartyID        string `json:"party_id,omitempty"`
+	Partner        string `json:"partner,omitempty"`
+	Rating         int64  `json:"rating"`
+	WaitingSeconds int64  `json:"waiting_seconds"`
+}
+
+// InitAdmin registers the admin console RPCs
+func InitAdmin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("admin_list_matches", adminListMatchesRPC); err != nil {
+		return fmt.Errorf("failed to register admin_list_matches RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("admin_adjust_stats", adminAdjustStatsRPC); err != nil {
+		return fmt.Errorf("failed to register admin_adjust_stats RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("admin_grant_currency", adminGrantCurrencyRPC); err != nil {
+		return fmt.Errorf("failed to register admin_grant_currency RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("admin_list_queue", adminListQueueRPC); err != nil {
+		return fmt.Errorf("failed to register admin_list_queue RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("admin_create_match", adminCreateMatchRPC); err != nil {
+		return fmt.Errorf("failed to register admin_create_match RPC: %w", err)
+	}
+
+	logger.Info("Admin console initialized")
+	return nil
+}
+
+// adminListMatchesRPC lists running matches with their labels, optionally
+// filtered by mode and state (admin only)
+func adminListMatchesRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request ListMatchesRequest
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultAdminMatchesLimit
+	}
+	if request.Limit > maxAdminMatchesLimit {
+		request.Limit = maxAdminMatchesLimit
+	}
+
+	terms := make([]string, 0, 2)
+	if request.Mode != "" {
+		if _, ok := gameModesByName[request.Mode]; !ok {
+			return "", rpcErrorf(CodeInvalidArgument, "unknown mode %s", request.Mode)
+		}
+		terms = append(terms, "+label.mode:"+request.Mode)
+	}
+	if request.State != "" {
+		terms = append(terms, "+label.state:"+request.State)
+	}
+
+	// Without a query every authoritative match is listed
+	matches, err := nk.MatchList(ctx, request.Limit, true, "", nil, nil, strings.Join(terms, " "))
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to list matches: %v", err)
+	}
+
+	listed := make([]AdminMatch, 0, len(matches))
+	for _, match := range matches {
+		entry := AdminMatch{MatchID: match.GetMatchId(), Connected: int(match.GetSize())}
+		if err := json.Unmarshal([]byte(match.GetLabel().GetValue()), &entry.Label); err != nil {
+			logger.Warn("Failed to parse label of match %s: %v", entry.MatchID, err)
+		}
+		listed = append(listed, entry)
+	}
+
+	return rpcOK(map[string]interface{}{"matches": listed})
+}
+
+// adminAdjustStatsRPC overwrites a player's rating or ranked counters, keeping
+// the main leaderboard in step with the rating (admin only)
+func adminAdjustStatsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request AdjustStatsRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" || request.Reason == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id and reason are required")
+	}
+	if request.Rating != nil && *request.Rating < 0 {
+		return "", rpcError(CodeInvalidArgument, "rating cannot be negative")
+	}
+	for _, value := range []*int{request.GamesWon, request.GamesLost, request.GamesDrawn, request.WinStreak, request.LossStreak} {
+		if value != nil && *value < 0 {
+			return "", rpcError(CodeInvalidArgument, "counters cannot be negative")
+		}
+	}
+
+	// Versioned like UpdateUserStats, so a game ending meanwhile isn't lost
+	var before, stats *UserStats
+	for attempt := 0; ; attempt++ {
+		loaded, versions, err := loadUserStats(ctx, nk, []string{request.UserID})
+		if err != nil {
+			return "", rpcError(CodeUnavailable, err.Error())
+		}
+		stats = loaded[request.UserID]
+		previous := *stats
+		before = &previous
+		request.apply(stats)
+
+		err = writeUserStats(ctx, nk, request.UserID, stats, versions[request.UserID])
+		if err == nil {
+			break
+		}
+		if attempt+1 >= statsWriteAttempts {
+			return "", rpcErrorf(CodeUnavailable, "failed to adjust stats: %v", err)
+		}
+	}
+
+	if request.Rating != nil && !isBotAccount(request.UserID) {
+		if err := writeRatingRecord(ctx, nk, request.UserID, stats.Username, stats); err != nil {
+			logger.Error("Failed to update leaderboard after adjusting user %s: %v", request.UserID, err)
+		}
+	}
+
+	recordAudit(ctx, logger, nk, "adjust_stats", request.UserID, map[string]interface{}{
+		"reason": request.Reason,
+		"before": before.playerStats(request.UserID),
+		"after":  stats.playerStats(request.UserID),
+	})
+	logger.WithField("target_id", request.UserID).Info("Admin adjusted stats: %s", request.Reason)
+	return rpcOK(stats.playerStats(request.UserID))
+}
+
+// apply overwrites the stats named in the request. Games played is kept equal to
+// the sum of the ranked results.
+func (r AdjustStatsRequest) apply(stats *UserStats) {
+	if r.Rating != nil {
+		stats.Rating = *r.Rating
+	}
+	if r.GamesWon != nil {
+		stats.GamesWon = *r.GamesWon
+	}
+	if r.GamesLost != nil {
+		stats.GamesLost = *r.GamesLost
+	}
+	if r.GamesDrawn != nil {
+		stats.GamesDrawn = *r.GamesDrawn
+	}
+	if r.WinStreak != nil {
+		stats.WinStreak = *r.WinStreak
+		if stats.WinStreak > stats.LongestWinStreak {
+			stats.LongestWinStreak = stats.WinStreak
+		}
+	}
+	if r.LossStreak != nil {
+		stats.LossStreak = *r.LossStreak
+	}
+	stats.GamesPlayed = stats.GamesWon + stats.GamesLost + stats.GamesDrawn
+}
+
+// adminGrantCurrencyRPC adds coins to (or with a negative amount, takes them
+// from) a player's wallet (admin only)
+func adminGrantCurrencyRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request GrantCurrencyRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" || request.Reason == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id and reason are required")
+	}
+	if request.Coins == 0 || request.Coins > maxAdminCoinGrant || request.Coins < -maxAdminCoinGrant {
+		return "", rpcErrorf(CodeInvalidArgument, "coins must be non-zero and at most %d either way", maxAdminCoinGrant)
+	}
+
+	metadata := map[string]interface{}{"source": "admin_grant", "reason": request.Reason}
+	updated, _, err := nk.WalletUpdate(ctx, request.UserID, map[string]int64{walletCoins: request.Coins}, metadata, true)
+	if err != nil {
+		// Nakama rejects updates that would leave the wallet negative
+		return "", rpcErrorf(CodeFailedPrecondition, "failed to update wallet: %v", err)
+	}
+
+	recordAudit(ctx, logger, nk, "grant_currency", request.UserID, map[string]interface{}{
+		"reason":  request.Reason,
+		"coins":   request.Coins,
+		"balance": updated[walletCoins],
+	})
+	logger.WithField("target_id", request.UserID).Info("Admin granted %d coins: %s", request.Coins, request.Reason)
+	return rpcOK(map[string]interface{}{"user_id": request.UserID, "coins": updated[walletCoins]})
+}
+
+// adminListQueueRPC lists everyone waiting in the matchmaking queue, longest
+// waiting first (admin only)
+func adminListQueueRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	queue, err := listQueue(ctx, nk)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].Timestamp.Before(queue[j].Timestamp) })
+
+	now := time.Now()
+	entries := make([]AdminQueueEntry, len(queue))
+	for i, entry := range queue {
+		size, winLength := entry.board()
+		entries[i] = AdminQueueEntry{
+			UserID:         entry.UserID,
+			Queue:          entry.queueName(),
+			Mode:           entry.Mode,
+			Size:           size,
+			WinLength:      winLength,
+			PartyID:        entry.PartyID,
+			Partner:        entry.Partner,
+			Rating:         entry.Rating,
+			WaitingSeconds: int64(now.Sub(entry.Timestamp) / time.Second),
+		}
+	}
+
+	return rpcOK(map[string]interface{}{"entries": entries})
+}
+
+// adminCreateMatchRPC creates a match for debugging, which may be ranked and
+// may allow self-play (admin only)
+func adminCreateMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request AdminCreateMatchRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	gameMode, ok := lookupGameMode(request.Mode)
+	if !ok {
+		return "", rpcErrorf(CodeInvalidArgument, "unknown mode %q", request.Mode)
+	}
+	size, winLength, err := boardVariant(gameMode, request.Size, request.WinLength)
+	if err != nil {
+		return "", rpcError(CodeInvalidArgument, err.Error())
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+		"mode":            gameMode.Name,
+		"size":            size,
+		"win_length":      winLength,
+		"ranked":          request.Ranked,
+		"allow_self_play": request.AllowSelfPlay,
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to create match: %v", err)
+	}
+
+	recordAudit(ctx, logger, nk, "create_match", matchID, map[string]interface{}{
+		"mode":            gameMode.Name,
+		"ranked":          request.Ranked,
+		"allow_self_play": request.AllowSelfPlay,
+	})
+	logger.WithField("match_id", matchID).Info("Admin created %s match (ranked: %t, self-play: %t)", gameMode.Name, request.Ranked, request.AllowSelfPlay)
+	return rpcOK(map[string]interface{}{"match_id": matchID})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Seconds the player to move may go without sending anything before
+	// forfeiting; matches may set afk_seconds, 0 disabling the check
+	defaultAfkSeconds = 120
+	// Warning given before an idle player forfeits
+	afkWarningSeconds = 30
+)
+
+// AfkWarningData represents the warning sent to a player about to forfeit for inactivity
+type AfkWarningData struct {
+	SecondsLeft int   `json:"seconds_left"`
+	Seq         int64 `json:"seq"`
+}
+
+func (a *AfkWarningData) setSeq(seq int64) { a.Seq = seq }
+
+// markActive records activity from a seated player, clearing any AFK warning
+func markActive(match *TTTMatch, userID string) {
+	if _, seated := match.Players[userID]; !seated {
+		return
+	}
+	match.LastActive[userID] = match.Tick
+	delete(match.AfkWarned, userID)
+}
+
+// checkAfk warns the player to move once they have been idle for all but
+// afkWarningSeconds of the AFK limit, and forfeits the game for them at the
+// limit. It applies whether or not the turn clock is running. Players waiting
+// on their opponent are never idle, and disconnected players have their own
+// grace period.
+func (h *TTTMatchHandler) checkAfk(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	if match.AfkTicks <= 0 {
+		return
+	}
+
+	for userID, symbol := range match.Players {
+		if symbol != match.Turn || match.Bots[userID] {
+			continue
+		}
+		presence, connected := match.Presences[userID]
+		if !connected {
+			return
+		}
+
+		// Idle time runs from the later of their last message and their turn starting
+		since := match.LastActive[userID]
+		if match.TurnStartTick > since {
+			since = match.TurnStartTick
+		}
+		idle := match.Tick - since
+
+		if idle >= match.AfkTicks {
+			match.Winner = opponentOf(symbol)
+			match.State = GameStateFinished
+			match.EndReason = EndReasonAfk
+			logger.WithField("user_id", userID).Info("Player forfeited after %ds without activity", idle/int64(match.TickRate))
+			h.endGame(ctx, logger, nk, match, true)
+			h.broadcastState(dispatcher, match, nil)
+			return
+		}
+
+		warnAt := match.AfkTicks - int64(afkWarningSeconds*match.TickRate)
+		if warnAt < match.AfkTicks/2 {
+			warnAt = match.AfkTicks / 2
+		}
+		if idle < warnAt {
+			// A skipped turn restarts the idle time, so a later one may warn again
+			delete(match.AfkWarned, userID)
+		} else if !match.AfkWarned[userID] {
+			match.AfkWarned[userID] = true
+			secondsLeft := int((match.AfkTicks - idle + int64(match.TickRate) - 1) / int64(match.TickRate))
+			h.send(dispatcher, match, OpcodeAfkWarning, &AfkWarningData{SecondsLeft: secondsLeft}, []runtime.Presence{presence})
+		}
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Match signal types
+	SignalAnnouncement = "announcement"
+
+	// Maximum number of live matches signalled per announcement
+	maxAnnouncementMatches = 1000
+)
+
+// MatchSignalData represents a command delivered to a running match via MatchSignal
+type MatchSignalData struct {
+	Type         string                  `json:"type"`
+	Announcement *AnnouncementData       `json:"announcement,omitempty"`
+	UserIDs      []string                `json:"user_ids,omitempty"`
+	Winner       string                  `json:"winner,omitempty"`     // force_end only
+	Turn         string                  `json:"turn,omitempty"`       // set_turn only
+	Cosmetics    *Cosmetics              `json:"cosmetics,omitempty"`  // cosmetics only
+	Profile      *ProfileCard            `json:"profile,omitempty"`    // profile only
+	Round        int                     `json:"round,omitempty"`      // game_over, bot_move, and hint
+	Results      map[string]PlayerResult `json:"results,omitempty"`    // game_over only
+	MoveCount    int                     `json:"move_count,omitempty"` // bot_move and hint; moves played when the search began
+	Move         *MoveData               `json:"move,omitempty"`       // bot_move and hint
+	RequestID    string                  `json:"request_id,omitempty"` // hint only
+}
+
+// AnnouncementRequest represents send_announcement request
+type AnnouncementRequest struct {
+	Title   string   `json:"title"`
+	Message string   `json:"message"`
+	Level   string   `json:"level"`    // info, warning, event
+	UserIDs []string `json:"user_ids"` // optional segment; empty means everyone online
+	Discord bool     `json:"discord"`  // also post it to the Discord webhook; everyone only
+}
+
+// InitAnnouncements initializes operator announcements
+func InitAnnouncements(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("send_announcement", sendAnnouncementRPC); err != nil {
+		return fmt.Errorf("failed to register send_announcement RPC: %w", err)
+	}
+
+	logger.Info("Announcement system initialized")
+	return nil
+}
+
+// sendAnnouncementRPC notifies online players and shows a banner in running matches (admin only)
+func sendAnnouncementRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request AnnouncementRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.Message == "" {
+		return "", rpcError(CodeInvalidArgument, "message is required")
+	}
+	if request.Level == "" {
+		request.Level = "info"
+	}
+	if request.Discord && len(request.UserIDs) > 0 {
+		return "", rpcError(CodeInvalidArgument, "only announcements to everyone can go to Discord")
+	}
+	if request.Discord && config.DiscordWebhookURL == "" {
+		return "", rpcError(CodeFailedPrecondition, "no Discord webhook is configured")
+	}
+
+	content := map[string]interface{}{
+		"type":    "announcement",
+		"title":   request.Title,
+		"message": request.Message,
+		"level":   request.Level,
+	}
+
+	// Non-persistent notifications only reach players who are online right now
+	if len(request.UserIDs) == 0 {
+		if err := nk.NotificationSendAll(ctx, request.Title, content, NotificationAnnouncement, false); err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to send announcement: %v", err)
+		}
+	} else {
+		notifications := make([]*runtime.NotificationSend, 0, len(request.UserIDs))
+		for _, userID := range request.UserIDs {
+			notifications = append(notifications, &runtime.NotificationSend{
+				UserID:     userID,
+				Subject:    request.Title,
+				Content:    content,
+				Code:       NotificationAnnouncement,
+				Persistent: false,
+			})
+		}
+		if err := notificationsSend(ctx, nk, notifications); err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to send announcement: %v", err)
+		}
+	}
+
+	// Players in a game get an in-match banner as well
+	signal, _ := json.Marshal(MatchSignalData{
+		Type: SignalAnnouncement,
+		Announcement: &AnnouncementData{
+			Title:   request.Title,
+			Message: request.Message,
+			Level:   request.Level,
+		},
+		UserIDs: request.UserIDs,
+	})
+
+	matches, err := nk.MatchList(ctx, maxAnnouncementMatches, true, "", nil, nil, "")
+	if err != nil {
+		logger.Error("Failed to list matches for announcement: %v", err)
+	}
+
+	signalled := 0
+	for _, match := range matches {
+		if _, err := nk.MatchSignal(ctx, match.MatchId, string(signal)); err != nil {
+			logger.Warn("Failed to signal match %s: %v", match.MatchId, err)
+			continue
+		}
+		signalled++
+	}
+
+	if request.Discord {
+		announceOperatorMessage(logger, nk, request.Title, request.Message)
+	}
+
+	logger.Info("Sent announcement %q to %d matches", request.Title, signalled)
+	return rpcOK(map[string]interface{}{
+		"matches_signalled": signalled,
+	})
+}
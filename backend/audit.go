@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Append-only record of admin actions (system-owned). Keys start with the
+	// time of the action, so listing the collection returns them oldest first.
+	auditLogCollection = "audit_log"
+
+	// Actor recorded when an admin call doesn't name one
+	defaultAuditActor = "server"
+
+	// Entries read per admin_list_audit_log page, by default and at most
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 100
+)
+
+// AuditEntry represents one recorded admin action
+type AuditEntry struct {
+	ID        string                 `json:"id"`
+	Actor     string                 `json:"actor"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+// ListAuditLogRequest represents admin_list_audit_log request. Filters apply
+// within each page, so a filtered page may hold fewer than limit entries.
+type ListAuditLogRequest struct {
+	Actor  string `json:"actor,omitempty"`
+	Action string `json:"action,omitempty"`
+	Target string `json:"target,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// InitAuditLog registers the admin audit log RPC
+func InitAuditLog(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("admin_list_audit_log", adminListAuditLogRPC); err != nil {
+		return fmt.Errorf("failed to register admin_list_audit_log RPC: %w", err)
+	}
+
+	logger.Info("Audit log initialized")
+	return nil
+}
+
+// adminListAuditLogRPC pages through the audit log, oldest first, optionally
+// filtered by actor, action, and target (admin only)
+func adminListAuditLogRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request ListAuditLogRequest
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultAuditPageSize
+	}
+	if request.Limit > maxAuditPageSize {
+		request.Limit = maxAuditPageSize
+	}
+
+	objects, cursor, err := nk.StorageList(ctx, "", "", auditLogCollection, request.Limit, request.Cursor)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to list audit log: %v", err)
+	}
+	entries := make([]AuditEntry, 0, len(objects))
+	for _, object := range objects {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(object.Value), &entry); err != nil {
+			continue
+		}
+		if request.Actor != "" && entry.Actor != request.Actor {
+			continue
+		}
+		if request.Action != "" && entry.Action != request.Action {
+			continue
+		}
+		if request.Target != "" && entry.Target != request.Target {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return rpcOK(map[string]interface{}{"entries": entries, "cursor": cursor})
+}
+
+// auditActor returns who made an admin call: the "actor" query parameter the
+// calling tool passes with the HTTP key, or "server" without one
+func auditActor(ctx context.Context) string {
+	params, _ := ctx.Value(runtime.RUNTIME_CTX_QUERY_PARAMS).(map[string][]string)
+	if actor := params["actor"]; len(actor) > 0 && actor[0] != "" {
+		return actor[0]
+	}
+	return defaultAuditActor
+}
+
+// recordAudit appends an admin action to the audit log. A failed write is
+// logged but doesn't undo or fail the action, which has already happened.
+func recordAudit(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, action, target string, details map[string]interface{}) {
+	now := time.Now()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		logger.Warn("Failed to generate audit entry ID: %v", err)
+	}
+	entry := AuditEntry{
+		ID:        fmt.Sprintf("%019d_%s", now.UnixNano(), hex.EncodeToString(suffix)),
+		Actor:     auditActor(ctx),
+		Action:    action,
+		Target:    target,
+		Details:   details,
+		Timestamp: now.Unix(),
+	}
+	value, _ := json.Marshal(entry)
+
+	// Version "*" never overwrites an earlier entry
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      auditLogCollection,
+			Key:             entry.ID,
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Error("Failed to record audit entry %s on %s: %v", action, target, err)
+	}
+}
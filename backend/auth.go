@@ -5,43 +5,98 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/rtapi"
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
+const (
+	// Attempts at a versioned stats write before giving up
+	statsWriteAttempts = 3
+
+	// Default lifetime of session tokens issued by the auth RPCs and refresh_session
+	defaultSessionTokenExpiry = 2 * time.Hour
+)
+
 // DeviceAuthRequest represents device authentication request
 type DeviceAuthRequest struct {
 	DeviceID string `json:"device_id"`
 	Username string `json:"username,omitempty"`
 }
 
+// EmailAuthRequest represents email authentication request
+type EmailAuthRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Username string `json:"username,omitempty"`
+	Create   *bool  `json:"create,omitempty"` // false only signs in existing accounts; defaults to true
+}
+
+// SocialAuthRequest represents google_auth and apple_auth requests
+type SocialAuthRequest struct {
+	Token    string `json:"token"` // ID token from the provider's sign-in SDK
+	Username string `json:"username,omitempty"`
+	Create   *bool  `json:"create,omitempty"`
+}
+
 // AuthResponse represents authentication response
 type AuthResponse struct {
-	Token    string `json:"token"`
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	Created  bool   `json:"created"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Created   bool   `json:"created"`
 }
 
 // InitAuth initializes authentication hooks
 func InitAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
-	// Register device authentication RPC
-	if err := initializer.RegisterRpc("device_auth", deviceAuthRPC); err != nil {
+	// Every auth RPC draws on one allowance, so switching methods doesn't buy more password guesses
+	if err := initializer.RegisterRpc("device_auth", withRateLimit(authLimiter, deviceAuthRPC)); err != nil {
 		return fmt.Errorf("failed to register device_auth RPC: %w", err)
 	}
 
+	if err := initializer.RegisterRpc("email_auth", withRateLimit(authLimiter, emailAuthRPC)); err != nil {
+		return fmt.Errorf("failed to register email_auth RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("google_auth", withRateLimit(authLimiter, googleAuthRPC)); err != nil {
+		return fmt.Errorf("failed to register google_auth RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("apple_auth", withRateLimit(authLimiter, appleAuthRPC)); err != nil {
+		return fmt.Errorf("failed to register apple_auth RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("refresh_session", withRateLimit(authLimiter, refreshSessionRPC)); err != nil {
+		return fmt.Errorf("failed to register refresh_session RPC: %w", err)
+	}
+
 	// Register before hook for authentication
 	if err := initializer.RegisterBeforeRt("MatchmakerAdd", beforeMatchmakerAdd); err != nil {
 		return fmt.Errorf("failed to register beforeMatchmakerAdd hook: %w", err)
 	}
 
-	// Register after hook for successful authentication
-	if err := initializer.RegisterAfterRt("AuthenticateDevice", afterDeviceAuth); err != nil {
+	// Register after hooks so clients authenticating directly with Nakama get
+	// the same setup as the auth RPCs
+	if err := initializer.RegisterAfterAuthenticateDevice(afterDeviceAuth); err != nil {
 		return fmt.Errorf("failed to register afterDeviceAuth hook: %w", err)
 	}
 
+	if err := initializer.RegisterAfterAuthenticateEmail(afterEmailAuth); err != nil {
+		return fmt.Errorf("failed to register afterEmailAuth hook: %w", err)
+	}
+
+	if err := initializer.RegisterAfterAuthenticateGoogle(afterGoogleAuth); err != nil {
+		return fmt.Errorf("failed to register afterGoogleAuth hook: %w", err)
+	}
+
+	if err := initializer.RegisterAfterAuthenticateApple(afterAppleAuth); err != nil {
+		return fmt.Errorf("failed to register afterAppleAuth hook: %w", err)
+	}
+
 	logger.Info("Authentication system initialized")
 	return nil
 }
@@ -50,11 +105,11 @@ func InitAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime
 func deviceAuthRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 	var request DeviceAuthRequest
 	if err := json.Unmarshal([]byte(payload), &request); err != nil {
-		return "", fmt.Errorf("invalid request format: %w", err)
+		return "", invalidPayload(err)
 	}
 
 	if request.DeviceID == "" {
-		return "", fmt.Errorf("device_id is required")
+		return "", rpcError(CodeInvalidArgument, "device_id is required")
 	}
 
 	// Generate username if not provided
@@ -66,40 +121,166 @@ func deviceAuthRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk ru
 	// Authenticate with device ID
 	userID, username, created, err := nk.AuthenticateDevice(ctx, request.DeviceID, username, true)
 	if err != nil {
-		return "", fmt.Errorf("authentication failed: %w", err)
+		return "", rpcErrorf(CodeUnauthenticated, "authentication failed: %v", err)
+	}
+
+	logger.Info("Device authenticated: userID=%s, username=%s, created=%v", userID, username, created)
+	return authenticated(ctx, logger, nk, userID, username, created)
+}
+
+// emailAuthRPC handles email and password authentication
+func emailAuthRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request EmailAuthRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
 	}
 
-	// For now, return user info without JWT token
-	response := AuthResponse{
-		Token:    "", // JWT token generation can be added later
-		UserID:   userID,
-		Username: username,
-		Created:  created,
+	if request.Email == "" || request.Password == "" {
+		return "", rpcError(CodeInvalidArgument, "email and password are required")
 	}
 
-	responseBytes, err := json.Marshal(response)
+	userID, username, created, err := nk.AuthenticateEmail(ctx, request.Email, request.Password, request.Username, createAccount(request.Create))
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal response: %w", err)
+		return "", rpcErrorf(CodeUnauthenticated, "authentication failed: %v", err)
 	}
 
-	logger.Info("Device authenticated: userID=%s, username=%s, created=%v", userID, username, created)
-	return string(responseBytes), nil
+	logger.Info("Email authenticated: userID=%s, username=%s, created=%v", userID, username, created)
+	return authenticated(ctx, logger, nk, userID, username, created)
+}
+
+// googleAuthRPC handles Google Sign-In authentication
+func googleAuthRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request SocialAuthRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	if request.Token == "" {
+		return "", rpcError(CodeInvalidArgument, "token is required")
+	}
+
+	userID, username, created, err := nk.AuthenticateGoogle(ctx, request.Token, request.Username, createAccount(request.Create))
+	if err != nil {
+		return "", rpcErrorf(CodeUnauthenticated, "authentication failed: %v", err)
+	}
+
+	logger.Info("Google authenticated: userID=%s, username=%s, created=%v", userID, username, created)
+	return authenticated(ctx, logger, nk, userID, username, created)
+}
+
+// appleAuthRPC handles Sign in with Apple authentication
+func appleAuthRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request SocialAuthRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	if request.Token == "" {
+		return "", rpcError(CodeInvalidArgument, "token is required")
+	}
+
+	userID, username, created, err := nk.AuthenticateApple(ctx, request.Token, request.Username, createAccount(request.Create))
+	if err != nil {
+		return "", rpcErrorf(CodeUnauthenticated, "authentication failed: %v", err)
+	}
+
+	logger.Info("Apple authenticated: userID=%s, username=%s, created=%v", userID, username, created)
+	return authenticated(ctx, logger, nk, userID, username, created)
+}
+
+// authenticated sets up a freshly authenticated player and returns their session
+func authenticated(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, username string, created bool) (string, error) {
+	token, expiresAt, err := nk.AuthenticateTokenGenerate(userID, username, time.Now().Add(config.SessionTokenExpiry).Unix(), nil)
+	if err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to issue session token: %v", err)
+	}
+
+	onAuthenticated(ctx, logger, nk, userID, username, created)
+
+	return rpcOK(AuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		UserID:    userID,
+		Username:  username,
+		Created:   created,
+	})
+}
+
+// createAccount returns whether an auth request may create a new account
+func createAccount(create *bool) bool {
+	return create == nil || *create
 }
 
-// beforeMatchmakerAdd validates authentication before matchmaking
+// refreshSessionRPC issues the caller a new session token while their current one
+// is still valid. Clients whose token already expired authenticate again with device_auth.
+func refreshSessionRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	// Keep any session variables the current token carries
+	vars, _ := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string)
+
+	token, expiresAt, err := nk.AuthenticateTokenGenerate(userID, username, time.Now().Add(config.SessionTokenExpiry).Unix(), vars)
+	if err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to issue session token: %v", err)
+	}
+
+	return rpcOK(AuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		UserID:    userID,
+		Username:  username,
+	})
+}
+
+// beforeMatchmakerAdd validates authentication and bans before matchmaking
 func beforeMatchmakerAdd(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, envelope *rtapi.Envelope) (*rtapi.Envelope, error) {
 	// Check if user is authenticated
 	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
 	if !ok || userID == "" {
-		return nil, runtime.NewError("authentication required", 3)
+		return nil, rpcError(CodeUnauthenticated, "authentication required")
+	}
+
+	// Banned players can't enter the matchmaker
+	if err := checkBan(ctx, logger, nk, userID); err != nil {
+		return nil, err
+	}
+
+	// Players in a match finish it first, and a ticket replaces any place they
+	// held in the storage-backed queue, so they are never paired twice
+	if matchID, err := activeMatchOf(ctx, nk, userID); err != nil {
+		logger.Warn("Failed to check whether %s is in a match: %v", userID, err)
+	} else if matchID != "" {
+		return nil, rpcErrorReason(CodeFailedPrecondition, ReasonInMatch, "already in an active match", map[string]interface{}{
+			"match_id": matchID,
+			"user_id":  userID,
+		})
+	}
+	if err := dequeue(ctx, nk, userID); err != nil {
+		logger.Warn("Failed to cancel queue entry of %s: %v", userID, err)
 	}
 
 	// Validate matchmaker properties
-	if envelope.GetMatchmakerAdd() != nil {
-		query := envelope.GetMatchmakerAdd().Query
-		if query == "" {
-			// Set default query for classic mode
-			envelope.GetMatchmakerAdd().Query = "*"
+	if add := envelope.GetMatchmakerAdd(); add != nil {
+		// Stamp the rating server-side so clients can't claim a different one
+		rating := int64(defaultRating)
+		if ratings, err := loadRatings(ctx, nk, []string{userID}); err != nil {
+			logger.Warn("Failed to load rating for %s, using default: %v", userID, err)
+		} else if r, ok := ratings[userID]; ok {
+			rating = r
+		}
+		if add.NumericProperties == nil {
+			add.NumericProperties = make(map[string]float64)
+		}
+		add.NumericProperties["rating"] = float64(rating)
+
+		if add.Query == "" || add.Query == "*" {
+			// Default to opponents within the starting rating band
+			add.Query = fmt.Sprintf("+properties.rating:>=%d +properties.rating:<=%d",
+				rating-ratingBandBase, rating+ratingBandBase)
 		}
 
 		// Add mode property if not present
@@ -109,51 +290,96 @@ func beforeMatchmakerAdd(ctx context.Context, logger runtime.Logger, db *sql.DB,
 		if _, exists := envelope.GetMatchmakerAdd().StringProperties["mode"]; !exists {
 			envelope.GetMatchmakerAdd().StringProperties["mode"] = GameModeClassic
 		}
+
+		// Only match tickets for the same board, whatever query the client sent
+		gameMode, _ := lookupGameMode(add.StringProperties["mode"])
+		size, winLength, err := boardVariant(gameMode, int(add.NumericProperties["size"]), int(add.NumericProperties["win_length"]))
+		if err != nil {
+			return nil, rpcError(CodeInvalidArgument, err.Error())
+		}
+		add.NumericProperties["size"] = float64(size)
+		add.NumericProperties["win_length"] = float64(winLength)
+		add.Query = fmt.Sprintf("%s +properties.size:%d +properties.win_length:%d", add.Query, size, winLength)
+
+		// Tickets are ranked unless they ask for casual, and custom boards are always casual
+		queue := QueueRanked
+		if add.StringProperties["queue"] == QueueCasual || isCustomVariant(gameMode, size, winLength) {
+			queue = QueueCasual
+		}
+		add.StringProperties["queue"] = queue
+		add.Query = fmt.Sprintf("%s +properties.queue:%s", add.Query, queue)
 	}
 
 	return envelope, nil
 }
 
-// afterDeviceAuth handles post-authentication setup
-func afterDeviceAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *rtapi.Envelope, in *rtapi.Envelope) error {
+// afterDeviceAuth handles post-authentication setup for device sessions
+func afterDeviceAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateDeviceRequest) error {
+	afterAuthenticate(ctx, logger, nk, out)
+	return nil
+}
+
+// afterEmailAuth handles post-authentication setup for email sessions
+func afterEmailAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateEmailRequest) error {
+	afterAuthenticate(ctx, logger, nk, out)
+	return nil
+}
+
+// afterGoogleAuth handles post-authentication setup for Google sessions
+func afterGoogleAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateGoogleRequest) error {
+	afterAuthenticate(ctx, logger, nk, out)
+	return nil
+}
+
+// afterAppleAuth handles post-authentication setup for Apple sessions
+func afterAppleAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateAppleRequest) error {
+	afterAuthenticate(ctx, logger, nk, out)
+	return nil
+}
+
+// afterAuthenticate runs the post-authentication setup for a session Nakama issued
+func afterAuthenticate(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, out *api.Session) {
 	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
-	if !ok {
-		return nil
+	if !ok || userID == "" {
+		return
 	}
-
 	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
 
-	// Initialize user statistics
-	err := initializeUserStats(ctx, logger, nk, userID, username)
-	if err != nil {
-		logger.Error("Failed to initialize user stats: %v", err)
+	onAuthenticated(ctx, logger, nk, userID, username, out.GetCreated())
+}
+
+// onAuthenticated is the setup shared by every auth method: new accounts get
+// their stats initialized, returning players get wiped stats repaired, and
+// every login counts towards quests
+func onAuthenticated(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, username string, created bool) {
+	if created {
+		if err := initializeUserStats(ctx, logger, nk, userID, username); err != nil {
+			logger.Error("Failed to initialize user stats: %v", err)
+		}
+	} else if err := repairUserStats(ctx, logger, nk, userID); err != nil {
+		logger.Warn("Failed to check user stats for repair: %v", err)
 	}
 
-	return nil
+	if err := RecordQuestEvents(ctx, logger, nk, userID, "", QuestEventLogin); err != nil {
+		logger.Warn("Failed to record login for quests: %v", err)
+	}
 }
 
-// initializeUserStats sets up initial user statistics
+// initializeUserStats creates a new player's statistics. It never replaces
+// existing stats, so running it again for a returning player is harmless.
 func initializeUserStats(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, username string) error {
-	// Create user storage object for statistics
-	objects := []*runtime.StorageWrite{
-		{
-			Collection: "user_stats",
-			Key:        "stats",
-			UserID:     userID,
-			Value: `{
-				"games_played": 0,
-				"games_won": 0,
-				"games_lost": 0,
-				"games_drawn": 0,
-				"total_score": 0,
-				"created_at": ` + fmt.Sprintf("%d", time.Now().Unix()) + `,
-				"username": "` + username + `"
-			}`,
-		},
-	}
-
-	_, err := nk.StorageWrite(ctx, objects)
-	if err != nil {
+	stats := newUserStats()
+	stats.Username = username
+	stats.CreatedAt = time.Now().Unix()
+
+	// Version "*" only writes if the player has no stats yet
+	if err := writeUserStats(ctx, nk, userID, stats, "*"); err != nil {
+		objects, readErr := storageRead(ctx, nk, []*runtime.StorageRead{
+			{Collection: userStatsCollection, Key: userStatsKey, UserID: userID},
+		})
+		if readErr == nil && len(objects) > 0 {
+			return nil
+		}
 		return fmt.Errorf("failed to create user stats: %w", err)
 	}
 
@@ -161,84 +387,89 @@ func initializeUserStats(ctx context.Context, logger runtime.Logger, nk runtime.
 	return nil
 }
 
-// UpdateUserStats updates user statistics after a game
-func UpdateUserStats(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, won, lost, drawn bool) error {
-	// Read current stats
-	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{
-		{
-			Collection: "user_stats",
-			Key:        "stats",
-			UserID:     userID,
-		},
-	})
+// repairUserStats rebuilds the stats of players whose stats were reset to zero
+// by earlier versions re-initializing them on every login. Stats showing no
+// games while match history exists are recounted from the history, and the
+// rating is restored from the main leaderboard.
+func repairUserStats(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) error {
+	loaded, versions, err := loadUserStats(ctx, nk, []string{userID})
 	if err != nil {
-		return fmt.Errorf("failed to read user stats: %w", err)
+		return err
 	}
-
-	var stats map[string]interface{}
-	if len(objects) > 0 {
-		// Parse JSON value
-		if err := json.Unmarshal([]byte(objects[0].Value), &stats); err != nil {
-			stats = make(map[string]interface{})
-		}
-	} else {
-		stats = make(map[string]interface{})
+	stats := loaded[userID]
+	if stats.GamesPlayed > 0 || stats.CasualGamesPlayed > 0 {
+		return nil
 	}
 
-	// Update stats
-	if gamesPlayed, ok := stats["games_played"].(float64); ok {
-		stats["games_played"] = gamesPlayed + 1
-	} else {
-		stats["games_played"] = 1
+	// The whole history, so the recount matches every game played
+	history, _, err := listMatchHistory(ctx, nk, userID, 0)
+	if err != nil {
+		return err
 	}
-
-	// Get current total score
-	var totalScore float64
-	if ts, ok := stats["total_score"].(float64); ok {
-		totalScore = ts
+	if len(history) == 0 {
+		return nil
 	}
 
-	if won {
-		if gamesWon, ok := stats["games_won"].(float64); ok {
-			stats["games_won"] = gamesWon + 1
-		} else {
-			stats["games_won"] = 1
-		}
-		stats["total_score"] = totalScore + 10
-	} else if lost {
-		if gamesLost, ok := stats["games_lost"].(float64); ok {
-			stats["games_lost"] = gamesLost + 1
-		} else {
-			stats["games_lost"] = 1
-		}
-		stats["total_score"] = totalScore - 5
-	} else if drawn {
-		if gamesDrawn, ok := stats["games_drawn"].(float64); ok {
-			stats["games_drawn"] = gamesDrawn + 1
-		} else {
-			stats["games_drawn"] = 1
-		}
-		stats["total_score"] = totalScore + 1
+	// Streaks replay ranked results in the order they happened
+	sort.Slice(history, func(i, j int) bool { return history[i].EndedAt < history[j].EndedAt })
+	for _, record := range history {
+		stats.apply(GameResult{
+			Won:    record.Result == ResultWin,
+			Lost:   record.Result == ResultLoss,
+			Drawn:  record.Result == ResultDraw,
+			Ranked: record.Ranked,
+		})
 	}
 
-	// Convert stats to JSON
-	statsJSON, err := json.Marshal(stats)
+	record, err := playerRecord(ctx, nk, config.LeaderboardID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal stats: %w", err)
+		return fmt.Errorf("failed to read rating: %w", err)
+	}
+	if record != nil {
+		stats.Rating = record.Score
 	}
 
-	// Write updated stats
-	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{
-		{
-			Collection: "user_stats",
-			Key:        "stats",
-			UserID:     userID,
-			Value:      string(statsJSON),
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to update user stats: %w", err)
+	// A match ending meanwhile changes the version; the next login retries
+	if err := writeUserStats(ctx, nk, userID, stats, versions[userID]); err != nil {
+		return fmt.Errorf("failed to write repaired user stats: %w", err)
 	}
 
+	logger.WithField("user_id", userID).Info("Rebuilt stats from %d history records", len(history))
 	return nil
 }
+
+// GameResult represents one finished game from a player's perspective
+type GameResult struct {
+	Won         bool
+	Lost        bool
+	Drawn       bool
+	Ranked      bool
+	Rated       bool  // whether the game moves the player's Elo rating
+	RatingDelta int64 // rating change for rated games
+}
+
+// UpdateUserStats applies a game result to the player's statistics and returns
+// the stats afterwards. Casual (unranked) results only update the casual
+// counters and never change the rating. Ranked results also advance the win and
+// loss streaks. The update is a versioned read-modify-write retried on conflict,
+// so games ending at the same time for one player don't overwrite each other.
+func UpdateUserStats(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, result GameResult) (*UserStats, error) {
+	for attempt := 0; ; attempt++ {
+		loaded, versions, err := loadUserStats(ctx, nk, []string{userID})
+		if err != nil {
+			return nil, err
+		}
+		stats := loaded[userID]
+		stats.apply(result)
+
+		err = writeUserStats(ctx, nk, userID, stats, versions[userID])
+		if err == nil {
+			return stats, nil
+		}
+		// Another game for this player ended at the same time; apply on top of it
+		if attempt+1 >= statsWriteAttempts {
+			return nil, err
+		}
+		logger.WithField("user_id", userID).Debug("Stats write conflict, retrying: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// memoryNakama keeps storage objects and wallets in memory with Nakama's
+// versioning rules; other calls are unused
+type memoryNakama struct {
+	countingNakama
+	mutex   sync.Mutex // matches write from goroutines
+	objects map[string]*api.StorageObject
+	wallets map[string]map[string]int64
+	version int
+	created []map[string]interface{} // params of every MatchCreate
+	labels  map[string]string        // matchID -> label of running matches
+}
+
+func newMemoryNakama() *memoryNakama {
+	return &memoryNakama{
+		countingNakama: countingNakama{counters: map[string]int64{}},
+		objects:        map[string]*api.StorageObject{},
+		wallets:        map[string]map[string]int64{},
+		labels:         map[string]string{},
+	}
+}
+
+func (n *memoryNakama) MetricsCounterAdd(name string, tags map[string]string, delta int64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.countingNakama.MetricsCounterAdd(name, tags, delta)
+}
+
+func storageID(collection, key, userID string) string {
+	return collection + "/" + userID + "/" + key
+}
+
+func (n *memoryNakama) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	var objects []*api.StorageObject
+	for _, read := range reads {
+		if object, ok := n.objects[storageID(read.Collection, read.Key, read.UserID)]; ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func (n *memoryNakama) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, write := range writes {
+		existing, exists := n.objects[storageID(write.Collection, write.Key, write.UserID)]
+		switch {
+		case write.Version == "*" && exists,
+			write.Version != "" && write.Version != "*" && (!exists || existing.Version != write.Version):
+			return nil, runtime.ErrStorageRejectedVersion
+		}
+	}
+	acks := make([]*api.StorageObjectAck, 0, len(writes))
+	for _, write := range writes {
+		n.version++
+		object := &api.StorageObject{
+			Collection: write.Collection,
+			Key:        write.Key,
+			UserId:     write.UserID,
+			Value:      write.Value,
+			Version:    strconv.Itoa(n.version),
+		}
+		n.objects[storageID(write.Collection, write.Key, write.UserID)] = object
+		acks = append(acks, &api.StorageObjectAck{Collection: object.Collection, Key: object.Key, UserId: object.UserId, Version: object.Version})
+	}
+	return acks, nil
+}
+
+func (n *memoryNakama) StorageDelete(ctx context.Context, deletes []*runtime.StorageDelete) error {
+	for _, del := range deletes {
+		delete(n.objects, storageID(del.Collection, del.Key, del.UserID))
+	}
+	return nil
+}
+
+// StorageList pages through a user's objects in key order, like Nakama
+func (n *memoryNakama) StorageList(ctx context.Context, callerID, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	var objects []*api.StorageObject
+	for _, object := range n.objects {
+		if object.Collection == collection && (userID == "" || object.UserId == userID) {
+			objects = append(objects, object)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	start, _ := strconv.Atoi(cursor)
+	end := min(start+limit, len(objects))
+	if start >= end {
+		return nil, "", nil
+	}
+	next := ""
+	if end < len(objects) {
+		next = strconv.Itoa(end)
+	}
+	return objects[start:end], next, nil
+}
+
+func (n *memoryNakama) WalletUpdate(ctx context.Context, userID string, changeset map[string]int64, metadata map[string]interface{}, updateLedger bool) (map[string]int64, map[string]int64, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.wallets[userID] == nil {
+		n.wallets[userID] = map[string]int64{}
+	}
+	previous := map[string]int64{}
+	for currency, amount := range changeset {
+		previous[currency] = n.wallets[userID][currency]
+		if n.wallets[userID][currency]+amount < 0 {
+			return nil, nil, fmt.Errorf("insufficient %s", currency)
+		}
+		n.wallets[userID][currency] += amount
+	}
+	return n.wallets[userID], previous, nil
+}
+
+func (n *memoryNakama) MatchCreate(ctx context.Context, module string, params map[string]interface{}) (string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.created = append(n.created, params)
+	return fmt.Sprintf("match-%d.node", len(n.created)), nil
+}
+
+func (n *memoryNakama) MatchGet(ctx context.Context, id string) (*api.Match, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	label, ok := n.labels[id]
+	if !ok {
+		return nil, nil
+	}
+	return &api.Match{MatchId: id, Label: wrapperspb.String(label)}, nil
+}
+
+// sessionContext is the context Nakama passes hooks and RPCs for a player's session
+func sessionContext(userID, username string) context.Context {
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, userID)
+	return context.WithValue(ctx, runtime.RUNTIME_CTX_USERNAME, username)
+}
+
+func TestNativeEmailAuthenticationCreatesStats(t *testing.T) {
+	initializer := &recordingInitializer{}
+	if err := InitAuth(context.Background(), discardLogger{}, nil, nil, initializer); err != nil {
+		t.Fatal(err)
+	}
+	if initializer.afterEmail == nil {
+		t.Fatal("no hook registered for Nakama's email authentication")
+	}
+
+	nk := newMemoryNakama()
+	ctx := sessionContext("user-1", "ada")
+	if err := initializer.afterEmail(ctx, discardLogger{}, nil, nk, &api.Session{Created: true}, &api.AuthenticateEmailRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, versions, err := loadUserStats(ctx, nk, []string{"user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions["user-1"] == "*" {
+		t.Fatal("email authentication created no stats")
+	}
+	if stats["user-1"].Username != "ada" || stats["user-1"].Rating != defaultRating {
+		t.Errorf("got stats for %q rated %d, want ada at %d", stats["user-1"].Username, stats["user-1"].Rating, defaultRating)
+	}
+
+	progress, _, err := loadQuestProgress(ctx, nk, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.LastLoginDay == 0 || nk.wallets["user-1"][walletCoins] == 0 {
+		t.Error("email authentication did not count the login towards quests")
+	}
+}
+
+func TestNativeEmailSignInKeepsExistingStats(t *testing.T) {
+	nk := newMemoryNakama()
+	ctx := sessionContext("user-1", "ada")
+	stats := newUserStats()
+	stats.Username = "ada"
+	stats.GamesPlayed, stats.GamesWon = 4, 3
+	if err := writeUserStats(ctx, nk, "user-1", stats, "*"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := afterEmailAuth(ctx, discardLogger{}, nil, nk, &api.Session{}, &api.AuthenticateEmailRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, _, err := loadUserStats(ctx, nk, []string{"user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded["user-1"].GamesPlayed != 4 || loaded["user-1"].GamesWon != 3 {
+		t.Errorf("got %d games and %d wins after signing in, want 4 and 3", loaded["user-1"].GamesPlayed, loaded["user-1"].GamesWon)
+	}
+}
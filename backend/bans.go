@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Active bans, owned by the banned player
+	bansCollection = "bans"
+	banKey         = "ban"
+
+	// Longest suspension an admin may apply; longer needs a permanent ban
+	maxBanDuration = 90 * 24 * time.Hour
+
+	// Ban kinds: a ban lasts until lifted, a suspension until it expires
+	BanKindBan        = "ban"
+	BanKindSuspension = "suspension"
+)
+
+// Ban represents a ban from matchmaking and match joins
+type Ban struct {
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+	ReportID  string `json:"report_id,omitempty"`
+	BannedAt  int64  `json:"banned_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // 0 for a permanent ban
+}
+
+// BanStatus represents the ban details returned to a rejected player
+type BanStatus struct {
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// BanPlayerRequest represents admin_ban_player request
+type BanPlayerRequest struct {
+	UserID          string `json:"user_id"`
+	DurationSeconds int64  `json:"duration_seconds,omitempty"` // omit for a permanent ban
+	Reason          string `json:"reason"`
+	ReportID        string `json:"report_id,omitempty"` // resolves this report if given
+}
+
+// UnbanPlayerRequest represents admin_unban_player request
+type UnbanPlayerRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// InitBans registers the admin ban RPCs
+func InitBans(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("admin_ban_player", adminBanPlayerRPC); err != nil {
+		return fmt.Errorf("failed to register admin_ban_player RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("admin_unban_player", adminUnbanPlayerRPC); err != nil {
+		return fmt.Errorf("failed to register admin_unban_player RPC: %w", err)
+	}
+
+	logger.Info("Bans initialized")
+	return nil
+}
+
+// adminBanPlayerRPC bans a player from matchmaking and joining matches, for a
+// while if a duration is given and otherwise until unbanned, resolving the
+// report that prompted it if given (admin only)
+func adminBanPlayerRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request BanPlayerRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" || request.Reason == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id and reason are required")
+	}
+	duration := time.Duration(request.DurationSeconds) * time.Second
+	if duration < 0 || duration > maxBanDuration {
+		return "", rpcErrorf(CodeInvalidArgument, "duration_seconds must be between 1 and %d, or omitted for a permanent ban", int64(maxBanDuration/time.Second))
+	}
+
+	now := time.Now()
+	ban := Ban{
+		Kind:     BanKindBan,
+		Reason:   request.Reason,
+		ReportID: request.ReportID,
+		BannedAt: now.Unix(),
+	}
+	resolution := fmt.Sprintf("banned: %s", request.Reason)
+	if duration > 0 {
+		ban.Kind = BanKindSuspension
+		ban.ExpiresAt = now.Add(duration).Unix()
+		resolution = fmt.Sprintf("suspended for %s: %s", duration, request.Reason)
+	}
+
+	value, _ := json.Marshal(ban)
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      bansCollection,
+			Key:             banKey,
+			UserID:          request.UserID,
+			Value:           string(value),
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to store ban: %v", err)
+	}
+
+	if request.ReportID != "" {
+		if err := resolveReport(ctx, nk, request.ReportID, resolution); err != nil {
+			logger.Warn("Failed to resolve report %s: %v", request.ReportID, err)
+		}
+	}
+
+	recordAudit(ctx, logger, nk, "ban_player", request.UserID, map[string]interface{}{
+		"kind":       ban.Kind,
+		"reason":     ban.Reason,
+		"report_id":  ban.ReportID,
+		"expires_at": ban.ExpiresAt,
+	})
+	notifyPlayerBanned(logger, nk, request.UserID, ban)
+	logger.WithField("banned_id", request.UserID).Info("Player %s", resolution)
+	return rpcOK(ban)
+}
+
+// adminUnbanPlayerRPC lifts a player's ban or suspension (admin only)
+func adminUnbanPlayerRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request UnbanPlayerRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id is required")
+	}
+
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{
+		{Collection: bansCollection, Key: banKey, UserID: request.UserID},
+	}); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to lift ban: %v", err)
+	}
+
+	recordAudit(ctx, logger, nk, "unban_player", request.UserID, nil)
+	logger.WithField("banned_id", request.UserID).Info("Player unbanned")
+	return rpcOK(map[string]interface{}{"user_id": request.UserID})
+}
+
+// activeBan returns the player's ban if one is in force, or nil
+func activeBan(ctx context.Context, nk runtime.NakamaModule, userID string) (*Ban, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: bansCollection, Key: banKey, UserID: userID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ban: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var ban Ban
+	if err := json.Unmarshal([]byte(objects[0].Value), &ban); err != nil {
+		return nil, fmt.Errorf("failed to parse ban: %w", err)
+	}
+	if ban.ExpiresAt != 0 && ban.ExpiresAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	return &ban, nil
+}
+
+// checkBan returns a structured permission error if the player is banned. A ban
+// that can't be read lets the player through, so a storage hiccup doesn't lock
+// everyone out.
+func checkBan(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) error {
+	ban, err := activeBan(ctx, nk, userID)
+	if err != nil {
+		logger.WithField("user_id", userID).Warn("Failed to check ban: %v", err)
+		return nil
+	}
+	if ban == nil {
+		return nil
+	}
+
+	message := "banned"
+	if ban.ExpiresAt != 0 {
+		message = fmt.Sprintf("suspended until %s", time.Unix(ban.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	return rpcErrorReason(CodePermissionDenied, ReasonBanned, message, BanStatus{
+		Kind:      ban.Kind,
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	})
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+// Bot difficulties
+const (
+	BotEasy   = "easy"   // random legal moves
+	BotMedium = "medium" // wins or blocks when it can, otherwise a one-ply heuristic
+	BotHard   = "hard"   // solver search: exact on 3x3, depth-limited on larger boards
+
+	// Practice bots whose strength follows the player's results against them
+	BotAdaptive = "adaptive"
+)
+
+const (
+	// Boards from this size up are searched for hard bots and hints off the
+	// match loop; the move found arrives as a match signal
+	backgroundSearchSize = 6
+	// A background search not heard back from in this long is started again
+	botSearchTimeout = 10 * time.Second
+
+	// Match signals delivering the move a background search found, for a bot
+	// seat or as a player's hint
+	SignalBotMove = "bot_move"
+	SignalHint    = "hint"
+)
+
+// BotProfile describes a provisioned bot account
+type BotProfile struct {
+	CustomID    string
+	Username    string
+	DisplayName string
+	AvatarURL   string
+	Rating      int
+	Difficulty  string
+}
+
+// botRoster is the fixed set of bot identities created at module init
+var botRoster = []BotProfile{
+	{CustomID: "lila_bot_pixel", Username: "bot_pixel", DisplayName: "Pixel", AvatarURL: "avatar://bot/pixel", Rating: 1000, Difficulty: BotEasy},
+	{CustomID: "lila_bot_nova", Username: "bot_nova", DisplayName: "Nova", AvatarURL: "avatar://bot/nova", Rating: 1200, Difficulty: BotMedium},
+	{CustomID: "lila_bot_atlas", Username: "bot_atlas", DisplayName: "Atlas", AvatarURL: "avatar://bot/atlas", Rating: 1400, Difficulty: BotMedium},
+	{CustomID: "lila_bot_sage", Username: "bot_sage", DisplayName: "Sage", AvatarURL: "avatar://bot/sage", Rating: 1600, Difficulty: BotHard},
+}
+
+// BotMatchRequest represents start_bot_match request
+type BotMatchRequest struct {
+	Mode       string `json:"mode"`
+	Difficulty string `json:"difficulty"`
+}
+
+// InitBots provisions bot accounts and registers the solo play RPC
+func InitBots(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	// Bot seats need a real identity; failing here only disables bot play
+	if err := provisionBots(ctx, logger, nk); err != nil {
+		logger.Error("Failed to provision bot accounts: %v", err)
+	}
+
+	if err := initializer.RegisterRpc("start_bot_match", startBotMatchRPC); err != nil {
+		return fmt.Errorf("failed to register start_bot_match RPC: %w", err)
+	}
+
+	logger.Info("Bot players initialized")
+	return nil
+}
+
+// startBotMatchRPC creates a casual match against a server-played bot
+func startBotMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	request := BotMatchRequest{Mode: GameModeClassic, Difficulty: BotMedium}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.Mode == "" {
+		request.Mode = GameModeClassic
+	}
+	if request.Difficulty == "" {
+		request.Difficulty = BotMedium
+	}
+	if !isBotDifficulty(request.Difficulty) {
+		return "", rpcErrorf(CodeInvalidArgument, "unknown difficulty %q", request.Difficulty)
+	}
+	if !isQueueableMode(request.Mode, time.Now()) {
+		return "", rpcErrorf(CodeInvalidArgument, "mode %s is not available", request.Mode)
+	}
+
+	// Adaptive bots start where the player's last practice game left them
+	level := 0
+	if request.Difficulty == BotAdaptive {
+		practice, _, err := loadBotPractice(ctx, nk, userID)
+		if err != nil {
+			return "", rpcError(CodeUnavailable, err.Error())
+		}
+		level = practice.Level
+	}
+
+	matchID, profile, err := createBotMatch(ctx, nk, request.Mode, 0, 0, request.Difficulty, level)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to create bot match: %v", err)
+	}
+
+	logger.Info("Created %s bot match %s against %s", request.Difficulty, matchID, profile.Username)
+	response := map[string]interface{}{
+		"match_id":   matchID,
+		"mode":       request.Mode,
+		"difficulty": request.Difficulty,
+		"bot":        profile.DisplayName,
+	}
+	if level != 0 {
+		response["bot_level"] = level
+	}
+	return rpcOK(response)
+}
+
+// Provisioned bot accounts by user ID
+var (
+	botAccounts      = make(map[string]BotProfile)
+	botAccountsMutex sync.RWMutex
+)
+
+// provisionBots creates (or reuses) an account for every bot in the roster
+func provisionBots(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	for _, profile := range botRoster {
+		userID, _, created, err := nk.AuthenticateCustom(ctx, profile.CustomID, profile.Username, true)
+		if err != nil {
+			return fmt.Errorf("failed to provision bot %s: %w", profile.Username, err)
+		}
+
+		metadata := map[string]interface{}{
+			"bot":    true,
+			"rating": profile.Rating,
+		}
+		if err := nk.AccountUpdateId(ctx, userID, "", metadata, profile.DisplayName, "", "", "", profile.AvatarURL); err != nil {
+			return fmt.Errorf("failed to update bot %s: %w", profile.Username, err)
+		}
+
+		botAccountsMutex.Lock()
+		botAccounts[userID] = profile
+		botAccountsMutex.Unlock()
+
+		if created {
+			logger.Info("Provisioned bot account %s (%s)", profile.Username, userID)
+		}
+	}
+
+	return nil
+}
+
+// botProfile returns the roster profile of a provisioned bot
+func botProfile(userID string) (BotProfile, bool) {
+	botAccountsMutex.RLock()
+	defer botAccountsMutex.RUnlock()
+	profile, ok := botAccounts[userID]
+	return profile, ok
+}
+
+// isBotAccount reports whether a user ID belongs to a provisioned bot
+func isBotAccount(userID string) bool {
+	botAccountsMutex.RLock()
+	defer botAccountsMutex.RUnlock()
+	_, ok := botAccounts[userID]
+	return ok
+}
+
+// createBotMatch creates a casual match with one bot seat of the given
+// difficulty. level is the strength of an adaptive bot and ignored otherwise.
+func createBotMatch(ctx context.Context, nk runtime.NakamaModule, mode string, size, winLength int, difficulty string, level int) (string, BotProfile, error) {
+	identity := difficulty
+	if difficulty == BotAdaptive {
+		identity = adaptiveBotIdentity(level)
+	}
+	botID, profile, ok := botForDifficulty(identity)
+	if !ok {
+		return "", BotProfile{}, fmt.Errorf("no %s bot provisioned", identity)
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+		"mode":       mode,
+		"size":       size,
+		"win_length": winLength,
+		"ranked":     false,
+		"bots":       []string{botID},
+		"difficulty": difficulty,
+		"bot_level":  level,
+	})
+	if err != nil {
+		return "", BotProfile{}, fmt.Errorf("failed to create match: %w", err)
+	}
+	return matchID, profile, nil
+}
+
+// isBotDifficulty reports whether a difficulty name is known
+func isBotDifficulty(difficulty string) bool {
+	return difficulty == BotEasy || difficulty == BotMedium || difficulty == BotHard || difficulty == BotAdaptive
+}
+
+// botForDifficulty returns a provisioned bot matching the difficulty
+func botForDifficulty(difficulty string) (string, BotProfile, bool) {
+	botAccountsMutex.RLock()
+	defer botAccountsMutex.RUnlock()
+
+	candidates := make([]string, 0, len(botAccounts))
+	for userID, profile := range botAccounts {
+		if profile.Difficulty == difficulty {
+			candidates = append(candidates, userID)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", BotProfile{}, false
+	}
+	userID := candidates[rand.Intn(len(candidates))]
+	return userID, botAccounts[userID], true
+}
+
+// randomBotPair returns two distinct provisioned bot user IDs
+func randomBotPair() ([]string, error) {
+	botAccountsMutex.RLock()
+	defer botAccountsMutex.RUnlock()
+
+	if len(botAccounts) < 2 {
+		return nil, fmt.Errorf("not enough bot accounts provisioned")
+	}
+
+	ids := make([]string, 0, len(botAccounts))
+	for userID := range botAccounts {
+		ids = append(ids, userID)
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	return ids[:2], nil
+}
+
+// playBotTurn makes a move for the seat whose turn it is if that seat is a bot.
+// Hard bots on large boards search in the background instead, so the search
+// never holds up the match loop.
+func (h *TTTMatchHandler) playBotTurn(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	symbol, ok := botToMove(match)
+	if !ok {
+		return
+	}
+
+	// Adaptive bots decide move by move how well to play; one already
+	// searching in the background waits for its search
+	difficulty := match.BotDifficulty
+	if difficulty == BotAdaptive {
+		difficulty = BotHard
+		if match.BotSearchStarted == 0 {
+			difficulty = adaptiveMoveDifficulty(match.BotLevel)
+		}
+	}
+
+	if difficulty == BotHard && match.Size >= backgroundSearchSize {
+		h.startBotSearch(logger, nk, match, symbol)
+		return
+	}
+
+	move, ok := chooseBotMove(match.Board, symbol, difficulty)
+	if !ok {
+		return
+	}
+	h.playBotMove(ctx, logger, nk, dispatcher, match, symbol, move)
+}
+
+// botToMove returns the symbol of the bot seat whose turn it is, if any
+func botToMove(match *TTTMatch) (string, bool) {
+	for userID, symbol := range match.Players {
+		if symbol == match.Turn && match.Bots[userID] {
+			return symbol, true
+		}
+	}
+	return "", false
+}
+
+// playBotMove plays a bot's chosen move, letting the mode relocate it (e.g.
+// gravity drops it down its column)
+func (h *TTTMatchHandler) playBotMove(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, symbol string, move MoveData) {
+	gameMode, _ := lookupGameMode(match.Mode)
+	resolved, err := gameMode.Rules.Resolve(match.Board, rules.Move{Row: move.Row, Col: move.Col})
+	if err != nil {
+		logger.Warn("Bot chose an invalid move: %v", err)
+		return
+	}
+	move.Row, move.Col = resolved.Row, resolved.Col
+
+	h.applyMove(ctx, logger, nk, dispatcher, match, symbol, move)
+}
+
+// startBotSearch searches a copy of the board for the bot's move in a
+// goroutine, which signals the match with the result
+func (h *TTTMatchHandler) startBotSearch(logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch, symbol string) {
+	if match.BotSearchStarted != 0 && time.Since(time.Unix(match.BotSearchStarted, 0)) < botSearchTimeout {
+		return
+	}
+	match.BotSearchStarted = time.Now().Unix()
+
+	board := rules.Copy(match.Board)
+	matchID, round, moveCount := match.ID, match.Round, match.MoveCount
+	go recoverInto(logger, nk, "bot_search", func() {
+		move, ok := chooseBotMove(board, symbol, BotHard)
+		if !ok {
+			return
+		}
+		signal, _ := json.Marshal(MatchSignalData{Type: SignalBotMove, Round: round, MoveCount: moveCount, Move: &move})
+
+		ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+		defer cancel()
+		if _, err := nk.MatchSignal(ctx, matchID, string(signal)); err != nil {
+			logger.Warn("Failed to deliver bot move: %v", err)
+		}
+	})
+}
+
+// applyBotSearch plays the move a background search found, unless the game
+// moved on while it ran
+func (h *TTTMatchHandler) applyBotSearch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, signal MatchSignalData) {
+	match.BotSearchStarted = 0
+	if signal.Move == nil || signal.Round != match.Round || signal.MoveCount != match.MoveCount || match.State != GameStatePlaying {
+		return
+	}
+	symbol, ok := botToMove(match)
+	if !ok {
+		return
+	}
+	h.playBotMove(ctx, logger, nk, dispatcher, match, symbol, *signal.Move)
+}
+
+// chooseBotMove picks a move for the given difficulty
+func chooseBotMove(board rules.Board, symbol, difficulty string) (MoveData, bool) {
+	switch difficulty {
+	case BotEasy:
+		moves := emptyCells(board)
+		if len(moves) == 0 {
+			return MoveData{}, false
+		}
+		return moves[rand.Intn(len(moves))], true
+	case BotMedium:
+		return heuristicBotMove(board, symbol)
+	default:
+		// Hard: one of the solver's best moves at random
+		analysis := analyzePosition(board, symbol)
+		if len(analysis.BestMoves) == 0 {
+			return MoveData{}, false
+		}
+		return analysis.BestMoves[rand.Intn(len(analysis.BestMoves))], true
+	}
+}
+
+// heuristicBotMove wins if it can, blocks an immediate loss, and otherwise plays
+// the move with the best static evaluation
+func heuristicBotMove(board rules.Board, symbol string) (MoveData, bool) {
+	moves := emptyCells(board)
+	if len(moves) == 0 {
+		return MoveData{}, false
+	}
+
+	work := rules.Copy(board)
+	for _, target := range []string{symbol, opponentOf(symbol)} {
+		for _, move := range moves {
+			work.Set(move.Row, move.Col, target)
+			won := rules.Winner(work) == target
+			work.Set(move.Row, move.Col, Empty)
+			if won {
+				return move, true
+			}
+		}
+	}
+
+	var best []MoveData
+	bestScore := 0
+	for _, move := range moves {
+		work.Set(move.Row, move.Col, symbol)
+		score := evaluateBoard(work, symbol)
+		work.Set(move.Row, move.Col, Empty)
+
+		if len(best) == 0 || score > bestScore {
+			best, bestScore = []MoveData{move}, score
+		} else if score == bestScore {
+			best = append(best, move)
+		}
+	}
+	return best[rand.Intn(len(best))], true
+}
+
+// stringSliceParam reads a list of strings from match params, which may arrive
+// either as []string or as a decoded []interface{}
+func stringSliceParam(params map[string]interface{}, key string) []string {
+	switch value := params[key].(type) {
+	case []string:
+		return value
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
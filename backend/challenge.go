@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Pending challenges, owned by the challenged player and keyed by challenge ID
+	challengesCollection = "challenges"
+
+	// How long a challenge may go unanswered
+	challengeTTL = 2 * time.Minute
+
+	// Nakama friend state for mutual friends
+	friendStateMutual = 0
+	friendsPage       = 100
+	maxFriends        = 1000
+)
+
+// ChallengeRequest represents challenge_player request
+type ChallengeRequest struct {
+	UserID string `json:"user_id"`
+	Mode   string `json:"mode"`
+	BestOf int    `json:"best_of,omitempty"`
+}
+
+// RespondChallengeRequest represents respond_challenge request
+type RespondChallengeRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Accept      bool   `json:"accept"`
+}
+
+// Challenge represents a pending challenge from one player to another
+type Challenge struct {
+	ID             string `json:"challenge_id"`
+	Challenger     string `json:"challenger"`
+	ChallengerName string `json:"challenger_name"`
+	Challenged     string `json:"challenged"`
+	Mode           string `json:"mode"`
+	BestOf         int    `json:"best_of"`
+	CreatedAt      int64  `json:"created_at"`
+	ExpiresAt      int64  `json:"expires_at"`
+}
+
+// InitChallenges registers the challenge RPCs
+func InitChallenges(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("challenge_player", challengePlayerRPC); err != nil {
+		return fmt.Errorf("failed to register challenge_player RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("respond_challenge", respondChallengeRPC); err != nil {
+		return fmt.Errorf("failed to register respond_challenge RPC: %w", err)
+	}
+
+	logger.Info("Challenges initialized")
+	return nil
+}
+
+// challengePlayerRPC challenges another player to a casual match. Players can be
+// challenged by their friends, or by anyone if they enabled challenges_from_anyone.
+func challengePlayerRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	var request ChallengeRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id is required")
+	}
+	if request.UserID == userID {
+		return "", rpcError(CodeInvalidArgument, "cannot challenge yourself")
+	}
+	if request.Mode == "" {
+		request.Mode = GameModeClassic
+	}
+	now := time.Now()
+	if !isQueueableMode(request.Mode, now) {
+		return "", rpcErrorf(CodeInvalidArgument, "mode %s is not available", request.Mode)
+	}
+	if request.BestOf == 0 {
+		request.BestOf = 1
+	}
+	if request.BestOf < 1 || request.BestOf > maxBestOf || request.BestOf%2 == 0 {
+		return "", rpcErrorf(CodeInvalidArgument, "best_of must be an odd number from 1 to %d", maxBestOf)
+	}
+
+	users, err := nk.UsersGetId(ctx, []string{request.UserID}, nil)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to look up user: %v", err)
+	}
+	if len(users) == 0 {
+		return "", rpcErrorf(CodeNotFound, "user %s not found", request.UserID)
+	}
+
+	settings, err := GetUserSettings(ctx, nk, request.UserID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if !settings.ChallengesFromAnyone {
+		friends, err := areFriends(ctx, nk, request.UserID, userID)
+		if err != nil {
+			return "", rpcError(CodeUnavailable, err.Error())
+		}
+		if !friends {
+			return "", rpcError(CodePermissionDenied, "this player only accepts challenges from friends")
+		}
+	}
+
+	id, err := newChallengeID()
+	if err != nil {
+		return "", rpcError(CodeInternal, err.Error())
+	}
+	challenge := Challenge{
+		ID:             id,
+		Challenger:     userID,
+		ChallengerName: username,
+		Challenged:     request.UserID,
+		Mode:           request.Mode,
+		BestOf:         request.BestOf,
+		CreatedAt:      now.Unix(),
+		ExpiresAt:      now.Add(challengeTTL).Unix(),
+	}
+
+	value, _ := json.Marshal(challenge)
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      challengesCollection,
+			Key:             challenge.ID,
+			UserID:          challenge.Challenged,
+			Value:           string(value),
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to store challenge: %v", err)
+	}
+
+	if err := notificationsSend(ctx, nk, []*runtime.NotificationSend{
+		{
+			UserID:     challenge.Challenged,
+			Subject:    "Challenge",
+			Content:    challengeContent("challenge", challenge),
+			Code:       NotificationChallenge,
+			Sender:     userID,
+			Persistent: true,
+		},
+	}); err != nil {
+		// The challenge can't be answered if it was never delivered
+		deleteChallenge(ctx, logger, nk, challenge.Challenged, challenge.ID)
+		return "", rpcErrorf(CodeUnavailable, "failed to send challenge: %v", err)
+	}
+
+	logger.Info("User %s challenged %s to a %s match (challenge %s)", userID, challenge.Challenged, challenge.Mode, challenge.ID)
+	return rpcOK(challenge)
+}
+
+// respondChallengeRPC accepts or declines a challenge sent to the caller. On
+// accept a casual match is created and both players are notified of it.
+func respondChallengeRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request RespondChallengeRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.ChallengeID == "" {
+		return "", rpcError(CodeInvalidArgument, "challenge_id is required")
+	}
+
+	// Only the challenged player owns the challenge, so nobody else can answer it
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: challengesCollection, Key: request.ChallengeID, UserID: userID},
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to read challenge: %v", err)
+	}
+	if len(objects) == 0 {
+		return "", rpcErrorf(CodeNotFound, "challenge %s not found", request.ChallengeID)
+	}
+
+	var challenge Challenge
+	if err := json.Unmarshal([]byte(objects[0].Value), &challenge); err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to parse challenge: %v", err)
+	}
+
+	// Claim the challenge so a double tap can't create two matches
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{
+		{Collection: challengesCollection, Key: challenge.ID, UserID: userID, Version: objects[0].Version},
+	}); err != nil {
+		return "", rpcErrorf(CodeFailedPrecondition, "challenge %s was already answered", challenge.ID)
+	}
+
+	if time.Now().Unix() > challenge.ExpiresAt {
+		return "", rpcErrorf(CodeFailedPrecondition, "challenge %s has expired", challenge.ID)
+	}
+
+	if !request.Accept {
+		if err := notificationsSend(ctx, nk, []*runtime.NotificationSend{
+			{
+				UserID:     challenge.Challenger,
+				Subject:    "Challenge Declined",
+				Content:    challengeContent("challenge_declined", challenge),
+				Code:       NotificationChallengeDeclined,
+				Sender:     userID,
+				Persistent: true,
+			},
+		}); err != nil {
+			logger.Warn("Failed to notify %s that challenge %s was declined: %v", challenge.Challenger, challenge.ID, err)
+		}
+
+		logger.Info("User %s declined challenge %s", userID, challenge.ID)
+		return rpcOK(map[string]interface{}{"challenge_id": challenge.ID, "accepted": false})
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+		"mode":    challenge.Mode,
+		"ranked":  false,
+		"best_of": challenge.BestOf,
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to create match: %v", err)
+	}
+
+	for _, player := range []string{challenge.Challenger, challenge.Challenged} {
+		if err := notifyMatchCreated(ctx, nk, player, matchID, challenge.Mode, map[string]interface{}{"challenge_id": challenge.ID}); err != nil {
+			logger.Error("Failed to notify %s of challenge match %s: %v", player, matchID, err)
+		}
+	}
+
+	logger.Info("User %s accepted challenge %s, created match %s", userID, challenge.ID, matchID)
+	return rpcOK(map[string]interface{}{"challenge_id": challenge.ID, "accepted": true, "match_id": matchID})
+}
+
+// areFriends reports whether friendID is a mutual friend of userID
+func areFriends(ctx context.Context, nk runtime.NakamaModule, userID, friendID string) (bool, error) {
+	state := friendStateMutual
+	cursor := ""
+	for {
+		friends, next, err := nk.FriendsList(ctx, userID, friendsPage, &state, cursor)
+		if err != nil {
+			return false, fmt.Errorf("failed to list friends: %w", err)
+		}
+		for _, friend := range friends {
+			if friend.GetUser().GetId() == friendID {
+				return true, nil
+			}
+		}
+		if next == "" {
+			return false, nil
+		}
+		cursor = next
+	}
+}
+
+// listFriendIDs returns the user IDs of a user's mutual friends, up to maxFriends
+func listFriendIDs(ctx context.Context, nk runtime.NakamaModule, userID string) ([]string, error) {
+	state := friendStateMutual
+	cursor := ""
+	ids := make([]string, 0)
+	for len(ids) < maxFriends {
+		friends, next, err := nk.FriendsList(ctx, userID, friendsPage, &state, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list friends: %w", err)
+		}
+		for _, friend := range friends {
+			ids = append(ids, friend.GetUser().GetId())
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return ids, nil
+}
+
+// challengeContent returns the notification content describing a challenge
+func challengeContent(kind string, challenge Challenge) map[string]interface{} {
+	return map[string]interface{}{
+		"type":            kind,
+		"challenge_id":    challenge.ID,
+		"challenger":      challenge.Challenger,
+		"challenger_name": challenge.ChallengerName,
+		"challenged":      challenge.Challenged,
+		"mode":            challenge.Mode,
+		"best_of":         challenge.BestOf,
+		"expires_at":      challenge.ExpiresAt,
+	}
+}
+
+// deleteChallenge removes a challenge that can no longer be answered
+func deleteChallenge(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, ownerID, challengeID string) {
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{
+		{Collection: challengesCollection, Key: challengeID, UserID: ownerID},
+	}); err != nil {
+		logger.Warn("Failed to delete challenge %s: %v", challengeID, err)
+	}
+}
+
+// newChallengeID returns a random challenge ID
+func newChallengeID() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate challenge ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
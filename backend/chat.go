@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Longest chat message, in characters
+	maxChatLength = 200
+	// Recent chat messages kept in match state for players who reconnect
+	chatHistorySize = 20
+)
+
+var (
+	// Emote IDs name client-side animations
+	emotes = map[string]bool{
+		"wave":      true,
+		"gg":        true,
+		"thumbs_up": true,
+		"laugh":     true,
+		"think":     true,
+		"wow":       true,
+		"oops":      true,
+	}
+
+	// Words masked out of chat, matched case-insensitively as whole words
+	profanityPattern = regexp.MustCompile(`(?i)\b(fuck\w*|shit\w*|bitch\w*|cunt\w*|asshole\w*|bastard\w*|dick|dickhead|wanker\w*|twat\w*|slut\w*|whore\w*)\b`)
+)
+
+// ChatMessage represents one chat line kept in match state
+type ChatMessage struct {
+	UserID string `json:"user_id"`
+	Text   string `json:"text"`
+	SentAt int64  `json:"sent_at"`
+}
+
+// ChatData represents a chat message broadcast to the match
+type ChatData struct {
+	ChatMessage
+	Seq int64 `json:"seq"`
+}
+
+// ChatHistoryData represents the recent chat sent to a player who joins or reconnects
+type ChatHistoryData struct {
+	Messages []ChatMessage `json:"messages"`
+	Seq      int64         `json:"seq"`
+}
+
+// EmoteData represents an emote broadcast to the match
+type EmoteData struct {
+	UserID string `json:"user_id"`
+	Emote  string `json:"emote"`
+	Seq    int64  `json:"seq"`
+}
+
+// ChatRequestData represents a chat message from a client
+type ChatRequestData struct {
+	Text      string `json:"text"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// EmoteRequestData represents an emote from a client
+type EmoteRequestData struct {
+	Emote     string `json:"emote"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (c *ChatData) setSeq(seq int64)        { c.Seq = seq }
+func (c *ChatHistoryData) setSeq(seq int64) { c.Seq = seq }
+func (e *EmoteData) setSeq(seq int64)       { e.Seq = seq }
+
+// handleChat filters a player's chat message and relays it to the match
+func (h *TTTMatchHandler) handleChat(dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	var request ChatRequestData
+	if err := json.Unmarshal(message.GetData(), &request); err != nil {
+		h.sendError(dispatcher, match, message, "", ErrInvalidMessage, "Invalid chat message")
+		return
+	}
+	text := strings.TrimSpace(request.Text)
+	if text == "" || utf8.RuneCountInString(text) > maxChatLength {
+		h.sendError(dispatcher, match, message, request.RequestID, ErrInvalidMessage, "Chat messages must be 1-200 characters")
+		return
+	}
+	if !h.allowMessage(dispatcher, match, chatLimiter, message, request.RequestID) {
+		return
+	}
+
+	chat := ChatMessage{
+		UserID: message.GetUserId(),
+		Text:   filterProfanity(text),
+		SentAt: time.Now().Unix(),
+	}
+	match.Chat = append(match.Chat, chat)
+	if len(match.Chat) > chatHistorySize {
+		match.Chat = match.Chat[len(match.Chat)-chatHistorySize:]
+	}
+
+	h.send(dispatcher, match, OpcodeChat, &ChatData{ChatMessage: chat}, nil)
+	saveMatchState(match)
+}
+
+// handleEmote relays one of the known emotes to the match
+func (h *TTTMatchHandler) handleEmote(dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	var request EmoteRequestData
+	if err := json.Unmarshal(message.GetData(), &request); err != nil || !emotes[request.Emote] {
+		h.sendError(dispatcher, match, message, request.RequestID, ErrInvalidMessage, "Unknown emote")
+		return
+	}
+	if !h.allowMessage(dispatcher, match, chatLimiter, message, request.RequestID) {
+		return
+	}
+
+	h.send(dispatcher, match, OpcodeEmote, &EmoteData{UserID: message.GetUserId(), Emote: request.Emote}, nil)
+}
+
+// sendChatHistory sends the recent chat to players who just joined, if there is any
+func (h *TTTMatchHandler) sendChatHistory(dispatcher runtime.MatchDispatcher, match *TTTMatch, presences []runtime.Presence) {
+	if len(match.Chat) == 0 || len(presences) == 0 {
+		return
+	}
+	h.send(dispatcher, match, OpcodeChatHistory, &ChatHistoryData{Messages: match.Chat}, presences)
+}
+
+// filterProfanity masks blocked words with asterisks of the same length
+func filterProfanity(text string) string {
+	return profanityPattern.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// runGameClock spends one tick of the game clock of the player to move in
+// modes with a per-player time bank. A player whose bank runs out loses.
+func (h *TTTMatchHandler) runGameClock(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	if match.ClockTicks <= 0 {
+		return
+	}
+
+	for userID, symbol := range match.Players {
+		if symbol != match.Turn {
+			continue
+		}
+		if _, started := match.Clocks[userID]; !started {
+			match.Clocks[userID] = match.ClockTicks
+		}
+		match.Clocks[userID]--
+		if match.Clocks[userID] > 0 {
+			return
+		}
+
+		match.Clocks[userID] = 0
+		match.Winner = opponentOf(symbol)
+		match.State = GameStateFinished
+		match.EndReason = EndReasonTimeout
+		logger.WithField("user_id", userID).Info("Player lost on time")
+		h.endGame(ctx, logger, nk, match, false)
+		h.broadcastState(dispatcher, match, nil)
+		return
+	}
+}
+
+// clocksState returns each player's remaining game clock in milliseconds, or nil
+// if the mode has no game clock
+func clocksState(match *TTTMatch) map[string]int64 {
+	if match.ClockTicks <= 0 || match.TickRate <= 0 {
+		return nil
+	}
+	clocks := make(map[string]int64, len(match.Players))
+	for userID := range match.Players {
+		left, started := match.Clocks[userID]
+		if !started {
+			left = match.ClockTicks
+		}
+		clocks[userID] = left * 1000 / int64(match.TickRate)
+	}
+	return clocks
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes and notification codes shared with the match handler
+const (
+	opcodeMove          = 1
+	opcodeState         = 2
+	opcodeError         = 3
+	opcodeResyncRequest = 6
+
+	notificationMatchCreated = 1
+)
+
+// envelope is the subset of Nakama's realtime JSON envelope the harness uses
+type envelope struct {
+	Cid           string          `json:"cid,omitempty"`
+	Rpc           *rpcMessage     `json:"rpc,omitempty"`
+	Error         *socketError    `json:"error,omitempty"`
+	Notifications *notifications  `json:"notifications,omitempty"`
+	MatchJoin     *matchJoin      `json:"match_join,omitempty"`
+	MatchLeave    *matchJoin      `json:"match_leave,omitempty"`
+	Match         json.RawMessage `json:"match,omitempty"`
+	MatchData     *matchData      `json:"match_data,omitempty"`
+	MatchDataSend *matchData      `json:"match_data_send,omitempty"`
+}
+
+type rpcMessage struct {
+	ID      string `json:"id"`
+	Payload string `json:"payload,omitempty"`
+}
+
+type socketError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notifications struct {
+	Notifications []struct {
+		Code    int    `json:"code"`
+		Content string `json:"content"`
+	} `json:"notifications"`
+}
+
+type matchJoin struct {
+	MatchID string `json:"match_id"`
+}
+
+type matchData struct {
+	MatchID string `json:"match_id"`
+	OpCode  string `json:"op_code"`
+	Data    string `json:"data,omitempty"` // base64
+}
+
+// gameState mirrors the server's StateData broadcast
+type gameState struct {
+	Board   [][]string        `json:"board"`
+	Turn    string            `json:"turn"`
+	Winner  string            `json:"winner"`
+	Players map[string]string `json:"players"`
+	Seq     int64             `json:"seq"`
+}
+
+// client is one simulated player
+type client struct {
+	config Config
+	stats  *Stats
+	id     string
+	userID string
+	token  string
+	socket *wsConn
+
+	nextCid   int
+	pending   map[string]chan envelope
+	mutex     sync.Mutex
+	matchIDs  chan string
+	matchData chan matchData
+	closed    chan struct{}
+}
+
+// newClient creates a simulated player with a custom ID unique to this run
+func newClient(config Config, stats *Stats, index int) *client {
+	return &client{
+		config:    config,
+		stats:     stats,
+		id:        fmt.Sprintf("loadtest_%s_%d", config.RunID, index),
+		pending:   make(map[string]chan envelope),
+		matchIDs:  make(chan string, 4),
+		matchData: make(chan matchData, 64),
+		closed:    make(chan struct{}),
+	}
+}
+
+// run authenticates, connects, and plays the configured number of games
+func (c *client) run() {
+	start := time.Now()
+	if err := c.authenticate(); err != nil {
+		c.stats.Fail("auth", err)
+		return
+	}
+	c.stats.Observe("auth", time.Since(start))
+
+	start = time.Now()
+	if err := c.connect(); err != nil {
+		c.stats.Fail("connect", err)
+		return
+	}
+	c.stats.Observe("connect", time.Since(start))
+	defer c.socket.Close()
+
+	for i := 0; i < c.config.Games; i++ {
+		if err := c.playGame(); err != nil {
+			c.stats.Fail("game", err)
+			continue
+		}
+		c.stats.Count("games_completed")
+	}
+}
+
+// authenticate creates or logs into the client's custom account over REST
+func (c *client) authenticate() error {
+	body, _ := json.Marshal(map[string]string{"id": c.id})
+	endpoint := strings.TrimRight(c.config.Addr, "/") + "/v2/account/authenticate/custom?create=true&username=" + url.QueryEscape(c.id)
+
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(c.config.ServerKey, "")
+	request.Header.Set("Content-Type", "application/json")
+
+	httpClient := &http.Client{Timeout: c.config.Timeout}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("auth request failed: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth returned %s", response.Status)
+	}
+
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&session); err != nil {
+		return fmt.Errorf("failed to decode session: %w", err)
+	}
+	c.token = session.Token
+
+	userID, err := tokenUserID(session.Token)
+	if err != nil {
+		return err
+	}
+	c.userID = userID
+	return nil
+}
+
+// connect opens the realtime socket and starts the read loop
+func (c *client) connect() error {
+	socketURL := strings.Replace(strings.TrimRight(c.config.Addr, "/"), "http", "ws", 1) +
+		"/ws?format=json&token=" + url.QueryEscape(c.token)
+
+	socket, err := dialWebSocket(socketURL, c.config.Timeout)
+	if err != nil {
+		return err
+	}
+	c.socket = socket
+
+	go c.readLoop()
+	return nil
+}
+
+// readLoop routes socket messages to pending requests, notifications, and match data
+func (c *client) readLoop() {
+	defer close(c.closed)
+	for {
+		message, err := c.socket.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var env envelope
+		if err := json.Unmarshal(message, &env); err != nil {
+			c.stats.Count("malformed_messages")
+			continue
+		}
+
+		switch {
+		case env.Cid != "":
+			c.mutex.Lock()
+			reply, ok := c.pending[env.Cid]
+			delete(c.pending, env.Cid)
+			c.mutex.Unlock()
+			if ok {
+				reply <- env
+			}
+		case env.Notifications != nil:
+			for _, notification := range env.Notifications.Notifications {
+				if notification.Code != notificationMatchCreated {
+					continue
+				}
+				var content struct {
+					MatchID string `json:"match_id"`
+				}
+				if json.Unmarshal([]byte(notification.Content), &content) == nil && content.MatchID != "" {
+					c.matchIDs <- content.MatchID
+				}
+			}
+		case env.MatchData != nil:
+			select {
+			case c.matchData <- *env.MatchData:
+			default:
+				c.stats.Count("dropped_match_data")
+			}
+		}
+	}
+}
+
+// request sends an envelope with a fresh cid and waits for its reply
+func (c *client) request(env envelope) (envelope, error) {
+	c.mutex.Lock()
+	c.nextCid++
+	env.Cid = strconv.Itoa(c.nextCid)
+	reply := make(chan envelope, 1)
+	c.pending[env.Cid] = reply
+	c.mutex.Unlock()
+
+	if err := c.send(env); err != nil {
+		return envelope{}, err
+	}
+
+	select {
+	case response := <-reply:
+		if response.Error != nil {
+			return response, fmt.Errorf("server error %d: %s", response.Error.Code, response.Error.Message)
+		}
+		return response, nil
+	case <-c.closed:
+		return envelope{}, fmt.Errorf("socket closed")
+	case <-time.After(c.config.Timeout):
+		return envelope{}, fmt.Errorf("request timed out")
+	}
+}
+
+// send writes an envelope without waiting for a reply
+func (c *client) send(env envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return c.socket.WriteText(data)
+}
+
+// playGame queues, joins the matched game, and plays random legal moves until it ends
+func (c *client) playGame() error {
+	start := time.Now()
+	matchID, err := c.findMatch()
+	if err != nil {
+		return fmt.Errorf("matchmaking: %w", err)
+	}
+	c.stats.Observe("matchmaking", time.Since(start))
+
+	start = time.Now()
+	if _, err := c.request(envelope{MatchJoin: &matchJoin{MatchID: matchID}}); err != nil {
+		return fmt.Errorf("join: %w", err)
+	}
+	c.stats.Observe("match_join", time.Since(start))
+	defer c.send(envelope{MatchLeave: &matchJoin{MatchID: matchID}})
+
+	var lastSeq int64 = -1
+	var moveSentAt time.Time
+	for {
+		var data matchData
+		select {
+		case data = <-c.matchData:
+		case <-c.closed:
+			return fmt.Errorf("socket closed mid-game")
+		case <-time.After(c.config.MoveTimeout):
+			return fmt.Errorf("no match data for %s", c.config.MoveTimeout)
+		}
+		if data.MatchID != matchID {
+			continue
+		}
+
+		payload, _ := base64.StdEncoding.DecodeString(data.Data)
+		switch data.OpCode {
+		case strconv.Itoa(opcodeError):
+			c.stats.Count("match_errors")
+			if !moveSentAt.IsZero() {
+				// The move was rejected; ask for fresh state and try again
+				moveSentAt = time.Time{}
+				lastSeq = -1
+				c.sendMatchData(matchID, opcodeResyncRequest, map[string]string{})
+			}
+
+		case strconv.Itoa(opcodeState):
+			var state gameState
+			if err := json.Unmarshal(payload, &state); err != nil {
+				c.stats.Count("malformed_messages")
+				continue
+			}
+			if !moveSentAt.IsZero() && state.Seq > lastSeq {
+				c.stats.Observe("move_broadcast", time.Since(moveSentAt))
+				moveSentAt = time.Time{}
+			}
+			if state.Seq > lastSeq {
+				lastSeq = state.Seq
+			}
+
+			if state.Winner != "" || boardFull(state.Board) {
+				c.stats.Observe("game_duration", time.Since(start))
+				return nil
+			}
+			if len(state.Players) < 2 || state.Turn != state.Players[c.userID] || !moveSentAt.IsZero() {
+				continue
+			}
+
+			row, col := randomEmptyCell(state.Board)
+			moveSentAt = time.Now()
+			c.stats.Count("moves_sent")
+			if err := c.sendMatchData(matchID, opcodeMove, map[string]interface{}{"row": row, "col": col}); err != nil {
+				return fmt.Errorf("send move: %w", err)
+			}
+		}
+	}
+}
+
+// findMatch queues for a game and returns the match ID, from either the RPC
+// reply (second player in) or the match-created notification (first player in)
+func (c *client) findMatch() (string, error) {
+	// Both paired players are notified, so drop match IDs left over from earlier games
+	for len(c.matchIDs) > 0 {
+		<-c.matchIDs
+	}
+
+	payload, _ := json.Marshal(map[string]string{"mode": c.config.Mode})
+	response, err := c.request(envelope{Rpc: &rpcMessage{ID: "start_matchmaking", Payload: string(payload)}})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		OK   bool `json:"ok"`
+		Data struct {
+			Ticket string `json:"ticket"`
+		} `json:"data"`
+	}
+	if response.Rpc == nil || json.Unmarshal([]byte(response.Rpc.Payload), &result) != nil || !result.OK {
+		return "", fmt.Errorf("unexpected start_matchmaking response")
+	}
+	if !strings.HasPrefix(result.Data.Ticket, "ticket_") {
+		return result.Data.Ticket, nil
+	}
+
+	select {
+	case matchID := <-c.matchIDs:
+		return matchID, nil
+	case <-c.closed:
+		return "", fmt.Errorf("socket closed while queued")
+	case <-time.After(c.config.QueueTimeout):
+		c.request(envelope{Rpc: &rpcMessage{ID: "stop_matchmaking", Payload: "{}"}})
+		return "", fmt.Errorf("no opponent within %s", c.config.QueueTimeout)
+	}
+}
+
+// sendMatchData sends a JSON payload to the match with the given opcode
+func (c *client) sendMatchData(matchID string, opcode int, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.send(envelope{MatchDataSend: &matchData{
+		MatchID: matchID,
+		OpCode:  strconv.Itoa(opcode),
+		Data:    base64.StdEncoding.EncodeToString(data),
+	}})
+}
+
+// tokenUserID extracts the user ID claim from a session token
+func tokenUserID(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed session token")
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed session token: %w", err)
+	}
+	var decoded struct {
+		UserID string `json:"uid"`
+	}
+	if err := json.Unmarshal(claims, &decoded); err != nil || decoded.UserID == "" {
+		return "", fmt.Errorf("session token has no user ID")
+	}
+	return decoded.UserID, nil
+}
+
+// boardFull reports whether every cell is taken
+func boardFull(board [][]string) bool {
+	for _, row := range board {
+		for _, cell := range row {
+			if cell == "" {
+				return false
+			}
+		}
+	}
+	return len(board) > 0
+}
+
+// randomEmptyCell picks a random empty cell of the board
+func randomEmptyCell(board [][]string) (int, int) {
+	var cells [][2]int
+	for i, row := range board {
+		for j, cell := range row {
+			if cell == "" {
+				cells = append(cells, [2]int{i, j})
+			}
+		}
+	}
+	cell := cells[rand.Intn(len(cells))]
+	return cell[0], cell[1]
+}
@@ -0,0 +1,169 @@
+// Command loadtest drives simulated players through authentication,
+// matchmaking, and complete games against a running Nakama server, then
+// reports latency percentiles and error counts.
+//
+// Usage:
+//
+//	go run ./cmd/loadtest -addr http://localhost:7350 -clients 200 -games 3
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config holds the harness settings
+type Config struct {
+	Addr         string
+	ServerKey    string
+	Mode         string
+	Clients      int
+	Games        int
+	Ramp         time.Duration
+	Timeout      time.Duration
+	QueueTimeout time.Duration
+	MoveTimeout  time.Duration
+	RunID        string
+}
+
+// Stats collects latencies and counters from all clients
+type Stats struct {
+	mutex     sync.Mutex
+	latencies map[string][]time.Duration
+	counters  map[string]int
+	failures  map[string]int
+	lastError map[string]error
+}
+
+// newStats returns an empty collector
+func newStats() *Stats {
+	return &Stats{
+		latencies: make(map[string][]time.Duration),
+		counters:  make(map[string]int),
+		failures:  make(map[string]int),
+		lastError: make(map[string]error),
+	}
+}
+
+// Observe records one latency sample
+func (s *Stats) Observe(name string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latencies[name] = append(s.latencies[name], d)
+}
+
+// Count increments a counter
+func (s *Stats) Count(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counters[name]++
+}
+
+// Fail records a failed step
+func (s *Stats) Fail(step string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[step]++
+	s.lastError[step] = err
+}
+
+// Report prints latency percentiles, counters, and failures
+func (s *Stats) Report(elapsed time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fmt.Printf("Run finished in %s\n\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("%-16s %8s %10s %10s %10s %10s\n", "latency", "count", "p50", "p95", "p99", "max")
+	for _, name := range sortedKeys(s.latencies) {
+		samples := s.latencies[name]
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		fmt.Printf("%-16s %8d %10s %10s %10s %10s\n", name, len(samples),
+			percentile(samples, 0.50), percentile(samples, 0.95), percentile(samples, 0.99), samples[len(samples)-1].Round(time.Millisecond))
+	}
+
+	fmt.Println()
+	for _, name := range sortedKeys(s.counters) {
+		fmt.Printf("%-20s %d\n", name, s.counters[name])
+	}
+
+	if len(s.failures) > 0 {
+		fmt.Println("\nfailures:")
+		for _, step := range sortedKeys(s.failures) {
+			fmt.Printf("  %-12s %6d  last: %v\n", step, s.failures[step], s.lastError[step])
+		}
+	}
+
+	games := s.counters["games_completed"] + s.failures["game"]
+	if games > 0 {
+		fmt.Printf("\ngame error rate: %.2f%%\n", 100*float64(s.failures["game"])/float64(games))
+	}
+}
+
+// percentile returns the p-th percentile of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(float64(len(sorted)-1) * p)
+	return sorted[index].Round(time.Millisecond)
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func main() {
+	config := Config{}
+	flag.StringVar(&config.Addr, "addr", "http://localhost:7350", "Nakama HTTP address")
+	flag.StringVar(&config.ServerKey, "server-key", "defaultkey", "Nakama server key")
+	flag.StringVar(&config.Mode, "mode", "classic", "game mode to queue for")
+	flag.IntVar(&config.Clients, "clients", 100, "number of simulated players")
+	flag.IntVar(&config.Games, "games", 1, "games each player plays")
+	flag.DurationVar(&config.Ramp, "ramp", 10*time.Second, "time over which clients are started")
+	flag.DurationVar(&config.Timeout, "timeout", 10*time.Second, "timeout for HTTP and socket requests")
+	flag.DurationVar(&config.QueueTimeout, "queue-timeout", 60*time.Second, "how long a player waits for an opponent")
+	flag.DurationVar(&config.MoveTimeout, "move-timeout", 30*time.Second, "how long a player waits for match data")
+	flag.StringVar(&config.RunID, "run-id", fmt.Sprintf("%d", time.Now().Unix()), "suffix that keeps account IDs unique per run")
+	flag.Parse()
+
+	if err := validate(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	stats := newStats()
+	var wg sync.WaitGroup
+	started := time.Now()
+
+	interval := config.Ramp / time.Duration(config.Clients)
+	for i := 0; i < config.Clients; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			newClient(config, stats, index).run()
+		}(i)
+		time.Sleep(interval)
+	}
+
+	wg.Wait()
+	stats.Report(time.Since(started))
+}
+
+// validate rejects settings the harness can't run with
+func validate(config Config) error {
+	if config.Clients < 2 || config.Clients%2 != 0 {
+		return errors.New("-clients must be an even number of at least 2 so every player gets an opponent")
+	}
+	if config.Games < 1 {
+		return errors.New("-games must be at least 1")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Largest board MAX_BOARD_SIZE may allow
+const boardSizeLimit = 15
+
+// Config represents the game settings operators can tune through the runtime env
+// (`runtime.env` in the Nakama config) without rebuilding the plugin
+type Config struct {
+	TurnSeconds     int // turn clock of matches that don't pass turn_seconds
+	MaxTurnTimeouts int // consecutive turn timeouts before a player forfeits
+	MaxBoardSize    int
+
+	// Flat scoring of limited-time modes that don't set their own, and the
+	// largest rating change per game in the others
+	Scoring    ScoringProfile
+	EloKFactor int
+
+	// A player's first rated games are placements: their rating is provisional,
+	// moves by the larger placement K-factor, and stays off the leaderboards
+	PlacementGames   int
+	PlacementKFactor int
+
+	QueueTTL           time.Duration // 0 keeps entries until paired
+	BotFallback        time.Duration // 0 disables bot matches for waiting players
+	SessionTokenExpiry time.Duration
+
+	// Leaderboards, and the weekly board's reset schedule (cron). The main
+	// board holds ratings and never resets; the season board always resets
+	// monthly, since seasons are calendar months.
+	LeaderboardID       string
+	WeeklyLeaderboardID string
+	SeasonLeaderboardID string
+	WeeklyReset         string
+
+	// Where match telemetry goes: "" (off), storage, webhook, or nakama. The
+	// webhook sink posts to TelemetryWebhookURL.
+	TelemetrySink       string
+	TelemetryWebhookURL string
+
+	// Endpoints sent signed match, leaderboard reset, and ban events, and the
+	// secret their signatures are made with
+	WebhookURLs   []string
+	WebhookSecret string
+
+	// Discord webhook notable events are announced to, and the win streak
+	// length (and its multiples) announced
+	DiscordWebhookURL string
+	DiscordStreakMin  int
+}
+
+// config holds the settings in force, the defaults until InitModule loads the env
+var config = defaultConfig()
+
+// defaultConfig returns the settings used when the env doesn't override them
+func defaultConfig() Config {
+	return Config{
+		TurnSeconds:         30,
+		MaxTurnTimeouts:     2,
+		MaxBoardSize:        7,
+		Scoring:             ScoringProfile{Win: 10, Draw: 1, Loss: -5},
+		EloKFactor:          32,
+		PlacementGames:      5,
+		PlacementKFactor:    64,
+		QueueTTL:            defaultQueueEntryTTL,
+		BotFallback:         defaultBotFallbackTimeout,
+		SessionTokenExpiry:  defaultSessionTokenExpiry,
+		LeaderboardID:       "ttt_leaderboard",
+		WeeklyLeaderboardID: "ttt_weekly_leaderboard",
+		SeasonLeaderboardID: "ttt_season",
+		WeeklyReset:         "0 0 * * 0",
+		DiscordStreakMin:    10,
+	}
+}
+
+// loadConfig reads the settings from the runtime env, keeping the default for
+// any not set. An invalid value fails module initialization.
+func loadConfig(ctx context.Context) (Config, error) {
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	cfg := defaultConfig()
+
+	ints := []struct {
+		key      string
+		target   *int
+		min, max int
+	}{
+		{"TURN_SECONDS", &cfg.TurnSeconds, 5, 3600},
+		{"MAX_TURN_TIMEOUTS", &cfg.MaxTurnTimeouts, 1, 100},
+		{"MAX_BOARD_SIZE", &cfg.MaxBoardSize, minBoardSize, boardSizeLimit},
+		{"ELO_K_FACTOR", &cfg.EloKFactor, 1, 400},
+		{"PLACEMENT_GAMES", &cfg.PlacementGames, 0, 50},
+		{"PLACEMENT_K_FACTOR", &cfg.PlacementKFactor, 1, 400},
+		{"DISCORD_STREAK_MIN", &cfg.DiscordStreakMin, 0, 1000},
+	}
+	for _, setting := range ints {
+		value, ok := env[setting.key]
+		if !ok {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < setting.min || number > setting.max {
+			return Config{}, fmt.Errorf("invalid %s %q: must be between %d and %d", setting.key, value, setting.min, setting.max)
+		}
+		*setting.target = number
+	}
+
+	scores := []struct {
+		key    string
+		target *int64
+	}{
+		{"SCORE_WIN", &cfg.Scoring.Win},
+		{"SCORE_DRAW", &cfg.Scoring.Draw},
+		{"SCORE_LOSS", &cfg.Scoring.Loss},
+	}
+	for _, setting := range scores {
+		value, ok := env[setting.key]
+		if !ok {
+			continue
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q", setting.key, value)
+		}
+		*setting.target = number
+	}
+
+	durations := []struct {
+		key      string
+		target   *time.Duration
+		positive bool // whether 0 is rejected rather than disabling the feature
+	}{
+		{"MATCHMAKING_QUEUE_TTL_SECONDS", &cfg.QueueTTL, false},
+		{"MATCHMAKING_BOT_FALLBACK_SECONDS", &cfg.BotFallback, false},
+		{"SESSION_TOKEN_EXPIRY_SECONDS", &cfg.SessionTokenExpiry, true},
+	}
+	for _, setting := range durations {
+		value, ok := env[setting.key]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 || (setting.positive && seconds == 0) {
+			return Config{}, fmt.Errorf("invalid %s %q", setting.key, value)
+		}
+		*setting.target = time.Duration(seconds) * time.Second
+	}
+
+	names := []struct {
+		key        string
+		target     *string
+		allowEmpty bool // empty reset schedules never reset; an empty telemetry sink is off
+	}{
+		{"LEADERBOARD_ID", &cfg.LeaderboardID, false},
+		{"WEEKLY_LEADERBOARD_ID", &cfg.WeeklyLeaderboardID, false},
+		{"SEASON_LEADERBOARD_ID", &cfg.SeasonLeaderboardID, false},
+		{"WEEKLY_RESET_SCHEDULE", &cfg.WeeklyReset, true},
+		{"TELEMETRY_SINK", &cfg.TelemetrySink, true},
+		{"TELEMETRY_WEBHOOK_URL", &cfg.TelemetryWebhookURL, true},
+		{"WEBHOOK_SECRET", &cfg.WebhookSecret, true},
+		{"DISCORD_WEBHOOK_URL", &cfg.DiscordWebhookURL, true},
+	}
+	for _, setting := range names {
+		value, ok := env[setting.key]
+		if !ok {
+			continue
+		}
+		if value == "" && !setting.allowEmpty {
+			return Config{}, fmt.Errorf("%s cannot be empty", setting.key)
+		}
+		*setting.target = value
+	}
+	if cfg.LeaderboardID == cfg.WeeklyLeaderboardID || cfg.LeaderboardID == cfg.SeasonLeaderboardID || cfg.WeeklyLeaderboardID == cfg.SeasonLeaderboardID {
+		return Config{}, fmt.Errorf("leaderboard IDs must be distinct")
+	}
+	if err := validateTelemetryConfig(cfg); err != nil {
+		return Config{}, err
+	}
+	webhookURLs, err := parseWebhookURLs(env["WEBHOOK_URLS"])
+	if err != nil {
+		return Config{}, err
+	}
+	if len(webhookURLs) > 0 && cfg.WebhookSecret == "" {
+		return Config{}, fmt.Errorf("WEBHOOK_SECRET is required with WEBHOOK_URLS")
+	}
+	cfg.WebhookURLs = webhookURLs
+	if cfg.DiscordWebhookURL != "" && !validWebhookURL(cfg.DiscordWebhookURL) {
+		return Config{}, fmt.Errorf("DISCORD_WEBHOOK_URL must be an http(s) URL")
+	}
+
+	return cfg, nil
+}
+
+// applyConfig puts loaded settings in force
+func applyConfig(cfg Config) {
+	setStandardScoring(cfg.Scoring)
+	config = cfg
+}
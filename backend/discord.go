@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Announcement bookkeeping (system-owned): the player last announced as #1,
+	// and one key per announced tournament period so every node posts it once
+	discordCollection = "discord"
+	discordLeaderKey  = "leader"
+
+	// Embed colours
+	discordColorLeader     = 0xF1C40F
+	discordColorTournament = 0x9B59B6
+	discordColorStreak     = 0xE67E22
+	discordColorOperator   = 0x3498DB
+
+	// Places listed when a tournament period ends
+	discordPodiumSize = 3
+)
+
+// DiscordMessage represents the body of a Discord webhook execution
+type DiscordMessage struct {
+	Embeds          []DiscordEmbed         `json:"embeds"`
+	AllowedMentions DiscordAllowedMentions `json:"allowed_mentions"`
+}
+
+// DiscordEmbed represents one rich embed of a Discord message
+type DiscordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp,omitempty"` // RFC 3339
+}
+
+// DiscordAllowedMentions represents which mentions in a message may ping. An
+// empty list keeps names like "@everyone" from pinging anyone.
+type DiscordAllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// discordLeader represents the stored player last announced as #1
+type discordLeader struct {
+	UserID string `json:"user_id"`
+	Rating int64  `json:"rating"`
+	Since  int64  `json:"since"`
+}
+
+// InitDiscord reports whether notable events are announced to Discord
+func InitDiscord(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if config.DiscordWebhookURL == "" {
+		logger.Info("Discord announcements disabled")
+		return nil
+	}
+
+	logger.Info("Discord announcements initialized")
+	return nil
+}
+
+// postDiscord sends an embed to the Discord webhook in the background, with the
+// retries and backoff of every webhook delivery
+func postDiscord(logger runtime.Logger, nk runtime.NakamaModule, kind string, embed DiscordEmbed) {
+	if config.DiscordWebhookURL == "" {
+		return
+	}
+	embed.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	body, err := json.Marshal(DiscordMessage{
+		Embeds:          []DiscordEmbed{embed},
+		AllowedMentions: DiscordAllowedMentions{Parse: []string{}},
+	})
+	if err != nil {
+		logger.Error("Failed to marshal Discord %s announcement: %v", kind, err)
+		return
+	}
+	startWebhookDelivery(logger, nk, config.DiscordWebhookURL, "discord."+kind, body, func(int64) map[string]string { return nil })
+}
+
+// discordName returns how a player is named in announcements: their username
+// with Discord markdown escaped, or AnonymousName in streamer mode
+func discordName(ctx context.Context, nk runtime.NakamaModule, userID, username string) string {
+	if settings, err := GetUserSettings(ctx, nk, userID); err == nil && settings.StreamerMode {
+		return AnonymousName
+	}
+	if username == "" {
+		if users, err := nk.UsersGetId(ctx, []string{userID}, nil); err == nil && len(users) > 0 {
+			username = users[0].Username
+		}
+	}
+	return discordMarkdown.Replace(username)
+}
+
+// discordMarkdown escapes the characters Discord formats text with
+var discordMarkdown = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`)
+
+// announceNewLeader announces a player who just took #1 on the main
+// leaderboard. The stored leader is swapped at the version read, so of several
+// nodes seeing the same change only one announces it.
+func announceNewLeader(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, username string, rating int64) {
+	if config.DiscordWebhookURL == "" {
+		return
+	}
+	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, config.LeaderboardID, nil, 1, "", 0)
+	if err != nil {
+		logger.Warn("Failed to read the top of the leaderboard for Discord: %v", err)
+		return
+	}
+	if len(records) == 0 || records[0].OwnerId != userID {
+		return
+	}
+
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: discordCollection, Key: discordLeaderKey},
+	})
+	if err != nil {
+		logger.Warn("Failed to read the announced leader: %v", err)
+		return
+	}
+	version := "*"
+	if len(objects) > 0 {
+		var leader discordLeader
+		if err := json.Unmarshal([]byte(objects[0].Value), &leader); err == nil && leader.UserID == userID {
+			return
+		}
+		version = objects[0].Version
+	}
+
+	value, _ := json.Marshal(discordLeader{UserID: userID, Rating: rating, Since: time.Now().Unix()})
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      discordCollection,
+			Key:             discordLeaderKey,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Debug("Leader announcement already claimed: %v", err)
+		return
+	}
+
+	postDiscord(logger, nk, "new_leader", DiscordEmbed{
+		Title:       "👑 New #1",
+		Description: fmt.Sprintf("**%s** took the top spot on the leaderboard with a rating of %d", discordName(ctx, nk, userID, username), rating),
+		Color:       discordColorLeader,
+	})
+}
+
+// announceTournamentWinner announces the podium of a tournament period that
+// just ended, once across all nodes
+func announceTournamentWinner(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, tournament *api.Tournament, end int64) {
+	if config.DiscordWebhookURL == "" {
+		return
+	}
+	records, _, _, _, err := nk.TournamentRecordsList(ctx, tournament.GetId(), nil, discordPodiumSize, "", end)
+	if err != nil {
+		logger.Warn("Failed to read final standings of tournament %s for Discord: %v", tournament.GetId(), err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	// Version "*" only succeeds for the first node to announce this period
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      discordCollection,
+			Key:             fmt.Sprintf("tournament:%s:%d", tournament.GetId(), end),
+			Value:           fmt.Sprintf(`{"winner":%q}`, records[0].OwnerId),
+			Version:         "*",
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Debug("Tournament %s announcement already claimed: %v", tournament.GetId(), err)
+		return
+	}
+
+	medals := []string{"🥇", "🥈", "🥉"}
+	lines := make([]string, 0, len(records))
+	for i, record := range records {
+		name := discordName(ctx, nk, record.OwnerId, record.Username.GetValue())
+		lines = append(lines, fmt.Sprintf("%s **%s** - %d points", medals[i], name, record.Score))
+	}
+	postDiscord(logger, nk, "tournament_winner", DiscordEmbed{
+		Title:       fmt.Sprintf("🏆 %s winner", tournament.GetTitle()),
+		Description: strings.Join(lines, "\n"),
+		Color:       discordColorTournament,
+	})
+}
+
+// announceWinStreak announces a ranked win streak reaching a multiple of
+// DISCORD_STREAK_MIN. Stats writes are versioned, so each streak length is
+// reached, and announced, once.
+func announceWinStreak(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, username string, streak int) {
+	if config.DiscordWebhookURL == "" || config.DiscordStreakMin <= 0 || streak < config.DiscordStreakMin || streak%config.DiscordStreakMin != 0 {
+		return
+	}
+	postDiscord(logger, nk, "win_streak", DiscordEmbed{
+		Title:       fmt.Sprintf("🔥 %d wins in a row", streak),
+		Description: fmt.Sprintf("**%s** has won %d ranked games in a row", discordName(ctx, nk, userID, username), streak),
+		Color:       discordColorStreak,
+	})
+}
+
+// announceOperatorMessage forwards an operator announcement to Discord
+func announceOperatorMessage(logger runtime.Logger, nk runtime.NakamaModule, title, message string) {
+	postDiscord(logger, nk, "announcement", DiscordEmbed{
+		Title:       title,
+		Description: message,
+		Color:       discordColorOperator,
+	})
+}
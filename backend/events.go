@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Live-ops configuration storage (system-owned)
+	liveOpsCollection = "liveops_config"
+	liveOpsEventsKey  = "events"
+
+	// How long the active event set is cached between storage reads
+	eventsCacheTTL = 30 * time.Second
+)
+
+// LiveEvent represents an operator-defined, time-windowed event
+type LiveEvent struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description,omitempty"`
+	StartAt         int64    `json:"start_at"`
+	EndAt           int64    `json:"end_at"`
+	ScoreMultiplier float64  `json:"score_multiplier,omitempty"` // applied to positive score deltas
+	DefaultMode     string   `json:"default_mode,omitempty"`     // mode used when a request doesn't pick one
+	Modes           []string `json:"modes,omitempty"`            // if set, only these modes can be queued
+	Badge           string   `json:"badge,omitempty"`            // awarded for a ranked win while the event runs
+}
+
+// Cached event configuration
+var (
+	eventsCache       []LiveEvent
+	eventsCacheLoaded time.Time
+	eventsMutex       sync.Mutex
+)
+
+// InitEvents initializes the live-ops events system
+func InitEvents(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_active_events", getActiveEventsRPC); err != nil {
+		return fmt.Errorf("failed to register get_active_events RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("set_events", setEventsRPC); err != nil {
+		return fmt.Errorf("failed to register set_events RPC: %w", err)
+	}
+
+	logger.Info("Live-ops events system initialized")
+	return nil
+}
+
+// getActiveEventsRPC returns the events running right now
+func getActiveEventsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	events, err := ActiveEvents(ctx, nk)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to load events: %v", err)
+	}
+
+	return rpcOK(map[string]interface{}{
+		"events": events,
+	})
+}
+
+// setEventsRPC replaces the configured event schedule (admin only)
+func setEventsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request struct {
+		Events []LiveEvent `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	for _, event := range request.Events {
+		if event.ID == "" || event.EndAt <= event.StartAt {
+			return "", rpcErrorf(CodeInvalidArgument, "event %q needs an id and an end after its start", event.ID)
+		}
+		if event.ScoreMultiplier < 0 {
+			return "", rpcErrorf(CodeInvalidArgument, "event %q has a negative score multiplier", event.ID)
+		}
+	}
+
+	value, err := json.Marshal(request.Events)
+	if err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to marshal events: %v", err)
+	}
+
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      liveOpsCollection,
+			Key:             liveOpsEventsKey,
+			Value:           string(value),
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to store events: %v", err)
+	}
+
+	// Drop the cache so the new schedule applies immediately on this node
+	eventsMutex.Lock()
+	eventsCacheLoaded = time.Time{}
+	eventsMutex.Unlock()
+
+	logger.Info("Updated live-ops schedule with %d events", len(request.Events))
+	return rpcOK(map[string]interface{}{
+		"events": request.Events,
+	})
+}
+
+// ActiveEvents returns the configured events whose window contains the current time
+func ActiveEvents(ctx context.Context, nk runtime.NakamaModule) ([]LiveEvent, error) {
+	events, err := loadEvents(ctx, nk)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	active := make([]LiveEvent, 0, len(events))
+	for _, event := range events {
+		if event.StartAt <= now && now < event.EndAt {
+			active = append(active, event)
+		}
+	}
+	return active, nil
+}
+
+// loadEvents reads the event schedule, using a short-lived cache
+func loadEvents(ctx context.Context, nk runtime.NakamaModule) ([]LiveEvent, error) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	if time.Since(eventsCacheLoaded) < eventsCacheTTL {
+		return eventsCache, nil
+	}
+
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: liveOpsCollection, Key: liveOpsEventsKey},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	events := []LiveEvent{}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), &events); err != nil {
+			return nil, fmt.Errorf("failed to decode events: %w", err)
+		}
+	}
+
+	eventsCache = events
+	eventsCacheLoaded = time.Now()
+	return events, nil
+}
+
+// eventScoreMultiplier returns the combined score multiplier of all active events
+func eventScoreMultiplier(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) float64 {
+	events, err := ActiveEvents(ctx, nk)
+	if err != nil {
+		logger.Warn("Failed to load active events for scoring: %v", err)
+		return 1
+	}
+
+	multiplier := 1.0
+	for _, event := range events {
+		if event.ScoreMultiplier > 0 {
+			multiplier *= event.ScoreMultiplier
+		}
+	}
+	return multiplier
+}
+
+// eventModeRules returns the default mode and allowed modes imposed by active events
+func eventModeRules(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) (string, map[string]bool) {
+	events, err := ActiveEvents(ctx, nk)
+	if err != nil {
+		logger.Warn("Failed to load active events for matchmaking: %v", err)
+		return "", nil
+	}
+
+	defaultMode := ""
+	var allowed map[string]bool
+	for _, event := range events {
+		if event.DefaultMode != "" && defaultMode == "" {
+			defaultMode = event.DefaultMode
+		}
+		if len(event.Modes) > 0 {
+			if allowed == nil {
+				allowed = make(map[string]bool)
+			}
+			for _, mode := range event.Modes {
+				allowed[mode] = true
+			}
+		}
+	}
+	return defaultMode, allowed
+}
+
+// awardEventBadges gives a player the badge of each running event that has one.
+// Event badges can only be earned inside their event's window, once per event.
+func awardEventBadges(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) {
+	events, err := ActiveEvents(ctx, nk)
+	if err != nil {
+		logger.Warn("Failed to load active events for badges: %v", err)
+		return
+	}
+
+	for _, event := range events {
+		if event.Badge == "" {
+			continue
+		}
+		badge := Badge{ID: event.Badge, EventID: event.ID, EarnedAt: time.Now().Unix()}
+		if err := awardBadge(ctx, nk, userID, badge); err != nil {
+			logger.Warn("Failed to award event badge %s to %s: %v", event.Badge, userID, err)
+		}
+	}
+}
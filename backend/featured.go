@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Featured match storage (system-owned)
+	featuredCollection = "featured"
+	featuredKey        = "match_of_the_day"
+
+	// How often the daily job checks for a day rollover
+	featuredCheckInterval = 10 * time.Minute
+)
+
+// FeaturedMatch represents the pinned match of the day
+type FeaturedMatch struct {
+	MatchID  string            `json:"match_id"`
+	Mode     string            `json:"mode"`
+	Players  map[string]string `json:"players"` // userID -> symbol
+	Rating   int64             `json:"rating"`  // the players' combined rating
+	Winner   string            `json:"winner,omitempty"`
+	Moves    int               `json:"moves"`
+	Duration int64             `json:"duration"`
+	EndedAt  int64             `json:"ended_at"`
+	Day      string            `json:"day"`
+	PinnedAt int64             `json:"pinned_at"`
+}
+
+// Best finished match seen on this node, per UTC day
+var (
+	featuredCandidate *FeaturedMatch
+	featuredMutex     sync.Mutex
+)
+
+// InitFeatured initializes the featured match of the day
+func InitFeatured(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_featured_match", getFeaturedMatchRPC); err != nil {
+		return fmt.Errorf("failed to register get_featured_match RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("pin_featured_match", pinFeaturedMatchRPC); err != nil {
+		return fmt.Errorf("failed to register pin_featured_match RPC: %w", err)
+	}
+
+	// Daily job: pin the best candidate once its day is over
+	go runFeaturedJob(context.Background(), logger, nk)
+
+	logger.Info("Featured match system initialized")
+	return nil
+}
+
+// getFeaturedMatchRPC returns the currently pinned match of the day
+func getFeaturedMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	featured, err := readFeaturedMatch(ctx, nk)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if featured == nil {
+		return "", rpcError(CodeNotFound, "no featured match yet")
+	}
+	return rpcOK(featured)
+}
+
+// pinFeaturedMatchRPC pins today's best candidate immediately (admin only)
+func pinFeaturedMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	featuredMutex.Lock()
+	candidate := featuredCandidate
+	featuredMutex.Unlock()
+
+	if candidate == nil {
+		return "", rpcError(CodeNotFound, "no finished match to feature yet")
+	}
+
+	if err := pinFeaturedMatch(ctx, logger, nk, candidate); err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	return rpcOK(candidate)
+}
+
+// featuredEligible reports whether a finished match may be advertised to
+// everyone: a ranked or lobby game between two people on its mode's own board.
+// Invite-only, challenge, admin test, and custom board games stay out.
+func featuredEligible(match *TTTMatch) bool {
+	if len(match.Bots) > 0 || len(match.Players) != 2 || match.PrivateCode != "" || match.AllowSelfPlay {
+		return false
+	}
+	gameMode, ok := lookupGameMode(match.Mode)
+	if !ok || isCustomVariant(gameMode, match.Size, match.WinLength) {
+		return false
+	}
+	return match.Ranked || match.Public
+}
+
+// considerFeaturedMatch offers a finished match as today's featured candidate,
+// given its players' ratings
+func considerFeaturedMatch(match *TTTMatch, ratings map[string]int64) {
+	now := time.Now().UTC()
+	candidate := &FeaturedMatch{
+		MatchID:  match.ID,
+		Mode:     match.Mode,
+		Players:  make(map[string]string, len(match.Players)),
+		Winner:   match.Winner,
+		Moves:    match.MoveCount,
+		Duration: now.Unix() - match.CreatedAt,
+		EndedAt:  now.Unix(),
+		Day:      now.Format("2006-01-02"),
+	}
+	for userID, symbol := range match.Players {
+		candidate.Players[userID] = symbol
+		candidate.Rating += ratings[userID]
+	}
+
+	featuredMutex.Lock()
+	defer featuredMutex.Unlock()
+
+	if featuredCandidate == nil || featuredCandidate.Day != candidate.Day || betterFeatured(candidate, featuredCandidate) {
+		featuredCandidate = candidate
+	}
+}
+
+// betterFeatured reports whether a is a more notable match than b. Games
+// between the strongest players come first, then longer games, which are more
+// interesting to watch back.
+func betterFeatured(a, b *FeaturedMatch) bool {
+	if a.Rating != b.Rating {
+		return a.Rating > b.Rating
+	}
+	if a.Moves != b.Moves {
+		return a.Moves > b.Moves
+	}
+	return a.Duration > b.Duration
+}
+
+// runFeaturedJob pins the previous day's candidate after each UTC day rollover
+func runFeaturedJob(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
+	ticker := time.NewTicker(featuredCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		today := time.Now().UTC().Format("2006-01-02")
+
+		featuredMutex.Lock()
+		candidate := featuredCandidate
+		if candidate != nil && candidate.Day != today {
+			featuredCandidate = nil
+		}
+		featuredMutex.Unlock()
+
+		if candidate == nil || candidate.Day == today {
+			continue
+		}
+		if err := pinFeaturedMatch(ctx, logger, nk, candidate); err != nil {
+			logger.Error("Failed to pin featured match: %v", err)
+		}
+	}
+}
+
+// pinFeaturedMatch stores a candidate as the match of the day unless another node
+// already pinned a more notable match for the same day
+func pinFeaturedMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, candidate *FeaturedMatch) error {
+	current, err := readFeaturedMatch(ctx, nk)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Day == candidate.Day && current.MatchID != candidate.MatchID && !betterFeatured(candidate, current) {
+		return nil
+	}
+
+	pinned := *candidate
+	pinned.PinnedAt = time.Now().Unix()
+	value, err := json.Marshal(pinned)
+	if err != nil {
+		return fmt.Errorf("failed to marshal featured match: %w", err)
+	}
+
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      featuredCollection,
+			Key:             featuredKey,
+			Value:           string(value),
+			PermissionRead:  2,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to store featured match: %w", err)
+	}
+
+	logger.Info("Pinned featured match %s for %s (%d moves)", pinned.MatchID, pinned.Day, pinned.Moves)
+	return nil
+}
+
+// readFeaturedMatch returns the pinned match of the day, or nil if none is pinned
+func readFeaturedMatch(ctx context.Context, nk runtime.NakamaModule) (*FeaturedMatch, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: featuredCollection, Key: featuredKey},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read featured match: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var featured FeaturedMatch
+	if err := json.Unmarshal([]byte(objects[0].Value), &featured); err != nil {
+		return nil, fmt.Errorf("failed to decode featured match: %w", err)
+	}
+	return &featured, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// featuredCandidateMatch returns a finished ranked classic match between two people
+func featuredCandidateMatch() *TTTMatch {
+	return &TTTMatch{
+		ID:        "featured",
+		Mode:      GameModeClassic,
+		Ranked:    true,
+		Size:      3,
+		WinLength: 3,
+		Players:   map[string]string{"player-one": PlayerX, "player-two": PlayerO},
+	}
+}
+
+func TestFeaturedEligible(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*TTTMatch)
+		want   bool
+	}{
+		{"ranked", func(*TTTMatch) {}, true},
+		{"public lobby", func(m *TTTMatch) { m.Ranked, m.Public = false, true }, true},
+		{"casual challenge", func(m *TTTMatch) { m.Ranked = false }, false},
+		{"private", func(m *TTTMatch) { m.Ranked, m.PrivateCode = false, "K7QX2M" }, false},
+		{"custom board", func(m *TTTMatch) { m.Public, m.Size, m.WinLength = true, 6, 4 }, false},
+		{"bot", func(m *TTTMatch) { m.Bots = map[string]bool{"player-two": true} }, false},
+		{"admin self-play", func(m *TTTMatch) { m.AllowSelfPlay = true }, false},
+	}
+	for _, tt := range tests {
+		match := featuredCandidateMatch()
+		tt.change(match)
+		if got := featuredEligible(match); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBetterFeaturedPrefersTheStrongestPlayers(t *testing.T) {
+	strong := &FeaturedMatch{Rating: 3400, Moves: 5}
+	long := &FeaturedMatch{Rating: 2400, Moves: 9}
+	if !betterFeatured(strong, long) || betterFeatured(long, strong) {
+		t.Error("a longer game between weaker players outranked the strongest pairing")
+	}
+	longer := &FeaturedMatch{Rating: 3400, Moves: 7}
+	if !betterFeatured(longer, strong) {
+		t.Error("equal ratings were not decided by game length")
+	}
+}
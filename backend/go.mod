@@ -2,6 +2,7 @@ module tictac.com/tic
 
 go 1.23.5
 
-require github.com/heroiclabs/nakama-common v1.36.0
-
-require google.golang.org/protobuf v1.36.4 // indirect
+require (
+	github.com/heroiclabs/nakama-common v1.36.0
+	google.golang.org/protobuf v1.36.4
+)
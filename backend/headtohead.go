@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-opponent records, owned by the player and keyed by the opponent's user ID
+	headToHeadCollection = "head_to_head"
+
+	// Attempts at a versioned head-to-head write before giving up
+	headToHeadWriteAttempts = 3
+)
+
+// HeadToHead represents a player's record against one opponent, ranked and casual games alike
+type HeadToHead struct {
+	OpponentID string `json:"opponent_id"`
+	Wins       int    `json:"wins"`
+	Losses     int    `json:"losses"`
+	Draws      int    `json:"draws"`
+	LastPlayed int64  `json:"last_played,omitempty"`
+}
+
+// HeadToHeadRequest represents get_head_to_head request
+type HeadToHeadRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// InitHeadToHead registers the head-to-head RPC
+func InitHeadToHead(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_head_to_head", getHeadToHeadRPC); err != nil {
+		return fmt.Errorf("failed to register get_head_to_head RPC: %w", err)
+	}
+
+	logger.Info("Head-to-head initialized")
+	return nil
+}
+
+// getHeadToHeadRPC returns the caller's record against another player
+func getHeadToHeadRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request HeadToHeadRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id is required")
+	}
+	if request.UserID == userID {
+		return "", rpcError(CodeInvalidArgument, "user_id must be another player")
+	}
+
+	users, err := nk.UsersGetId(ctx, []string{request.UserID}, nil)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to look up user: %v", err)
+	}
+	if len(users) == 0 {
+		return "", rpcErrorf(CodeNotFound, "user %s not found", request.UserID)
+	}
+
+	records, _, err := loadHeadToHead(ctx, nk, map[string]string{userID: request.UserID})
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	record := records[userID]
+
+	return rpcOK(map[string]interface{}{
+		"opponent_id":       record.OpponentID,
+		"opponent_username": users[0].Username,
+		"wins":              record.Wins,
+		"losses":            record.Losses,
+		"draws":             record.Draws,
+		"games":             record.Wins + record.Losses + record.Draws,
+		"last_played":       record.LastPlayed,
+	})
+}
+
+// recordHeadToHead adds a finished game to both players' records against each
+// other. Games against bots aren't rivalries and are skipped.
+func recordHeadToHead(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	opponents := make(map[string]string, len(match.Players))
+	for userID := range match.Players {
+		if isBotAccount(userID) {
+			return
+		}
+		for otherID := range match.Players {
+			if otherID != userID {
+				opponents[userID] = otherID
+			}
+		}
+	}
+	if len(opponents) != 2 {
+		return
+	}
+	now := time.Now().Unix()
+
+	for attempt := 0; ; attempt++ {
+		records, versions, err := loadHeadToHead(ctx, nk, opponents)
+		if err != nil {
+			logger.Warn("Failed to read head-to-head records for match %s: %v", match.ID, err)
+			return
+		}
+
+		writes := make([]*runtime.StorageWrite, 0, len(records))
+		for userID, record := range records {
+			switch resultFor(match, match.Players[userID]) {
+			case ResultWin:
+				record.Wins++
+			case ResultLoss:
+				record.Losses++
+			default:
+				record.Draws++
+			}
+			record.LastPlayed = now
+
+			value, _ := json.Marshal(record)
+			writes = append(writes, &runtime.StorageWrite{
+				Collection:      headToHeadCollection,
+				Key:             record.OpponentID,
+				UserID:          userID,
+				Value:           string(value),
+				Version:         versions[userID],
+				PermissionRead:  2,
+				PermissionWrite: 0,
+			})
+		}
+
+		// Both records are written together, so a conflict on either retries both
+		_, err = nk.StorageWrite(ctx, writes)
+		if err == nil {
+			return
+		}
+		if attempt+1 >= headToHeadWriteAttempts {
+			logger.Warn("Failed to write head-to-head records for match %s: %v", match.ID, err)
+			return
+		}
+	}
+}
+
+// loadHeadToHead reads each user's record against their opponent in one storage
+// call. Missing records come back empty with version "*".
+func loadHeadToHead(ctx context.Context, nk runtime.NakamaModule, opponents map[string]string) (map[string]*HeadToHead, map[string]string, error) {
+	records := make(map[string]*HeadToHead, len(opponents))
+	versions := make(map[string]string, len(opponents))
+	reads := make([]*runtime.StorageRead, 0, len(opponents))
+	for userID, opponentID := range opponents {
+		records[userID] = &HeadToHead{OpponentID: opponentID}
+		versions[userID] = "*"
+		reads = append(reads, &runtime.StorageRead{Collection: headToHeadCollection, Key: opponentID, UserID: userID})
+	}
+
+	objects, err := storageRead(ctx, nk, reads)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read head-to-head records: %w", err)
+	}
+	for _, object := range objects {
+		var record HeadToHead
+		if err := json.Unmarshal([]byte(object.Value), &record); err != nil {
+			continue
+		}
+		record.OpponentID = object.Key
+		records[object.UserId] = &record
+		versions[object.UserId] = object.Version
+	}
+	return records, versions, nil
+}
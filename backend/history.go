@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Match history storage
+	matchHistoryCollection = "match_history"
+	maxHistoryScan         = 1000
+	historyPageSize        = 100
+
+	// Match results from a player's perspective
+	ResultWin  = "win"
+	ResultLoss = "loss"
+	ResultDraw = "draw"
+)
+
+// MatchHistoryRecord represents a finished match from one player's perspective
+type MatchHistoryRecord struct {
+	MatchID    string `json:"match_id"`
+	Mode       string `json:"mode"`
+	Ranked     bool   `json:"ranked"`
+	Symbol     string `json:"symbol"`
+	OpponentID string `json:"opponent_id"`
+	Result     string `json:"result"`
+	ScoreDelta int64  `json:"score_delta"`
+	Moves      int    `json:"moves"`
+	Duration   int64  `json:"duration"`
+	EndedAt    int64  `json:"ended_at"`
+}
+
+// StatsQuery represents a query_stats request document
+type StatsQuery struct {
+	UserID       string             `json:"user_id,omitempty"` // another player; server-to-server only
+	Fields       []string           `json:"fields,omitempty"`
+	Filter       StatsQueryFilter   `json:"filter"`
+	Aggregations []StatsAggregation `json:"aggregations,omitempty"`
+	Limit        int                `json:"limit,omitempty"`
+}
+
+// StatsQueryFilter restricts which history records a query considers
+type StatsQueryFilter struct {
+	Mode       string `json:"mode,omitempty"`
+	Ranked     *bool  `json:"ranked,omitempty"`
+	Result     string `json:"result,omitempty"`
+	OpponentID string `json:"opponent_id,omitempty"`
+	From       int64  `json:"from,omitempty"`
+	To         int64  `json:"to,omitempty"`
+}
+
+// StatsAggregation represents an aggregation over a numeric history field
+type StatsAggregation struct {
+	Field string `json:"field"`
+	Op    string `json:"op"` // sum, avg, min, max, count
+}
+
+// StatsQueryResponse represents query_stats response
+type StatsQueryResponse struct {
+	Rows         []map[string]interface{} `json:"rows,omitempty"`
+	Aggregations map[string]float64       `json:"aggregations,omitempty"`
+	Matched      int                      `json:"matched"`
+	Truncated    bool                     `json:"truncated,omitempty"` // only the first maxHistoryScan records were considered
+}
+
+// InitHistory initializes match history queries
+func InitHistory(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("query_stats", queryStatsRPC); err != nil {
+		return fmt.Errorf("failed to register query_stats RPC: %w", err)
+	}
+
+	logger.Info("Match history system initialized")
+	return nil
+}
+
+// recordMatchHistory stores a history record for every player in a finished match
+func recordMatchHistory(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch, deltas map[string]int64) {
+	endedAt := time.Now().Unix()
+	writes := make([]*runtime.StorageWrite, 0, len(match.Players))
+
+	for userID, symbol := range match.Players {
+		record := MatchHistoryRecord{
+			MatchID:    match.ID,
+			Mode:       match.Mode,
+			Ranked:     match.Ranked,
+			Symbol:     symbol,
+			Result:     resultFor(match, symbol),
+			ScoreDelta: deltas[userID],
+			Moves:      match.MoveCount,
+			Duration:   endedAt - match.CreatedAt,
+			EndedAt:    endedAt,
+		}
+		for otherID := range match.Players {
+			if otherID != userID {
+				record.OpponentID = otherID
+			}
+		}
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			logger.Error("Failed to marshal match history for user %s: %v", userID, err)
+			continue
+		}
+
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      matchHistoryCollection,
+			Key:             resultKey(match),
+			UserID:          userID,
+			Value:           string(value),
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		})
+	}
+
+	if len(writes) == 0 {
+		return
+	}
+
+	if _, err := storageWrite(ctx, nk, writes); err != nil {
+		logger.Error("Failed to write match history for match %s: %v", match.ID, err)
+	}
+}
+
+// resultFor returns the result of a finished match for the given symbol
+func resultFor(match *TTTMatch, symbol string) string {
+	switch match.Winner {
+	case "":
+		return ResultDraw
+	case symbol:
+		return ResultWin
+	default:
+		return ResultLoss
+	}
+}
+
+// queryStatsRPC evaluates a stats query over the caller's match history, or
+// over any player's when called server-to-server
+func queryStatsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var query StatsQuery
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &query); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+
+	// History is stored owner-only, so only the server may query another player's
+	callerID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if query.UserID != "" && query.UserID != callerID {
+		if err := requireAdmin(ctx); err != nil {
+			return "", err
+		}
+	}
+	if query.UserID == "" {
+		if callerID == "" {
+			return "", rpcError(CodeInvalidArgument, "user_id is required")
+		}
+		query.UserID = callerID
+	}
+	if query.Limit <= 0 || query.Limit > historyPageSize {
+		query.Limit = historyPageSize
+	}
+	// Bad queries fail the same way whether or not any records match
+	if err := query.validate(); err != nil {
+		return "", rpcError(CodeInvalidArgument, err.Error())
+	}
+
+	// Records are listed by match ID, not by date, so a truncated scan holds
+	// an arbitrary subset of the player's matches
+	records, truncated, err := listMatchHistory(ctx, nk, query.UserID, maxHistoryScan)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+
+	matched := make([]MatchHistoryRecord, 0, len(records))
+	for _, record := range records {
+		if query.Filter.matches(record) {
+			matched = append(matched, record)
+		}
+	}
+
+	// Newest matches first
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].EndedAt > matched[j].EndedAt
+	})
+
+	response := StatsQueryResponse{
+		Matched:   len(matched),
+		Truncated: truncated,
+	}
+
+	if len(query.Aggregations) > 0 {
+		response.Aggregations = make(map[string]float64, len(query.Aggregations))
+		for _, agg := range query.Aggregations {
+			value, err := aggregateHistory(matched, agg)
+			if err != nil {
+				return "", rpcError(CodeInvalidArgument, err.Error())
+			}
+			response.Aggregations[agg.Op+"_"+agg.Field] = value
+		}
+	}
+
+	if len(query.Fields) > 0 {
+		rows := matched
+		if len(rows) > query.Limit {
+			rows = rows[:query.Limit]
+		}
+		response.Rows = make([]map[string]interface{}, len(rows))
+		for i, record := range rows {
+			row, err := projectHistory(record, query.Fields)
+			if err != nil {
+				return "", rpcError(CodeInvalidArgument, err.Error())
+			}
+			response.Rows[i] = row
+		}
+	}
+
+	return rpcOK(response)
+}
+
+// listMatchHistory reads a user's history records in storage key order,
+// stopping once it has read limit records (0 reads them all). It reports
+// whether records were left unread.
+func listMatchHistory(ctx context.Context, nk runtime.NakamaModule, userID string, limit int) ([]MatchHistoryRecord, bool, error) {
+	records := make([]MatchHistoryRecord, 0)
+	cursor := ""
+
+	for {
+		if limit > 0 && len(records) >= limit {
+			return records, true, nil
+		}
+		objects, nextCursor, err := nk.StorageList(ctx, "", userID, matchHistoryCollection, historyPageSize, cursor)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list match history: %w", err)
+		}
+
+		for _, object := range objects {
+			var record MatchHistoryRecord
+			if err := json.Unmarshal([]byte(object.Value), &record); err != nil {
+				continue
+			}
+			records = append(records, record)
+		}
+
+		if nextCursor == "" {
+			return records, false, nil
+		}
+		cursor = nextCursor
+	}
+}
+
+// validate checks a query's fields and aggregations
+func (q StatsQuery) validate() error {
+	if _, err := projectHistory(MatchHistoryRecord{}, q.Fields); err != nil {
+		return err
+	}
+	for _, agg := range q.Aggregations {
+		if _, err := aggregateHistory([]MatchHistoryRecord{{}}, agg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches reports whether a history record satisfies the filter
+func (f StatsQueryFilter) matches(record MatchHistoryRecord) bool {
+	if f.Mode != "" && record.Mode != f.Mode {
+		return false
+	}
+	if f.Ranked != nil && record.Ranked != *f.Ranked {
+		return false
+	}
+	if f.Result != "" && record.Result != f.Result {
+		return false
+	}
+	if f.OpponentID != "" && record.OpponentID != f.OpponentID {
+		return false
+	}
+	if f.From > 0 && record.EndedAt < f.From {
+		return false
+	}
+	if f.To > 0 && record.EndedAt > f.To {
+		return false
+	}
+	return true
+}
+
+// historyNumber returns a numeric history field by name
+func historyNumber(record MatchHistoryRecord, field string) (float64, error) {
+	switch field {
+	case "score_delta":
+		return float64(record.ScoreDelta), nil
+	case "moves":
+		return float64(record.Moves), nil
+	case "duration":
+		return float64(record.Duration), nil
+	case "ended_at":
+		return float64(record.EndedAt), nil
+	case "win":
+		if record.Result == ResultWin {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("field %q cannot be aggregated", field)
+}
+
+// aggregateHistory applies one aggregation over the matched records
+func aggregateHistory(records []MatchHistoryRecord, agg StatsAggregation) (float64, error) {
+	if agg.Op == "count" {
+		return float64(len(records)), nil
+	}
+
+	values := make([]float64, 0, len(records))
+	for _, record := range records {
+		value, err := historyNumber(record, agg.Field)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	result := values[0]
+	switch agg.Op {
+	case "sum", "avg":
+		result = 0
+		for _, value := range values {
+			result += value
+		}
+		if agg.Op == "avg" {
+			result /= float64(len(values))
+		}
+	case "min":
+		for _, value := range values {
+			if value < result {
+				result = value
+			}
+		}
+	case "max":
+		for _, value := range values {
+			if value > result {
+				result = value
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unsupported aggregation %q", agg.Op)
+	}
+
+	return result, nil
+}
+
+// projectHistory returns only the requested fields of a history record
+func projectHistory(record MatchHistoryRecord, fields []string) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "match_id":
+			row[field] = record.MatchID
+		case "mode":
+			row[field] = record.Mode
+		case "ranked":
+			row[field] = record.Ranked
+		case "symbol":
+			row[field] = record.Symbol
+		case "opponent_id":
+			row[field] = record.OpponentID
+		case "result":
+			row[field] = record.Result
+		case "score_delta":
+			row[field] = record.ScoreDelta
+		case "moves":
+			row[field] = record.Moves
+		case "duration":
+			row[field] = record.Duration
+		case "ended_at":
+			row[field] = record.EndedAt
+		default:
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return row, nil
+}
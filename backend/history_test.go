@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// writeHistory stores count history records for a player
+func writeHistory(t *testing.T, nk *memoryNakama, userID string, count int) {
+	t.Helper()
+	writes := make([]*runtime.StorageWrite, 0, count)
+	for i := 0; i < count; i++ {
+		value, _ := json.Marshal(MatchHistoryRecord{MatchID: fmt.Sprintf("match-%04d", i), Result: ResultWin, EndedAt: int64(i + 1)})
+		writes = append(writes, &runtime.StorageWrite{Collection: matchHistoryCollection, Key: fmt.Sprintf("match-%04d", i), UserID: userID, Value: string(value)})
+	}
+	if _, err := nk.StorageWrite(context.Background(), writes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryStatsReportsTruncatedScans(t *testing.T) {
+	nk := newMemoryNakama()
+	writeHistory(t, nk, "user-1", maxHistoryScan+1)
+
+	response, err := queryStatsRPC(sessionContext("user-1", "ada"), discardLogger{}, nil, nk, `{"aggregations": [{"op": "count"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope struct {
+		Data StatsQueryResponse `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(response), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if !envelope.Data.Truncated || envelope.Data.Matched != maxHistoryScan {
+		t.Errorf("got %d matched, truncated %v; want %d, truncated", envelope.Data.Matched, envelope.Data.Truncated, maxHistoryScan)
+	}
+
+	records, truncated, err := listMatchHistory(context.Background(), nk, "user-1", 0)
+	if err != nil || truncated || len(records) != maxHistoryScan+1 {
+		t.Errorf("full listing got %d records, truncated %v, %v; want all %d", len(records), truncated, err, maxHistoryScan+1)
+	}
+}
+
+func TestQueryStatsRejectsBadQueriesWithoutMatches(t *testing.T) {
+	nk := newMemoryNakama()
+	for _, payload := range []string{
+		`{"aggregations": [{"op": "median", "field": "moves"}]}`,
+		`{"aggregations": [{"op": "sum", "field": "password"}]}`,
+		`{"fields": ["password"]}`,
+	} {
+		_, err := queryStatsRPC(sessionContext("user-1", "ada"), discardLogger{}, nil, nk, payload)
+		var rpcErr *runtime.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidArgument {
+			t.Errorf("%s: got %v, want an invalid argument error", payload, err)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+// Package rules implements tic-tac-toe boards, move validation, and win
+// detection for every game mode. It has no Nakama dependencies so rule
+// changes can be exercised without a running server.
+package rules
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Player symbols
+const (
+	X     = "X"
+	O     = "O"
+	Empty = ""
+)
+
+// Move validation errors
+var (
+	ErrOutOfBounds   = errors.New("move is outside the board")
+	ErrOccupied      = errors.New("cell is already occupied")
+	ErrColumnFull    = errors.New("column is full")
+	ErrInvalidSymbol = errors.New("symbol not allowed in this mode")
+	ErrBadEncoding   = errors.New("malformed run-length board")
+)
+
+// Board is a square grid stored row-major in a flat byte slice, one byte per
+// cell, so boards are a single allocation and cheap to copy and scan
+type Board struct {
+	Size      int
+	Cells     []byte
+	WinLength int // pieces in a row needed to win; 0 means a full line
+}
+
+// Cell bytes
+const (
+	CellEmpty byte = 0
+	CellX     byte = 'X'
+	CellO     byte = 'O'
+)
+
+// Move represents a placement. Symbol is only set in modes that let the mover choose it.
+type Move struct {
+	Row    int
+	Col    int
+	Symbol string
+}
+
+// Rules is the behaviour that differs between game modes
+type Rules interface {
+	// Size returns the board size
+	Size() int
+	// Resolve validates a requested move on the board, returning the move to apply
+	Resolve(board Board, move Move) (Move, error)
+	// Winner returns the winning symbol after mover's move, or "" if the game goes on
+	Winner(board Board, mover string) string
+}
+
+// Standard returns plain tic-tac-toe rules on a size x size board
+func Standard(size int) Rules {
+	return standard{size: size}
+}
+
+// Gravity returns rules where pieces drop to the lowest empty cell of a column
+func Gravity(size int) Rules {
+	return gravity{standard{size: size}}
+}
+
+// Wild returns rules where either player may place X or O
+func Wild(size int) Rules {
+	return wild{standard{size: size}}
+}
+
+// Misere returns rules where completing a line loses
+func Misere(size int) Rules {
+	return misere{standard{size: size}}
+}
+
+// standard is plain tic-tac-toe: the mover places their own symbol and a full line wins
+type standard struct {
+	size int
+}
+
+func (s standard) Size() int { return s.size }
+
+func (s standard) Resolve(board Board, move Move) (Move, error) {
+	if move.Symbol != "" {
+		return move, ErrInvalidSymbol
+	}
+	return move, checkCell(board, move)
+}
+
+func (s standard) Winner(board Board, mover string) string {
+	if Winner(board) != "" {
+		return mover
+	}
+	return ""
+}
+
+// gravity drops the piece to the lowest empty cell of the chosen column
+type gravity struct {
+	standard
+}
+
+func (g gravity) Resolve(board Board, move Move) (Move, error) {
+	if move.Col >= 0 && move.Col < board.Size {
+		move.Row = DropRow(board, move.Col)
+		if move.Row < 0 {
+			return move, ErrColumnFull
+		}
+	}
+	return g.standard.Resolve(board, move)
+}
+
+// wild lets the mover place either symbol; completing a line of either wins for the mover
+type wild struct {
+	standard
+}
+
+func (w wild) Resolve(board Board, move Move) (Move, error) {
+	if move.Symbol != "" && move.Symbol != X && move.Symbol != O {
+		return move, ErrInvalidSymbol
+	}
+	return move, checkCell(board, move)
+}
+
+// misere hands the win to the opponent of whoever completes a line
+type misere struct {
+	standard
+}
+
+func (m misere) Winner(board Board, mover string) string {
+	if Winner(board) != "" {
+		return Opponent(mover)
+	}
+	return ""
+}
+
+// checkCell rejects moves outside the board or onto an occupied cell
+func checkCell(board Board, move Move) error {
+	if move.Row < 0 || move.Row >= board.Size || move.Col < 0 || move.Col >= board.Size {
+		return ErrOutOfBounds
+	}
+	if board.At(move.Row, move.Col) != Empty {
+		return ErrOccupied
+	}
+	return nil
+}
+
+// NewBoard returns an empty board of the given size, won by a full line
+func NewBoard(size int) Board {
+	return Board{Size: size, Cells: make([]byte, size*size)}
+}
+
+// NewBoardK returns an empty board of the given size, won by k pieces in a row
+func NewBoardK(size, k int) Board {
+	board := NewBoard(size)
+	if k > 0 && k < size {
+		board.WinLength = k
+	}
+	return board
+}
+
+// LineLength returns how many pieces in a row win on this board
+func (b Board) LineLength() int {
+	if b.WinLength > 0 && b.WinLength < b.Size {
+		return b.WinLength
+	}
+	return b.Size
+}
+
+// FromRows converts a [row][col] grid of symbols into a board. Unknown symbols
+// are treated as empty, so callers should validate client input first.
+func FromRows(rows [][]string) Board {
+	board := NewBoard(len(rows))
+	for i, row := range rows {
+		for j, cell := range row {
+			if j < board.Size {
+				board.Set(i, j, cell)
+			}
+		}
+	}
+	return board
+}
+
+// Rows returns the board as a [row][col] grid of symbols, the shape clients use
+func (b Board) Rows() [][]string {
+	rows := make([][]string, b.Size)
+	cells := make([]string, len(b.Cells))
+	for i, cell := range b.Cells {
+		cells[i] = symbolOf(cell)
+	}
+	for i := range rows {
+		rows[i] = cells[i*b.Size : (i+1)*b.Size : (i+1)*b.Size]
+	}
+	return rows
+}
+
+// RunLength returns the board's cells, row-major, as a run-length string: each
+// run of equal cells is its character ("X", "O", or "." for empty), preceded by
+// the run's length when longer than one. An empty 7x7 board is "49.", and a
+// 3x3 board with X in the centre is "4.X4.".
+func (b Board) RunLength() string {
+	var encoded strings.Builder
+	for i := 0; i < len(b.Cells); {
+		run := 1
+		for i+run < len(b.Cells) && b.Cells[i+run] == b.Cells[i] {
+			run++
+		}
+		if run > 1 {
+			encoded.WriteString(strconv.Itoa(run))
+		}
+		encoded.WriteByte(runLengthChar(b.Cells[i]))
+		i += run
+	}
+	return encoded.String()
+}
+
+// FromRunLength decodes a RunLength string into a size x size board. The runs
+// must cover the board exactly.
+func FromRunLength(size int, encoded string) (Board, error) {
+	board := NewBoard(size)
+	filled := 0
+	for i := 0; i < len(encoded); {
+		start := i
+		for i < len(encoded) && encoded[i] >= '0' && encoded[i] <= '9' {
+			i++
+		}
+		run := 1
+		if i > start {
+			n, err := strconv.Atoi(encoded[start:i])
+			if err != nil || n < 1 {
+				return Board{}, ErrBadEncoding
+			}
+			run = n
+		}
+		if i == len(encoded) || run > len(board.Cells)-filled {
+			return Board{}, ErrBadEncoding
+		}
+
+		var cell byte
+		switch encoded[i] {
+		case '.':
+			cell = CellEmpty
+		case CellX, CellO:
+			cell = encoded[i]
+		default:
+			return Board{}, ErrBadEncoding
+		}
+		for j := 0; j < run; j++ {
+			board.Cells[filled+j] = cell
+		}
+		filled += run
+		i++
+	}
+	if filled != len(board.Cells) {
+		return Board{}, ErrBadEncoding
+	}
+	return board, nil
+}
+
+// runLengthChar returns the character a cell is written as in RunLength strings
+func runLengthChar(cell byte) byte {
+	if cell == CellEmpty {
+		return '.'
+	}
+	return cell
+}
+
+// At returns the symbol in a cell
+func (b Board) At(row, col int) string {
+	return symbolOf(b.Cells[row*b.Size+col])
+}
+
+// Set places a symbol (or Empty) in a cell
+func (b Board) Set(row, col int, symbol string) {
+	b.Cells[row*b.Size+col] = cellOf(symbol)
+}
+
+// Copy returns a deep copy of a board
+func Copy(board Board) Board {
+	return Board{Size: board.Size, Cells: append([]byte(nil), board.Cells...), WinLength: board.WinLength}
+}
+
+// Full reports whether every cell of the board is taken
+func Full(board Board) bool {
+	for _, cell := range board.Cells {
+		if cell == CellEmpty {
+			return false
+		}
+	}
+	return true
+}
+
+// DropRow returns the lowest empty row in a column, or -1 if the column is full
+func DropRow(board Board, col int) int {
+	for row := board.Size - 1; row >= 0; row-- {
+		if board.Cells[row*board.Size+col] == CellEmpty {
+			return row
+		}
+	}
+	return -1
+}
+
+// Opponent returns the other player's symbol
+func Opponent(symbol string) string {
+	if symbol == X {
+		return O
+	}
+	return X
+}
+
+// Winner returns the symbol holding LineLength cells in a row anywhere on the
+// board: horizontally, vertically, or on either diagonal
+func Winner(board Board) string {
+	size := board.Size
+	cells := board.Cells
+	k := board.LineLength()
+	if size == 0 {
+		return ""
+	}
+
+	// Each run is found from its first cell, so only look right, down, and
+	// along both downward diagonals
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			first := cells[row*size+col]
+			if first == CellEmpty {
+				continue
+			}
+			start := row*size + col
+			fitsRight := col+k <= size
+			fitsDown := row+k <= size
+			fitsLeft := col-k+1 >= 0
+
+			if fitsRight && lineHolds(cells, start, 1, k, first) ||
+				fitsDown && lineHolds(cells, start, size, k, first) ||
+				fitsRight && fitsDown && lineHolds(cells, start, size+1, k, first) ||
+				fitsLeft && fitsDown && lineHolds(cells, start, size-1, k, first) {
+				return symbolOf(first)
+			}
+		}
+	}
+
+	return ""
+}
+
+// lineHolds reports whether n cells from start, step apart, all hold want
+func lineHolds(cells []byte, start, step, n int, want byte) bool {
+	for k := 1; k < n; k++ {
+		if cells[start+k*step] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// cellOf converts a symbol to its cell byte
+func cellOf(symbol string) byte {
+	switch symbol {
+	case X:
+		return CellX
+	case O:
+		return CellO
+	default:
+		return CellEmpty
+	}
+}
+
+// symbolOf converts a cell byte to its symbol
+func symbolOf(cell byte) string {
+	switch cell {
+	case CellX:
+		return X
+	case CellO:
+		return O
+	default:
+		return Empty
+	}
+}
@@ -0,0 +1,309 @@
+package rules
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+// Board sizes and line lengths a match may be configured with
+const (
+	minTestSize = 3
+	maxTestSize = 15
+	minTestK    = 3
+)
+
+// directions are the four ways a line can run from its first cell
+var directions = []struct {
+	name       string
+	dRow, dCol int
+}{
+	{"row", 0, 1},
+	{"column", 1, 0},
+	{"diagonal", 1, 1},
+	{"anti-diagonal", 1, -1},
+}
+
+// boardFrom builds a board from rows of "X", "O", and "." characters
+func boardFrom(rows ...string) Board {
+	board := NewBoard(len(rows))
+	for i, row := range rows {
+		for j, cell := range row {
+			if cell != '.' {
+				board.Set(i, j, string(cell))
+			}
+		}
+	}
+	return board
+}
+
+func TestWinnerFindsEveryLineOnEveryBoardSize(t *testing.T) {
+	for size := minTestSize; size <= maxTestSize; size++ {
+		for k := minTestK; k <= size; k++ {
+			for _, dir := range directions {
+				for row := 0; row < size; row++ {
+					for col := 0; col < size; col++ {
+						endRow, endCol := row+(k-1)*dir.dRow, col+(k-1)*dir.dCol
+						if endRow < 0 || endRow >= size || endCol < 0 || endCol >= size {
+							continue
+						}
+
+						board := NewBoardK(size, k)
+						for i := 0; i < k-1; i++ {
+							board.Set(row+i*dir.dRow, col+i*dir.dCol, O)
+						}
+						if got := Winner(board); got != "" {
+							t.Fatalf("size %d k %d: %d in a %s from (%d,%d) won for %q", size, k, k-1, dir.name, row, col, got)
+						}
+						board.Set(endRow, endCol, O)
+						if got := Winner(board); got != O {
+							t.Fatalf("size %d k %d: %s from (%d,%d) got winner %q, want O", size, k, dir.name, row, col, got)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWinnerIgnoresLinesBrokenByTheOpponent(t *testing.T) {
+	board := boardFrom(
+		"XXOXX",
+		".....",
+		".....",
+		".....",
+		".....",
+	)
+	board.WinLength = 4
+	if got := Winner(board); got != "" {
+		t.Errorf("got winner %q for a broken row, want none", got)
+	}
+}
+
+func TestWinnerDoesNotWrapAroundRows(t *testing.T) {
+	board := boardFrom(
+		"...X",
+		"XX..",
+		"....",
+		"....",
+	)
+	board.WinLength = 3
+	if got := Winner(board); got != "" {
+		t.Errorf("got winner %q for cells split across rows, want none", got)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	board := boardFrom(
+		"XOX",
+		"XOO",
+		"OXX",
+	)
+	if !Full(board) {
+		t.Error("expected the board to be full")
+	}
+	if got := Winner(board); got != "" {
+		t.Errorf("got winner %q on a drawn board, want none", got)
+	}
+	if Full(NewBoard(3)) {
+		t.Error("empty board reported full")
+	}
+}
+
+func TestStandardResolve(t *testing.T) {
+	r := Standard(3)
+	board := boardFrom(
+		"X..",
+		"...",
+		"...",
+	)
+	tests := []struct {
+		name string
+		move Move
+		want error
+	}{
+		{"empty cell", Move{Row: 1, Col: 1}, nil},
+		{"occupied", Move{Row: 0, Col: 0}, ErrOccupied},
+		{"row out of bounds", Move{Row: 3, Col: 0}, ErrOutOfBounds},
+		{"negative column", Move{Row: 0, Col: -1}, ErrOutOfBounds},
+		{"chosen symbol", Move{Row: 1, Col: 1, Symbol: O}, ErrInvalidSymbol},
+	}
+	for _, tt := range tests {
+		if _, err := r.Resolve(board, tt.move); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestGravityResolveDropsToLowestEmptyRow(t *testing.T) {
+	r := Gravity(4)
+	board := boardFrom(
+		"....",
+		"X...",
+		"O...",
+		"XO..",
+	)
+	tests := []struct {
+		col     int
+		wantRow int
+	}{
+		{col: 0, wantRow: 0},
+		{col: 1, wantRow: 2},
+		{col: 3, wantRow: 3},
+	}
+	for _, tt := range tests {
+		// The requested row is ignored; only the column matters
+		move, err := r.Resolve(board, Move{Row: 0, Col: tt.col})
+		if err != nil || move.Row != tt.wantRow {
+			t.Errorf("column %d: got row %d, %v; want row %d", tt.col, move.Row, err, tt.wantRow)
+		}
+	}
+
+	board.Set(0, 0, O)
+	if _, err := r.Resolve(board, Move{Col: 0}); !errors.Is(err, ErrColumnFull) {
+		t.Errorf("full column: got %v, want ErrColumnFull", err)
+	}
+	if _, err := r.Resolve(board, Move{Col: 4}); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("column off the board: got %v, want ErrOutOfBounds", err)
+	}
+}
+
+func TestGravityWinner(t *testing.T) {
+	r := Gravity(4)
+	board := boardFrom(
+		"....",
+		"....",
+		"....",
+		"OOOO",
+	)
+	if got := r.Winner(board, O); got != O {
+		t.Errorf("got winner %q, want O", got)
+	}
+}
+
+func TestWildResolve(t *testing.T) {
+	r := Wild(3)
+	board := NewBoard(3)
+	for _, symbol := range []string{"", X, O} {
+		if _, err := r.Resolve(board, Move{Row: 0, Col: 0, Symbol: symbol}); err != nil {
+			t.Errorf("symbol %q: got %v, want it allowed", symbol, err)
+		}
+	}
+	if _, err := r.Resolve(board, Move{Row: 0, Col: 0, Symbol: "Z"}); !errors.Is(err, ErrInvalidSymbol) {
+		t.Errorf("symbol Z: got %v, want ErrInvalidSymbol", err)
+	}
+}
+
+func TestWildWinnerIsTheMoverWhicheverSymbolCompletesTheLine(t *testing.T) {
+	board := boardFrom(
+		"OOO",
+		"X..",
+		"X..",
+	)
+	if got := Wild(3).Winner(board, X); got != X {
+		t.Errorf("got winner %q, want X, who completed the line of O", got)
+	}
+}
+
+func TestMisereWinnerIsTheOpponentOfWhoeverCompletesALine(t *testing.T) {
+	board := boardFrom(
+		"XXX",
+		"OO.",
+		"...",
+	)
+	r := Misere(3)
+	if got := r.Winner(board, X); got != O {
+		t.Errorf("got winner %q, want O", got)
+	}
+	if got := r.Winner(NewBoard(3), X); got != "" {
+		t.Errorf("got winner %q on an empty board, want none", got)
+	}
+}
+
+func TestStandardWinnerIsTheMover(t *testing.T) {
+	board := boardFrom(
+		"X..",
+		".X.",
+		"..X",
+	)
+	if got := Standard(3).Winner(board, X); got != X {
+		t.Errorf("got winner %q, want X", got)
+	}
+}
+
+func TestRunLengthExamples(t *testing.T) {
+	if got := NewBoard(7).RunLength(); got != "49." {
+		t.Errorf("empty 7x7 board encoded as %q, want 49.", got)
+	}
+	board := NewBoard(3)
+	board.Set(1, 1, X)
+	if got := board.RunLength(); got != "4.X4." {
+		t.Errorf("centre X encoded as %q, want 4.X4.", got)
+	}
+}
+
+func TestRunLengthRoundTrip(t *testing.T) {
+	cellValues := []byte{CellEmpty, CellX, CellO}
+	roundTrips := func(seed int64) bool {
+		random := rand.New(rand.NewSource(seed))
+		board := NewBoard(1 + random.Intn(maxTestSize))
+		for i := range board.Cells {
+			board.Cells[i] = cellValues[random.Intn(len(cellValues))]
+		}
+
+		decoded, err := FromRunLength(board.Size, board.RunLength())
+		return err == nil && string(decoded.Cells) == string(board.Cells)
+	}
+	if err := quick.Check(roundTrips, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFromRunLengthRejectsMalformedInput(t *testing.T) {
+	for _, encoded := range []string{
+		"",                      // covers nothing
+		"8.",                    // one cell short
+		"10.",                   // one cell over
+		"4.X4",                  // trailing count
+		"4.Z4.",                 // unknown cell
+		"0.9.",                  // empty run
+		"4.x4.",                 // lowercase symbol
+		"99999999999999999999.", // overflows
+	} {
+		if _, err := FromRunLength(3, encoded); !errors.Is(err, ErrBadEncoding) {
+			t.Errorf("%q: got %v, want ErrBadEncoding", encoded, err)
+		}
+	}
+}
+
+// benchmarkMoves is a 5x5 game of twelve moves, none of which wins
+var benchmarkMoves = []Move{
+	{Row: 2, Col: 2}, {Row: 0, Col: 0}, {Row: 1, Col: 1}, {Row: 3, Col: 3},
+	{Row: 0, Col: 4}, {Row: 4, Col: 0}, {Row: 2, Col: 1}, {Row: 2, Col: 3},
+	{Row: 1, Col: 3}, {Row: 3, Col: 1}, {Row: 4, Col: 4}, {Row: 0, Col: 2},
+}
+
+func BenchmarkMoveAndWinCheck(b *testing.B) {
+	r := Standard(5)
+	board := NewBoard(5)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range board.Cells {
+			board.Cells[j] = CellEmpty
+		}
+		symbol := X
+		for _, requested := range benchmarkMoves {
+			move, err := r.Resolve(board, requested)
+			if err != nil {
+				b.Fatal(err)
+			}
+			board.Set(move.Row, move.Col, symbol)
+			if r.Winner(board, symbol) != "" {
+				b.Fatal("benchmark game was won")
+			}
+			symbol = Opponent(symbol)
+		}
+	}
+}
@@ -6,10 +6,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 
+	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
+const (
+	// Owners looked up per leaderboard read when listing friends' records
+	ownerRecordsBatch = 100
+
+	// Players shown above and below the caller by get_leaderboard_around_me
+	defaultNeighbors = 5
+	maxNeighbors     = 25
+
+	// Records counted per read when sizing a leaderboard for admin_clear_leaderboards
+	clearCountBatch = 100
+)
+
+// clearableLeaderboards returns the leaderboards admin_clear_leaderboards may
+// clear, with the function recreating each
+func clearableLeaderboards() map[string]func(context.Context, runtime.Logger, runtime.NakamaModule) error {
+	return map[string]func(context.Context, runtime.Logger, runtime.NakamaModule) error{
+		config.LeaderboardID:       createLeaderboards,
+		config.WeeklyLeaderboardID: createLeaderboards,
+		config.SeasonLeaderboardID: createSeasonLeaderboard,
+	}
+}
+
 // LeaderboardEntry represents a leaderboard entry
 type LeaderboardEntry struct {
 	UserID     string  `json:"user_id"`
@@ -20,14 +45,67 @@ type LeaderboardEntry struct {
 	GamesLost  int     `json:"games_lost"`
 	GamesDrawn int     `json:"games_drawn"`
 	WinRate    float64 `json:"win_rate"`
+	WinStreak  int     `json:"win_streak"`
+	Rating     int64   `json:"rating,omitempty"`
+	// Profile card, if the player set one
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarID    string `json:"avatar_id,omitempty"`
+}
+
+// RecordMetadata represents the player details written with each leaderboard
+// record, so a page renders from the records call alone. On the weekly and
+// monthly boards the game counters are the period's.
+type RecordMetadata struct {
+	Username    string `json:"username"`
+	Rating      int64  `json:"rating"`
+	WinStreak   int    `json:"win_streak"`
+	GamesPlayed int    `json:"games_played"`
+	GamesWon    int    `json:"games_won"`
+	GamesLost   int    `json:"games_lost"`
+	GamesDrawn  int    `json:"games_drawn"`
+}
+
+// ClearLeaderboardsRequest represents admin_clear_leaderboards request
+type ClearLeaderboardsRequest struct {
+	Leaderboards []string `json:"leaderboards"`
+	DryRun       bool     `json:"dry_run"`
+}
+
+// ClearedLeaderboard represents one leaderboard cleared, or that would be on a dry run
+type ClearedLeaderboard struct {
+	ID      string `json:"id"`
+	Records int    `json:"records"` // records in the current period before clearing
 }
 
 // LeaderboardResponse represents leaderboard response
 type LeaderboardResponse struct {
 	Entries []LeaderboardEntry `json:"entries"`
 	Total   int                `json:"total"`
+	Stale   bool               `json:"stale,omitempty"` // served from cache because storage was unavailable
+	// Pass as "cursor" to read the next or previous page; empty at either end
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// LeaderboardRequest represents a leaderboard page request
+type LeaderboardRequest struct {
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
 }
 
+// leaderboardPage represents a page of leaderboard entries with its cursors
+type leaderboardPage struct {
+	Entries    []LeaderboardEntry
+	NextCursor string
+	PrevCursor string
+}
+
+// Last good page of each leaderboard, served when a fresh read fails or times out
+var (
+	leaderboardCache      = make(map[string]leaderboardPage)
+	leaderboardCacheMutex sync.RWMutex
+)
+
 // PlayerStats represents detailed player statistics
 type PlayerStats struct {
 	UserID      string  `json:"user_id"`
@@ -40,12 +118,20 @@ type PlayerStats struct {
 	GamesPlayed int     `json:"games_played"`
 	WinRate     float64 `json:"win_rate"`
 	CreatedAt   int64   `json:"created_at"`
+	// Consecutive ranked results; a draw ends both streaks
+	WinStreak        int `json:"win_streak"`
+	LossStreak       int `json:"loss_streak"`
+	LongestWinStreak int `json:"longest_win_streak"`
+	// Placement progress; provisional players have no rank until it completes
+	Provisional          bool `json:"provisional"`
+	PlacementGamesPlayed int  `json:"placement_games_played"`
+	PlacementGames       int  `json:"placement_games"`
 }
 
 // InitLeaderboard initializes the leaderboard system
 func InitLeaderboard(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	// Register leaderboard RPCs
-	if err := initializer.RegisterRpc("get_leaderboard", getLeaderboardRPC); err != nil {
+	if err := initializer.RegisterRpc("get_leaderboard", withRateLimit(leaderboardLimiter, getLeaderboardRPC)); err != nil {
 		return fmt.Errorf("failed to register get_leaderboard RPC: %w", err)
 	}
 
@@ -53,13 +139,29 @@ func InitLeaderboard(ctx context.Context, logger runtime.Logger, db *sql.DB, nk
 		return fmt.Errorf("failed to register get_player_stats RPC: %w", err)
 	}
 
-	if err := initializer.RegisterRpc("get_weekly_leaderboard", getWeeklyLeaderboardRPC); err != nil {
+	if err := initializer.RegisterLeaderboardReset(onLeaderboardReset); err != nil {
+		return fmt.Errorf("failed to register leaderboard reset handler: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_weekly_leaderboard", withRateLimit(leaderboardLimiter, getWeeklyLeaderboardRPC)); err != nil {
 		return fmt.Errorf("failed to register get_weekly_leaderboard RPC: %w", err)
 	}
 
+	if err := initializer.RegisterRpc("get_monthly_leaderboard", withRateLimit(leaderboardLimiter, getMonthlyLeaderboardRPC)); err != nil {
+		return fmt.Errorf("failed to register get_monthly_leaderboard RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_friends_leaderboard", withRateLimit(leaderboardLimiter, getFriendsLeaderboardRPC)); err != nil {
+		return fmt.Errorf("failed to register get_friends_leaderboard RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_leaderboard_around_me", withRateLimit(leaderboardLimiter, getLeaderboardAroundMeRPC)); err != nil {
+		return fmt.Errorf("failed to register get_leaderboard_around_me RPC: %w", err)
+	}
+
 	// Register clear leaderboard RPC for testing
-	if err := initializer.RegisterRpc("clear_leaderboards", clearLeaderboardsRPC); err != nil {
-		return fmt.Errorf("failed to register clear_leaderboards RPC: %w", err)
+	if err := initializer.RegisterRpc("admin_clear_leaderboards", adminClearLeaderboardsRPC); err != nil {
+		return fmt.Errorf("failed to register admin_clear_leaderboards RPC: %w", err)
 	}
 
 	// Create leaderboards
@@ -74,7 +176,7 @@ func InitLeaderboard(ctx context.Context, logger runtime.Logger, db *sql.DB, nk
 // createLeaderboards creates all necessary leaderboards
 func createLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
 	// Create main leaderboard
-	leaderboardID := "ttt_leaderboard"
+	leaderboardID := config.LeaderboardID
 	leaderboard, err := nk.LeaderboardsGetId(ctx, []string{leaderboardID})
 	if err != nil {
 		return fmt.Errorf("failed to check leaderboard: %w", err)
@@ -84,7 +186,9 @@ func createLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.N
 		metadata := map[string]interface{}{
 			"description": "Player Performance",
 		}
-		err = nk.LeaderboardCreate(ctx, leaderboardID, true, "desc", "incr", "0 0 * * 0", metadata, true)
+		// Ratings carry over from week to week, so the main board never resets;
+		// weekly points go on the weekly board
+		err = nk.LeaderboardCreate(ctx, leaderboardID, true, "desc", "incr", "", metadata, true)
 		if err != nil {
 			return fmt.Errorf("failed to create leaderboard: %w", err)
 		}
@@ -92,7 +196,7 @@ func createLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.N
 	}
 
 	// Create weekly leaderboard
-	weeklyLeaderboardID := "ttt_weekly_leaderboard"
+	weeklyLeaderboardID := config.WeeklyLeaderboardID
 	weeklyLeaderboard, err := nk.LeaderboardsGetId(ctx, []string{weeklyLeaderboardID})
 	if err != nil {
 		return fmt.Errorf("failed to check weekly leaderboard: %w", err)
@@ -102,8 +206,8 @@ func createLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.N
 		metadata := map[string]interface{}{
 			"description": "Weekly Player Performance",
 		}
-		// Weekly reset every Sunday at midnight
-		err = nk.LeaderboardCreate(ctx, weeklyLeaderboardID, true, "desc", "incr", "0 0 * * 0", metadata, true)
+		// Weekly reset, by default every Sunday at midnight
+		err = nk.LeaderboardCreate(ctx, weeklyLeaderboardID, true, "desc", "incr", config.WeeklyReset, metadata, true)
 		if err != nil {
 			return fmt.Errorf("failed to create weekly leaderboard: %w", err)
 		}
@@ -115,309 +219,598 @@ func createLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.N
 
 // getLeaderboardRPC returns the current leaderboard
 func getLeaderboardRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-	var request struct {
-		Limit int `json:"limit"`
-	}
-	if payload != "" {
-		if err := json.Unmarshal([]byte(payload), &request); err != nil {
-			request.Limit = 10 // Default limit
-		}
-	}
-	if request.Limit <= 0 || request.Limit > 100 {
-		request.Limit = 10
-	}
+	logger = rpcLogger(ctx, logger)
 
-	leaderboardID := "ttt_leaderboard"
+	request := parseLeaderboardRequest(payload)
+
+	leaderboardID := config.LeaderboardID
+	// Only first pages are cached, since every page has its own cursor
+	cacheKey := fmt.Sprintf("%s:%d", leaderboardID, request.Limit)
 
 	// Get leaderboard records
-	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, request.Limit, "", 0)
+	records, _, next, prev, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, request.Limit, request.Cursor, 0)
 	if err != nil {
-		return "", fmt.Errorf("failed to get leaderboard records: %w", err)
-	}
-
-	// Convert to our format
-	entries := make([]LeaderboardEntry, len(records))
-	for i, record := range records {
-		// Get additional stats from user storage
-		stats, err := getUserStats(ctx, nk, record.OwnerId)
-		if err != nil {
-			logger.Error("Failed to get stats for user %s: %v", record.OwnerId, err)
-			stats = &PlayerStats{} // Use empty stats
-		}
-
-		winRate := 0.0
-		if stats.GamesPlayed > 0 {
-			winRate = float64(stats.GamesWon) / float64(stats.GamesPlayed) * 100
-		}
-
-		entries[i] = LeaderboardEntry{
-			UserID:     record.OwnerId,
-			Username:   record.Username.GetValue(),
-			Score:      record.Score,
-			Rank:       i + 1,
-			GamesWon:   stats.GamesWon,
-			GamesLost:  stats.GamesLost,
-			GamesDrawn: stats.GamesDrawn,
-			WinRate:    winRate,
+		cached, ok := cachedLeaderboard(cacheKey)
+		if !ok || request.Cursor != "" {
+			return "", rpcErrorf(CodeUnavailable, "failed to get leaderboard records: %v", err)
 		}
+		logger.Warn("Serving cached leaderboard after read failure: %v", err)
+		return leaderboardResponse(ctx, logger, nk, cached, true)
 	}
 
-	response := LeaderboardResponse{
-		Entries: entries,
-		Total:   len(entries),
-	}
+	entries := leaderboardEntries(ctx, logger, nk, leaderboardID, records)
 
-	responseBytes, err := json.Marshal(response)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal leaderboard response: %w", err)
+	page := leaderboardPage{Entries: entries, NextCursor: next, PrevCursor: prev}
+	if request.Cursor == "" {
+		cacheLeaderboard(cacheKey, page)
 	}
+	return leaderboardResponse(ctx, logger, nk, page, false)
+}
 
-	return string(responseBytes), nil
+// onLeaderboardReset runs whenever a leaderboard resets. Nakama takes a single
+// reset handler, so everything that reacts to resets is called from here.
+func onLeaderboardReset(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, leaderboard *api.Leaderboard, reset int64) error {
+	notifyLeaderboardReset(ctx, logger, nk, leaderboard.GetId(), reset)
+	return onSeasonReset(ctx, logger, db, nk, leaderboard, reset)
 }
 
 // getPlayerStatsRPC returns detailed player statistics
 func getPlayerStatsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
 	var request struct {
 		UserID string `json:"user_id"`
 	}
 	if err := json.Unmarshal([]byte(payload), &request); err != nil {
-		return "", fmt.Errorf("invalid request format: %w", err)
+		return "", invalidPayload(err)
+	}
+
+	// Get user's leaderboard record; it carries the player's rank on the whole board
+	record, err := playerRecord(ctx, nk, config.LeaderboardID, request.UserID)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to get player record: %v", err)
 	}
 
-	// Get user's leaderboard record
-	leaderboardID := "ttt_leaderboard"
-	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, []string{request.UserID}, 1, "", 0)
+	userStats, err := getUserStats(ctx, nk, request.UserID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get player record: %w", err)
+		return "", rpcErrorf(CodeUnavailable, "failed to get user stats: %v", err)
+	}
+	if userStats.GamesPlayed > 0 {
+		userStats.WinRate = float64(userStats.GamesWon) / float64(userStats.GamesPlayed) * 100
 	}
 
 	var stats PlayerStats
-	if len(records) > 0 {
-		record := records[0]
-		userStats, err := getUserStats(ctx, nk, record.OwnerId)
-		if err != nil {
-			return "", fmt.Errorf("failed to get user stats: %w", err)
+	switch {
+	case record != nil:
+		stats = *userStats
+		stats.Username = record.Username.GetValue()
+		stats.Score = record.Score
+		stats.Rank = int(record.Rank)
+	case userStats.Provisional && userStats.PlacementGamesPlayed > 0:
+		// Players in placements are kept off the board, so they have no rank yet
+		stats = *userStats
+		if stats.Username == "" {
+			if users, err := nk.UsersGetId(ctx, []string{stats.UserID}, nil); err == nil && len(users) > 0 {
+				stats.Username = users[0].Username
+			}
 		}
+	}
 
-		winRate := 0.0
-		if userStats.GamesPlayed > 0 {
-			winRate = float64(userStats.GamesWon) / float64(userStats.GamesPlayed) * 100
+	// Streamer-mode players are anonymous to everyone else
+	if viewerID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); stats.UserID != "" && stats.UserID != viewerID {
+		if settings, err := GetUserSettings(ctx, nk, stats.UserID); err == nil && settings.StreamerMode {
+			stats.Username = AnonymousName
 		}
+	}
+
+	return rpcOK(stats)
+}
+
+// getWeeklyLeaderboardRPC returns the weekly leaderboard
+func getWeeklyLeaderboardRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	request := parseLeaderboardRequest(payload)
+
+	leaderboardID := config.WeeklyLeaderboardID
+	// Only first pages are cached, since every page has its own cursor
+	cacheKey := fmt.Sprintf("%s:%d", leaderboardID, request.Limit)
+
+	// Get weekly leaderboard records
+	records, _, next, prev, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, request.Limit, request.Cursor, 0)
+	if err != nil {
+		cached, ok := cachedLeaderboard(cacheKey)
+		if !ok || request.Cursor != "" {
+			return "", rpcErrorf(CodeUnavailable, "failed to get weekly leaderboard records: %v", err)
+		}
+		logger.Warn("Serving cached weekly leaderboard after read failure: %v", err)
+		return leaderboardResponse(ctx, logger, nk, cached, true)
+	}
+
+	// Weekly entries carry this week's results, not the all-time ones
+	page := leaderboardPage{Entries: leaderboardEntries(ctx, logger, nk, leaderboardID, records), NextCursor: next, PrevCursor: prev}
+	if request.Cursor == "" {
+		cacheLeaderboard(cacheKey, page)
+	}
+	return leaderboardResponse(ctx, logger, nk, page, false)
+}
+
+// getFriendsLeaderboardRPC returns the caller and their friends ranked among themselves
+func getFriendsLeaderboardRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
 
-		stats = PlayerStats{
-			UserID:      record.OwnerId,
-			Username:    record.Username.GetValue(),
-			Score:       record.Score,
-			Rank:        1, // This would need to be calculated properly
-			GamesWon:    userStats.GamesWon,
-			GamesLost:   userStats.GamesLost,
-			GamesDrawn:  userStats.GamesDrawn,
-			GamesPlayed: userStats.GamesPlayed,
-			WinRate:     winRate,
-			CreatedAt:   userStats.CreatedAt,
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request struct {
+		Weekly bool `json:"weekly"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
 		}
 	}
 
-	responseBytes, err := json.Marshal(stats)
+	leaderboardID := config.LeaderboardID
+	if request.Weekly {
+		leaderboardID = config.WeeklyLeaderboardID
+	}
+
+	friends, err := listFriendIDs(ctx, nk, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal player stats: %w", err)
+		return "", rpcError(CodeUnavailable, err.Error())
 	}
+	ownerIDs := append([]string{userID}, friends...)
 
-	return string(responseBytes), nil
+	// Read the friends' own records, in batches of ownerRecordsBatch owners
+	records := make([]*api.LeaderboardRecord, 0, len(ownerIDs))
+	for start := 0; start < len(ownerIDs); start += ownerRecordsBatch {
+		end := start + ownerRecordsBatch
+		if end > len(ownerIDs) {
+			end = len(ownerIDs)
+		}
+		_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, ownerIDs[start:end], 1, "", 0)
+		if err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to get friends' leaderboard records: %v", err)
+		}
+		records = append(records, ownerRecords...)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Score > records[j].Score })
+
+	// Friends are ranked among themselves, not on the whole board
+	entries := leaderboardEntries(ctx, logger, nk, leaderboardID, records)
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	return leaderboardResponse(ctx, logger, nk, leaderboardPage{Entries: entries}, false)
 }
 
-// getWeeklyLeaderboardRPC returns the weekly leaderboard
-func getWeeklyLeaderboardRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+// getLeaderboardAroundMeRPC returns the caller's record with the players ranked
+// just above and below them
+func getLeaderboardAroundMeRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
 	var request struct {
-		Limit int `json:"limit"`
+		Weekly    bool `json:"weekly"`
+		Neighbors int  `json:"neighbors"`
 	}
 	if payload != "" {
 		if err := json.Unmarshal([]byte(payload), &request); err != nil {
-			request.Limit = 10
+			return "", invalidPayload(err)
 		}
 	}
-	if request.Limit <= 0 || request.Limit > 100 {
-		request.Limit = 10
+	if request.Neighbors <= 0 || request.Neighbors > maxNeighbors {
+		request.Neighbors = defaultNeighbors
 	}
 
-	leaderboardID := "ttt_weekly_leaderboard"
+	leaderboardID := config.LeaderboardID
+	if request.Weekly {
+		leaderboardID = config.WeeklyLeaderboardID
+	}
 
-	// Get weekly leaderboard records
-	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, request.Limit, "", 0)
+	// The haystack is centred on the caller, so it holds Neighbors records either side
+	list, err := nk.LeaderboardRecordsHaystack(ctx, leaderboardID, userID, 2*request.Neighbors+1, "", 0)
 	if err != nil {
-		return "", fmt.Errorf("failed to get weekly leaderboard records: %w", err)
+		return "", rpcErrorf(CodeUnavailable, "failed to get leaderboard around player: %v", err)
 	}
 
-	// Convert to our format
-	entries := make([]LeaderboardEntry, len(records))
-	for i, record := range records {
-		entries[i] = LeaderboardEntry{
-			UserID:   record.OwnerId,
-			Username: record.Username.GetValue(),
-			Score:    record.Score,
-			Rank:     i + 1,
+	entries := leaderboardEntries(ctx, logger, nk, leaderboardID, list.GetRecords())
+
+	return leaderboardResponse(ctx, logger, nk, leaderboardPage{
+		Entries:    entries,
+		NextCursor: list.GetNextCursor(),
+		PrevCursor: list.GetPrevCursor(),
+	}, false)
+}
+
+// parseLeaderboardRequest reads a page request, defaulting to the first 10 entries
+func parseLeaderboardRequest(payload string) LeaderboardRequest {
+	var request LeaderboardRequest
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			request = LeaderboardRequest{}
 		}
 	}
-
-	response := LeaderboardResponse{
-		Entries: entries,
-		Total:   len(entries),
+	if request.Limit <= 0 || request.Limit > 100 {
+		request.Limit = 10
 	}
+	return request
+}
 
-	responseBytes, err := json.Marshal(response)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal weekly leaderboard response: %w", err)
+// leaderboardResponse anonymizes entries for the viewer and wraps them in the response envelope
+func leaderboardResponse(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, page leaderboardPage, stale bool) (string, error) {
+	attachProfiles(ctx, logger, nk, page.Entries)
+
+	// Hide players who enabled streamer mode
+	viewerID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	anonymizeEntries(ctx, logger, nk, viewerID, page.Entries)
+
+	return rpcOK(LeaderboardResponse{
+		Entries:    page.Entries,
+		Total:      len(page.Entries),
+		Stale:      stale,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	})
+}
+
+// cacheLeaderboard stores a copy of a freshly read leaderboard page
+func cacheLeaderboard(key string, page leaderboardPage) {
+	leaderboardCacheMutex.Lock()
+	defer leaderboardCacheMutex.Unlock()
+	page.Entries = append([]LeaderboardEntry(nil), page.Entries...)
+	leaderboardCache[key] = page
+}
+
+// cachedLeaderboard returns a copy of the last good page, since callers anonymize entries in place
+func cachedLeaderboard(key string) (leaderboardPage, bool) {
+	leaderboardCacheMutex.RLock()
+	defer leaderboardCacheMutex.RUnlock()
+	page, ok := leaderboardCache[key]
+	if !ok {
+		return leaderboardPage{}, false
 	}
+	page.Entries = append([]LeaderboardEntry(nil), page.Entries...)
+	return page, true
+}
 
-	return string(responseBytes), nil
+// uncacheLeaderboard drops every cached page of a leaderboard
+func uncacheLeaderboard(leaderboardID string) {
+	leaderboardCacheMutex.Lock()
+	defer leaderboardCacheMutex.Unlock()
+	for key := range leaderboardCache {
+		if strings.HasPrefix(key, leaderboardID+":") {
+			delete(leaderboardCache, key)
+		}
+	}
 }
 
-// clearLeaderboardsRPC clears all leaderboard data (for testing)
-func clearLeaderboardsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-	// Delete all records from main leaderboard
-	err := nk.LeaderboardDelete(ctx, "ttt_leaderboard")
-	if err != nil {
-		logger.Error("Failed to clear main leaderboard: %v", err)
+// adminClearLeaderboardsRPC deletes and recreates the selected leaderboards,
+// or with dry_run only reports how many records each holds (admin only)
+func adminClearLeaderboardsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
 	}
+	logger = rpcLogger(ctx, logger)
 
-	// Delete all records from weekly leaderboard
-	err = nk.LeaderboardDelete(ctx, "ttt_weekly_leaderboard")
-	if err != nil {
-		logger.Error("Failed to clear weekly leaderboard: %v", err)
+	var request ClearLeaderboardsRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	// Clearing can't be undone, so every board has to be named
+	if len(request.Leaderboards) == 0 {
+		return "", rpcError(CodeInvalidArgument, "leaderboards is required")
+	}
+	clearable := clearableLeaderboards()
+	for _, leaderboardID := range request.Leaderboards {
+		if _, ok := clearable[leaderboardID]; !ok {
+			return "", rpcErrorf(CodeInvalidArgument, "leaderboard %s cannot be cleared", leaderboardID)
+		}
 	}
 
-	// Recreate leaderboards
-	if err := createLeaderboards(ctx, logger, nk); err != nil {
-		return "", fmt.Errorf("failed to recreate leaderboards: %w", err)
+	cleared := make([]ClearedLeaderboard, 0, len(request.Leaderboards))
+	seen := make(map[string]bool, len(request.Leaderboards))
+	for _, leaderboardID := range request.Leaderboards {
+		if seen[leaderboardID] {
+			continue
+		}
+		seen[leaderboardID] = true
+		count, err := countLeaderboardRecords(ctx, nk, leaderboardID)
+		if err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to count %s records: %v", leaderboardID, err)
+		}
+		cleared = append(cleared, ClearedLeaderboard{ID: leaderboardID, Records: count})
+	}
+	if request.DryRun {
+		return rpcOK(map[string]interface{}{"dry_run": true, "leaderboards": cleared})
 	}
 
-	logger.Info("Cleared and recreated all leaderboards")
-	
-	response := map[string]interface{}{
-		"message": "Leaderboards cleared and recreated successfully",
-		"success": true,
+	for _, board := range cleared {
+		if err := nk.LeaderboardDelete(ctx, board.ID); err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to clear %s: %v", board.ID, err)
+		}
+		if err := clearable[board.ID](ctx, logger, nk); err != nil {
+			return "", rpcErrorf(CodeInternal, "failed to recreate %s: %v", board.ID, err)
+		}
+		uncacheLeaderboard(board.ID)
+		recordAudit(ctx, logger, nk, "clear_leaderboard", board.ID, map[string]interface{}{"records": board.Records})
+		logger.Warn("Cleared leaderboard %s (%d records)", board.ID, board.Records)
 	}
-	
-	responseBytes, err := json.Marshal(response)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal response: %w", err)
+
+	return rpcOK(map[string]interface{}{"dry_run": false, "leaderboards": cleared})
+}
+
+// countLeaderboardRecords counts the records in a leaderboard's current period
+func countLeaderboardRecords(ctx context.Context, nk runtime.NakamaModule, leaderboardID string) (int, error) {
+	count := 0
+	cursor := ""
+	for {
+		records, _, next, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, clearCountBatch, cursor, 0)
+		if err != nil {
+			return 0, err
+		}
+		count += len(records)
+		if next == "" {
+			return count, nil
+		}
+		cursor = next
 	}
+}
 
-	return string(responseBytes), nil
+// recordOwnerIDs returns the owners of leaderboard records, in order
+func recordOwnerIDs(records []*api.LeaderboardRecord) []string {
+	ownerIDs := make([]string, len(records))
+	for i, record := range records {
+		ownerIDs[i] = record.OwnerId
+	}
+	return ownerIDs
 }
 
 // getUserStats retrieves user statistics from storage
 func getUserStats(ctx context.Context, nk runtime.NakamaModule, userID string) (*PlayerStats, error) {
-	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{
-		{
-			Collection: "user_stats",
-			Key:        "stats",
-			UserID:     userID,
-		},
-	})
+	stats, err := getUsersStats(ctx, nk, []string{userID})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read user stats: %w", err)
+		return nil, err
 	}
+	return stats[userID], nil
+}
 
-	if len(objects) == 0 {
-		return &PlayerStats{}, nil
+// getUsersStats reads the statistics of several users in a single storage call.
+// Users without stored stats get the stats of a new player.
+func getUsersStats(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]*PlayerStats, error) {
+	stored, _, err := loadUserStats(ctx, nk, userIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	var stats map[string]interface{}
-	if err := json.Unmarshal([]byte(objects[0].Value), &stats); err != nil {
-		return &PlayerStats{}, nil
+	stats := make(map[string]*PlayerStats, len(stored))
+	for userID, userStats := range stored {
+		stats[userID] = userStats.playerStats(userID)
 	}
+	return stats, nil
+}
 
-	playerStats := &PlayerStats{
-		UserID: userID,
+// UpdateLeaderboard updates leaderboard with game results, writing the player's
+// details as record metadata. stats are the player's stats after the game.
+func UpdateLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, stats *UserStats, delta int64, result GameResult) error {
+	// Stats carry the username from sign-up; older accounts may predate that
+	username := stats.Username
+	if username == "" {
+		if users, err := nk.UsersGetId(ctx, []string{userID}, nil); err != nil {
+			logger.Warn("Failed to get username for user %s: %v", userID, err)
+		} else if len(users) > 0 {
+			username = users[0].Username
+		}
 	}
 
-	if username, ok := stats["username"].(string); ok {
-		playerStats.Username = username
-	}
-	if gamesWon, ok := stats["games_won"].(float64); ok {
-		playerStats.GamesWon = int(gamesWon)
+	// Main leaderboard holds the player's current rating and all-time results
+	if err := writeRatingRecord(ctx, nk, userID, username, stats); err != nil {
+		return err
 	}
-	if gamesLost, ok := stats["games_lost"].(float64); ok {
-		playerStats.GamesLost = int(gamesLost)
+	// Placement games swing the rating too far to rank on; the game that
+	// completes placements puts the player on the main board at their rating
+	if stats.provisional() {
+		logger.Info("User %s (%s) is in placements (%d/%d), rating %d (%+d)", userID, username, stats.placementGamesPlayed(), config.PlacementGames, stats.Rating, delta)
+		return nil
 	}
-	if gamesDrawn, ok := stats["games_drawn"].(float64); ok {
-		playerStats.GamesDrawn = int(gamesDrawn)
+
+	// Weekly and season (monthly) leaderboards accumulate rating gained this
+	// period, with the period's results stored alongside
+	periodIDs := []string{config.WeeklyLeaderboardID, config.SeasonLeaderboardID}
+	ends, err := periodEnds(ctx, nk, periodIDs)
+	if err != nil {
+		logger.Warn("Failed to read leaderboard periods for user %s: %v", userID, err)
+	}
+	for _, leaderboardID := range periodIDs {
+		// Without the period's results, readers fall back to storage for this player
+		var periodMetadata map[string]interface{}
+		if end, ok := ends[leaderboardID]; ok {
+			period, err := recordPeriodStats(ctx, logger, nk, leaderboardID, userID, end, result)
+			if err != nil {
+				logger.Warn("Failed to update %s stats for user %s: %v", leaderboardID, userID, err)
+			} else {
+				periodMetadata = RecordMetadata{
+					Username:    username,
+					Rating:      stats.Rating,
+					WinStreak:   stats.WinStreak,
+					GamesPlayed: period.GamesPlayed,
+					GamesWon:    period.GamesWon,
+					GamesLost:   period.GamesLost,
+					GamesDrawn:  period.GamesDrawn,
+				}.toMap()
+			}
+		}
+		if _, err := leaderboardRecordWrite(ctx, nk, leaderboardID, userID, username, delta, 0, periodMetadata, nil); err != nil {
+			return fmt.Errorf("failed to update %s: %w", leaderboardID, err)
+		}
 	}
-	if gamesPlayed, ok := stats["games_played"].(float64); ok {
-		playerStats.GamesPlayed = int(gamesPlayed)
+
+	logger.Info("Updated leaderboards for user %s (%s): rating %d (%+d)", userID, username, stats.Rating, delta)
+	announceNewLeader(ctx, logger, nk, userID, username, stats.Rating)
+	return nil
+}
+
+// writeRatingRecord sets a player's main leaderboard record to their rating,
+// with their all-time results as metadata. Provisional players are kept off the
+// board, so any record they have is removed instead.
+func writeRatingRecord(ctx context.Context, nk runtime.NakamaModule, userID, username string, stats *UserStats) error {
+	if stats.provisional() {
+		if err := nk.LeaderboardRecordDelete(ctx, config.LeaderboardID, userID); err != nil {
+			return fmt.Errorf("failed to remove provisional player from main leaderboard: %w", err)
+		}
+		return nil
 	}
-	if totalScore, ok := stats["total_score"].(float64); ok {
-		playerStats.Score = int64(totalScore)
+
+	metadata := RecordMetadata{
+		Username:    username,
+		Rating:      stats.Rating,
+		WinStreak:   stats.WinStreak,
+		GamesPlayed: stats.GamesPlayed,
+		GamesWon:    stats.GamesWon,
+		GamesLost:   stats.GamesLost,
+		GamesDrawn:  stats.GamesDrawn,
 	}
-	if createdAt, ok := stats["created_at"].(float64); ok {
-		playerStats.CreatedAt = int64(createdAt)
+	if _, err := leaderboardRecordWrite(ctx, nk, config.LeaderboardID, userID, username, stats.Rating, 0, metadata.toMap(), &setOperator); err != nil {
+		return fmt.Errorf("failed to update main leaderboard: %w", err)
 	}
-
-	return playerStats, nil
+	return nil
 }
 
-// UpdateLeaderboard updates leaderboard with game results
-func UpdateLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, score int64) error {
-	// Get user information including username
-	users, err := nk.UsersGetId(ctx, []string{userID}, []string{})
-	if err != nil {
-		logger.Error("Failed to get user info for user %s: %v", userID, err)
-		// Continue without username if we can't get it
+// toMap returns the metadata in the form LeaderboardRecordWrite takes
+func (m RecordMetadata) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"username":     m.Username,
+		"rating":       m.Rating,
+		"win_streak":   m.WinStreak,
+		"games_played": m.GamesPlayed,
+		"games_won":    m.GamesWon,
+		"games_lost":   m.GamesLost,
+		"games_drawn":  m.GamesDrawn,
 	}
+}
 
-	username := ""
-	if len(users) > 0 {
-		username = users[0].Username
-		logger.Info("Retrieved username for user %s: %s", userID, username)
-	} else {
-		logger.Warn("No user found for ID %s", userID)
+// recordMetadata parses the metadata of a record. Records written before
+// metadata was added, or whose period results failed to save, have none.
+func recordMetadata(record *api.LeaderboardRecord) (*RecordMetadata, bool) {
+	var metadata RecordMetadata
+	if err := json.Unmarshal([]byte(record.GetMetadata()), &metadata); err != nil || metadata.GamesPlayed == 0 {
+		return nil, false
 	}
+	return &metadata, true
+}
 
-	// Update main leaderboard
-	_, err = nk.LeaderboardRecordWrite(ctx, "ttt_leaderboard", userID, username, score, 0, nil, nil)
-	if err != nil {
-		return fmt.Errorf("failed to update main leaderboard: %w", err)
+// recordEntry converts a leaderboard record, filling in results from its
+// metadata. It reports whether the record had any.
+func recordEntry(record *api.LeaderboardRecord) (LeaderboardEntry, bool) {
+	entry := LeaderboardEntry{
+		UserID:   record.OwnerId,
+		Username: record.Username.GetValue(),
+		Score:    record.Score,
+		Rank:     int(record.Rank),
+	}
+	metadata, ok := recordMetadata(record)
+	if !ok {
+		return entry, false
+	}
+	if entry.Username == "" {
+		entry.Username = metadata.Username
+	}
+	entry.Rating = metadata.Rating
+	entry.WinStreak = metadata.WinStreak
+	entry.GamesWon = metadata.GamesWon
+	entry.GamesLost = metadata.GamesLost
+	entry.GamesDrawn = metadata.GamesDrawn
+	entry.WinRate = float64(metadata.GamesWon) / float64(metadata.GamesPlayed) * 100
+	return entry, true
+}
+
+// leaderboardEntries converts leaderboard records using their metadata. Only
+// players whose records have none are looked up in storage: their all-time stats
+// on the main board, their results this period on the weekly and monthly ones.
+func leaderboardEntries(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, leaderboardID string, records []*api.LeaderboardRecord) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, len(records))
+	complete := make([]bool, len(records))
+	missing := make([]string, 0)
+	for i, record := range records {
+		entries[i], complete[i] = recordEntry(record)
+		if !complete[i] {
+			missing = append(missing, record.OwnerId)
+		}
+	}
+	if len(missing) == 0 {
+		return entries
 	}
 
-	// Update weekly leaderboard
-	_, err = nk.LeaderboardRecordWrite(ctx, "ttt_weekly_leaderboard", userID, username, score, 0, nil, nil)
+	allStats, err := getUsersStats(ctx, nk, missing)
 	if err != nil {
-		return fmt.Errorf("failed to update weekly leaderboard: %w", err)
+		logger.Error("Failed to get stats for leaderboard players: %v", err)
+		allStats = nil
+	}
+	var periodStats map[string]*PeriodStats
+	if leaderboardID != config.LeaderboardID {
+		if periodStats, _, err = loadPeriodStats(ctx, nk, leaderboardID, missing); err != nil {
+			logger.Error("Failed to get %s stats for leaderboard players: %v", leaderboardID, err)
+			periodStats = nil
+		}
 	}
 
-	logger.Info("Updated leaderboards for user %s (%s) with score %d", userID, username, score)
-	return nil
+	for i, record := range records {
+		stats, ok := allStats[record.OwnerId]
+		if complete[i] || !ok {
+			continue
+		}
+		entry := &entries[i]
+		entry.Rating = stats.Score
+		entry.WinStreak = stats.WinStreak
+		games := &PeriodStats{GamesPlayed: stats.GamesPlayed, GamesWon: stats.GamesWon, GamesLost: stats.GamesLost, GamesDrawn: stats.GamesDrawn}
+		if leaderboardID != config.LeaderboardID {
+			games, ok = periodStats[record.OwnerId]
+			if !ok || games.ExpiresAt != record.GetExpiryTime().GetSeconds() {
+				continue
+			}
+		}
+		entry.GamesWon = games.GamesWon
+		entry.GamesLost = games.GamesLost
+		entry.GamesDrawn = games.GamesDrawn
+		if games.GamesPlayed > 0 {
+			entry.WinRate = float64(games.GamesWon) / float64(games.GamesPlayed) * 100
+		}
+	}
+	return entries
 }
 
 // GetPlayerRank returns a player's current rank
 func GetPlayerRank(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) (int, error) {
-	leaderboardID := "ttt_leaderboard"
-	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, []string{userID}, 1, "", 0)
+	record, err := playerRecord(ctx, nk, config.LeaderboardID, userID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get player rank: %w", err)
 	}
-
-	if len(records) == 0 {
+	if record == nil {
 		return 0, fmt.Errorf("player not found in leaderboard")
 	}
+	return int(record.Rank), nil
+}
 
-	// Get all records to calculate rank
-	allRecords, _, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, 1000, "", 0)
+// playerRecord returns a player's own record on a leaderboard, ranked by Nakama,
+// or nil if they have none
+func playerRecord(ctx context.Context, nk runtime.NakamaModule, leaderboardID, userID string) (*api.LeaderboardRecord, error) {
+	// Owner records come back separately from the page of top records
+	_, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, []string{userID}, 1, "", 0)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get all records: %w", err)
+		return nil, err
 	}
-
-	// Sort by score to find rank
-	sort.Slice(allRecords, func(i, j int) bool {
-		return allRecords[i].Score > allRecords[j].Score
-	})
-
-	for i, record := range allRecords {
+	for _, record := range ownerRecords {
 		if record.OwnerId == userID {
-			return i + 1, nil
+			return record, nil
 		}
 	}
-
-	return 0, fmt.Errorf("player rank not found")
+	return nil, nil
 }
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Identity providers link_account accepts
+	LinkProviderEmail  = "email"
+	LinkProviderGoogle = "google"
+	LinkProviderApple  = "apple"
+)
+
+// LinkAccountRequest represents link_account request
+type LinkAccountRequest struct {
+	Provider string `json:"provider"` // email, google, or apple
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"` // ID token for google and apple
+	Merge    bool   `json:"merge,omitempty"` // confirm merging into an account that already has the identity
+}
+
+// InitAccountLinking registers the account linking RPC
+func InitAccountLinking(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("link_account", withRateLimit(authLimiter, linkAccountRPC)); err != nil {
+		return fmt.Errorf("failed to register link_account RPC: %w", err)
+	}
+
+	logger.Info("Account linking initialized")
+	return nil
+}
+
+// linkAccountRPC attaches an email or social identity to the caller's account.
+// If another account already has the identity, the caller must prove they own it
+// and confirm with merge, and their progress is then moved into that account.
+func linkAccountRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	var request LinkAccountRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	var linkErr error
+	switch request.Provider {
+	case LinkProviderEmail:
+		if request.Email == "" || request.Password == "" {
+			return "", rpcError(CodeInvalidArgument, "email and password are required")
+		}
+		linkErr = nk.LinkEmail(ctx, userID, request.Email, request.Password)
+	case LinkProviderGoogle:
+		if request.Token == "" {
+			return "", rpcError(CodeInvalidArgument, "token is required")
+		}
+		linkErr = nk.LinkGoogle(ctx, userID, request.Token)
+	case LinkProviderApple:
+		if request.Token == "" {
+			return "", rpcError(CodeInvalidArgument, "token is required")
+		}
+		linkErr = nk.LinkApple(ctx, userID, request.Token)
+	default:
+		return "", rpcErrorf(CodeInvalidArgument, "provider must be %s, %s, or %s", LinkProviderEmail, LinkProviderGoogle, LinkProviderApple)
+	}
+	if linkErr == nil {
+		logger.Info("User %s linked %s identity", userID, request.Provider)
+		return rpcOK(map[string]interface{}{"linked": true, "merged": false, "user_id": userID, "username": username})
+	}
+
+	// Linking fails when another account has the identity. Signing in without
+	// creating proves the caller owns that account and tells us which one it is.
+	targetID, targetName, err := existingAccount(ctx, nk, request)
+	if err != nil {
+		return "", rpcErrorf(CodeFailedPrecondition, "failed to link account: %v", linkErr)
+	}
+	if targetID == userID {
+		return rpcOK(map[string]interface{}{"linked": true, "merged": false, "user_id": userID, "username": username})
+	}
+
+	// Merging deletes the caller's account, so only a guest may be merged away
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to read account: %v", err)
+	}
+	if !isGuestAccount(account) {
+		return "", rpcErrorf(CodeFailedPrecondition, "this %s identity belongs to %s, and only guest accounts can be merged into another account", request.Provider, targetName)
+	}
+	if !request.Merge {
+		return "", rpcErrorf(CodeAlreadyExists, "this %s identity belongs to %s; send merge: true to move your progress into that account", request.Provider, targetName)
+	}
+
+	if err := mergeAccounts(ctx, logger, nk, account, targetID); err != nil {
+		return "", rpcErrorf(CodeAborted, "failed to merge accounts, try again: %v", err)
+	}
+
+	token, expiresAt, err := nk.AuthenticateTokenGenerate(targetID, targetName, time.Now().Add(config.SessionTokenExpiry).Unix(), nil)
+	if err != nil {
+		return "", rpcErrorf(CodeInternal, "accounts merged but failed to issue session token: %v", err)
+	}
+
+	logger.Info("Merged guest %s into %s via %s identity", userID, targetID, request.Provider)
+	return rpcOK(map[string]interface{}{
+		"linked":     true,
+		"merged":     true,
+		"user_id":    targetID,
+		"username":   targetName,
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+// existingAccount returns the account that already has the requested identity,
+// failing unless the credentials sign in to it
+func existingAccount(ctx context.Context, nk runtime.NakamaModule, request LinkAccountRequest) (string, string, error) {
+	var userID, username string
+	var err error
+	switch request.Provider {
+	case LinkProviderEmail:
+		userID, username, _, err = nk.AuthenticateEmail(ctx, request.Email, request.Password, "", false)
+	case LinkProviderGoogle:
+		userID, username, _, err = nk.AuthenticateGoogle(ctx, request.Token, "", false)
+	case LinkProviderApple:
+		userID, username, _, err = nk.AuthenticateApple(ctx, request.Token, "", false)
+	}
+	return userID, username, err
+}
+
+// isGuestAccount reports whether an account signs in with device IDs only
+func isGuestAccount(account *api.Account) bool {
+	user := account.GetUser()
+	return account.GetEmail() == "" && account.GetCustomId() == "" &&
+		user.GetGoogleId() == "" && user.GetAppleId() == "" && user.GetFacebookId() == "" &&
+		user.GetFacebookInstantGameId() == "" && user.GetGamecenterId() == "" && user.GetSteamId() == ""
+}
+
+// mergeAccounts moves a guest's progress into another account and deletes the
+// guest, moving its device IDs over so the guest's devices sign in to the target.
+// Stats, leaderboard records, match history, coins, cosmetics, and badges carry
+// over; quest progress and head-to-head records do not.
+func mergeAccounts(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, account *api.Account, toID string) error {
+	fromID := account.GetUser().GetId()
+
+	// Storage moves in one batch, so a failure leaves both accounts as they were
+	writes, deletes, err := mergeStorage(ctx, nk, fromID, toID)
+	if err != nil {
+		return err
+	}
+	if _, err := nk.StorageWrite(ctx, writes); err != nil {
+		return fmt.Errorf("failed to write merged storage: %w", err)
+	}
+	// Deleting the guest's copies keeps a retry from counting them twice
+	if err := nk.StorageDelete(ctx, deletes); err != nil {
+		return fmt.Errorf("failed to clear guest storage: %w", err)
+	}
+
+	if err := mergeLeaderboards(ctx, nk, fromID, toID); err != nil {
+		return err
+	}
+
+	coins, err := walletCoinBalance(ctx, nk, fromID)
+	if err != nil {
+		return err
+	}
+	if coins > 0 {
+		metadata := map[string]interface{}{"reason": "account_merge", "from": fromID, "to": toID}
+		if _, err := nk.WalletsUpdate(ctx, []*runtime.WalletUpdate{
+			{UserID: fromID, Changeset: map[string]int64{walletCoins: -coins}, Metadata: metadata},
+			{UserID: toID, Changeset: map[string]int64{walletCoins: coins}, Metadata: metadata},
+		}, true); err != nil {
+			return fmt.Errorf("failed to move coins: %w", err)
+		}
+	}
+
+	if err := nk.AccountDeleteId(ctx, fromID, false); err != nil {
+		return fmt.Errorf("failed to delete guest account: %w", err)
+	}
+	for _, device := range account.GetDevices() {
+		if err := nk.LinkDevice(ctx, toID, device.GetId()); err != nil {
+			logger.Error("Failed to move device %s from %s to %s: %v", device.GetId(), fromID, toID, err)
+		}
+	}
+	return nil
+}
+
+// mergeStorage returns the storage writes that add the guest's stats, match
+// history, cosmetics, and badges to the target, and the deletes that clear them from the guest
+func mergeStorage(ctx context.Context, nk runtime.NakamaModule, fromID, toID string) ([]*runtime.StorageWrite, []*runtime.StorageDelete, error) {
+	var writes []*runtime.StorageWrite
+	var deletes []*runtime.StorageDelete
+
+	stats, statsVersions, err := loadUserStats(ctx, nk, []string{fromID, toID})
+	if err != nil {
+		return nil, nil, err
+	}
+	merged := mergeStats(stats[fromID], stats[toID])
+	merged.SchemaVersion = userStatsSchemaVersion
+	value, _ := json.Marshal(merged)
+	writes = append(writes, &runtime.StorageWrite{Collection: userStatsCollection, Key: userStatsKey, UserID: toID, Value: string(value), Version: statsVersions[toID]})
+	deletes = append(deletes, &runtime.StorageDelete{Collection: userStatsCollection, Key: userStatsKey, UserID: fromID})
+
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: badgesCollection, Key: badgesKey, UserID: fromID},
+		{Collection: badgesCollection, Key: badgesKey, UserID: toID},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read badges: %w", err)
+	}
+	badges := map[string][]Badge{}
+	badgesVersion := "*"
+	for _, object := range objects {
+		var value []Badge
+		if err := json.Unmarshal([]byte(object.Value), &value); err == nil {
+			badges[object.UserId] = value
+		}
+		if object.UserId == toID {
+			badgesVersion = object.Version
+		}
+	}
+
+	if len(badges[fromID]) > 0 {
+		value, _ := json.Marshal(append(badges[toID], badges[fromID]...))
+		writes = append(writes, &runtime.StorageWrite{
+			Collection: badgesCollection, Key: badgesKey, UserID: toID, Value: string(value),
+			Version: badgesVersion, PermissionRead: 2, PermissionWrite: 0,
+		})
+		deletes = append(deletes, &runtime.StorageDelete{Collection: badgesCollection, Key: badgesKey, UserID: fromID})
+	}
+
+	inventories, versions, err := loadInventories(ctx, nk, []string{fromID, toID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(inventories[fromID].Owned) > 0 {
+		merged := inventories[toID]
+		for _, itemID := range inventories[fromID].Owned {
+			if !merged.owns(itemID) {
+				merged.Owned = append(merged.Owned, itemID)
+			}
+		}
+		value, _ := json.Marshal(merged)
+		writes = append(writes, &runtime.StorageWrite{
+			Collection: cosmeticsCollection, Key: cosmeticsKey, UserID: toID, Value: string(value),
+			Version: versions[toID], PermissionRead: 2, PermissionWrite: 0,
+		})
+		deletes = append(deletes, &runtime.StorageDelete{Collection: cosmeticsCollection, Key: cosmeticsKey, UserID: fromID})
+	}
+
+	cursor := ""
+	for scanned := 0; scanned < maxHistoryScan; {
+		objects, next, err := nk.StorageList(ctx, "", fromID, matchHistoryCollection, historyPageSize, cursor)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list match history: %w", err)
+		}
+		if len(objects) == 0 {
+			break
+		}
+
+		// Matches the guest played against the target are already in the target's history
+		reads := make([]*runtime.StorageRead, 0, len(objects))
+		for _, object := range objects {
+			reads = append(reads, &runtime.StorageRead{Collection: matchHistoryCollection, Key: object.Key, UserID: toID})
+		}
+		existing, err := storageRead(ctx, nk, reads)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read match history: %w", err)
+		}
+		recorded := make(map[string]bool, len(existing))
+		for _, object := range existing {
+			recorded[object.Key] = true
+		}
+
+		for _, object := range objects {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: matchHistoryCollection, Key: object.Key, UserID: fromID})
+			if recorded[object.Key] {
+				continue
+			}
+			writes = append(writes, &runtime.StorageWrite{
+				Collection: matchHistoryCollection, Key: object.Key, UserID: toID, Value: object.Value,
+				PermissionRead: int(object.PermissionRead), PermissionWrite: int(object.PermissionWrite),
+			})
+		}
+		scanned += len(objects)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	return writes, deletes, nil
+}
+
+// mergeStats combines a guest's stats into the target's. Counters are added;
+// the rating and streaks come from whichever account played more ranked games.
+func mergeStats(from, to *UserStats) *UserStats {
+	merged := *to
+	if from.GamesPlayed > to.GamesPlayed {
+		merged.Rating = from.Rating
+		merged.WinStreak = from.WinStreak
+		merged.LossStreak = from.LossStreak
+	}
+
+	merged.TotalScore += from.TotalScore
+	merged.GamesPlayed += from.GamesPlayed
+	merged.GamesWon += from.GamesWon
+	merged.GamesLost += from.GamesLost
+	merged.GamesDrawn += from.GamesDrawn
+	merged.CasualGamesPlayed += from.CasualGamesPlayed
+	merged.CasualGamesWon += from.CasualGamesWon
+	merged.CasualGamesLost += from.CasualGamesLost
+	merged.CasualGamesDrawn += from.CasualGamesDrawn
+	if from.LongestWinStreak > merged.LongestWinStreak {
+		merged.LongestWinStreak = from.LongestWinStreak
+	}
+	if from.CreatedAt != 0 && (merged.CreatedAt == 0 || from.CreatedAt < merged.CreatedAt) {
+		merged.CreatedAt = from.CreatedAt
+	}
+	return &merged
+}
+
+// mergeLeaderboards moves a guest's leaderboard records to the target: the main
+// board takes the merged rating, and the weekly and season boards add the guest's score
+func mergeLeaderboards(ctx context.Context, nk runtime.NakamaModule, fromID, toID string) error {
+	users, err := nk.UsersGetId(ctx, []string{toID}, nil)
+	if err != nil || len(users) == 0 {
+		return fmt.Errorf("failed to look up account %s: %v", toID, err)
+	}
+	username := users[0].Username
+
+	// A guest without a main board record played no ranked games, so the target's rating stands
+	guestRecord, err := playerRecord(ctx, nk, config.LeaderboardID, fromID)
+	if err != nil {
+		return fmt.Errorf("failed to read guest record on main leaderboard: %w", err)
+	}
+	if guestRecord != nil {
+		ratings, err := loadRatings(ctx, nk, []string{toID})
+		if err != nil {
+			return fmt.Errorf("failed to read merged rating: %w", err)
+		}
+		if _, err := leaderboardRecordWrite(ctx, nk, config.LeaderboardID, toID, username, ratings[toID], 0, nil, &setOperator); err != nil {
+			return fmt.Errorf("failed to update main leaderboard: %w", err)
+		}
+		if err := nk.LeaderboardRecordDelete(ctx, config.LeaderboardID, fromID); err != nil {
+			return fmt.Errorf("failed to delete guest record from main leaderboard: %w", err)
+		}
+	}
+
+	for _, leaderboardID := range []string{config.WeeklyLeaderboardID, config.SeasonLeaderboardID} {
+		record, err := playerRecord(ctx, nk, leaderboardID, fromID)
+		if err != nil {
+			return fmt.Errorf("failed to read guest record on %s: %w", leaderboardID, err)
+		}
+		if record == nil {
+			continue
+		}
+		if _, err := leaderboardRecordWrite(ctx, nk, leaderboardID, toID, username, record.Score, 0, nil, nil); err != nil {
+			return fmt.Errorf("failed to update %s: %w", leaderboardID, err)
+		}
+		if err := nk.LeaderboardRecordDelete(ctx, leaderboardID, fromID); err != nil {
+			return fmt.Errorf("failed to delete guest record from %s: %w", leaderboardID, err)
+		}
+	}
+	return nil
+}
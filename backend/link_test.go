@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestIsGuestAccount(t *testing.T) {
+	devices := []*api.AccountDevice{{Id: "device-1"}}
+	tests := []struct {
+		name    string
+		account *api.Account
+		want    bool
+	}{
+		{"device only", &api.Account{User: &api.User{Id: "user-1"}, Devices: devices}, true},
+		{"email", &api.Account{User: &api.User{Id: "user-1"}, Devices: devices, Email: "ada@example.com"}, false},
+		{"google", &api.Account{User: &api.User{Id: "user-1", GoogleId: "g-1"}}, false},
+		{"apple", &api.Account{User: &api.User{Id: "user-1", AppleId: "a-1"}}, false},
+		{"custom ID", &api.Account{User: &api.User{Id: "user-1"}, CustomId: "c-1"}, false},
+	}
+	for _, tt := range tests {
+		if got := isGuestAccount(tt.account); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMergeStorageKeepsTheTargetsRecordOfSharedMatches(t *testing.T) {
+	nk := newMemoryNakama()
+	ctx := context.Background()
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{Collection: matchHistoryCollection, Key: "shared", UserID: "guest", Value: `{"result": "win"}`},
+		{Collection: matchHistoryCollection, Key: "guest-only", UserID: "guest", Value: `{"result": "draw"}`},
+		{Collection: matchHistoryCollection, Key: "shared", UserID: "target", Value: `{"result": "loss"}`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	writes, deletes, err := mergeStorage(ctx, nk, "guest", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nk.StorageWrite(ctx, writes); err != nil {
+		t.Fatal(err)
+	}
+	if err := nk.StorageDelete(ctx, deletes); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := nk.objects[storageID(matchHistoryCollection, "shared", "target")]
+	if shared == nil || shared.Value != `{"result": "loss"}` {
+		t.Errorf("target's record of the shared match became %v", shared)
+	}
+	if nk.objects[storageID(matchHistoryCollection, "guest-only", "target")] == nil {
+		t.Error("guest's other match was not moved to the target")
+	}
+	for _, key := range []string{"shared", "guest-only"} {
+		if nk.objects[storageID(matchHistoryCollection, key, "guest")] != nil {
+			t.Errorf("guest still has match %s", key)
+		}
+	}
+}
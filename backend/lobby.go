@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Open matches returned by list_open_matches, by default and at most
+	defaultOpenMatchesLimit = 20
+	maxOpenMatchesLimit     = 100
+
+	// Seconds an open match may sit with nobody in it before it closes
+	openMatchEmptySeconds = 60
+)
+
+// MatchLabel represents the label of a match, queried by list_open_matches
+type MatchLabel struct {
+	Mode      string `json:"mode"`
+	State     string `json:"state"`
+	Players   int    `json:"players"`
+	Size      int    `json:"size"`
+	WinLength int    `json:"win_length"`
+	Ranked    bool   `json:"ranked"`
+	Public    bool   `json:"public"`
+	Private   bool   `json:"private,omitempty"`
+	Open      int    `json:"open"` // 1 while a public match is waiting for a second player
+}
+
+// CreateOpenMatchRequest represents create_open_match request
+type CreateOpenMatchRequest struct {
+	Mode      string `json:"mode"`
+	Size      int    `json:"size,omitempty"`
+	WinLength int    `json:"win_length,omitempty"`
+}
+
+// ListOpenMatchesRequest represents list_open_matches request
+type ListOpenMatchesRequest struct {
+	Mode  string `json:"mode,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// OpenMatch represents a public match waiting for an opponent
+type OpenMatch struct {
+	MatchID   string `json:"match_id"`
+	Mode      string `json:"mode"`
+	Size      int    `json:"size"`
+	WinLength int    `json:"win_length"`
+	Players   int    `json:"players"`
+}
+
+// InitLobby registers the lobby RPCs
+func InitLobby(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("create_open_match", createOpenMatchRPC); err != nil {
+		return fmt.Errorf("failed to register create_open_match RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("list_open_matches", listOpenMatchesRPC); err != nil {
+		return fmt.Errorf("failed to register list_open_matches RPC: %w", err)
+	}
+
+	logger.Info("Lobby initialized")
+	return nil
+}
+
+// createOpenMatchRPC creates a casual match listed in the lobby until a second player joins
+func createOpenMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request CreateOpenMatchRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.Mode == "" {
+		request.Mode = GameModeClassic
+	}
+	if !isQueueableMode(request.Mode, time.Now()) {
+		return "", rpcErrorf(CodeInvalidArgument, "mode %s is not available", request.Mode)
+	}
+	gameMode, _ := lookupGameMode(request.Mode)
+	size, winLength, err := boardVariant(gameMode, request.Size, request.WinLength)
+	if err != nil {
+		return "", rpcError(CodeInvalidArgument, err.Error())
+	}
+
+	if err := checkBan(ctx, logger, nk, userID); err != nil {
+		return "", err
+	}
+
+	// Players pick their opponent from the lobby, so open matches are casual
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+		"mode":       request.Mode,
+		"size":       size,
+		"win_length": winLength,
+		"ranked":     false,
+		"public":     true,
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to create match: %v", err)
+	}
+
+	logger.Info("User %s created open %s match %s", userID, request.Mode, matchID)
+	return rpcOK(OpenMatch{
+		MatchID:   matchID,
+		Mode:      request.Mode,
+		Size:      size,
+		WinLength: winLength,
+	})
+}
+
+// listOpenMatchesRPC lists public matches waiting for a second player
+func listOpenMatchesRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request ListOpenMatchesRequest
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultOpenMatchesLimit
+	}
+	if request.Limit > maxOpenMatchesLimit {
+		request.Limit = maxOpenMatchesLimit
+	}
+
+	query := "+label.open:1"
+	if request.Mode != "" {
+		if _, ok := gameModesByName[request.Mode]; !ok {
+			return "", rpcErrorf(CodeInvalidArgument, "unknown mode %s", request.Mode)
+		}
+		query += " +label.mode:" + request.Mode
+	}
+
+	maxSize := 1
+	matches, err := nk.MatchList(ctx, request.Limit, true, "", nil, &maxSize, query)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to list matches: %v", err)
+	}
+
+	open := make([]OpenMatch, 0, len(matches))
+	for _, match := range matches {
+		var label MatchLabel
+		if err := json.Unmarshal([]byte(match.GetLabel().GetValue()), &label); err != nil {
+			continue
+		}
+		open = append(open, OpenMatch{
+			MatchID:   match.GetMatchId(),
+			Mode:      label.Mode,
+			Size:      label.Size,
+			WinLength: label.WinLength,
+			Players:   label.Players,
+		})
+	}
+
+	return rpcOK(map[string]interface{}{"matches": open})
+}
+
+// matchLabel returns the label describing a match's mode, state, and privacy
+func matchLabel(match *TTTMatch) string {
+	label := MatchLabel{
+		Mode:      match.Mode,
+		State:     match.State,
+		Players:   len(match.Players),
+		Size:      match.Size,
+		WinLength: match.WinLength,
+		Ranked:    match.Ranked,
+		Public:    match.Public,
+		Private:   match.PrivateCode != "",
+	}
+	if match.Public && match.State == GameStateWaiting && len(match.Players) < 2 {
+		label.Open = 1
+	}
+	encoded, _ := json.Marshal(label)
+	return string(encoded)
+}
+
+// updateLabel republishes the match label if anything in it changed
+func (h *TTTMatchHandler) updateLabel(logger runtime.Logger, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	label := matchLabel(match)
+	if label == match.Label {
+		return
+	}
+	if err := dispatcher.MatchLabelUpdate(label); err != nil {
+		logger.Warn("Failed to update match label: %v", err)
+		return
+	}
+	match.Label = label
+}
+
+// openMatchAbandoned reports whether an open match has been empty long enough to close
+func openMatchAbandoned(match *TTTMatch) bool {
+	if !match.Public || match.State != GameStateWaiting || len(match.Presences) > 0 {
+		match.EmptySince = 0
+		return false
+	}
+	if match.EmptySince == 0 {
+		match.EmptySince = match.Tick
+	}
+	return match.Tick-match.EmptySince >= int64(openMatchEmptySeconds*match.TickRate)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Module log levels, lowest first
+const (
+	LogLevelDebug int32 = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// logLevelNames maps the LOG_LEVEL runtime env value to a level
+var logLevelNames = map[string]int32{
+	"debug": LogLevelDebug,
+	"info":  LogLevelInfo,
+	"warn":  LogLevelWarn,
+	"error": LogLevelError,
+}
+
+// moduleLogLevel is the minimum level this module logs at
+var moduleLogLevel = LogLevelInfo
+
+// configureLogLevel applies the LOG_LEVEL runtime env setting, if any
+func configureLogLevel(ctx context.Context, logger runtime.Logger) {
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	name := strings.ToLower(env["LOG_LEVEL"])
+	if name == "" {
+		return
+	}
+
+	level, ok := logLevelNames[name]
+	if !ok {
+		logger.Warn("Ignoring unknown LOG_LEVEL %q", name)
+		return
+	}
+	atomic.StoreInt32(&moduleLogLevel, level)
+	logger.Info("Module log level set to %s", name)
+}
+
+// leveledLogger drops messages below the module log level
+type leveledLogger struct {
+	runtime.Logger
+}
+
+// withLogLevel wraps a logger so it honours the module log level
+func withLogLevel(logger runtime.Logger) runtime.Logger {
+	if _, ok := logger.(leveledLogger); ok {
+		return logger
+	}
+	return leveledLogger{logger}
+}
+
+func enabled(level int32) bool {
+	return atomic.LoadInt32(&moduleLogLevel) <= level
+}
+
+func (l leveledLogger) Debug(format string, v ...interface{}) {
+	if enabled(LogLevelDebug) {
+		l.Logger.Debug(format, v...)
+	}
+}
+
+func (l leveledLogger) Info(format string, v ...interface{}) {
+	if enabled(LogLevelInfo) {
+		l.Logger.Info(format, v...)
+	}
+}
+
+func (l leveledLogger) Warn(format string, v ...interface{}) {
+	if enabled(LogLevelWarn) {
+		l.Logger.Warn(format, v...)
+	}
+}
+
+func (l leveledLogger) Error(format string, v ...interface{}) {
+	if enabled(LogLevelError) {
+		l.Logger.Error(format, v...)
+	}
+}
+
+func (l leveledLogger) WithField(key string, v interface{}) runtime.Logger {
+	return leveledLogger{l.Logger.WithField(key, v)}
+}
+
+func (l leveledLogger) WithFields(fields map[string]interface{}) runtime.Logger {
+	return leveledLogger{l.Logger.WithFields(fields)}
+}
+
+// matchLogger tags log lines with the match ID, mode, and tick
+func matchLogger(logger runtime.Logger, match *TTTMatch, tick int64) runtime.Logger {
+	return withLogLevel(logger).WithFields(map[string]interface{}{
+		"match_id": match.ID,
+		"mode":     match.Mode,
+		"tick":     tick,
+	})
+}
+
+// rpcLogger tags log lines with the calling user's ID, if any
+func rpcLogger(ctx context.Context, logger runtime.Logger) runtime.Logger {
+	logger = withLogLevel(logger)
+	if userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); ok && userID != "" {
+		return logger.WithField("user_id", userID)
+	}
+	return logger
+}
@@ -6,19 +6,86 @@ import (
 	"fmt"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
 )
 
 const (
 	// Game modes
 	GameModeClassic  = "classic"  // 3x3 board
 	GameModeAdvanced = "advanced" // 5x5 board
+	GameModeBlitz    = "blitz"    // 3x3 board, 60 seconds on each player's game clock
 
 	// Opcodes
-	OpcodeMove        = 1
-	OpcodeState       = 2
-	OpcodeError       = 3
-	OpcodeMatchFound  = 4
-	OpcodeLeaderboard = 5
+	OpcodeMove          = 1
+	OpcodeState         = 2
+	OpcodeError         = 3
+	OpcodeMatchFound    = 4
+	OpcodeLeaderboard   = 5
+	OpcodeResyncRequest = 6
+	OpcodeReplayRequest = 7
+	OpcodeHintRequest   = 8
+	OpcodeHint          = 9
+	OpcodeAnnouncement  = 10
+	OpcodeAck           = 11
+	OpcodeRematchOffer  = 12
+	OpcodeRematchAccept = 13
+	OpcodeGameOver      = 14
+	OpcodeChat          = 15
+	OpcodeEmote         = 16
+	OpcodeChatHistory   = 17
+	OpcodeAfkWarning    = 18
+	OpcodeUndoRequest   = 19
+	OpcodeUndoAccept    = 20
+
+	// Error codes sent in ErrorData so clients can react without parsing messages
+	ErrInvalidMessage     = "invalid_message"
+	ErrNotPlaying         = "not_playing"
+	ErrNotInMatch         = "not_in_match"
+	ErrNotYourTurn        = "not_your_turn"
+	ErrCellOccupied       = "cell_occupied"
+	ErrOutOfBounds        = "out_of_bounds"
+	ErrColumnFull         = "column_full"
+	ErrInvalidSymbol      = "invalid_symbol"
+	ErrHintUnavailable    = "hint_unavailable"
+	ErrRematchUnavailable = "rematch_unavailable"
+	ErrSpectator          = "spectator"
+	ErrRateLimited        = "rate_limited"
+	ErrUndoUnavailable    = "undo_unavailable"
+	ErrInternal           = "internal"
+
+	// Notification codes
+	NotificationMatchCreated      = 1
+	NotificationAnnouncement      = 2
+	NotificationChallenge         = 3
+	NotificationChallengeDeclined = 4
+	NotificationSeasonReward      = 5
+	NotificationPartyInvite       = 6
+	NotificationYourTurn          = 7
+
+	// Number of recent broadcasts kept per match for replay
+	replayBufferSize = 64
+
+	// Hints each player may request per casual game; matches may set hint_budget
+	defaultHintBudget = 3
+
+	// Join roles, passed as the "role" join metadata; players is the default
+	RolePlayer    = "player"
+	RoleSpectator = "spectator"
+
+	// Spectators allowed to watch a single match
+	maxSpectators = 50
+
+	// Seconds a player who left a game in progress has to reconnect before forfeiting
+	disconnectGraceSeconds = 15
+
+	// Reasons a game ended, sent with OpcodeGameOver. Only those other than on
+	// the board (forfeit, timeout, afk, admin) are kept in the match.
+	EndReasonLine    = "line"
+	EndReasonDraw    = "draw"
+	EndReasonForfeit = "forfeit" // a player left and didn't reconnect
+	EndReasonTimeout = "timeout" // a player's game clock ran out, or their turn clock too many turns in a row
+	EndReasonAfk     = "afk"     // the player to move sent nothing for too long
+	EndReasonAdmin   = "admin"   // an operator ended the game
 
 	// Game states
 	GameStateWaiting  = "waiting"
@@ -26,30 +93,119 @@ const (
 	GameStateFinished = "finished"
 
 	// Player symbols
-	PlayerX = "X"
-	PlayerO = "O"
-	Empty   = ""
+	PlayerX = rules.X
+	PlayerO = rules.O
+	Empty   = rules.Empty
 )
 
 // MoveData represents a move from client
 type MoveData struct {
-	Row int `json:"row"`
-	Col int `json:"col"`
+	Row       int    `json:"row"`
+	Col       int    `json:"col"`
+	Symbol    string `json:"symbol,omitempty"`     // wild mode only
+	RequestID string `json:"request_id,omitempty"` // client-generated, echoed in errors and acks
 }
 
 // StateData represents game state broadcast
 type StateData struct {
-	Board   [][]string        `json:"board"`
-	Turn    string            `json:"turn"`
-	Winner  string            `json:"winner,omitempty"`
-	Size    int               `json:"size"`
-	Mode    string            `json:"mode"`
-	Players map[string]string `json:"players"` // userID -> symbol
+	Board      [][]string             `json:"board,omitempty"`     // omitted when board_rle is sent
+	BoardRLE   string                 `json:"board_rle,omitempty"` // run-length cells of large boards (protocol 3)
+	Turn       string                 `json:"turn"`
+	Winner     string                 `json:"winner,omitempty"`
+	Size       int                    `json:"size"`
+	WinLength  int                    `json:"win_length"`
+	Mode       string                 `json:"mode"`
+	Ranked     bool                   `json:"ranked"`                   // whether the game moves ratings and the leaderboard
+	Players    map[string]string      `json:"players"`                  // userID -> symbol
+	Cosmetics  map[string]Cosmetics   `json:"cosmetics,omitempty"`      // userID -> equipped cosmetics
+	Profiles   map[string]ProfileCard `json:"profiles,omitempty"`       // userID -> display name and avatar
+	Checksum   string                 `json:"checksum"`                 // hash of board/turn/winner for desync detection
+	TurnLeft   int                    `json:"turn_time_left,omitempty"` // seconds left on the current turn clock
+	Spectators int                    `json:"spectators,omitempty"`     // number of connected spectators
+	Series     *SeriesData            `json:"series,omitempty"`         // best-of-N score; omitted for single games
+	Moves      []MoveRecord           `json:"moves"`                    // every move of the current game, in order
+	First      string                 `json:"first_player,omitempty"`   // userID who moved first (plays X) this game
+	Reason     string                 `json:"reason,omitempty"`         // why the game ended, if not on the board
+	Clocks     map[string]int64       `json:"clocks,omitempty"`         // userID -> milliseconds left on their game clock (blitz)
+	Seq        int64                  `json:"seq"`
+
+	ProtocolVersion int `json:"protocol_version"` // version the server speaks to the recipient
+}
+
+// MoveRecord represents one move in a game's history
+type MoveRecord struct {
+	Number int    `json:"number"` // 1-based move number within the game
+	Symbol string `json:"symbol"` // piece placed; differs from the mover's symbol only in wild mode
+	Row    int    `json:"row"`
+	Col    int    `json:"col"`
+	Player string `json:"player,omitempty"` // userID of the mover
 }
 
 // ErrorData represents error message
 type ErrorData struct {
-	Msg string `json:"msg"`
+	Code         string `json:"code"`
+	Msg          string `json:"msg"`
+	RequestID    string `json:"request_id,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // rate_limited only
+	Seq          int64  `json:"seq"`
+}
+
+// AckData acknowledges an accepted client action
+type AckData struct {
+	RequestID string `json:"request_id"`
+	Seq       int64  `json:"seq"`
+}
+
+// RematchData represents a rematch offer broadcast to the match
+type RematchData struct {
+	OfferedBy string `json:"offered_by"`
+	Seq       int64  `json:"seq"`
+}
+
+// GameOverData represents the summary broadcast once a finished game's results are recorded
+type GameOverData struct {
+	Winner           string                  `json:"winner,omitempty"`    // winning symbol; empty for a draw
+	WinnerID         string                  `json:"winner_id,omitempty"` // userID of the winner
+	Reason           string                  `json:"reason"`              // line, draw, forfeit, timeout, afk, or admin
+	Results          map[string]PlayerResult `json:"results"`             // userID -> that player's outcome
+	RematchAvailable bool                    `json:"rematch_available"`
+	Seq              int64                   `json:"seq"`
+}
+
+// PlayerResult represents one player's outcome of a finished game
+type PlayerResult struct {
+	Result     string `json:"result"`              // win, loss, or draw
+	ScoreDelta int64  `json:"score_delta"`         // leaderboard points gained or lost; 0 for casual games
+	Rating     int64  `json:"rating,omitempty"`    // rating after the game; omitted if it wasn't recorded
+	Placement  bool   `json:"placement,omitempty"` // one of the player's placement games
+}
+
+// HintData represents a suggested move sent to the requesting player
+type HintData struct {
+	Row       int    `json:"row"`
+	Col       int    `json:"col"`
+	Remaining int    `json:"remaining"`
+	RequestID string `json:"request_id,omitempty"`
+	Seq       int64  `json:"seq"`
+}
+
+// HintRequestData represents an optional hint request payload
+type HintRequestData struct {
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// AnnouncementData represents an operator banner shown to players in a match
+type AnnouncementData struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Level   string `json:"level"`
+	Seq     int64  `json:"seq"`
+}
+
+// ReplayRequestData represents a client request to replay broadcasts after a sequence number
+type ReplayRequestData struct {
+	FromSeq   int64  `json:"from_seq"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // MatchFoundData represents match found notification
@@ -75,8 +231,25 @@ type PlayerRanking struct {
 
 // InitModule initializes the Nakama module
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	configureLogLevel(ctx, logger)
+	logger = withLogLevel(logger)
 	logger.Info("Initializing Tic-Tac-Toe module")
 
+	// Load settings from the runtime env before anything reads them
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	applyConfig(cfg)
+
+	// Guard every RPC registered below against panics
+	initializer = recoveringInitializer{initializer}
+
+	// Register auth RPCs and the hooks every auth method and matchmaker ticket goes through
+	if err := InitAuth(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize auth: %w", err)
+	}
+
 	// Register match handler
 	if err := initializer.RegisterMatch("ttt_match", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
 		return &TTTMatchHandler{}, nil
@@ -84,16 +257,171 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return fmt.Errorf("failed to register match: %w", err)
 	}
 
+	// Register the game mode catalogue
+	if err := InitModes(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize game modes: %w", err)
+	}
+
+	// Start result recording workers
+	if err := InitResults(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize result recording: %w", err)
+	}
+
+	// Persist in-flight matches so they can be resumed after a restart
+	if err := InitPersistence(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize match persistence: %w", err)
+	}
+
+	// Provision bot accounts and enable solo play against them
+	if err := InitBots(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize bots: %w", err)
+	}
+
 	// Initialize matchmaking system
 	if err := InitMatchmaking(ctx, logger, db, nk, initializer); err != nil {
 		return fmt.Errorf("failed to initialize matchmaking: %w", err)
 	}
 
+	// Initialize invite-code private matches
+	if err := InitPrivateMatches(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize private matches: %w", err)
+	}
+
+	// Initialize friend challenges
+	if err := InitChallenges(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize challenges: %w", err)
+	}
+
+	// Initialize parties
+	if err := InitParties(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize parties: %w", err)
+	}
+
+	// Initialize the open match lobby
+	if err := InitLobby(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize lobby: %w", err)
+	}
+
+	// Initialize guest account linking
+	if err := InitAccountLinking(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize account linking: %w", err)
+	}
+
+	// Initialize player profiles
+	if err := InitProfiles(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize profiles: %w", err)
+	}
+
+	// Initialize head-to-head records
+	if err := InitHeadToHead(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize head-to-head: %w", err)
+	}
+
+	// Initialize daily and weekly quests
+	if err := InitQuests(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize quests: %w", err)
+	}
+
+	// Initialize cosmetic shop
+	if err := InitShop(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize shop: %w", err)
+	}
+
+	// Initialize recurring tournaments
+	if err := InitTournaments(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize tournaments: %w", err)
+	}
+
+	// Initialize monthly seasons
+	if err := InitSeasons(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize seasons: %w", err)
+	}
+
+	// Initialize player reports and bans
+	if err := InitModeration(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize moderation: %w", err)
+	}
+
+	// Initialize bans from matchmaking and match joins
+	if err := InitBans(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize bans: %w", err)
+	}
+
+	// Initialize admin inspection of live matches
+	if err := InitMatchAdmin(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize match admin: %w", err)
+	}
+
+	// Initialize admin console
+	if err := InitAdmin(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize admin console: %w", err)
+	}
+
+	// Initialize audit log of admin actions
+	if err := InitAuditLog(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize audit log: %w", err)
+	}
+
 	// Initialize leaderboard system
 	if err := InitLeaderboard(ctx, logger, db, nk, initializer); err != nil {
 		return fmt.Errorf("failed to initialize leaderboard: %w", err)
 	}
 
+	// Initialize match history queries
+	if err := InitHistory(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize match history: %w", err)
+	}
+
+	// Initialize position analysis
+	if err := InitSolver(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize solver: %w", err)
+	}
+
+	// Initialize self-play simulation
+	if err := InitSimulation(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize simulation: %w", err)
+	}
+
+	// Initialize live-ops events
+	if err := InitEvents(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize events: %w", err)
+	}
+
+	// Initialize match telemetry
+	if err := InitTelemetry(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize telemetry: %w", err)
+	}
+
+	// Initialize outbound webhooks
+	if err := InitWebhooks(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize webhooks: %w", err)
+	}
+
+	// Initialize Discord announcements
+	if err := InitDiscord(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize Discord announcements: %w", err)
+	}
+
+	// Initialize operator announcements
+	if err := InitAnnouncements(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize announcements: %w", err)
+	}
+
+	// Initialize limited-time mode rotation
+	if err := InitRotation(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize rotation: %w", err)
+	}
+
+	// Initialize user settings (streamer mode)
+	if err := InitSettings(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize settings: %w", err)
+	}
+
+	// Initialize featured match of the day
+	if err := InitFeatured(ctx, logger, db, nk, initializer); err != nil {
+		return fmt.Errorf("failed to initialize featured match: %w", err)
+	}
+
 	logger.Info("Tic-Tac-Toe module initialized successfully")
 	return nil
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// recordingInitializer records the RPCs and hooks registered with it; other
+// registrations are unused
+type recordingInitializer struct {
+	runtime.Initializer
+	rpcs       map[string]rpcFunc
+	hooks      []string
+	afterEmail func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateEmailRequest) error
+}
+
+func (i *recordingInitializer) RegisterRpc(id string, fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error)) error {
+	if i.rpcs == nil {
+		i.rpcs = map[string]rpcFunc{}
+	}
+	i.rpcs[id] = fn
+	return nil
+}
+
+func (i *recordingInitializer) RegisterBeforeRt(id string, fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, envelope *rtapi.Envelope) (*rtapi.Envelope, error)) error {
+	i.hooks = append(i.hooks, "before_rt:"+id)
+	return nil
+}
+
+func (i *recordingInitializer) RegisterAfterAuthenticateDevice(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateDeviceRequest) error) error {
+	i.hooks = append(i.hooks, "after_authenticate_device")
+	return nil
+}
+
+func (i *recordingInitializer) RegisterAfterAuthenticateEmail(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateEmailRequest) error) error {
+	i.hooks = append(i.hooks, "after_authenticate_email")
+	i.afterEmail = fn
+	return nil
+}
+
+func (i *recordingInitializer) RegisterAfterAuthenticateGoogle(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateGoogleRequest) error) error {
+	i.hooks = append(i.hooks, "after_authenticate_google")
+	return nil
+}
+
+func (i *recordingInitializer) RegisterAfterAuthenticateApple(fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateAppleRequest) error) error {
+	i.hooks = append(i.hooks, "after_authenticate_apple")
+	return nil
+}
+
+// rpcNames returns the registered RPC IDs in order
+func (i *recordingInitializer) rpcNames() []string {
+	names := make([]string, 0, len(i.rpcs))
+	for id := range i.rpcs {
+		names = append(names, id)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// discardLogger drops every log line
+type discardLogger struct{}
+
+func (discardLogger) Debug(format string, v ...interface{})                     {}
+func (discardLogger) Info(format string, v ...interface{})                      {}
+func (discardLogger) Warn(format string, v ...interface{})                      {}
+func (discardLogger) Error(format string, v ...interface{})                     {}
+func (l discardLogger) WithField(key string, v interface{}) runtime.Logger      { return l }
+func (l discardLogger) WithFields(fields map[string]interface{}) runtime.Logger { return l }
+func (discardLogger) Fields() map[string]interface{}                            { return nil }
+
+func TestInitAuthRegistersAuthRPCsAndHooks(t *testing.T) {
+	initializer := &recordingInitializer{}
+	if err := InitAuth(context.Background(), discardLogger{}, nil, nil, initializer); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(initializer.rpcNames(), ","), "apple_auth,device_auth,email_auth,google_auth,refresh_session"; got != want {
+		t.Errorf("registered RPCs %s, want %s", got, want)
+	}
+	sort.Strings(initializer.hooks)
+	if got, want := strings.Join(initializer.hooks, ","), "after_authenticate_apple,after_authenticate_device,after_authenticate_email,after_authenticate_google,before_rt:MatchmakerAdd"; got != want {
+		t.Errorf("registered hooks %s, want %s", got, want)
+	}
+}
+
+// TestInitModuleCallsEveryInitializer checks that no InitX function is left
+// out of InitModule, which would silently drop its RPCs and hooks
+func TestInitModuleCallsEveryInitializer(t *testing.T) {
+	files := token.NewFileSet()
+	packages, err := parser.ParseDir(files, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defined := map[string]bool{}
+	called := map[string]bool{}
+	for _, file := range packages["main"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Init") {
+				continue
+			}
+			if fn.Name.Name != "InitModule" {
+				defined[fn.Name.Name] = true
+				continue
+			}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				if call, ok := node.(*ast.CallExpr); ok {
+					if ident, ok := call.Fun.(*ast.Ident); ok {
+						called[ident.Name] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	if len(defined) == 0 {
+		t.Fatal("found no InitX functions")
+	}
+	for name := range defined {
+		if !called[name] {
+			t.Errorf("%s is never called from InitModule", name)
+		}
+	}
+}
+
+func TestAuthRPCsShareOneRateLimit(t *testing.T) {
+	initializer := &recordingInitializer{}
+	if err := InitAuth(context.Background(), discardLogger{}, nil, nil, initializer); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitAccountLinking(context.Background(), discardLogger{}, nil, nil, initializer); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_CLIENT_IP, "198.51.100.7")
+	limited := 0
+	for i, id := range []string{"email_auth", "google_auth", "apple_auth", "device_auth", "refresh_session", "email_auth", "link_account"} {
+		// Malformed payloads are rejected after the limiter takes its token
+		_, err := initializer.rpcs[id](ctx, discardLogger{}, nil, nil, "{")
+		if err != nil && strings.Contains(err.Error(), "rate limited") {
+			if i < int(authLimiter.burst) {
+				t.Fatalf("%s was limited after only %d calls", id, i)
+			}
+			limited++
+		}
+	}
+	if limited == 0 {
+		t.Error("auth RPCs were never rate limited")
+	}
+}
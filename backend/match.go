@@ -1,28 +1,106 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
 )
 
 // TTTMatch represents a Tic-Tac-Toe match
 type TTTMatch struct {
-	ID        string
-	Mode      string
-	Size      int
-	Board     [][]string
-	Turn      string
-	Winner    string
-	State     string
-	Players   map[string]string // userID -> symbol
-	MoveCount int
-	CreatedAt int64
+	ID                  string
+	Mode                string
+	Ranked              bool   // ranked results update the leaderboard; casual ones only casual stats
+	RotationLeaderboard string // temporary leaderboard for limited-time modes
+	Size                int
+	WinLength           int         // pieces in a row needed to win
+	Board               rules.Board // flat row-major cells; converted to rows only for clients
+	Turn                string
+	Winner              string
+	State               string
+	Players             map[string]string           // userID -> symbol
+	Presences           map[string]runtime.Presence // userID -> connected presence
+	Spectators          map[string]runtime.Presence // userID -> watching presence; never seated
+	Clients             map[string]ClientProtocol   // userID -> protocol version and encoding negotiated at join
+	Cosmetics           map[string]Cosmetics        // userID -> equipped cosmetics, loaded after joining
+	Profiles            map[string]ProfileCard      // userID -> display name and avatar, loaded after joining
+	MoveCount           int
+	Moves               []MoveRecord // moves of the current game, in order
+	CreatedAt           int64
+	HintBudget          int                // hints allowed per player per game (casual only)
+	HintsUsed           map[string]int     // userID -> hints used this game
+	HintTurns           map[string]int     // userID -> move count of the turn they last asked for a hint
+	Bots                map[string]bool    // userIDs of seats played by the server
+	BotDifficulty       string             // how bot seats choose their moves
+	BotLevel            int                // strength of an adaptive bot, minBotLevel to maxBotLevel
+	BotSearchStarted    int64              // unix time a background bot search began; 0 when none is running
+	SimulationID        string             // set for matches started by simulate_matches
+	PrivateCode         string             // invite code of a private match, released on terminate
+	Public              bool               // listed in the lobby while waiting for a second player
+	Label               string             // match label last published, queried by list_open_matches
+	EmptySince          int64              // tick an open match was last seen empty; 0 while occupied
+	RestoredFrom        string             // ID of the match this one resumed after a restart
+	Seq                 int64              // sequence number of the last broadcast
+	Outbox              []SequencedMessage // recent broadcasts kept for replay
+	ResultRecorded      bool               // results have been handed off for recording
+	TickRate            int                // match ticks per second
+	Tick                int64              // tick of the current MatchLoop
+	TurnTicks           int64              // ticks allowed per turn (0 disables the clock)
+	TurnStartTick       int64              // tick the current turn started on
+	TurnTimeouts        map[string]int     // userID -> consecutive turns timed out
+	Round               int                // game number within this match, incremented by rematches
+	RematchOffers       map[string]bool    // userIDs who offered a rematch of the finished game
+	BestOf              int                // games in the series; 1 for a single game
+	SeriesGame          int                // game number within the current series
+	SeriesWins          map[string]int     // userID -> games won in the current series
+	NextGameTick        int64              // tick the next series game starts on; 0 if none is pending
+	Disconnected        map[string]int64   // userID -> tick a seated player left the game in progress
+	EndReason           string             // why the game ended other than on the board, e.g. EndReasonForfeit
+	Chat                []ChatMessage      // recent chat, oldest first, kept for players who reconnect
+	AfkTicks            int64              // ticks the player to move may stay idle before forfeiting (0 disables)
+	ClockTicks          int64              // each player's game clock in ticks (0 for untimed modes)
+	Clocks              map[string]int64   // userID -> ticks left on their game clock; missing until their first turn
+	LastActive          map[string]int64   // userID -> tick of the player's last message
+	AfkWarned           map[string]bool    // userIDs warned about inactivity since their last message
+	UndoLimit           int                // moves each player may take back per game (0 disables undo)
+	UndosUsed           map[string]int     // userID -> moves taken back this game
+	UndoRequest         string             // userID waiting on their opponent to accept an undo
+	AllowSelfPlay       bool               // debug matches let a seated player join again from a second session
 }
 
+// SequencedMessage represents a broadcast kept for gap replay
+type SequencedMessage struct {
+	Seq    int64
+	Opcode int64
+	// The message as encoded for each way clients had joined when it was sent;
+	// nil for clients whose protocol version predates the opcode
+	Encoded map[ClientProtocol][]byte
+}
+
+// sequenced is implemented by broadcast payloads that carry a sequence number
+type sequenced interface {
+	setSeq(seq int64)
+}
+
+func (s *StateData) setSeq(seq int64)        { s.Seq = seq }
+func (e *ErrorData) setSeq(seq int64)        { e.Seq = seq }
+func (d *HintData) setSeq(seq int64)         { d.Seq = seq }
+func (a *AnnouncementData) setSeq(seq int64) { a.Seq = seq }
+func (a *AckData) setSeq(seq int64)          { a.Seq = seq }
+func (r *RematchData) setSeq(seq int64)      { r.Seq = seq }
+func (g *GameOverData) setSeq(seq int64)     { g.Seq = seq }
+
 // TTTMatchHandler implements the Match interface
 type TTTMatchHandler struct{}
 
@@ -33,38 +111,203 @@ func (h *TTTMatchHandler) MatchInit(ctx context.Context, logger runtime.Logger,
 		mode = modeParam
 	}
 
-	size := 3
-	if mode == GameModeAdvanced {
-		size = 5
+	gameMode, ok := lookupGameMode(mode)
+	if !ok {
+		logger.Warn("Unknown mode %q, using %s", mode, gameMode.Name)
+	}
+	mode = gameMode.Name
+
+	// size and win_length override the mode's board, e.g. 5 in a row on 7x7
+	size, winLength, err := boardVariant(gameMode, intParam(params, "size", 0), intParam(params, "win_length", 0))
+	if err != nil {
+		logger.Warn("Invalid board for %s, using %dx%d: %v", mode, gameMode.Size, gameMode.WinLength, err)
+		size, winLength = gameMode.Size, gameMode.WinLength
+	}
+
+	// Limited-time modes have their own temporary leaderboard
+	rotationLeaderboard := ""
+	if gameMode.Limited {
+		rotationLeaderboard = currentRotation(time.Now()).LeaderboardID
+		rotationCtx, cancel := context.WithTimeout(ctx, backendCallTimeout)
+		err := ensureRotation(rotationCtx, logger, nk)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to prepare rotation leaderboard: %v", err)
+		}
 	}
 
+	// Bot and private friendly matches pass ranked=false so they only count as casual
+	ranked := true
+	if rankedParam, ok := params["ranked"].(bool); ok {
+		ranked = rankedParam
+	}
+	// Ratings only compare games on the same board, so custom variants are casual
+	if isCustomVariant(gameMode, size, winLength) {
+		ranked = false
+	}
+
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+
 	match := &TTTMatch{
-		ID:        "",
-		Mode:      mode,
-		Size:      size,
-		Board:     make([][]string, size),
-		Turn:      PlayerX,
-		Winner:    "",
-		State:     GameStateWaiting,
-		Players:   make(map[string]string),
-		MoveCount: 0,
-		CreatedAt: time.Now().Unix(),
+		ID:                  matchID,
+		Mode:                mode,
+		Ranked:              ranked,
+		RotationLeaderboard: rotationLeaderboard,
+		Size:                size,
+		WinLength:           winLength,
+		Board:               rules.NewBoardK(size, winLength),
+		Turn:                PlayerX,
+		Winner:              "",
+		State:               GameStateWaiting,
+		Players:             make(map[string]string),
+		Presences:           make(map[string]runtime.Presence),
+		Spectators:          make(map[string]runtime.Presence),
+		Clients:             make(map[string]ClientProtocol),
+		Cosmetics:           make(map[string]Cosmetics),
+		Profiles:            make(map[string]ProfileCard),
+		MoveCount:           0,
+		Moves:               []MoveRecord{},
+		HintBudget:          intParam(params, "hint_budget", defaultHintBudget),
+		HintsUsed:           make(map[string]int),
+		HintTurns:           make(map[string]int),
+		CreatedAt:           time.Now().Unix(),
+		TickRate:            gameMode.TickRate,
+		TurnTicks:           int64(intParam(params, "turn_seconds", config.TurnSeconds) * gameMode.TickRate),
+		ClockTicks:          int64(gameMode.Clock * gameMode.TickRate),
+		Clocks:              make(map[string]int64),
+		TurnTimeouts:        make(map[string]int),
+		Round:               1,
+		RematchOffers:       make(map[string]bool),
+		BestOf:              bestOfParam(logger, params),
+		SeriesGame:          1,
+		SeriesWins:          make(map[string]int),
+		Disconnected:        make(map[string]int64),
+		Chat:                []ChatMessage{},
+		AfkTicks:            int64(intParam(params, "afk_seconds", defaultAfkSeconds) * gameMode.TickRate),
+		LastActive:          make(map[string]int64),
+		AfkWarned:           make(map[string]bool),
+		UndoLimit:           intParam(params, "undo_limit", defaultUndoLimit),
+		UndosUsed:           make(map[string]int),
+		AllowSelfPlay:       params["allow_self_play"] == true,
 	}
 
-	// Initialize empty board
-	for i := range match.Board {
-		match.Board[i] = make([]string, size)
-		for j := range match.Board[i] {
-			match.Board[i][j] = Empty
+	// A game clock replaces the per-turn clock
+	if match.ClockTicks > 0 {
+		match.TurnTicks = 0
+	}
+
+	// Seat server-driven bot players (used by simulate_matches)
+	if bots := stringSliceParam(params, "bots"); len(bots) == 2 {
+		match.Bots = make(map[string]bool, len(bots))
+		match.Players[bots[0]] = PlayerX
+		match.Players[bots[1]] = PlayerO
+		for _, botID := range bots {
+			match.Bots[botID] = true
 		}
+		flipForFirstMove(match)
+		match.State = GameStatePlaying
+	} else if len(bots) == 1 {
+		// Solo play: the bot takes O and waits for the human to join as X
+		match.Bots = map[string]bool{bots[0]: true}
+		match.Players[bots[0]] = PlayerO
+	}
+	match.BotDifficulty = BotHard
+	if difficulty, ok := params["difficulty"].(string); ok && isBotDifficulty(difficulty) {
+		match.BotDifficulty = difficulty
+	}
+	if match.BotDifficulty == BotAdaptive {
+		match.BotLevel = clampBotLevel(intParam(params, "bot_level", startingBotLevel))
+	}
+	if simulationID, ok := params["simulation_id"].(string); ok {
+		match.SimulationID = simulationID
 	}
 
-	logger.Info("Initialized %s match with %dx%d board", mode, size, size)
-	return match, 2, ""
+	// Resume a match lost to a restart from its saved state
+	if restoreFrom, ok := params["restore_from"].(string); ok && restoreFrom != "" {
+		restoreCtx, cancel := context.WithTimeout(ctx, backendCallTimeout)
+		saved, _, err := loadSavedMatch(restoreCtx, nk, restoreFrom)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to load saved match %s: %v", restoreFrom, err)
+		} else if saved != nil {
+			restoreMatch(match, saved)
+			match.RestoredFrom = restoreFrom
+			mode, size = match.Mode, match.Size
+			logger.Info("Restored match %s at move %d", restoreFrom, match.MoveCount)
+		}
+	}
+
+	if code, ok := params["private_code"].(string); ok && code != "" {
+		match.PrivateCode = code
+	}
+	if public, ok := params["public"].(bool); ok {
+		match.Public = public
+	}
+	match.Label = matchLabel(match)
+	recordMatchCreated(nk, match)
+	telemetryMatchCreated(match)
+
+	matchLogger(logger, match, 0).Info("Initialized %s match with %dx%d board, %d in a row to win", mode, size, size, winLength)
+	return match, gameMode.TickRate, match.Label
 }
 
 func (h *TTTMatchHandler) MatchJoinAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presence runtime.Presence, metadata map[string]string) (interface{}, bool, string) {
 	match := state.(*TTTMatch)
+	logger = matchLogger(logger, match, tick)
+
+	// Banned players can't play or watch; the rejection carries the same
+	// structured error as the RPCs
+	if !match.Bots[presence.GetUserId()] {
+		banCtx, cancel := context.WithTimeout(ctx, backendCallTimeout)
+		err := checkBan(banCtx, logger, nk, presence.GetUserId())
+		cancel()
+		if err != nil {
+			return match, false, err.Error()
+		}
+	}
+
+	// Clients say which protocol version they speak, and may ask for protobuf
+	// messages instead of JSON
+	client, reason := joinProtocol(metadata)
+	if reason != "" {
+		return match, false, reason
+	}
+
+	// Private matches only admit people holding the invite code, though seated
+	// players may reconnect without it
+	if _, seated := match.Players[presence.GetUserId()]; !seated && match.PrivateCode != "" && normalizeInviteCode(metadata["code"]) != match.PrivateCode {
+		logger.WithField("user_id", presence.GetUserId()).Warn("Rejected join of a private match without its invite code")
+		return match, false, "Invite code required"
+	}
+
+	// Spectators watch without taking a seat, in any game state
+	if metadata["role"] == RoleSpectator {
+		if _, seated := match.Players[presence.GetUserId()]; seated {
+			return match, false, "Players cannot spectate their own match"
+		}
+		if len(match.Spectators) >= maxSpectators {
+			return match, false, "Too many spectators"
+		}
+		match.Spectators[presence.GetUserId()] = presence
+		match.Clients[presence.GetUserId()] = client
+		logger.WithField("user_id", presence.GetUserId()).Debug("Admitted spectator")
+		return match, true, ""
+	}
+
+	// Seated players may reconnect, e.g. to a match resumed after a restart. In
+	// ranked matches they can't join again from a second session while the first
+	// is still connected, so one account never plays both sides of a game.
+	if _, seated := match.Players[presence.GetUserId()]; seated {
+		if connected, ok := match.Presences[presence.GetUserId()]; ok && connected.GetSessionId() != presence.GetSessionId() && match.Ranked && !match.AllowSelfPlay {
+			logger.WithField("user_id", presence.GetUserId()).Warn("Rejected second session of a seated player")
+			return match, false, "Already playing this match from another session"
+		}
+		match.Clients[presence.GetUserId()] = client
+		go recordSeat(logger, nk, match.ID, presence.GetUserId())
+		telemetryPlayerJoined(match, presence.GetUserId(), true)
+		logger.WithField("user_id", presence.GetUserId()).Debug("Player rejoined")
+		return match, true, ""
+	}
 
 	// Check if match is full
 	if len(match.Players) >= 2 {
@@ -76,18 +319,26 @@ func (h *TTTMatchHandler) MatchJoinAttempt(ctx context.Context, logger runtime.L
 		return match, false, "Match is finished"
 	}
 
-	// Assign player symbol
+	// Assign whichever symbol is still free
 	symbol := PlayerX
-	if len(match.Players) == 1 {
-		symbol = PlayerO
+	for _, taken := range match.Players {
+		if taken == PlayerX {
+			symbol = PlayerO
+		}
 	}
 
 	match.Players[presence.GetUserId()] = symbol
+	match.Clients[presence.GetUserId()] = client
+	go recordSeat(logger, nk, match.ID, presence.GetUserId())
+	telemetryPlayerJoined(match, presence.GetUserId(), false)
+	logger.WithField("user_id", presence.GetUserId()).Debug("Seated player as %s", symbol)
 
 	// Start game if we have 2 players
 	if len(match.Players) == 2 {
+		flipForFirstMove(match)
 		match.State = GameStatePlaying
-		logger.Info("Match started with 2 players")
+		match.TurnStartTick = tick
+		logger.Info("Match started with 2 players, %s moves first", firstPlayer(match))
 	}
 
 	return match, true, ""
@@ -95,9 +346,26 @@ func (h *TTTMatchHandler) MatchJoinAttempt(ctx context.Context, logger runtime.L
 
 func (h *TTTMatchHandler) MatchJoin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
 	match := state.(*TTTMatch)
+	logger = matchLogger(logger, match, tick)
 
 	// Send match found notification
 	for _, presence := range presences {
+		if _, watching := match.Spectators[presence.GetUserId()]; watching {
+			match.Spectators[presence.GetUserId()] = presence
+		} else {
+			match.Presences[presence.GetUserId()] = presence
+			if _, left := match.Disconnected[presence.GetUserId()]; left {
+				delete(match.Disconnected, presence.GetUserId())
+				logger.WithField("user_id", presence.GetUserId()).Info("Player reconnected within the grace period")
+			}
+			if _, loaded := match.Cosmetics[presence.GetUserId()]; !loaded {
+				go loadPlayerCosmetics(logger, nk, match.ID, presence.GetUserId())
+			}
+			if _, loaded := match.Profiles[presence.GetUserId()]; !loaded {
+				go loadPlayerProfile(logger, nk, match.ID, presence.GetUserId())
+			}
+		}
+
 		matchFoundData := MatchFoundData{
 			MatchID: match.ID,
 			Mode:    match.Mode,
@@ -106,33 +374,42 @@ func (h *TTTMatchHandler) MatchJoin(ctx context.Context, logger runtime.Logger,
 		dispatcher.BroadcastMessage(OpcodeMatchFound, matchFoundBytes, []runtime.Presence{presence}, nil, false)
 	}
 
-	// Send current game state to all players
-	stateData := StateData{
-		Board:   match.Board,
-		Turn:    match.Turn,
-		Size:    match.Size,
-		Mode:    match.Mode,
-		Players: match.Players,
-	}
-
-	stateBytes, _ := json.Marshal(stateData)
-	dispatcher.BroadcastMessage(OpcodeState, stateBytes, nil, nil, true)
+	// Send current game state to all players, and recent chat to those joining
+	h.broadcastState(dispatcher, match, nil)
+	h.sendChatHistory(dispatcher, match, presences)
 
 	return match
 }
 
 func (h *TTTMatchHandler) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
 	match := state.(*TTTMatch)
+	logger = matchLogger(logger, match, tick)
 
-	// Remove players
+	// Remove players; spectators leaving don't affect the game. A player who leaves
+	// a game in progress keeps their seat until the grace period runs out, so they
+	// can reconnect or else be recorded as forfeiting.
 	for _, presence := range presences {
+		// A session replaced by the player joining again from another one leaves
+		// without giving up the seat
+		if connected, ok := match.Presences[presence.GetUserId()]; ok && connected.GetSessionId() != presence.GetSessionId() {
+			logger.WithField("user_id", presence.GetUserId()).Debug("Replaced session left match")
+			continue
+		}
+		delete(match.Clients, presence.GetUserId())
+		if _, watching := match.Spectators[presence.GetUserId()]; watching {
+			delete(match.Spectators, presence.GetUserId())
+			logger.WithField("user_id", presence.GetUserId()).Debug("Spectator left match")
+			continue
+		}
+		delete(match.Presences, presence.GetUserId())
+		if match.State == GameStatePlaying {
+			match.Disconnected[presence.GetUserId()] = tick
+			logger.WithField("user_id", presence.GetUserId()).Info("Player left match, forfeiting in %ds unless they return", disconnectGraceSeconds)
+			continue
+		}
 		delete(match.Players, presence.GetUserId())
-	}
-
-	// If game was in progress, mark as finished
-	if match.State == GameStatePlaying {
-		match.State = GameStateFinished
-		logger.Info("Match ended due to player leaving")
+		go clearSeat(logger, nk, match.ID, presence.GetUserId())
+		logger.WithField("user_id", presence.GetUserId()).Info("Player left match")
 	}
 
 	return match
@@ -140,23 +417,259 @@ func (h *TTTMatchHandler) MatchLeave(ctx context.Context, logger runtime.Logger,
 
 func (h *TTTMatchHandler) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, messages []runtime.MatchData) interface{} {
 	match := state.(*TTTMatch)
+	logger = matchLogger(logger, match, tick)
+	match.Tick = tick
 
-	// Process messages
+	// Process messages; a message that panics is skipped so the match survives
 	for _, message := range messages {
-		if message.GetOpCode() == OpcodeMove {
-			h.handleMove(ctx, logger, nk, dispatcher, match, message)
+		// Drop messages not sent by the session that joined as their user
+		if reason := spoofedReason(match, message); reason != "" {
+			logger.WithFields(map[string]interface{}{
+				"user_id":    message.GetUserId(),
+				"session_id": message.GetSessionId(),
+				"opcode":     message.GetOpCode(),
+			}).Warn("Rejected match message: %s", reason)
+			continue
+		}
+
+		// Automatic catch-up requests don't show the player is at the keyboard
+		if opcode := message.GetOpCode(); opcode != OpcodeResyncRequest && opcode != OpcodeReplayRequest {
+			markActive(match, message.GetUserId())
+		}
+		messageLogger := logger.WithField("user_id", message.GetUserId())
+		if !recoverInto(messageLogger, nk, "match_message", func() {
+			h.handleMessage(ctx, messageLogger, nk, dispatcher, match, message)
+		}) {
+			h.sendError(dispatcher, match, message, "", ErrInternal, "Internal error")
 		}
 	}
 
+	// Start the next game of a series once the break is over
+	if seriesPending(match) && tick >= match.NextGameTick && len(match.Players) == 2 {
+		h.startNextSeriesGame(logger, dispatcher, match)
+	}
+
+	// Forfeit the game of a player who didn't come back in time
+	if match.State == GameStatePlaying {
+		h.checkDisconnects(ctx, logger, nk, dispatcher, match)
+	}
+
+	// Run down the game clock of the player to move
+	if match.State == GameStatePlaying {
+		h.runGameClock(ctx, logger, nk, dispatcher, match)
+	}
+
+	// Forfeit the game of a player to move who has gone idle
+	if match.State == GameStatePlaying {
+		h.checkAfk(ctx, logger, nk, dispatcher, match)
+	}
+
+	// Enforce the turn clock
+	if match.State == GameStatePlaying {
+		h.checkTurnClock(ctx, logger, nk, dispatcher, match)
+	}
+
+	// Let a bot seat move once per tick
+	if match.State == GameStatePlaying {
+		recoverInto(logger, nk, "bot_turn", func() {
+			h.playBotTurn(ctx, logger, nk, dispatcher, match)
+		})
+	}
+
+	// Bot-only matches have nobody left to watch the result
+	if match.State == GameStateFinished && !seriesPending(match) && len(match.Bots) > 0 && len(match.Bots) == len(match.Players) {
+		return nil
+	}
+
+	// Close open matches nobody joined, so the lobby doesn't fill with them
+	if openMatchAbandoned(match) {
+		logger.Info("Closing open match left empty for %ds", openMatchEmptySeconds)
+		return nil
+	}
+
+	h.updateLabel(logger, dispatcher, match)
 	return match
 }
 
+// handleMessage dispatches one client message by opcode
+func (h *TTTMatchHandler) handleMessage(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	// Spectators may only catch up on state, never act on the game
+	if _, watching := match.Spectators[message.GetUserId()]; watching {
+		switch message.GetOpCode() {
+		case OpcodeResyncRequest, OpcodeReplayRequest:
+		default:
+			h.sendError(dispatcher, match, message, "", ErrSpectator, "Spectators cannot play")
+			return
+		}
+	}
+
+	switch message.GetOpCode() {
+	case OpcodeMove:
+		h.handleMove(ctx, logger, nk, dispatcher, match, message)
+	case OpcodeResyncRequest:
+		// Client state diverged; resend the authoritative state to the sender only
+		h.broadcastState(dispatcher, match, []runtime.Presence{message})
+	case OpcodeReplayRequest:
+		h.handleReplay(dispatcher, match, message)
+	case OpcodeHintRequest:
+		h.handleHint(logger, nk, dispatcher, match, message)
+	case OpcodeRematchOffer, OpcodeRematchAccept:
+		h.handleRematch(logger, dispatcher, match, message)
+	case OpcodeChat:
+		h.handleChat(dispatcher, match, message)
+	case OpcodeEmote:
+		h.handleEmote(dispatcher, match, message)
+	case OpcodeUndoRequest, OpcodeUndoAccept:
+		h.handleUndo(logger, dispatcher, match, message)
+	default:
+		logger.Warn("Ignoring message with unregistered opcode %d", message.GetOpCode())
+	}
+}
+
+// spoofedReason returns why a message can't have come from the user it names,
+// or "" if it was sent by the session that user joined the match with
+func spoofedReason(match *TTTMatch, message runtime.MatchData) string {
+	presence, joined := match.Presences[message.GetUserId()]
+	if !joined {
+		presence, joined = match.Spectators[message.GetUserId()]
+	}
+	if !joined {
+		return "sender has not joined the match"
+	}
+	if presence.GetSessionId() != message.GetSessionId() {
+		return "sender session does not match the joined presence"
+	}
+	return ""
+}
+
+// handleRematch records a rematch offer (or acceptance) for a finished game and
+// starts the next game once both seats have agreed. Bots always agree.
+func (h *TTTMatchHandler) handleRematch(logger runtime.Logger, dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	userID := message.GetUserId()
+	if _, ok := match.Players[userID]; !ok {
+		h.sendError(dispatcher, match, message, "", ErrNotInMatch, "Player not in match")
+		return
+	}
+	if !rematchAvailable(match) {
+		h.sendError(dispatcher, match, message, "", ErrRematchUnavailable, "Rematch not available")
+		return
+	}
+
+	if message.GetOpCode() == OpcodeRematchAccept && len(match.RematchOffers) == 0 {
+		h.sendError(dispatcher, match, message, "", ErrRematchUnavailable, "No rematch offer to accept")
+		return
+	}
+
+	match.RematchOffers[userID] = true
+	for playerID := range match.Players {
+		if !match.RematchOffers[playerID] && !match.Bots[playerID] {
+			// Still waiting on the other player
+			h.send(dispatcher, match, OpcodeRematchOffer, &RematchData{OfferedBy: userID}, nil)
+			return
+		}
+	}
+
+	h.startRematch(logger, dispatcher, match)
+}
+
+// rematchAvailable reports whether the finished game can be replayed: it isn't
+// a break within a series and both players are still connected (or bots)
+func rematchAvailable(match *TTTMatch) bool {
+	if match.State != GameStateFinished || seriesPending(match) || len(match.Players) < 2 {
+		return false
+	}
+	for userID := range match.Players {
+		if _, connected := match.Presences[userID]; !connected && !match.Bots[userID] {
+			return false
+		}
+	}
+	return true
+}
+
+// startRematch resets the board for another game in the same match, with symbols swapped
+func (h *TTTMatchHandler) startRematch(logger runtime.Logger, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	for userID, symbol := range match.Players {
+		match.Players[userID] = opponentOf(symbol)
+	}
+
+	resetGame(match)
+	match.ResultRecorded = false
+	match.RematchOffers = make(map[string]bool)
+	match.SeriesGame = 1
+	match.SeriesWins = make(map[string]int)
+	match.Round++
+
+	logger.Info("Starting rematch, game %d", match.Round)
+	h.broadcastState(dispatcher, match, nil)
+}
+
+// flipForFirstMove tosses a coin for who plays X, and so moves first, in the
+// opening game. Later games in the match alternate by swapping symbols.
+func flipForFirstMove(match *TTTMatch) {
+	if rand.Intn(2) == 0 {
+		return
+	}
+	for userID, symbol := range match.Players {
+		match.Players[userID] = opponentOf(symbol)
+	}
+}
+
+// firstPlayer returns the user who moves first in the current game
+func firstPlayer(match *TTTMatch) string {
+	return playerWithSymbol(match, PlayerX)
+}
+
+// playerWithSymbol returns the user seated as symbol, or "" if the seat is empty
+func playerWithSymbol(match *TTTMatch, symbol string) string {
+	for userID, seat := range match.Players {
+		if seat == symbol {
+			return userID
+		}
+	}
+	return ""
+}
+
+// resetGame clears the board and per-game state for a new game in the same match
+func resetGame(match *TTTMatch) {
+	match.Board = rules.NewBoardK(match.Size, match.WinLength)
+	match.Turn = PlayerX
+	match.Winner = ""
+	match.State = GameStatePlaying
+	match.MoveCount = 0
+	match.Moves = []MoveRecord{}
+	match.CreatedAt = time.Now().Unix()
+	match.HintsUsed = make(map[string]int)
+	match.HintTurns = make(map[string]int)
+	match.TurnTimeouts = make(map[string]int)
+	match.TurnStartTick = match.Tick
+	match.NextGameTick = 0
+	match.EndReason = ""
+	match.AfkWarned = make(map[string]bool)
+	match.UndosUsed = make(map[string]int)
+	match.UndoRequest = ""
+	match.Clocks = make(map[string]int64)
+}
+
+// resultKey identifies one game of a match, so rematches record separately
+func resultKey(match *TTTMatch) string {
+	if match.Round <= 1 {
+		return match.ID
+	}
+	return fmt.Sprintf("%s.%d", match.ID, match.Round)
+}
+
 func (h *TTTMatchHandler) MatchTerminate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, graceSeconds int) interface{} {
 	match := state.(*TTTMatch)
+	logger = matchLogger(logger, match, tick)
+
+	// Record results only if the game ended without them being handed off already;
+	// an unfinished series has no result yet
+	if match.State == GameStateFinished && match.Winner != "" && !seriesPending(match) {
+		h.finishGame(ctx, logger, nk, match)
+	}
 
-	// Update leaderboard if game was finished
-	if match.State == GameStateFinished && match.Winner != "" {
-		h.updateLeaderboard(ctx, logger, nk, match)
+	if match.PrivateCode != "" {
+		releaseInviteCode(ctx, logger, nk, match.PrivateCode)
 	}
 
 	logger.Info("Match terminated")
@@ -164,67 +677,276 @@ func (h *TTTMatchHandler) MatchTerminate(ctx context.Context, logger runtime.Log
 }
 
 func (h *TTTMatchHandler) MatchSignal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, data string) (interface{}, string) {
-	return state, ""
+	match := state.(*TTTMatch)
+	logger = matchLogger(logger, match, tick)
+
+	var signal MatchSignalData
+	if err := json.Unmarshal([]byte(data), &signal); err != nil {
+		logger.Warn("Ignoring malformed match signal: %v", err)
+		return match, ""
+	}
+
+	switch signal.Type {
+	case SignalAnnouncement:
+		if signal.Announcement == nil {
+			return match, ""
+		}
+		recipients := h.segmentPresences(match, signal.UserIDs)
+		if recipients == nil || len(recipients) > 0 {
+			h.send(dispatcher, match, OpcodeAnnouncement, signal.Announcement, recipients)
+		}
+	case SignalCosmetics:
+		if signal.Cosmetics == nil || len(signal.UserIDs) != 1 {
+			return match, ""
+		}
+		if _, seated := match.Players[signal.UserIDs[0]]; seated {
+			match.Cosmetics[signal.UserIDs[0]] = *signal.Cosmetics
+			h.broadcastState(dispatcher, match, nil)
+		}
+	case SignalProfile:
+		if signal.Profile == nil || len(signal.UserIDs) != 1 {
+			return match, ""
+		}
+		if _, seated := match.Players[signal.UserIDs[0]]; seated {
+			match.Profiles[signal.UserIDs[0]] = *signal.Profile
+			h.broadcastState(dispatcher, match, nil)
+		}
+	case SignalBotMove:
+		h.applyBotSearch(ctx, logger, nk, dispatcher, match, signal)
+	case SignalHint:
+		h.applyHintSearch(dispatcher, match, signal)
+	case SignalGameOver:
+		// A rematch may already have started before the results were recorded
+		if signal.Round != match.Round || match.State != GameStateFinished {
+			return match, ""
+		}
+		h.send(dispatcher, match, OpcodeGameOver, gameOverData(match, signal.Results), nil)
+	case SignalInspect, SignalForceEnd, SignalSetTurn, SignalKick:
+		return match, h.handleAdminSignal(ctx, logger, nk, dispatcher, match, signal)
+	}
+
+	return match, ""
+}
+
+// segmentPresences returns the connected presences of the given users, or nil
+// (meaning everyone) when no segment is given
+func (h *TTTMatchHandler) segmentPresences(match *TTTMatch, userIDs []string) []runtime.Presence {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	presences := make([]runtime.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if presence, ok := match.Presences[userID]; ok {
+			presences = append(presences, presence)
+		}
+	}
+	return presences
 }
 
 // handleMove processes a move from a player
 func (h *TTTMatchHandler) handleMove(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	// Parse move data, in the encoding the sender joined with
+	moveData, err := decodeMove(match, message)
+	if err != nil {
+		h.sendError(dispatcher, match, message, "", ErrInvalidMessage, "Invalid move data")
+		return
+	}
+	requestID := moveData.RequestID
+	if !h.allowMessage(dispatcher, match, moveLimiter, message, requestID) {
+		return
+	}
+
 	// Check if game is in playing state
 	if match.State != GameStatePlaying {
-		h.sendError(dispatcher, "Game is not in playing state")
+		h.sendError(dispatcher, match, message, requestID, ErrNotPlaying, "Game is not in playing state")
 		return
 	}
 
-	// Parse move data
-	var moveData MoveData
-	if err := json.Unmarshal(message.GetData(), &moveData); err != nil {
-		h.sendError(dispatcher, "Invalid move data")
+	// Check if it's the player's turn
+	playerSymbol, exists := match.Players[message.GetUserId()]
+	if !exists {
+		h.sendError(dispatcher, match, message, requestID, ErrNotInMatch, "Player not in match")
 		return
 	}
 
-	// Validate move coordinates
-	if moveData.Row < 0 || moveData.Row >= match.Size || moveData.Col < 0 || moveData.Col >= match.Size {
-		h.sendError(dispatcher, "Invalid move coordinates")
+	if playerSymbol != match.Turn {
+		h.sendError(dispatcher, match, message, requestID, ErrNotYourTurn, "Not your turn")
 		return
 	}
 
-	// Check if it's the player's turn
-	playerSymbol, exists := match.Players[message.GetUserId()]
+	// Let the mode validate the move (and relocate it, e.g. gravity drops)
+	gameMode, _ := lookupGameMode(match.Mode)
+	resolved, err := gameMode.Rules.Resolve(match.Board, rules.Move{Row: moveData.Row, Col: moveData.Col, Symbol: moveData.Symbol})
+	if err != nil {
+		code, text := moveError(err)
+		h.sendError(dispatcher, match, message, requestID, code, text)
+		return
+	}
+	moveData.Row, moveData.Col = resolved.Row, resolved.Col
+
+	h.applyMove(ctx, logger, nk, dispatcher, match, playerSymbol, moveData)
+
+	// Acknowledge the accepted move so the client can settle its pending request
+	if requestID != "" {
+		h.send(dispatcher, match, OpcodeAck, &AckData{RequestID: requestID}, []runtime.Presence{message})
+	}
+}
+
+// handleHint answers a hint request with the solver's suggested move for the
+// sender. Each player may ask once per turn, and on large boards the search
+// runs off the match loop and the hint follows as a match signal.
+func (h *TTTMatchHandler) handleHint(logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	// The payload is optional and only carries a request ID
+	var request HintRequestData
+	_ = json.Unmarshal(message.GetData(), &request)
+	requestID := request.RequestID
+
+	if !h.allowMessage(dispatcher, match, hintLimiter, message, requestID) {
+		return
+	}
+
+	if match.Ranked {
+		h.sendError(dispatcher, match, message, requestID, ErrHintUnavailable, "Hints are disabled in ranked matches")
+		return
+	}
+
+	if isRotationMode(match.Mode) {
+		h.sendError(dispatcher, match, message, requestID, ErrHintUnavailable, "Hints are not available in this mode")
+		return
+	}
+
+	if match.State != GameStatePlaying {
+		h.sendError(dispatcher, match, message, requestID, ErrNotPlaying, "Game is not in playing state")
+		return
+	}
+
+	userID := message.GetUserId()
+	playerSymbol, exists := match.Players[userID]
 	if !exists {
-		h.sendError(dispatcher, "Player not in match")
+		h.sendError(dispatcher, match, message, requestID, ErrNotInMatch, "Player not in match")
 		return
 	}
 
 	if playerSymbol != match.Turn {
-		h.sendError(dispatcher, "Not your turn")
+		h.sendError(dispatcher, match, message, requestID, ErrNotYourTurn, "Not your turn")
+		return
+	}
+
+	if match.HintsUsed[userID] >= match.HintBudget {
+		h.sendError(dispatcher, match, message, requestID, ErrHintUnavailable, "No hints remaining")
 		return
 	}
 
-	// Check if cell is empty
-	if match.Board[moveData.Row][moveData.Col] != Empty {
-		h.sendError(dispatcher, "Cell already occupied")
+	// Repeated requests can't queue up searches of the same position
+	if turn, asked := match.HintTurns[userID]; asked && turn == match.MoveCount {
+		h.sendError(dispatcher, match, message, requestID, ErrHintUnavailable, "Hint already requested this turn")
 		return
 	}
+	match.HintTurns[userID] = match.MoveCount
 
+	if match.Size >= backgroundSearchSize {
+		startHintSearch(logger, nk, match, userID, playerSymbol, requestID)
+		return
+	}
+
+	move, ok := chooseBotMove(match.Board, playerSymbol, BotHard)
+	if !ok {
+		h.sendError(dispatcher, match, message, requestID, ErrHintUnavailable, "No moves available")
+		return
+	}
+	h.sendHint(dispatcher, match, userID, message, move, requestID)
+}
+
+// sendHint charges a hint to the player and sends them the suggested move
+func (h *TTTMatchHandler) sendHint(dispatcher runtime.MatchDispatcher, match *TTTMatch, userID string, to runtime.Presence, move MoveData, requestID string) {
+	match.HintsUsed[userID]++
+	hint := &HintData{
+		Row:       move.Row,
+		Col:       move.Col,
+		Remaining: match.HintBudget - match.HintsUsed[userID],
+		RequestID: requestID,
+	}
+	h.send(dispatcher, match, OpcodeHint, hint, []runtime.Presence{to})
+}
+
+// startHintSearch searches a copy of the board for a player's hint in a
+// goroutine, which signals the match with the result
+func startHintSearch(logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch, userID, symbol, requestID string) {
+	board := rules.Copy(match.Board)
+	matchID, round, moveCount := match.ID, match.Round, match.MoveCount
+	go recoverInto(logger, nk, "hint_search", func() {
+		move, ok := chooseBotMove(board, symbol, BotHard)
+		if !ok {
+			return
+		}
+		signal, _ := json.Marshal(MatchSignalData{
+			Type:      SignalHint,
+			UserIDs:   []string{userID},
+			Round:     round,
+			MoveCount: moveCount,
+			Move:      &move,
+			RequestID: requestID,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+		defer cancel()
+		if _, err := nk.MatchSignal(ctx, matchID, string(signal)); err != nil {
+			logger.Warn("Failed to deliver hint: %v", err)
+		}
+	})
+}
+
+// applyHintSearch sends the hint a background search found, unless the
+// player's turn is over or they left while it ran
+func (h *TTTMatchHandler) applyHintSearch(dispatcher runtime.MatchDispatcher, match *TTTMatch, signal MatchSignalData) {
+	if signal.Move == nil || len(signal.UserIDs) != 1 || signal.Round != match.Round || signal.MoveCount != match.MoveCount || match.State != GameStatePlaying {
+		return
+	}
+	userID := signal.UserIDs[0]
+	presence, connected := match.Presences[userID]
+	if !connected || match.Players[userID] != match.Turn || match.HintsUsed[userID] >= match.HintBudget {
+		return
+	}
+	h.sendHint(dispatcher, match, userID, presence, *signal.Move, signal.RequestID)
+}
+
+// applyMove places a validated move, resolves the game result, and broadcasts the new state
+func (h *TTTMatchHandler) applyMove(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, playerSymbol string, moveData MoveData) {
 	// Make the move
-	match.Board[moveData.Row][moveData.Col] = playerSymbol
+	piece := playerSymbol
+	if moveData.Symbol != "" {
+		piece = moveData.Symbol
+	}
+	match.Board.Set(moveData.Row, moveData.Col, piece)
 	match.MoveCount++
+	match.Moves = append(match.Moves, MoveRecord{
+		Number: match.MoveCount,
+		Symbol: piece,
+		Row:    moveData.Row,
+		Col:    moveData.Col,
+		Player: playerWithSymbol(match, playerSymbol),
+	})
+	// A pending undo request lapses once the board changes
+	match.UndoRequest = ""
+	recordMove(nk, match)
+	telemetryMoveMade(match, match.Moves[len(match.Moves)-1])
 
-	// Check for win or draw
-	winner := h.checkWinner(match)
+	// Check for win or draw; the mode decides who a completed line counts for
+	gameMode, _ := lookupGameMode(match.Mode)
+	winner := gameMode.Rules.Winner(match.Board, playerSymbol)
 	if winner != "" {
 		match.Winner = winner
 		match.State = GameStateFinished
 		logger.Info("Game finished! Winner: %s", winner)
 		
 		// Update leaderboard immediately when game ends
-		h.updateLeaderboard(ctx, logger, nk, match)
-	} else if match.MoveCount >= match.Size*match.Size {
+		h.endGame(ctx, logger, nk, match, false)
+	} else if rules.Full(match.Board) {
 		match.State = GameStateFinished
 		logger.Info("Game finished! Draw")
 		
 		// Update leaderboard immediately when game ends (draw)
-		h.updateLeaderboard(ctx, logger, nk, match)
+		h.endGame(ctx, logger, nk, match, false)
 	} else {
 		// Switch turns
 		if match.Turn == PlayerX {
@@ -232,128 +954,524 @@ func (h *TTTMatchHandler) handleMove(ctx context.Context, logger runtime.Logger,
 		} else {
 			match.Turn = PlayerX
 		}
+		match.TurnStartTick = match.Tick
+		notifyTurnIfAway(logger, nk, match)
+	}
+
+	// A move resets the mover's timeout streak
+	for userID, symbol := range match.Players {
+		if symbol == playerSymbol {
+			delete(match.TurnTimeouts, userID)
+		}
 	}
 
 	// Broadcast updated state
-	stateData := StateData{
-		Board:   match.Board,
-		Turn:    match.Turn,
-		Winner:  match.Winner,
-		Size:    match.Size,
-		Mode:    match.Mode,
-		Players: match.Players,
-	}
-
-	stateBytes, _ := json.Marshal(stateData)
-	dispatcher.BroadcastMessage(OpcodeState, stateBytes, nil, nil, true)
-}
-
-// checkWinner checks if there's a winner
-func (h *TTTMatchHandler) checkWinner(match *TTTMatch) string {
-	size := match.Size
-
-	// Check rows
-	for i := 0; i < size; i++ {
-		if match.Board[i][0] != Empty {
-			won := true
-			for j := 1; j < size; j++ {
-				if match.Board[i][j] != match.Board[i][0] {
-					won = false
-					break
-				}
-			}
-			if won {
-				return match.Board[i][0]
-			}
+	h.broadcastState(dispatcher, match, nil)
+}
+
+// checkTurnClock skips the turn of a player who ran out of time, and forfeits the
+// match for them after config.MaxTurnTimeouts consecutive timeouts
+func (h *TTTMatchHandler) checkTurnClock(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	if match.TurnTicks <= 0 || match.Tick-match.TurnStartTick < match.TurnTicks {
+		return
+	}
+
+	for userID, symbol := range match.Players {
+		if symbol != match.Turn {
+			continue
+		}
+
+		match.TurnTimeouts[userID]++
+		if match.TurnTimeouts[userID] >= config.MaxTurnTimeouts {
+			match.Winner = opponentOf(symbol)
+			match.State = GameStateFinished
+			match.EndReason = EndReasonTimeout
+			logger.WithField("user_id", userID).Info("Player forfeited after %d turn timeouts", match.TurnTimeouts[userID])
+			h.endGame(ctx, logger, nk, match, true)
+		} else {
+			logger.WithField("user_id", userID).Info("Player ran out of time, skipping turn")
+			match.Turn = opponentOf(symbol)
+			match.TurnStartTick = match.Tick
+			notifyTurnIfAway(logger, nk, match)
 		}
+		h.broadcastState(dispatcher, match, nil)
+		return
 	}
+}
 
-	// Check columns
-	for j := 0; j < size; j++ {
-		if match.Board[0][j] != Empty {
-			won := true
-			for i := 1; i < size; i++ {
-				if match.Board[i][j] != match.Board[0][j] {
-					won = false
-					break
-				}
-			}
-			if won {
-				return match.Board[0][j]
-			}
+// checkDisconnects forfeits the game for a player who left it and hasn't
+// reconnected within disconnectGraceSeconds. If both players are gone, the one
+// who left first forfeits.
+func (h *TTTMatchHandler) checkDisconnects(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	graceTicks := int64(disconnectGraceSeconds * match.TickRate)
+	leaver, leftAt := "", int64(0)
+	for userID, tick := range match.Disconnected {
+		if match.Tick-tick >= graceTicks && (leaver == "" || tick < leftAt) {
+			leaver, leftAt = userID, tick
 		}
 	}
+	symbol, seated := match.Players[leaver]
+	if !seated {
+		return
+	}
 
-	// Check main diagonal
-	if match.Board[0][0] != Empty {
-		won := true
-		for i := 1; i < size; i++ {
-			if match.Board[i][i] != match.Board[0][0] {
-				won = false
-				break
-			}
+	delete(match.Disconnected, leaver)
+	match.Winner = opponentOf(symbol)
+	match.State = GameStateFinished
+	match.EndReason = EndReasonForfeit
+	logger.WithField("user_id", leaver).Info("Player forfeited by not reconnecting within %ds", disconnectGraceSeconds)
+	h.endGame(ctx, logger, nk, match, true)
+	h.broadcastState(dispatcher, match, nil)
+}
+
+// turnSecondsLeft returns the seconds remaining on the turn clock, or 0 if it isn't running
+func turnSecondsLeft(match *TTTMatch) int {
+	if match.TurnTicks <= 0 || match.State != GameStatePlaying || match.TickRate <= 0 {
+		return 0
+	}
+	left := match.TurnTicks - (match.Tick - match.TurnStartTick)
+	if left < 0 {
+		left = 0
+	} else if left > match.TurnTicks {
+		left = match.TurnTicks
+	}
+	return int((left + int64(match.TickRate) - 1) / int64(match.TickRate))
+}
+
+// intParam reads a numeric match parameter, which arrives as a float64 from JSON
+func intParam(params map[string]interface{}, key string, fallback int) int {
+	switch value := params[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	default:
+		return fallback
+	}
+}
+
+// finishGame queues results for a game that just ended. Recording happens on the
+// worker pool so storage latency never stalls a match tick.
+func (h *TTTMatchHandler) finishGame(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	if match.ResultRecorded {
+		return
+	}
+	match.ResultRecorded = true
+	recordMatchFinished(nk, match)
+	telemetryMatchFinished(match)
+
+	if !enqueueResults(h, logger, match) {
+		logger.Warn("Result queue full, deferring match %s", match.ID)
+		deferResults(h, logger, nk, match)
+	}
+}
+
+// recordResults writes leaderboard, stats, and history for a finished match
+func (h *TTTMatchHandler) recordResults(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	claimed, err := claimMatchResult(ctx, nk, match)
+	if err != nil {
+		logger.Error("Failed to claim results for match %s, not recording: %v", match.ID, err)
+		return
+	}
+	if !claimed {
+		logger.Warn("Results for match %s were already recorded", match.ID)
+		return
+	}
+
+	results, failures := h.updateLeaderboard(ctx, logger, nk, match)
+	if failures > 0 {
+		logger.Error("Recording results for match %s had %d failed writes", match.ID, failures)
+	}
+
+	if match.SimulationID != "" {
+		recordSimulatedMatch(match.SimulationID, failures)
+		return
+	}
+
+	if match.BotDifficulty == BotAdaptive && len(match.Bots) > 0 {
+		recordBotPractice(ctx, logger, nk, match)
+	}
+
+	if featuredEligible(match) {
+		userIDs := make([]string, 0, len(match.Players))
+		for userID := range match.Players {
+			userIDs = append(userIDs, userID)
 		}
-		if won {
-			return match.Board[0][0]
+		ratings, err := loadRatings(ctx, nk, userIDs)
+		if err != nil {
+			logger.Warn("Failed to load ratings for featured match candidate: %v", err)
 		}
+		considerFeaturedMatch(match, ratings)
 	}
 
-	// Check anti-diagonal
-	if match.Board[0][size-1] != Empty {
-		won := true
-		for i := 1; i < size; i++ {
-			if match.Board[i][size-1-i] != match.Board[0][size-1] {
-				won = false
-				break
-			}
+	sendGameOver(ctx, logger, nk, match, results)
+	notifyMatchCompleted(ctx, logger, nk, match, results)
+}
+
+// gameOverData summarizes the finished game for OpcodeGameOver
+func gameOverData(match *TTTMatch, results map[string]PlayerResult) *GameOverData {
+	data := &GameOverData{
+		Winner:           match.Winner,
+		Reason:           match.EndReason,
+		Results:          results,
+		RematchAvailable: rematchAvailable(match),
+	}
+	if data.Reason == "" {
+		data.Reason = EndReasonLine
+		if match.Winner == "" {
+			data.Reason = EndReasonDraw
 		}
-		if won {
-			return match.Board[0][size-1]
+	}
+	for userID, symbol := range match.Players {
+		if symbol == match.Winner {
+			data.WinnerID = userID
 		}
 	}
+	if data.Results == nil {
+		data.Results = map[string]PlayerResult{}
+	}
+	return data
+}
 
-	return ""
+// broadcastState sends the current game state to the given presences (all if nil)
+func (h *TTTMatchHandler) broadcastState(dispatcher runtime.MatchDispatcher, match *TTTMatch, presences []runtime.Presence) {
+	stateData := matchState(match)
+	h.send(dispatcher, match, OpcodeState, &stateData, presences)
+
+	// Every state change is broadcast to everyone, so persist on those
+	if presences == nil {
+		saveMatchState(match)
+	}
+}
+
+// matchState returns the game state clients are sent
+func matchState(match *TTTMatch) StateData {
+	return StateData{
+		Board:      match.Board.Rows(),
+		Turn:       match.Turn,
+		Winner:     match.Winner,
+		Size:       match.Size,
+		WinLength:  match.WinLength,
+		Mode:       match.Mode,
+		Ranked:     match.Ranked,
+		Players:    match.Players,
+		Cosmetics:  match.Cosmetics,
+		Profiles:   match.Profiles,
+		Checksum:   stateChecksum(match),
+		TurnLeft:   turnSecondsLeft(match),
+		Spectators: len(match.Spectators),
+		Series:     seriesState(match),
+		Moves:      match.Moves,
+		First:      firstPlayer(match),
+		Reason:     match.EndReason,
+		Clocks:     clocksState(match),
+	}
+}
+
+// send stamps a payload with a sequence number and dispatches it. Broadcasts to
+// everyone advance the sequence and are kept for replay; targeted messages carry
+// the current sequence so they never open a gap for other clients.
+func (h *TTTMatchHandler) send(dispatcher runtime.MatchDispatcher, match *TTTMatch, opcode int64, payload sequenced, presences []runtime.Presence) {
+	if presences == nil {
+		match.Seq++
+	}
+	payload.setSeq(match.Seq)
+
+	// Each way clients joined gets its own encoding, adapted to their protocol
+	// version, and nothing if the opcode is newer than it
+	groups := clientGroups(match, presences)
+	encoded := make(map[ClientProtocol][]byte, len(groups))
+	for client, recipients := range groups {
+		data := encodeFor(client, opcode, payload)
+		encoded[client] = data
+		if data != nil {
+			dispatcher.BroadcastMessage(opcode, data, recipients, nil, true)
+		}
+	}
+
+	if presences == nil {
+		match.Outbox = append(match.Outbox, SequencedMessage{Seq: match.Seq, Opcode: opcode, Encoded: encoded})
+		if len(match.Outbox) > replayBufferSize {
+			match.Outbox = match.Outbox[len(match.Outbox)-replayBufferSize:]
+		}
+	}
 }
 
-// updateLeaderboard updates the leaderboard with game results
-func (h *TTTMatchHandler) updateLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+// handleReplay resends broadcasts the sender missed after the given sequence number
+func (h *TTTMatchHandler) handleReplay(dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	var request ReplayRequestData
+	if err := json.Unmarshal(message.GetData(), &request); err != nil {
+		h.sendError(dispatcher, match, message, "", ErrInvalidMessage, "Invalid replay request")
+		return
+	}
+
+	sender := []runtime.Presence{message}
+	client := clientProtocol(match, message.GetUserId())
+
+	// Fall back to a full resync if the gap is older than the replay buffer, or
+	// if a missed broadcast wasn't encoded the way the sender joined because
+	// nobody in the match had joined that way when it was sent
+	if len(match.Outbox) == 0 || request.FromSeq < match.Outbox[0].Seq-1 {
+		h.broadcastState(dispatcher, match, sender)
+		return
+	}
+	missed := make([]SequencedMessage, 0, len(match.Outbox))
+	for _, buffered := range match.Outbox {
+		if buffered.Seq <= request.FromSeq {
+			continue
+		}
+		if _, ok := buffered.Encoded[client]; !ok {
+			h.broadcastState(dispatcher, match, sender)
+			return
+		}
+		missed = append(missed, buffered)
+	}
+
+	for _, buffered := range missed {
+		if data := buffered.Encoded[client]; data != nil {
+			dispatcher.BroadcastMessage(buffered.Opcode, data, sender, nil, true)
+		}
+	}
+}
+
+// payloadEncoder is a scratch buffer with an encoder writing into it
+type payloadEncoder struct {
+	buffer  bytes.Buffer
+	encoder *json.Encoder
+}
+
+// encodeBuffers pools the encoders used to marshal outgoing messages
+var encodeBuffers = sync.Pool{New: func() interface{} {
+	scratch := &payloadEncoder{}
+	scratch.encoder = json.NewEncoder(&scratch.buffer)
+	return scratch
+}}
+
+// encodePayload marshals a message through a pooled buffer. The result is copied
+// out because the dispatcher and replay outbox keep it after the buffer is reused.
+func encodePayload(payload interface{}) []byte {
+	scratch := encodeBuffers.Get().(*payloadEncoder)
+	defer encodeBuffers.Put(scratch)
+	scratch.buffer.Reset()
+
+	if err := scratch.encoder.Encode(payload); err != nil {
+		return nil
+	}
+	// Encode appends a newline the wire format doesn't need
+	return append([]byte(nil), bytes.TrimSuffix(scratch.buffer.Bytes(), []byte{'\n'})...)
+}
+
+// stateChecksum returns a deterministic hash of the canonical board and turn
+// state. The canonical form is built in a stack buffer and hashed in one write,
+// so checksumming a broadcast doesn't allocate beyond the returned string.
+func stateChecksum(match *TTTMatch) string {
+	var scratch [256]byte
+	canonical := strconv.AppendInt(scratch[:0], int64(match.Size), 10)
+	canonical = append(canonical, '|')
+	canonical = append(canonical, match.Turn...)
+	canonical = append(canonical, '|')
+	canonical = append(canonical, match.Winner...)
+	canonical = append(canonical, '|')
+	for i, cell := range match.Board.Cells {
+		if cell == rules.CellEmpty {
+			cell = '.'
+		}
+		canonical = append(canonical, cell)
+		if (i+1)%match.Board.Size == 0 {
+			canonical = append(canonical, '/')
+		}
+	}
+
+	hash := fnv.New64a()
+	hash.Write(canonical)
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// moveError maps a rules validation error to the error code and message sent to clients
+func moveError(err error) (string, string) {
+	switch {
+	case errors.Is(err, rules.ErrColumnFull):
+		return ErrColumnFull, "Column is full"
+	case errors.Is(err, rules.ErrInvalidSymbol):
+		return ErrInvalidSymbol, "Invalid symbol"
+	case errors.Is(err, rules.ErrOccupied):
+		return ErrCellOccupied, "Cell already occupied"
+	default:
+		return ErrOutOfBounds, "Invalid move coordinates"
+	}
+}
+
+// updateLeaderboard updates the leaderboard with game results and returns the number of failed writes
+func (h *TTTMatchHandler) updateLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) (map[string]PlayerResult, int) {
+	failures := 0
+	deltas := make(map[string]int64, len(match.Players))
+	results := make(map[string]PlayerResult, len(match.Players))
+	multiplier := eventScoreMultiplier(ctx, logger, nk)
+	gameMode, _ := lookupGameMode(match.Mode)
+
+	// Ranked games move Elo ratings, which need both players' current ratings
+	userIDs := make([]string, 0, len(match.Players))
+	for userID := range match.Players {
+		userIDs = append(userIDs, userID)
+	}
+	// A bot's rating only serves as its opponent's; bots are never rated themselves
+	opponents := map[string]PlayerRating{}
+	ratings := map[string]PlayerRating{}
+	if match.Ranked && match.RotationLeaderboard == "" {
+		var err error
+		if opponents, err = loadPlayerRatings(ctx, nk, userIDs); err != nil {
+			logger.Error("Failed to load ratings: %v", err)
+			return results, len(userIDs)
+		}
+		for userID, player := range opponents {
+			if !isBotAccount(userID) {
+				ratings[userID] = player
+			}
+		}
+	}
+
+	// Ranked win streaks earn bonus points; a failed read only costs the bonus
+	streaks := map[string]int{}
+	if match.Ranked {
+		var err error
+		if streaks, err = loadWinStreaks(ctx, nk, userIDs); err != nil {
+			logger.Warn("Failed to load win streaks, skipping streak bonuses: %v", err)
+			streaks = map[string]int{}
+		}
+	}
+
 	for userID, symbol := range match.Players {
-		// Determine score based on game result
+		// Determine score based on game result. Limited-time modes keep flat
+		// per-result points; everything else is an Elo rating change.
 		score := int64(0)
+		result := 0.0
 		won := false
 		lost := false
 		drawn := false
 
 		if match.Winner == symbol {
-			score = 10 // Win
+			score = gameMode.Scoring.Win
+			result = 1
 			won = true
 		} else if match.Winner == "" {
-			score = 1 // Draw
+			score = gameMode.Scoring.Draw
+			result = 0.5
 			drawn = true
 		} else {
-			score = -5 // Loss
+			score = gameMode.Scoring.Loss
 			lost = true
 		}
 
-		// Update leaderboard
-		err := UpdateLeaderboard(ctx, logger, nk, userID, score)
-		if err != nil {
-			logger.Error("Failed to update leaderboard for user %s: %v", userID, err)
+		// Players still in placements move by the larger placement K-factor
+		player, rated := ratings[userID]
+		if rated {
+			opponentRating := int64(defaultRating)
+			for otherID := range match.Players {
+				if otherID != userID {
+					opponentRating = opponents[otherID].Rating
+				}
+			}
+			score = ratingDelta(player.Rating, opponentRating, result, player.kFactor())
+		}
+
+		// Ranked win streaks earn leaderboard points on top of the game's own
+		bonus := int64(0)
+		if won {
+			if bonus = streakBonus(streaks[userID] + 1); bonus > 0 {
+				logger.WithField("user_id", userID).Info("Win streak of %d earns %d bonus points", streaks[userID]+1, bonus)
+			}
 		}
+		gameResult, points := scoreGame(GameResult{
+			Won:    won,
+			Lost:   lost,
+			Drawn:  drawn,
+			Ranked: match.Ranked,
+			Rated:  rated,
+		}, score, multiplier, bonus)
 
-		// Update user statistics
-		err = UpdateUserStats(ctx, logger, nk, userID, won, lost, drawn)
+		// Stats hold the rating, so they go first and the leaderboard mirrors the stored result
+		stats, err := UpdateUserStats(ctx, logger, nk, userID, gameResult)
 		if err != nil {
 			logger.Error("Failed to update user stats for user %s: %v", userID, err)
+			failures++
+			results[userID] = PlayerResult{Result: resultFor(match, symbol)}
+			continue
+		}
+		if won && match.Ranked && !isBotAccount(userID) {
+			announceWinStreak(ctx, logger, nk, userID, stats.Username, stats.WinStreak)
+		}
+		playerResult := PlayerResult{Result: resultFor(match, symbol)}
+		if rated {
+			playerResult.Rating = stats.Rating
+			playerResult.Placement = player.Provisional
+		}
+
+		// Casual matches and bot accounts never touch the competitive leaderboard
+		if match.Ranked && !isBotAccount(userID) {
+			deltas[userID] = points
+			playerResult.ScoreDelta = points
+			if match.RotationLeaderboard != "" {
+				// Limited-time modes only score on their own temporary leaderboard
+				if err := UpdateRotationLeaderboard(ctx, logger, nk, match.RotationLeaderboard, userID, points); err != nil {
+					logger.Error("Failed to update rotation leaderboard for user %s: %v", userID, err)
+					failures++
+				}
+			} else if err := UpdateLeaderboard(ctx, logger, nk, userID, stats, points, GameResult{Won: won, Lost: lost, Drawn: drawn, Ranked: true}); err != nil {
+				logger.Error("Failed to update leaderboard for user %s: %v", userID, err)
+				failures++
+			}
+		}
+		results[userID] = playerResult
+
+		// Every game a person plays, ranked or not, counts towards their quests
+		if !isBotAccount(userID) {
+			events := []string{QuestEventPlay}
+			if won {
+				events = append(events, QuestEventWin)
+			} else if drawn {
+				events = append(events, QuestEventDraw)
+			}
+			if err := RecordQuestEvents(ctx, logger, nk, userID, match.Mode, events...); err != nil {
+				logger.Warn("Failed to update quests for user %s: %v", userID, err)
+			}
+			if won && match.Ranked {
+				awardEventBadges(ctx, logger, nk, userID)
+			}
 		}
 	}
 
+	if match.Ranked {
+		recordTournamentResults(ctx, logger, nk, match)
+	}
+
+	// Every game between two people counts towards their rivalry
+	recordHeadToHead(ctx, logger, nk, match)
+
+	// Record match history for stats queries
+	recordMatchHistory(ctx, logger, nk, match, deltas)
+
 	logger.Info("Updated leaderboard and stats for match %s", match.ID)
+	return results, failures
 }
 
-// sendError sends an error message to all players
-func (h *TTTMatchHandler) sendError(dispatcher runtime.MatchDispatcher, message string) {
-	errorData := ErrorData{Msg: message}
-	errorBytes, _ := json.Marshal(errorData)
-	dispatcher.BroadcastMessage(OpcodeError, errorBytes, nil, nil, true)
+// sendError sends an error to the player whose action failed, echoing its request ID
+func (h *TTTMatchHandler) sendError(dispatcher runtime.MatchDispatcher, match *TTTMatch, to runtime.Presence, requestID, code, message string) {
+	h.send(dispatcher, match, OpcodeError, &ErrorData{Code: code, Msg: message, RequestID: requestID}, []runtime.Presence{to})
+}
+
+// allowMessage takes a token from the sender's allowance on limiter, telling
+// them when to retry if they have none left
+func (h *TTTMatchHandler) allowMessage(dispatcher runtime.MatchDispatcher, match *TTTMatch, limiter *rateLimiter, message runtime.MatchData, requestID string) bool {
+	ok, retryAfter := limiter.allow(message.GetUserId())
+	if !ok {
+		h.send(dispatcher, match, OpcodeError, &ErrorData{
+			Code:         ErrRateLimited,
+			Msg:          "Sending messages too quickly",
+			RequestID:    requestID,
+			RetryAfterMs: retryAfter.Milliseconds() + 1,
+		}, []runtime.Presence{message})
+	}
+	return ok
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+// benchmarkMatch returns a 5x5 ranked match twelve moves in
+func benchmarkMatch() *TTTMatch {
+	match := &TTTMatch{
+		ID:        "benchmark",
+		Mode:      GameModeAdvanced,
+		Ranked:    true,
+		Size:      5,
+		WinLength: 4,
+		Board:     rules.NewBoardK(5, 4),
+		Turn:      PlayerX,
+		State:     GameStatePlaying,
+		Players:   map[string]string{"player-one": PlayerX, "player-two": PlayerO},
+	}
+	symbol := PlayerX
+	for _, cell := range [][2]int{{2, 2}, {0, 0}, {1, 1}, {3, 3}, {0, 4}, {4, 0}, {2, 1}, {2, 3}, {1, 3}, {3, 1}, {4, 4}, {0, 2}} {
+		match.Board.Set(cell[0], cell[1], symbol)
+		match.Moves = append(match.Moves, MoveRecord{Number: len(match.Moves) + 1, Player: symbol, Symbol: symbol, Row: cell[0], Col: cell[1]})
+		match.MoveCount++
+		symbol = rules.Opponent(symbol)
+	}
+	return match
+}
+
+func BenchmarkStateBroadcastEncoding(b *testing.B) {
+	match := benchmarkMatch()
+	for _, client := range []ClientProtocol{
+		{Version: currentProtocolVersion, Encoding: EncodingJSON},
+		{Version: currentProtocolVersion, Encoding: EncodingProtobuf},
+	} {
+		b.Run(client.Encoding, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				state := matchState(match)
+				if encodeFor(client, OpcodeState, &state) == nil {
+					b.Fatal("state was not encoded")
+				}
+			}
+		})
+	}
+}
+
+func TestStateChecksumIsStable(t *testing.T) {
+	// Clients compare checksums across server versions, so the canonical form
+	// must not change: "<size>|<turn>|<winner>|" then each row's cells ("." for
+	// empty) followed by "/"
+	match := benchmarkMatch()
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d|%s|%s|", match.Size, match.Turn, match.Winner)
+	for _, row := range match.Board.Rows() {
+		for _, cell := range row {
+			if cell == Empty {
+				cell = "."
+			}
+			hash.Write([]byte(cell))
+		}
+		hash.Write([]byte{'/'})
+	}
+
+	if got, want := stateChecksum(match), strconv.FormatUint(hash.Sum64(), 16); got != want {
+		t.Errorf("checksum = %s, want %s", got, want)
+	}
+}
+
+func TestPrivateMatchesOnlyAdmitInviteCodeHolders(t *testing.T) {
+	nk := newMemoryNakama()
+	handler := &TTTMatchHandler{}
+	match := &TTTMatch{
+		ID:          "private",
+		Mode:        GameModeClassic,
+		State:       GameStateWaiting,
+		PrivateCode: "K7QX2M",
+		Players:     map[string]string{"host": PlayerX},
+		Presences:   map[string]runtime.Presence{},
+		Clients:     map[string]ClientProtocol{},
+		Spectators:  map[string]runtime.Presence{},
+		Bots:        map[string]bool{},
+	}
+	tests := []struct {
+		name     string
+		userID   string
+		metadata map[string]string
+		want     bool
+	}{
+		{"no code", "stranger", nil, false},
+		{"wrong code", "stranger", map[string]string{"code": "AAAAAA"}, false},
+		{"spectator without code", "stranger", map[string]string{"role": RoleSpectator}, false},
+		{"host reconnecting", "host", nil, true},
+		{"code typed in lower case", "guest", map[string]string{"code": "k7qx2m"}, true},
+	}
+	for _, tt := range tests {
+		_, admitted, reason := handler.MatchJoinAttempt(context.Background(), discardLogger{}, nil, nk, nil, 0, match, queuePresence{userID: tt.userID}, tt.metadata)
+		if admitted != tt.want {
+			t.Errorf("%s: admitted %v (%q), want %v", tt.name, admitted, reason, tt.want)
+		}
+	}
+}
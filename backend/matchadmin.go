@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Admin match signal types
+const (
+	SignalInspect  = "inspect"   // return the match state
+	SignalForceEnd = "force_end" // end the game, awarding it to Winner or abandoning it
+	SignalSetTurn  = "set_turn"  // hand the turn to Turn
+	SignalKick     = "kick"      // remove UserIDs from the match
+)
+
+// MatchAdminRequest represents admin_match_signal request
+type MatchAdminRequest struct {
+	MatchID string   `json:"match_id"`
+	Type    string   `json:"type"`
+	Winner  string   `json:"winner,omitempty"`
+	Turn    string   `json:"turn,omitempty"`
+	UserIDs []string `json:"user_ids,omitempty"`
+}
+
+// MatchInspection represents the live state of a match returned to admins
+type MatchInspection struct {
+	State      *SavedMatch `json:"state"`
+	Tick       int64       `json:"tick"`
+	Connected  []string    `json:"connected"`
+	Spectators []string    `json:"spectators"`
+	Label      string      `json:"label,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// InitMatchAdmin registers the admin match signal RPC
+func InitMatchAdmin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("admin_match_signal", adminMatchSignalRPC); err != nil {
+		return fmt.Errorf("failed to register admin_match_signal RPC: %w", err)
+	}
+
+	logger.Info("Match admin initialized")
+	return nil
+}
+
+// adminMatchSignalRPC inspects or commands a live match by ID (admin only)
+func adminMatchSignalRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request MatchAdminRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.MatchID == "" {
+		return "", rpcError(CodeInvalidArgument, "match_id is required")
+	}
+
+	switch request.Type {
+	case SignalInspect:
+	case SignalForceEnd:
+		if request.Winner != "" && request.Winner != PlayerX && request.Winner != PlayerO {
+			return "", rpcError(CodeInvalidArgument, "winner must be X, O, or empty to abandon")
+		}
+	case SignalSetTurn:
+		if request.Turn != PlayerX && request.Turn != PlayerO {
+			return "", rpcError(CodeInvalidArgument, "turn must be X or O")
+		}
+	case SignalKick:
+		if len(request.UserIDs) == 0 {
+			return "", rpcError(CodeInvalidArgument, "user_ids is required")
+		}
+	default:
+		return "", rpcErrorf(CodeInvalidArgument, "unknown signal type %q", request.Type)
+	}
+
+	signal, _ := json.Marshal(MatchSignalData{
+		Type:    request.Type,
+		Winner:  request.Winner,
+		Turn:    request.Turn,
+		UserIDs: request.UserIDs,
+	})
+	result, err := nk.MatchSignal(ctx, request.MatchID, string(signal))
+	if err != nil {
+		return "", rpcErrorf(CodeNotFound, "failed to signal match %s: %v", request.MatchID, err)
+	}
+
+	var inspection MatchInspection
+	if err := json.Unmarshal([]byte(result), &inspection); err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to parse match response: %v", err)
+	}
+	if inspection.Error != "" {
+		return "", rpcError(CodeFailedPrecondition, inspection.Error)
+	}
+
+	if request.Type != SignalInspect {
+		recordAudit(ctx, logger, nk, "match_"+request.Type, request.MatchID, map[string]interface{}{
+			"winner":   request.Winner,
+			"turn":     request.Turn,
+			"user_ids": request.UserIDs,
+		})
+	}
+	logger.Info("Admin signal %s applied to match %s", request.Type, request.MatchID)
+	return rpcOK(inspection)
+}
+
+// handleAdminSignal applies an admin command to the match and returns its
+// resulting state as the signal response
+func (h *TTTMatchHandler) handleAdminSignal(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, match *TTTMatch, signal MatchSignalData) string {
+	var failure string
+
+	switch signal.Type {
+	case SignalForceEnd:
+		if match.State == GameStateFinished && !seriesPending(match) {
+			failure = "match is already finished"
+			break
+		}
+		match.State = GameStateFinished
+		match.Winner = signal.Winner
+		match.EndReason = EndReasonAdmin
+		match.NextGameTick = 0
+		if signal.Winner == "" {
+			// Abandoned: nobody is credited with a result
+			match.ResultRecorded = true
+			logger.Info("Admin abandoned the match")
+		} else {
+			logger.Info("Admin ended the match, awarding it to %s", signal.Winner)
+			h.endGame(ctx, logger, nk, match, true)
+		}
+		h.broadcastState(dispatcher, match, nil)
+
+	case SignalSetTurn:
+		if match.State != GameStatePlaying {
+			failure = "game is not in playing state"
+			break
+		}
+		match.Turn = signal.Turn
+		match.TurnStartTick = match.Tick
+		logger.Info("Admin set the turn to %s", signal.Turn)
+		h.broadcastState(dispatcher, match, nil)
+
+	case SignalKick:
+		kicked := make([]runtime.Presence, 0, len(signal.UserIDs))
+		for _, userID := range signal.UserIDs {
+			if presence, ok := match.Presences[userID]; ok {
+				kicked = append(kicked, presence)
+			} else if presence, ok := match.Spectators[userID]; ok {
+				kicked = append(kicked, presence)
+			}
+		}
+		if len(kicked) == 0 {
+			failure = "none of the users are connected to this match"
+			break
+		}
+		if err := dispatcher.MatchKick(kicked); err != nil {
+			failure = fmt.Sprintf("failed to kick: %v", err)
+			break
+		}
+		logger.Info("Admin kicked %d presences", len(kicked))
+	}
+
+	return inspectMatch(match, failure)
+}
+
+// inspectMatch serializes a match for admins, with an optional failure message
+func inspectMatch(match *TTTMatch, failure string) string {
+	inspection := MatchInspection{
+		State:      savedMatchOf(match),
+		Tick:       match.Tick,
+		Connected:  make([]string, 0, len(match.Presences)),
+		Spectators: make([]string, 0, len(match.Spectators)),
+		Error:      failure,
+	}
+	for userID := range match.Presences {
+		inspection.Connected = append(inspection.Connected, userID)
+	}
+	for userID := range match.Spectators {
+		inspection.Spectators = append(inspection.Spectators, userID)
+	}
+	inspection.Label = match.Label
+
+	result, _ := json.Marshal(inspection)
+	return string(result)
+}
@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"sync"
+	"sort"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/api"
@@ -14,32 +14,63 @@ import (
 
 // MatchmakingRequest represents a matchmaking request
 type MatchmakingRequest struct {
-	Mode string `json:"mode"`
+	Mode      string `json:"mode"`
+	Size      int    `json:"size,omitempty"`       // board size; the mode's own if omitted
+	WinLength int    `json:"win_length,omitempty"` // pieces in a row to win; the mode's own if omitted
+	Ranked    *bool  `json:"ranked,omitempty"`     // ranked unless false; custom boards are always casual
+}
+
+// MatchmakingStatus represents get_matchmaking_status response
+type MatchmakingStatus struct {
+	Queued        bool   `json:"queued"`
+	Mode          string `json:"mode,omitempty"`
+	Ranked        bool   `json:"ranked,omitempty"`
+	Ticket        string `json:"ticket,omitempty"`
+	Position      int    `json:"position,omitempty"`       // 1-based among players queued for the same mode
+	WaitSeconds   int    `json:"wait_seconds"`             // time spent in the queue so far
+	EstimatedWait *int   `json:"estimated_wait,omitempty"` // seconds until matched; omitted without recent data
 }
 
 // MatchmakingResponse represents matchmaking response
 type MatchmakingResponse struct {
-	Ticket string `json:"ticket"`
-	Mode   string `json:"mode"`
+	Ticket    string `json:"ticket"`
+	Mode      string `json:"mode"`
+	Size      int    `json:"size"`
+	WinLength int    `json:"win_length"`
+	Ranked    bool   `json:"ranked"`
 }
 
-// MatchmakingQueue represents a player waiting for a match
-type MatchmakingQueue struct {
-	UserID    string
-	Mode      string
-	Timestamp time.Time
-}
+const (
+	// How long a player waits in the queue before being offered a bot instead
+	defaultBotFallbackTimeout = 20 * time.Second
+	// How often the queue is checked for players who waited too long
+	queueSweepInterval = 5 * time.Second
+
+	// Rating band for pairing: starts narrow and widens the longer a player waits
+	ratingBandBase   = 100
+	ratingBandGrowth = 50
+	ratingBandStep   = 5 * time.Second
+	ratingBandMax    = 600
+
+	// Queues a player can join, kept apart so casual games never pair with ranked ones
+	QueueRanked = "ranked"
+	QueueCasual = "casual"
 
-// Global matchmaking queue
-var (
-	matchmakingQueue = make(map[string]*MatchmakingQueue)
-	queueMutex       sync.RWMutex
+	// Nakama's per-user notification stream; every session of a user is on it
+	streamModeNotifications uint8 = 0
 )
 
+// MatchFoundEvent represents the realtime match-found push, shaped like a match
+// message so clients can handle it with their OpcodeMatchFound handler
+type MatchFoundEvent struct {
+	Opcode int64                  `json:"opcode"`
+	Data   map[string]interface{} `json:"data"`
+}
+
 // InitMatchmaking initializes matchmaking system
 func InitMatchmaking(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	// Register matchmaking RPC
-	if err := initializer.RegisterRpc("start_matchmaking", startMatchmakingRPC); err != nil {
+	if err := initializer.RegisterRpc("start_matchmaking", withRateLimit(matchmakingLimiter, startMatchmakingRPC)); err != nil {
 		return fmt.Errorf("failed to register start_matchmaking RPC: %w", err)
 	}
 
@@ -47,6 +78,10 @@ func InitMatchmaking(ctx context.Context, logger runtime.Logger, db *sql.DB, nk
 		return fmt.Errorf("failed to register stop_matchmaking RPC: %w", err)
 	}
 
+	if err := initializer.RegisterRpc("get_matchmaking_status", getMatchmakingStatusRPC); err != nil {
+		return fmt.Errorf("failed to register get_matchmaking_status RPC: %w", err)
+	}
+
 	// Register matchmaker matched handler
 	if err := initializer.RegisterMatchmakerMatched(func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, entries []runtime.MatchmakerEntry) (string, error) {
 		return handleMatchmakerMatched(ctx, logger, nk, entries)
@@ -54,164 +89,464 @@ func InitMatchmaking(ctx context.Context, logger runtime.Logger, db *sql.DB, nk
 		return fmt.Errorf("failed to register matchmaker matched handler: %w", err)
 	}
 
+	go runQueueSweeper(logger, nk)
+
 	logger.Info("Matchmaking system initialized")
 	return nil
 }
 
 // startMatchmakingRPC starts the matchmaking process
 func startMatchmakingRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
 	var request MatchmakingRequest
 	if err := json.Unmarshal([]byte(payload), &request); err != nil {
-		return "", fmt.Errorf("invalid request format: %w", err)
+		return "", invalidPayload(err)
 	}
 
-	// Validate game mode
-	if request.Mode != GameModeClassic && request.Mode != GameModeAdvanced {
+	// Live-ops events may choose the default mode or restrict which modes are open
+	eventMode, allowedModes := eventModeRules(ctx, logger, nk)
+
+	// Validate game mode; the only limited-time mode open is this week's rotation
+	if !isQueueableMode(request.Mode, time.Now()) {
 		request.Mode = GameModeClassic // Default to classic
+		if isQueueableMode(eventMode, time.Now()) {
+			request.Mode = eventMode
+		}
+	}
+	if allowedModes != nil && !allowedModes[request.Mode] {
+		return "", rpcErrorf(CodeFailedPrecondition, "mode %s is not available during the current event", request.Mode)
+	}
+	logger = logger.WithField("mode", request.Mode)
+
+	// Players only meet opponents who asked for the same board
+	gameMode, _ := lookupGameMode(request.Mode)
+	size, winLength, err := boardVariant(gameMode, request.Size, request.WinLength)
+	if err != nil {
+		return "", rpcError(CodeInvalidArgument, err.Error())
 	}
+	ranked := (request.Ranked == nil || *request.Ranked) && !isCustomVariant(gameMode, size, winLength)
 
 	// Get user ID from context
 	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
 	if !ok {
-		return "", fmt.Errorf("user not authenticated")
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	// Banned players can't queue
+	if err := checkBan(ctx, logger, nk, userID); err != nil {
+		return "", err
+	}
+
+	// A full party queues together through its leader
+	party, err := loadPartyOf(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	partyID, partner := "", ""
+	if party != nil {
+		if party.Leader != userID {
+			return "", rpcError(CodeFailedPrecondition, "only the party leader can queue")
+		}
+		if len(party.Members) < partySize {
+			return "", rpcError(CodeFailedPrecondition, "party needs another member to queue")
+		}
+		partyID, partner = party.ID, party.Members[1]
+		if err := checkBan(ctx, logger, nk, partner); err != nil {
+			return "", err
+		}
+	}
+
+	// Pair by rating, a party by its members' average; an unreadable rating
+	// shouldn't keep the player out of the queue
+	rating := int64(defaultRating)
+	members := []string{userID}
+	if partner != "" {
+		members = append(members, partner)
+	}
+	if ratings, err := loadRatings(ctx, nk, members); err != nil {
+		logger.Warn("Failed to load rating, using default: %v", err)
+	} else {
+		rating = 0
+		for _, member := range members {
+			rating += ratings[member]
+		}
+		rating /= int64(len(members))
+	}
+
+	// Players finish (or leave) the match they are in before queueing again
+	for _, member := range members {
+		matchID, err := activeMatchOf(ctx, nk, member)
+		if err != nil {
+			logger.Warn("Failed to check whether %s is in a match: %v", member, err)
+			continue
+		}
+		if matchID != "" {
+			return "", rpcErrorReason(CodeFailedPrecondition, ReasonInMatch, "already in an active match", map[string]interface{}{
+				"match_id": matchID,
+				"user_id":  member,
+			})
+		}
+	}
+
+	now := time.Now()
+	self := &MatchmakingQueue{
+		UserID:    userID,
+		Mode:      request.Mode,
+		Size:      size,
+		WinLength: winLength,
+		Casual:    !ranked,
+		PartyID:   partyID,
+		Partner:   partner,
+		Rating:    rating,
+		Ticket:    fmt.Sprintf("ticket_%s_%d", userID, now.UnixNano()),
+		Timestamp: now,
+	}
+	response := MatchmakingResponse{
+		Ticket:    self.Ticket,
+		Mode:      request.Mode,
+		Size:      size,
+		WinLength: winLength,
+		Ranked:    ranked,
 	}
 
-	// Add player to matchmaking queue
-	queueMutex.Lock()
-	defer queueMutex.Unlock()
+	// Queue first, replacing any ticket from an earlier call (a retry, or another
+	// device), so the player is only ever queued once. A partner who was queued
+	// on their own now queues with the party.
+	if err := enqueue(ctx, nk, self); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to join matchmaking queue: %v", err)
+	}
+	if partner != "" {
+		if err := dequeue(ctx, nk, partner); err != nil {
+			logger.Warn("Failed to cancel queue entry of partner %s: %v", partner, err)
+		}
+	}
+
+	queue, err := listQueue(ctx, nk)
+	if err != nil {
+		// The sweeper pairs the player later
+		logger.Warn("Failed to read matchmaking queue: %v", err)
+		return rpcOK(response)
+	}
+
+	// Candidates are players waiting for the same mode within either player's band
+	candidates := make([]*MatchmakingQueue, 0)
+	for _, queuedPlayer := range queue {
+		if !queuedPlayer.sameVariant(self) || queuedPlayer.UserID == userID {
+			continue
+		}
+		if !withinRatingBand(rating, 0, queuedPlayer.Rating, now.Sub(queuedPlayer.Timestamp)) {
+			continue
+		}
+		candidates = append(candidates, queuedPlayer)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return ratingGap(rating, candidates[i].Rating) < ratingGap(rating, candidates[j].Rating)
+	})
 
-	// Check if there's already a player waiting for the same mode
+	// Take the closest-rated candidate who is still there; stale ones are dropped
+	// on the way. The caller's entry is claimed with theirs, so if a newer call
+	// replaced it or another node paired the caller meanwhile, this call backs off.
 	var opponent *MatchmakingQueue
-	for _, queuedPlayer := range matchmakingQueue {
-		if queuedPlayer.Mode == request.Mode && queuedPlayer.UserID != userID {
-			opponent = queuedPlayer
+	for _, candidate := range candidates {
+		if reason := staleReason(logger, nk, candidate, now); reason != "" {
+			dropQueueEntry(ctx, logger, nk, candidate, reason)
+			continue
+		}
+		if claimQueueEntries(ctx, nk, candidate, self) {
+			opponent = candidate
 			break
 		}
+		if !stillQueued(ctx, nk, self) {
+			logger.Info("Queue entry of user %s was replaced or paired elsewhere", userID)
+			return rpcOK(response)
+		}
 	}
 
 	if opponent != nil {
-		// Found an opponent! Create a match
 		logger.Info("Found opponent for user %s: %s, mode: %s", userID, opponent.UserID, request.Mode)
 
-		// Remove both players from queue
-		delete(matchmakingQueue, opponent.UserID)
+		matchID, err := startQueuedMatches(ctx, logger, nk, opponent, self)
+		if err == nil {
+			// Return match info to current player
+			response.Ticket = matchID
+			return rpcOK(response)
+		}
 
-		// Create a match
-		matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
-			"mode": request.Mode,
-		})
-		if err != nil {
-			logger.Error("Failed to create match: %v", err)
-			// Add current player to queue as fallback
-			matchmakingQueue[userID] = &MatchmakingQueue{
-				UserID:    userID,
-				Mode:      request.Mode,
-				Timestamp: time.Now(),
-			}
-			ticket := fmt.Sprintf("ticket_%s_%d", userID, time.Now().Unix())
-			response := MatchmakingResponse{
-				Ticket: ticket,
-				Mode:   request.Mode,
+		// Put both players back, the opponent with their original wait
+		logger.Error("Failed to create match: %v", err)
+		for _, entry := range []*MatchmakingQueue{opponent, self} {
+			if err := enqueue(ctx, nk, entry); err != nil {
+				logger.Error("Failed to requeue %s: %v", entry.UserID, err)
 			}
-			responseBytes, _ := json.Marshal(response)
-			return string(responseBytes), nil
 		}
+		return rpcOK(response)
+	}
+
+	logger.Info("Added user %s to matchmaking queue for mode %s, ticket: %s", userID, request.Mode, self.Ticket)
+	return rpcOK(response)
+}
 
-		logger.Info("Created match %s for users %s and %s", matchID, userID, opponent.UserID)
+// runQueueSweeper periodically moves players who waited too long into bot matches
+func runQueueSweeper(logger runtime.Logger, nk runtime.NakamaModule) {
+	ticker := time.NewTicker(queueSweepInterval)
+	defer ticker.Stop()
 
-		// Send notification to the opponent player about the match creation
-		notification := map[string]interface{}{
-			"type":     "match_created",
-			"match_id": matchID,
-			"mode":     request.Mode,
+	for range ticker.C {
+		recoverInto(logger, nk, "queue_sweeper", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			defer cancel()
+			sweepQueue(ctx, logger, nk, time.Now())
+		})
+	}
+}
+
+// sweepQueue drops stale entries, pairs waiting players whose rating bands have
+// widened enough to overlap, then takes players who waited too long off the queue and starts a
+// bot match for each. Every node sweeps; claims keep them from pairing a player twice.
+func sweepQueue(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, now time.Time) {
+	queue, err := listQueue(ctx, nk)
+	if err != nil {
+		logger.Error("Failed to sweep matchmaking queue: %v", err)
+		return
+	}
+
+	// Players who disconnected or waited past the TTL are never paired
+	queue = pruneQueue(ctx, logger, nk, queue, now)
+	recordQueueDepth(nk, queue)
+
+	waiting := pairWaitingPlayers(ctx, logger, nk, queue, now)
+
+	if config.BotFallback <= 0 {
+		return
+	}
+
+	for _, entry := range waiting {
+		// A bot match only seats one player, so parties keep waiting for another party
+		if now.Sub(entry.Timestamp) < config.BotFallback || entry.Partner != "" {
+			continue
+		}
+		// The player may have left, or been paired by another node
+		if !claimQueueEntries(ctx, nk, entry) {
+			continue
 		}
 
-		// Send notification to opponent
-		notificationSend := &runtime.NotificationSend{
-			UserID:     opponent.UserID,
-			Subject:    "Match Created",
-			Content:    notification,
-			Code:       1,
-			Persistent: true,
+		userLogger := withLogLevel(logger).WithFields(map[string]interface{}{"user_id": entry.UserID, "mode": entry.Mode})
+
+		size, winLength := entry.board()
+		matchID, profile, err := createBotMatch(ctx, nk, entry.Mode, size, winLength, BotMedium, 0)
+		if err != nil {
+			// Put the player back so the next sweep can try again
+			userLogger.Error("Failed to create fallback bot match: %v", err)
+			if err := enqueue(ctx, nk, entry); err != nil {
+				userLogger.Error("Failed to requeue player: %v", err)
+			}
+			continue
 		}
 
-		if err := nk.NotificationsSend(ctx, []*runtime.NotificationSend{notificationSend}); err != nil {
-			logger.Error("Failed to send notification to opponent: %v", err)
-		} else {
-			logger.Info("Sent match creation notification to opponent %s", opponent.UserID)
+		recordDepartures(entry.Mode, 1, now)
+		recordQueueWait(nk, entry, now)
+
+		if err := notifyMatchCreated(ctx, nk, entry.UserID, matchID, entry.Mode, map[string]interface{}{"bot": profile.DisplayName}); err != nil {
+			userLogger.Error("Failed to notify player of fallback bot match: %v", err)
+			continue
 		}
+		userLogger.Info("Moved player to bot match %s after %s in queue", matchID, now.Sub(entry.Timestamp).Round(time.Second))
+	}
+}
 
-		// Return match info to current player
-		response := MatchmakingResponse{
-			Ticket: matchID,
-			Mode:   request.Mode,
+// pairWaitingPlayers matches queued players of the same mode, longest waiting
+// first, with the closest-rated opponent inside their current band. It returns
+// the players left waiting.
+func pairWaitingPlayers(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, queue []*MatchmakingQueue, now time.Time) []*MatchmakingQueue {
+	waiting := append([]*MatchmakingQueue(nil), queue...)
+	sort.Slice(waiting, func(i, j int) bool { return waiting[i].Timestamp.Before(waiting[j].Timestamp) })
+
+	paired := make(map[string]bool)
+	for i, entry := range waiting {
+		if paired[entry.UserID] {
+			continue
 		}
-		responseBytes, err := json.Marshal(response)
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal response: %w", err)
+		var opponent *MatchmakingQueue
+		for _, other := range waiting[i+1:] {
+			if paired[other.UserID] || !other.sameVariant(entry) {
+				continue
+			}
+			if !withinRatingBand(entry.Rating, now.Sub(entry.Timestamp), other.Rating, now.Sub(other.Timestamp)) {
+				continue
+			}
+			if opponent == nil || ratingGap(entry.Rating, other.Rating) < ratingGap(entry.Rating, opponent.Rating) {
+				opponent = other
+			}
 		}
-		return string(responseBytes), nil
-	} else {
-		// No opponent found, add to queue
-		matchmakingQueue[userID] = &MatchmakingQueue{
-			UserID:    userID,
-			Mode:      request.Mode,
-			Timestamp: time.Now(),
+		if opponent == nil {
+			continue
 		}
 
-		ticket := fmt.Sprintf("ticket_%s_%d", userID, time.Now().Unix())
-		logger.Info("Added user %s to matchmaking queue for mode %s, ticket: %s", userID, request.Mode, ticket)
+		// Either player may have changed since the scan; they stay out of this sweep either way
+		paired[entry.UserID], paired[opponent.UserID] = true, true
+		if !claimQueueEntries(ctx, nk, entry, opponent) {
+			continue
+		}
+
+		pairLogger := withLogLevel(logger).WithField("mode", entry.Mode)
+		if _, err := startQueuedMatches(ctx, pairLogger, nk, entry, opponent); err != nil {
+			// Requeue both with their original wait so they keep their place
+			pairLogger.Error("Failed to create match for waiting players: %v", err)
+			for _, player := range []*MatchmakingQueue{entry, opponent} {
+				if err := enqueue(ctx, nk, player); err != nil {
+					pairLogger.Error("Failed to requeue %s: %v", player.UserID, err)
+				}
+			}
+		}
+	}
 
-		response := MatchmakingResponse{
-			Ticket: ticket,
-			Mode:   request.Mode,
+	remaining := make([]*MatchmakingQueue, 0, len(waiting))
+	for _, entry := range waiting {
+		if !paired[entry.UserID] {
+			remaining = append(remaining, entry)
 		}
+	}
+	return remaining
+}
 
-		responseBytes, err := json.Marshal(response)
+// startQueuedMatches creates the match for two paired queue entries and tells
+// both players about it. Two parties get a match for their leaders and another
+// for their partners. It returns the match of the leaders.
+func startQueuedMatches(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, a, b *MatchmakingQueue) (string, error) {
+	pairs := [][2]*MatchmakingQueue{{a, b}}
+	if a.Partner != "" && b.Partner != "" {
+		pairs = append(pairs, [2]*MatchmakingQueue{a.partnerEntry(), b.partnerEntry()})
+	}
+
+	matchIDs := make([]string, len(pairs))
+	for i, pair := range pairs {
+		matchID, err := handleMatchmakerMatched(ctx, logger, nk, []runtime.MatchmakerEntry{queueEntry{pair[0]}, queueEntry{pair[1]}})
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal response: %w", err)
+			return "", err
 		}
+		matchIDs[i] = matchID
+	}
 
-		logger.Info("User %s started matchmaking for mode %s, ticket: %s", userID, request.Mode, ticket)
-		return string(responseBytes), nil
+	now := time.Now()
+	for i, pair := range pairs {
+		for _, player := range pair {
+			recordQueueWait(nk, player, now)
+			var extra map[string]interface{}
+			if player.PartyID != "" {
+				extra = map[string]interface{}{"party_id": player.PartyID}
+			}
+			if err := notifyMatchCreated(ctx, nk, player.UserID, matchIDs[i], player.Mode, extra); err != nil {
+				logger.Error("Failed to notify %s of match %s: %v", player.UserID, matchIDs[i], err)
+			}
+		}
 	}
+	return matchIDs[0], nil
+}
+
+// ratingBand returns how far from their own rating a player will accept an opponent
+func ratingBand(waited time.Duration) int64 {
+	band := int64(ratingBandBase + ratingBandGrowth*int(waited/ratingBandStep))
+	if band > ratingBandMax {
+		band = ratingBandMax
+	}
+	return band
+}
+
+// withinRatingBand reports whether two players are close enough in rating, using
+// the wider of their two bands so a long wait helps both sides
+func withinRatingBand(rating int64, waited time.Duration, otherRating int64, otherWaited time.Duration) bool {
+	band := ratingBand(waited)
+	if otherBand := ratingBand(otherWaited); otherBand > band {
+		band = otherBand
+	}
+	return ratingGap(rating, otherRating) <= band
+}
+
+// ratingGap returns the absolute difference between two ratings
+func ratingGap(a, b int64) int64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// notifyMatchCreated tells a player which match they were placed in: immediately
+// over their notification stream if they're online, and with a persistent
+// notification for clients that connect later
+func notifyMatchCreated(ctx context.Context, nk runtime.NakamaModule, userID, matchID, mode string, extra map[string]interface{}) error {
+	content := map[string]interface{}{
+		"type":     "match_created",
+		"match_id": matchID,
+		"mode":     mode,
+	}
+	for key, value := range extra {
+		content[key] = value
+	}
+
+	event, _ := json.Marshal(MatchFoundEvent{Opcode: OpcodeMatchFound, Data: content})
+	streamErr := nk.StreamSend(streamModeNotifications, userID, "", "", string(event), nil, true)
+
+	// Players who turned match-found notifications off only hear about it while online
+	persistent := true
+	if settings, err := GetUserSettings(ctx, nk, userID); err == nil {
+		persistent = settings.MatchFoundNotifications
+	}
+
+	if err := notificationsSend(ctx, nk, []*runtime.NotificationSend{
+		{
+			UserID:     userID,
+			Subject:    "Match Created",
+			Content:    content,
+			Code:       NotificationMatchCreated,
+			Persistent: persistent,
+		},
+	}); err != nil {
+		return err
+	}
+	if streamErr != nil {
+		return fmt.Errorf("failed to push match found event: %w", streamErr)
+	}
+	return nil
 }
 
 // stopMatchmakingRPC stops the matchmaking process
 func stopMatchmakingRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
 	var request struct {
 		Ticket string `json:"ticket"`
 	}
 	if err := json.Unmarshal([]byte(payload), &request); err != nil {
-		return "", fmt.Errorf("invalid request format: %w", err)
+		return "", invalidPayload(err)
 	}
 
 	// Get user ID from context
 	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
 	if !ok {
-		return "", fmt.Errorf("user not authenticated")
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
 	}
 
 	// Remove player from matchmaking queue
-	queueMutex.Lock()
-	defer queueMutex.Unlock()
-
-	if _, exists := matchmakingQueue[userID]; exists {
-		delete(matchmakingQueue, userID)
-		logger.Info("Removed user %s from matchmaking queue, ticket: %s", userID, request.Ticket)
-	} else {
-		logger.Info("User %s was not in matchmaking queue, ticket: %s", userID, request.Ticket)
+	if err := dequeue(ctx, nk, userID); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to leave matchmaking queue: %v", err)
 	}
 
 	logger.Info("User %s stopped matchmaking for ticket: %s", userID, request.Ticket)
-	return `{"success": true}`, nil
+	return rpcOK(map[string]interface{}{"success": true})
 }
 
-// handleMatchmakerMatched handles when matchmaking finds a match
+// handleMatchmakerMatched creates the match for a pairing. It is the single
+// pairing path: Nakama's matchmaker calls it for socket tickets, and the
+// storage-backed queue calls it with adapted entries.
 func handleMatchmakerMatched(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, entries []runtime.MatchmakerEntry) (string, error) {
 	if len(entries) != 2 {
 		return "", fmt.Errorf("expected exactly 2 players, got %d", len(entries))
 	}
+	// Two tickets of one player (e.g. from two devices) must never meet
+	if entries[0].GetPresence().GetUserId() == entries[1].GetPresence().GetUserId() {
+		return "", fmt.Errorf("refusing to pair %s with themselves", entries[0].GetPresence().GetUserId())
+	}
 
 	// Determine game mode from matchmaker properties
 	mode := GameModeClassic
@@ -221,26 +556,105 @@ func handleMatchmakerMatched(ctx context.Context, logger runtime.Logger, nk runt
 			mode = modeStr
 		}
 	}
+	logger = withLogLevel(logger).WithField("mode", mode)
+
+	// Both tickets asked for the same queue and board, so either one's will do.
+	// Both pairing paths stamp the queue; a ticket without one is never ranked.
+	params := map[string]interface{}{
+		"mode":   mode,
+		"ranked": props["queue"] == QueueRanked,
+	}
+	for _, key := range []string{"size", "win_length"} {
+		if value, ok := props[key].(float64); ok && value > 0 {
+			params[key] = int(value)
+		}
+	}
 
 	// Create match
-	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
-		"mode": mode,
-	})
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", params)
 	if err != nil {
 		return "", fmt.Errorf("failed to create match: %w", err)
 	}
+	recordDepartures(mode, len(entries), time.Now())
 
-	logger.Info("Created match %s for mode %s with players: %s, %s",
-		matchID, mode, entries[0].GetPresence().GetUserId(), entries[1].GetPresence().GetUserId())
+	logger.Info("Created match %s for mode %s with players: %s (%d), %s (%d)",
+		matchID, mode,
+		entries[0].GetPresence().GetUserId(), entryRating(entries[0]),
+		entries[1].GetPresence().GetUserId(), entryRating(entries[1]))
 
 	return matchID, nil
 }
 
-// GetMatchmakingStatus returns current matchmaking status
-func GetMatchmakingStatus(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) ([]runtime.MatchmakerEntry, error) {
-	// Return empty since matchmaker API not available
-	logger.Info("Getting matchmaking status for user: %s", userID)
-	return []runtime.MatchmakerEntry{}, nil
+// entryRating reads the rating stamped on a matchmaker ticket
+func entryRating(entry runtime.MatchmakerEntry) int64 {
+	if rating, ok := entry.GetProperties()["rating"].(float64); ok {
+		return int64(rating)
+	}
+	return defaultRating
+}
+
+// getMatchmakingStatusRPC returns the caller's place in the matchmaking queue
+func getMatchmakingStatusRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	status, err := GetMatchmakingStatus(ctx, nk, userID, time.Now())
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	return rpcOK(status)
+}
+
+// GetMatchmakingStatus returns whether a user is queued, their position among
+// players waiting for the same mode, and how long they have waited and may still wait
+func GetMatchmakingStatus(ctx context.Context, nk runtime.NakamaModule, userID string, now time.Time) (*MatchmakingStatus, error) {
+	queue, err := listQueue(ctx, nk)
+	if err != nil {
+		return nil, err
+	}
+
+	var self *MatchmakingQueue
+	for _, entry := range queue {
+		if entry.UserID == userID {
+			self = entry
+			break
+		}
+	}
+	if self == nil {
+		return &MatchmakingStatus{Queued: false}, nil
+	}
+
+	position := 1
+	for _, entry := range queue {
+		if entry.sameVariant(self) && entry.UserID != userID && entry.Timestamp.Before(self.Timestamp) {
+			position++
+		}
+	}
+
+	status := &MatchmakingStatus{
+		Queued:      true,
+		Mode:        self.Mode,
+		Ranked:      !self.Casual,
+		Ticket:      self.Ticket,
+		Position:    position,
+		WaitSeconds: int(now.Sub(self.Timestamp) / time.Second),
+	}
+	if wait, ok := estimatedWait(self.Mode, position, now); ok {
+		// A bot match is offered once the fallback timeout passes
+		if config.BotFallback > 0 {
+			if remaining := config.BotFallback - now.Sub(self.Timestamp); remaining < wait {
+				wait = remaining
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		seconds := int(wait / time.Second)
+		status.EstimatedWait = &seconds
+	}
+	return status, nil
 }
 
 // CreateCustomMatch creates a custom match for testing
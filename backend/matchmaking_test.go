@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// socketEntry is a matchmaker entry as Nakama builds it from a socket ticket,
+// with the string and numeric properties merged into one map
+type socketEntry struct {
+	userID     string
+	properties map[string]interface{}
+}
+
+func (e socketEntry) GetPresence() runtime.Presence         { return queuePresence{userID: e.userID} }
+func (e socketEntry) GetTicket() string                     { return "ticket-" + e.userID }
+func (e socketEntry) GetPartyId() string                    { return "" }
+func (e socketEntry) GetProperties() map[string]interface{} { return e.properties }
+
+// addSocketTicket runs a socket matchmaker ticket through beforeMatchmakerAdd
+// and returns the entry Nakama would pair
+func addSocketTicket(t *testing.T, nk runtime.NakamaModule, userID string, add *rtapi.MatchmakerAdd) socketEntry {
+	t.Helper()
+	envelope := &rtapi.Envelope{Message: &rtapi.Envelope_MatchmakerAdd{MatchmakerAdd: add}}
+	out, err := beforeMatchmakerAdd(sessionContext(userID, userID), discardLogger{}, nil, nk, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamped := out.GetMatchmakerAdd()
+	properties := map[string]interface{}{}
+	for key, value := range stamped.StringProperties {
+		properties[key] = value
+	}
+	for key, value := range stamped.NumericProperties {
+		properties[key] = value
+	}
+	return socketEntry{userID: userID, properties: properties}
+}
+
+func TestSocketTicketsPairIntoTheirQueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		strings    map[string]string
+		numbers    map[string]float64
+		wantRanked bool
+	}{
+		{"no queue asked for", nil, nil, true},
+		{"ranked", map[string]string{"queue": QueueRanked}, nil, true},
+		{"casual", map[string]string{"queue": QueueCasual}, nil, false},
+		{"custom board asking for ranked", map[string]string{"queue": QueueRanked}, map[string]float64{"size": 6, "win_length": 4}, false},
+	}
+	for _, tt := range tests {
+		nk := newMemoryNakama()
+		entries := make([]runtime.MatchmakerEntry, 0, 2)
+		for _, userID := range []string{"user-1", "user-2"} {
+			add := &rtapi.MatchmakerAdd{MinCount: 2, MaxCount: 2, Query: "*", StringProperties: map[string]string{}, NumericProperties: map[string]float64{}}
+			for key, value := range tt.strings {
+				add.StringProperties[key] = value
+			}
+			for key, value := range tt.numbers {
+				add.NumericProperties[key] = value
+			}
+			entries = append(entries, addSocketTicket(t, nk, userID, add))
+		}
+
+		if _, err := handleMatchmakerMatched(sessionContext("", ""), discardLogger{}, nk, entries); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := nk.created[0]["ranked"]; got != tt.wantRanked {
+			t.Errorf("%s: match created with ranked %v, want %v", tt.name, got, tt.wantRanked)
+		}
+	}
+}
+
+func TestUnstampedTicketsAreNeverRanked(t *testing.T) {
+	nk := newMemoryNakama()
+	entries := []runtime.MatchmakerEntry{
+		socketEntry{userID: "user-1", properties: map[string]interface{}{"mode": GameModeClassic}},
+		socketEntry{userID: "user-2", properties: map[string]interface{}{"mode": GameModeClassic}},
+	}
+	if _, err := handleMatchmakerMatched(sessionContext("", ""), discardLogger{}, nk, entries); err != nil {
+		t.Fatal(err)
+	}
+	if nk.created[0]["ranked"] != false {
+		t.Error("tickets without a queue created a ranked match")
+	}
+}
+
+func TestBannedPlayersCannotAddSocketTickets(t *testing.T) {
+	nk := newMemoryNakama()
+	ctx := sessionContext("user-1", "ada")
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{Collection: bansCollection, Key: banKey, UserID: "user-1", Value: `{"kind": "ban", "reason": "cheating"}`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := &rtapi.Envelope{Message: &rtapi.Envelope_MatchmakerAdd{MatchmakerAdd: &rtapi.MatchmakerAdd{MinCount: 2, MaxCount: 2}}}
+	if _, err := beforeMatchmakerAdd(ctx, discardLogger{}, nil, nk, envelope); err == nil {
+		t.Error("a banned player added a matchmaker ticket")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Metric names, exported through Nakama's Prometheus endpoint with the
+// server's metrics prefix
+const (
+	metricMatchesCreated  = "matches_created"  // counter, by mode and ranked
+	metricMatchesFinished = "matches_finished" // counter, by mode and end reason
+	metricGameDuration    = "game_duration"    // timer, by mode; each game of a series counts
+	metricMoves           = "moves"            // counter, by mode; rate() gives moves per second
+	metricQueueDepth      = "queue_depth"      // gauge, by queue and mode
+	metricQueueWait       = "queue_wait"       // timer, by mode; time from queueing to a match
+	metricRPCLatency      = "rpc_latency"      // timer, by rpc
+	metricRPCErrors       = "rpc_errors"       // counter, by rpc
+)
+
+// withRPCMetrics records how long each call of an RPC takes and whether it failed
+func withRPCMetrics(id string, fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		start := time.Now()
+		response, err := fn(ctx, logger, db, nk, payload)
+		tags := map[string]string{"rpc": id}
+		nk.MetricsTimerRecord(metricRPCLatency, tags, time.Since(start))
+		if err != nil {
+			nk.MetricsCounterAdd(metricRPCErrors, tags, 1)
+		}
+		return response, err
+	}
+}
+
+// recordMatchCreated counts a new match. Matches restored after a restart were
+// counted when first created.
+func recordMatchCreated(nk runtime.NakamaModule, match *TTTMatch) {
+	if match.RestoredFrom != "" {
+		return
+	}
+	nk.MetricsCounterAdd(metricMatchesCreated, map[string]string{
+		"mode":   match.Mode,
+		"ranked": strconv.FormatBool(match.Ranked),
+	}, 1)
+}
+
+// recordGameFinished records how long a game that just ended took
+func recordGameFinished(nk runtime.NakamaModule, match *TTTMatch) {
+	duration := time.Since(time.Unix(match.CreatedAt, 0))
+	nk.MetricsTimerRecord(metricGameDuration, map[string]string{"mode": match.Mode}, duration)
+}
+
+// recordMatchFinished counts a match whose result is being recorded
+func recordMatchFinished(nk runtime.NakamaModule, match *TTTMatch) {
+	reason := match.EndReason
+	if reason == "" {
+		reason = "completed"
+	}
+	nk.MetricsCounterAdd(metricMatchesFinished, map[string]string{"mode": match.Mode, "reason": reason}, 1)
+}
+
+// recordMove counts a move played
+func recordMove(nk runtime.NakamaModule, match *TTTMatch) {
+	nk.MetricsCounterAdd(metricMoves, map[string]string{"mode": match.Mode}, 1)
+}
+
+// recordQueueWait records how long a player waited in the queue before their
+// match, or their bot match, was created
+func recordQueueWait(nk runtime.NakamaModule, entry *MatchmakingQueue, now time.Time) {
+	nk.MetricsTimerRecord(metricQueueWait, map[string]string{"mode": entry.Mode}, now.Sub(entry.Timestamp))
+}
+
+// recordQueueDepth sets the queue depth gauges from a full scan of the queue.
+// Every mode and queue is set, so one that empties drops to zero.
+func recordQueueDepth(nk runtime.NakamaModule, queue []*MatchmakingQueue) {
+	depth := make(map[[2]string]int)
+	for _, entry := range queue {
+		players := 1
+		if entry.Partner != "" {
+			players = 2
+		}
+		depth[[2]string{entry.queueName(), entry.Mode}] += players
+	}
+	for _, mode := range gameModes {
+		for _, queueName := range []string{QueueRanked, QueueCasual} {
+			nk.MetricsGaugeSet(metricQueueDepth, map[string]string{"queue": queueName, "mode": mode.Name}, float64(depth[[2]string{queueName, mode.Name}]))
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Player reports (system-owned, keyed by match, reporter, and reported player)
+	reportsCollection = "reports"
+
+	maxReportDetailsLength = 500
+	reportsPageSize        = 50
+
+	// Report statuses
+	ReportStatusOpen     = "open"
+	ReportStatusResolved = "resolved"
+)
+
+// Reasons a player may be reported for
+var reportReasons = map[string]bool{
+	"cheating":      true,
+	"abuse":         true,
+	"stalling":      true,
+	"inappropriate": true,
+	"other":         true,
+}
+
+// Report represents a player's report of another player in a match
+type Report struct {
+	ID         string          `json:"id"`
+	ReporterID string          `json:"reporter_id"`
+	ReportedID string          `json:"reported_id"`
+	MatchID    string          `json:"match_id"`
+	Reason     string          `json:"reason"`
+	Details    string          `json:"details,omitempty"`
+	Evidence   *ReportEvidence `json:"evidence"`
+	Status     string          `json:"status"`
+	CreatedAt  int64           `json:"created_at"`
+	ResolvedAt int64           `json:"resolved_at,omitempty"`
+	Resolution string          `json:"resolution,omitempty"`
+}
+
+// ReportEvidence represents the snapshot of the match taken when it was reported:
+// the full live state (board, moves, and chat) if it is still running, otherwise
+// the reporter's history record of it
+type ReportEvidence struct {
+	Match   *SavedMatch         `json:"match,omitempty"`
+	History *MatchHistoryRecord `json:"history,omitempty"`
+}
+
+// ReportPlayerRequest represents report_player request
+type ReportPlayerRequest struct {
+	UserID  string `json:"user_id"`
+	MatchID string `json:"match_id"`
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+// ListReportsRequest represents admin_list_reports request
+type ListReportsRequest struct {
+	Status string `json:"status,omitempty"` // open (default), resolved, or all
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// InitModeration registers the player report RPC and the admin report RPC
+func InitModeration(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("report_player", reportPlayerRPC); err != nil {
+		return fmt.Errorf("failed to register report_player RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("admin_list_reports", adminListReportsRPC); err != nil {
+		return fmt.Errorf("failed to register admin_list_reports RPC: %w", err)
+	}
+
+	logger.Info("Moderation initialized")
+	return nil
+}
+
+// reportPlayerRPC files a report against the caller's opponent in a match
+func reportPlayerRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request ReportPlayerRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" || request.MatchID == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id and match_id are required")
+	}
+	if request.UserID == userID {
+		return "", rpcError(CodeInvalidArgument, "cannot report yourself")
+	}
+	if !reportReasons[request.Reason] {
+		return "", rpcError(CodeInvalidArgument, "reason must be cheating, abuse, stalling, inappropriate, or other")
+	}
+	details := strings.TrimSpace(request.Details)
+	if utf8.RuneCountInString(details) > maxReportDetailsLength {
+		return "", rpcErrorf(CodeInvalidArgument, "details must be at most %d characters", maxReportDetailsLength)
+	}
+
+	evidence, err := reportEvidence(ctx, nk, request.MatchID, userID, request.UserID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if evidence == nil {
+		return "", rpcError(CodeNotFound, "no match between you and that player was found")
+	}
+
+	report := Report{
+		ID:         reportKey(request.MatchID, userID, request.UserID),
+		ReporterID: userID,
+		ReportedID: request.UserID,
+		MatchID:    request.MatchID,
+		Reason:     request.Reason,
+		Details:    details,
+		Evidence:   evidence,
+		Status:     ReportStatusOpen,
+		CreatedAt:  time.Now().Unix(),
+	}
+	value, _ := json.Marshal(report)
+
+	// Version "*" allows one report per reporter, player, and match
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      reportsCollection,
+			Key:             report.ID,
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return "", rpcError(CodeAlreadyExists, "you already reported this player for this match")
+	}
+
+	logger.WithField("reported_id", request.UserID).Info("Player reported for %s in match %s", request.Reason, request.MatchID)
+	return rpcOK(map[string]interface{}{"report_id": report.ID})
+}
+
+// reportEvidence snapshots a match both players took part in: the live state if
+// the match is still running, otherwise the reporter's history record. It
+// returns nil if neither shows the two players in the match together.
+func reportEvidence(ctx context.Context, nk runtime.NakamaModule, matchID, reporterID, reportedID string) (*ReportEvidence, error) {
+	signal, _ := json.Marshal(MatchSignalData{Type: SignalInspect})
+	if result, err := nk.MatchSignal(ctx, matchID, string(signal)); err == nil {
+		var inspection MatchInspection
+		if err := json.Unmarshal([]byte(result), &inspection); err == nil && inspection.State != nil {
+			_, reporterSeated := inspection.State.Players[reporterID]
+			_, reportedSeated := inspection.State.Players[reportedID]
+			if reporterSeated && reportedSeated {
+				return &ReportEvidence{Match: inspection.State}, nil
+			}
+		}
+	}
+
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: matchHistoryCollection, Key: matchID, UserID: reporterID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read match history: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	var record MatchHistoryRecord
+	if err := json.Unmarshal([]byte(objects[0].Value), &record); err != nil || record.OpponentID != reportedID {
+		return nil, nil
+	}
+	return &ReportEvidence{History: &record}, nil
+}
+
+// reportKey identifies a report, so each reporter may report a player once per match
+func reportKey(matchID, reporterID, reportedID string) string {
+	return fmt.Sprintf("%s_%s_%s", matchID, reporterID, reportedID)
+}
+
+// adminListReportsRPC lists filed reports, newest first within each page (admin only)
+func adminListReportsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request ListReportsRequest
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	switch request.Status {
+	case "":
+		request.Status = ReportStatusOpen
+	case ReportStatusOpen, ReportStatusResolved, "all":
+	default:
+		return "", rpcError(CodeInvalidArgument, "status must be open, resolved, or all")
+	}
+
+	objects, cursor, err := nk.StorageList(ctx, "", "", reportsCollection, reportsPageSize, request.Cursor)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to list reports: %v", err)
+	}
+	reports := make([]Report, 0, len(objects))
+	for _, object := range objects {
+		var report Report
+		if err := json.Unmarshal([]byte(object.Value), &report); err != nil {
+			continue
+		}
+		if request.Status == "all" || report.Status == request.Status {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].CreatedAt > reports[j].CreatedAt
+	})
+
+	return rpcOK(map[string]interface{}{"reports": reports, "cursor": cursor})
+}
+
+// resolveReport marks a report resolved with the action taken
+func resolveReport(ctx context.Context, nk runtime.NakamaModule, reportID, resolution string) error {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: reportsCollection, Key: reportID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read report: %w", err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("report %s not found", reportID)
+	}
+
+	var report Report
+	if err := json.Unmarshal([]byte(objects[0].Value), &report); err != nil {
+		return fmt.Errorf("failed to parse report: %w", err)
+	}
+	report.Status = ReportStatusResolved
+	report.ResolvedAt = time.Now().Unix()
+	report.Resolution = resolution
+	value, _ := json.Marshal(report)
+
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      reportsCollection,
+			Key:             reportID,
+			Value:           string(value),
+			Version:         objects[0].Version,
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to update report: %w", err)
+	}
+	return nil
+}
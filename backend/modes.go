@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+const (
+	// Default match tick rate (ticks per second)
+	defaultTickRate = 2
+
+	// Smallest board a match may be played on; config.MaxBoardSize is the largest
+	minBoardSize = 3
+)
+
+// ScoringProfile holds the flat score delta for each result on limited-time
+// mode leaderboards. Standard modes use Elo ratings instead.
+type ScoringProfile struct {
+	Win  int64 `json:"win"`
+	Draw int64 `json:"draw"`
+	Loss int64 `json:"loss"`
+}
+
+// standardScoring is the scoring used by every mode unless it sets its own
+var standardScoring = defaultConfig().Scoring
+
+// GameMode represents everything the server needs to know about one mode
+type GameMode struct {
+	Name      string         `json:"name"`
+	Size      int            `json:"size"`
+	WinLength int            `json:"win_length"`
+	TickRate  int            `json:"tick_rate"`
+	Scoring   ScoringProfile `json:"scoring"`
+	Limited   bool           `json:"limited"`                 // only queueable during its rotation week
+	Clock     int            `json:"clock_seconds,omitempty"` // each player's total time bank; 0 for untimed games
+	Rules     rules.Rules    `json:"-"`
+}
+
+// gameModes lists every registered mode in display order
+var gameModes = []*GameMode{
+	{Name: GameModeClassic, Size: 3, WinLength: 3, Rules: rules.Standard(3)},
+	{Name: GameModeAdvanced, Size: 5, WinLength: 4, Rules: rules.Standard(5)},
+	{Name: GameModeBlitz, Size: 3, WinLength: 3, TickRate: 10, Clock: 60, Rules: rules.Standard(3)},
+	{Name: GameModeGravity, Size: 4, WinLength: 4, Limited: true, Rules: rules.Gravity(4)},
+	{Name: GameModeWild, Size: 3, WinLength: 3, Limited: true, Rules: rules.Wild(3)},
+	{Name: GameModeMisere, Size: 3, WinLength: 3, Limited: true, Rules: rules.Misere(3)},
+}
+
+// gameModesByName indexes gameModes, filling in defaults
+var gameModesByName = indexGameModes(gameModes)
+
+// indexGameModes applies defaults to each mode and indexes them by name
+func indexGameModes(modes []*GameMode) map[string]*GameMode {
+	byName := make(map[string]*GameMode, len(modes))
+	for _, mode := range modes {
+		if mode.WinLength == 0 {
+			mode.WinLength = mode.Size
+		}
+		if mode.TickRate == 0 {
+			mode.TickRate = defaultTickRate
+		}
+		if mode.Scoring == (ScoringProfile{}) {
+			mode.Scoring = standardScoring
+		}
+		byName[mode.Name] = mode
+	}
+	return byName
+}
+
+// setStandardScoring changes the standard scoring, including that of every mode
+// using it
+func setStandardScoring(scoring ScoringProfile) {
+	for _, mode := range gameModes {
+		if mode.Scoring == standardScoring {
+			mode.Scoring = scoring
+		}
+	}
+	standardScoring = scoring
+}
+
+// InitModes registers the game mode catalogue RPC
+func InitModes(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_game_modes", getGameModesRPC); err != nil {
+		return fmt.Errorf("failed to register get_game_modes RPC: %w", err)
+	}
+
+	logger.Info("Game mode registry initialized with %d modes", len(gameModes))
+	return nil
+}
+
+// getGameModesRPC returns the modes clients can queue for right now
+func getGameModesRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	now := time.Now()
+	modes := make([]*GameMode, 0, len(gameModes))
+	for _, mode := range gameModes {
+		if isQueueableMode(mode.Name, now) {
+			modes = append(modes, mode)
+		}
+	}
+
+	return rpcOK(map[string]interface{}{
+		"modes": modes,
+	})
+}
+
+// lookupGameMode returns a registered mode, falling back to classic for unknown names
+func lookupGameMode(name string) (*GameMode, bool) {
+	mode, ok := gameModesByName[name]
+	if !ok {
+		return gameModesByName[GameModeClassic], false
+	}
+	return mode, true
+}
+
+// isQueueableMode reports whether players may queue for a mode at the given time.
+// Limited-time modes are only open during their rotation week.
+func isQueueableMode(name string, now time.Time) bool {
+	mode, ok := gameModesByName[name]
+	if !ok {
+		return false
+	}
+	return !mode.Limited || currentRotation(now).Mode == name
+}
+
+// boardVariant resolves a requested board size and win length against a mode,
+// where 0 means the mode's own. A size without a win length keeps the mode's
+// win length if it fits, and otherwise needs the whole side.
+func boardVariant(mode *GameMode, size, winLength int) (int, int, error) {
+	if size == 0 {
+		size = mode.Size
+	}
+	if size < minBoardSize || size > config.MaxBoardSize {
+		return 0, 0, fmt.Errorf("size must be between %d and %d", minBoardSize, config.MaxBoardSize)
+	}
+	if winLength == 0 {
+		winLength = mode.WinLength
+		if winLength > size {
+			winLength = size
+		}
+	}
+	if winLength < minWinLength || winLength > size {
+		return 0, 0, fmt.Errorf("win_length must be between %d and %d", minWinLength, size)
+	}
+	return size, winLength, nil
+}
+
+// isCustomVariant reports whether a board differs from the mode's own
+func isCustomVariant(mode *GameMode, size, winLength int) bool {
+	return size != mode.Size || winLength != mode.WinLength
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Parties, owned by the system and keyed by party ID
+	partiesCollection = "parties"
+	// Each member's current party, owned by the member
+	partyMembershipCollection = "party_membership"
+	partyMembershipKey        = "current"
+
+	// Players in a full party; a duo queues against another duo
+	partySize = 2
+)
+
+// Party represents a group of friends who queue together
+type Party struct {
+	ID        string   `json:"party_id"`
+	Leader    string   `json:"leader"`
+	Members   []string `json:"members"` // leader first
+	Invited   []string `json:"invited,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+
+	// Storage version the party was read at
+	version string
+}
+
+// PartyMembership represents the party a player belongs to
+type PartyMembership struct {
+	PartyID string `json:"party_id"`
+}
+
+// InviteToPartyRequest represents invite_to_party request
+type InviteToPartyRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// JoinPartyRequest represents join_party request
+type JoinPartyRequest struct {
+	PartyID string `json:"party_id"`
+}
+
+// InitParties registers the party RPCs
+func InitParties(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("create_party", createPartyRPC); err != nil {
+		return fmt.Errorf("failed to register create_party RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("invite_to_party", inviteToPartyRPC); err != nil {
+		return fmt.Errorf("failed to register invite_to_party RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("join_party", joinPartyRPC); err != nil {
+		return fmt.Errorf("failed to register join_party RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("leave_party", leavePartyRPC); err != nil {
+		return fmt.Errorf("failed to register leave_party RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_party", getPartyRPC); err != nil {
+		return fmt.Errorf("failed to register get_party RPC: %w", err)
+	}
+
+	logger.Info("Parties initialized")
+	return nil
+}
+
+// createPartyRPC starts a party led by the caller
+func createPartyRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	id, err := newChallengeID()
+	if err != nil {
+		return "", rpcError(CodeInternal, err.Error())
+	}
+	party := &Party{
+		ID:        id,
+		Leader:    userID,
+		Members:   []string{userID},
+		CreatedAt: time.Now().Unix(),
+	}
+
+	// The membership is created only if the caller has none, so they can't lead two parties
+	if err := writeParty(ctx, nk, party, userID); err != nil {
+		return "", rpcError(CodeFailedPrecondition, "already in a party")
+	}
+
+	logger.Info("User %s created party %s", userID, party.ID)
+	return rpcOK(party)
+}
+
+// inviteToPartyRPC invites one of the leader's friends to their party
+func inviteToPartyRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	var request InviteToPartyRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.UserID == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id is required")
+	}
+	if request.UserID == userID {
+		return "", rpcError(CodeInvalidArgument, "cannot invite yourself")
+	}
+
+	party, err := loadPartyOf(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if party == nil {
+		return "", rpcError(CodeFailedPrecondition, "not in a party")
+	}
+	if party.Leader != userID {
+		return "", rpcError(CodePermissionDenied, "only the party leader can invite")
+	}
+	if len(party.Members) >= partySize {
+		return "", rpcError(CodeFailedPrecondition, "party is full")
+	}
+
+	friends, err := areFriends(ctx, nk, userID, request.UserID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if !friends {
+		return "", rpcError(CodePermissionDenied, "only friends can be invited to a party")
+	}
+
+	if !containsString(party.Invited, request.UserID) {
+		party.Invited = append(party.Invited, request.UserID)
+		if err := writeParty(ctx, nk, party, ""); err != nil {
+			return "", rpcErrorf(CodeAborted, "party changed, try again: %v", err)
+		}
+	}
+
+	if err := notificationsSend(ctx, nk, []*runtime.NotificationSend{
+		{
+			UserID:  request.UserID,
+			Subject: "Party Invite",
+			Content: map[string]interface{}{
+				"type":        "party_invite",
+				"party_id":    party.ID,
+				"leader":      userID,
+				"leader_name": username,
+			},
+			Code:       NotificationPartyInvite,
+			Sender:     userID,
+			Persistent: true,
+		},
+	}); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to send party invite: %v", err)
+	}
+
+	logger.Info("User %s invited %s to party %s", userID, request.UserID, party.ID)
+	return rpcOK(party)
+}
+
+// joinPartyRPC accepts an invite to a party
+func joinPartyRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request JoinPartyRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.PartyID == "" {
+		return "", rpcError(CodeInvalidArgument, "party_id is required")
+	}
+
+	party, err := loadParty(ctx, nk, request.PartyID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if party == nil || !containsString(party.Invited, userID) {
+		return "", rpcErrorf(CodeNotFound, "no invite to party %s", request.PartyID)
+	}
+	if len(party.Members) >= partySize {
+		return "", rpcError(CodeFailedPrecondition, "party is full")
+	}
+
+	party.Invited = removeString(party.Invited, userID)
+	party.Members = append(party.Members, userID)
+	if err := writeParty(ctx, nk, party, userID); err != nil {
+		return "", rpcErrorf(CodeFailedPrecondition, "could not join party %s; leave your current party first", party.ID)
+	}
+
+	logger.Info("User %s joined party %s", userID, party.ID)
+	return rpcOK(party)
+}
+
+// leavePartyRPC takes the caller out of their party. A leader leaving disbands it.
+func leavePartyRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	party, err := loadPartyOf(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if party == nil {
+		return rpcOK(map[string]interface{}{"left": false})
+	}
+
+	// A queued party is no longer the party that queued
+	if err := dequeue(ctx, nk, party.Leader); err != nil {
+		logger.Warn("Failed to dequeue party %s: %v", party.ID, err)
+	}
+
+	leaving := []string{userID}
+	if party.Leader == userID {
+		leaving = party.Members
+	}
+	deletes := make([]*runtime.StorageDelete, 0, len(leaving)+1)
+	for _, member := range leaving {
+		deletes = append(deletes, &runtime.StorageDelete{Collection: partyMembershipCollection, Key: partyMembershipKey, UserID: member})
+	}
+
+	if party.Leader == userID {
+		deletes = append(deletes, &runtime.StorageDelete{Collection: partiesCollection, Key: party.ID, Version: party.version})
+	} else {
+		party.Members = removeString(party.Members, userID)
+		if err := writeParty(ctx, nk, party, ""); err != nil {
+			return "", rpcErrorf(CodeAborted, "party changed, try again: %v", err)
+		}
+	}
+	if err := nk.StorageDelete(ctx, deletes); err != nil {
+		return "", rpcErrorf(CodeAborted, "party changed, try again: %v", err)
+	}
+
+	logger.Info("User %s left party %s", userID, party.ID)
+	return rpcOK(map[string]interface{}{"left": true, "party_id": party.ID, "disbanded": party.Leader == userID})
+}
+
+// getPartyRPC returns the caller's party, or null if they aren't in one
+func getPartyRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	party, err := loadPartyOf(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	return rpcOK(party)
+}
+
+// loadParty reads a party, returning nil if it doesn't exist
+func loadParty(ctx context.Context, nk runtime.NakamaModule, partyID string) (*Party, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: partiesCollection, Key: partyID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read party: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var party Party
+	if err := json.Unmarshal([]byte(objects[0].Value), &party); err != nil {
+		return nil, fmt.Errorf("failed to parse party: %w", err)
+	}
+	party.version = objects[0].Version
+	return &party, nil
+}
+
+// loadPartyOf reads the party a player belongs to, returning nil if they have none
+func loadPartyOf(ctx context.Context, nk runtime.NakamaModule, userID string) (*Party, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: partyMembershipCollection, Key: partyMembershipKey, UserID: userID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read party membership: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var membership PartyMembership
+	if err := json.Unmarshal([]byte(objects[0].Value), &membership); err != nil {
+		return nil, fmt.Errorf("failed to parse party membership: %w", err)
+	}
+	party, err := loadParty(ctx, nk, membership.PartyID)
+	if err != nil || party == nil || !containsString(party.Members, userID) {
+		// A membership left behind by a disbanded party doesn't count
+		return nil, err
+	}
+	return party, nil
+}
+
+// writeParty saves a party if it hasn't changed since it was read, along with a
+// new membership for joiningUserID (if set) that must not already exist. Both
+// writes succeed or fail together.
+func writeParty(ctx context.Context, nk runtime.NakamaModule, party *Party, joiningUserID string) error {
+	value, _ := json.Marshal(party)
+	version := party.version
+	if version == "" {
+		version = "*"
+	}
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      partiesCollection,
+			Key:             party.ID,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}
+	if joiningUserID != "" {
+		membership, _ := json.Marshal(PartyMembership{PartyID: party.ID})
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      partyMembershipCollection,
+			Key:             partyMembershipKey,
+			UserID:          joiningUserID,
+			Value:           string(membership),
+			Version:         "*",
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		})
+	}
+
+	acks, err := nk.StorageWrite(ctx, writes)
+	if err != nil {
+		return err
+	}
+	party.version = acks[0].GetVersion()
+	return nil
+}
+
+// partnerEntry returns the queue entry of the leader's partner in a queued party,
+// who plays the partner of the opposing party
+func (q *MatchmakingQueue) partnerEntry() *MatchmakingQueue {
+	partner := *q
+	partner.UserID = q.Partner
+	partner.Partner = q.UserID
+	return &partner
+}
+
+// containsString reports whether values holds value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns values without value
+func removeString(values []string, value string) []string {
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Per-player results on the resetting leaderboards, one object per leaderboard
+// keyed by its ID. Each object belongs to the period ending at ExpiresAt, the
+// expiry Nakama gives the player's record, so counters start over with the board.
+const periodStatsCollection = "period_stats"
+
+// PeriodStats represents a player's ranked results within one leaderboard period
+type PeriodStats struct {
+	ExpiresAt   int64 `json:"expires_at"`
+	GamesPlayed int   `json:"games_played"`
+	GamesWon    int   `json:"games_won"`
+	GamesLost   int   `json:"games_lost"`
+	GamesDrawn  int   `json:"games_drawn"`
+}
+
+// getMonthlyLeaderboardRPC returns the monthly (season) leaderboard with each
+// player's results this month
+func getMonthlyLeaderboardRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	request := parseLeaderboardRequest(payload)
+
+	// Only first pages are cached, since every page has its own cursor
+	cacheKey := fmt.Sprintf("%s:%d", config.SeasonLeaderboardID, request.Limit)
+
+	records, _, next, prev, err := nk.LeaderboardRecordsList(ctx, config.SeasonLeaderboardID, nil, request.Limit, request.Cursor, 0)
+	if err != nil {
+		cached, ok := cachedLeaderboard(cacheKey)
+		if !ok || request.Cursor != "" {
+			return "", rpcErrorf(CodeUnavailable, "failed to get monthly leaderboard records: %v", err)
+		}
+		logger.Warn("Serving cached monthly leaderboard after read failure: %v", err)
+		return leaderboardResponse(ctx, logger, nk, cached, true)
+	}
+
+	page := leaderboardPage{Entries: leaderboardEntries(ctx, logger, nk, config.SeasonLeaderboardID, records), NextCursor: next, PrevCursor: prev}
+	if request.Cursor == "" {
+		cacheLeaderboard(cacheKey, page)
+	}
+	return leaderboardResponse(ctx, logger, nk, page, false)
+}
+
+// loadPeriodStats reads several players' stats for a leaderboard in one storage
+// call, with their storage versions. Players without any are left out.
+func loadPeriodStats(ctx context.Context, nk runtime.NakamaModule, leaderboardID string, userIDs []string) (map[string]*PeriodStats, map[string]string, error) {
+	stats := make(map[string]*PeriodStats, len(userIDs))
+	versions := make(map[string]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return stats, versions, nil
+	}
+
+	reads := make([]*runtime.StorageRead, len(userIDs))
+	for i, userID := range userIDs {
+		reads[i] = &runtime.StorageRead{Collection: periodStatsCollection, Key: leaderboardID, UserID: userID}
+	}
+	objects, err := storageRead(ctx, nk, reads)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read period stats: %w", err)
+	}
+
+	for _, object := range objects {
+		var stored PeriodStats
+		if err := json.Unmarshal([]byte(object.Value), &stored); err != nil {
+			continue
+		}
+		stats[object.UserId] = &stored
+		versions[object.UserId] = object.Version
+	}
+	return stats, versions, nil
+}
+
+// recordPeriodStats adds a ranked result to a player's stats for the period of
+// a leaderboard ending at expiresAt, starting over if the stored stats belong to
+// an earlier period, and returns the updated stats. Like UpdateUserStats, it
+// retries on write conflicts.
+func recordPeriodStats(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, leaderboardID, userID string, expiresAt int64, result GameResult) (*PeriodStats, error) {
+	for attempt := 0; ; attempt++ {
+		loaded, versions, err := loadPeriodStats(ctx, nk, leaderboardID, []string{userID})
+		if err != nil {
+			return nil, err
+		}
+		stats, ok := loaded[userID]
+		if !ok || stats.ExpiresAt != expiresAt {
+			stats = &PeriodStats{ExpiresAt: expiresAt}
+		}
+		stats.GamesPlayed++
+		switch {
+		case result.Won:
+			stats.GamesWon++
+		case result.Lost:
+			stats.GamesLost++
+		case result.Drawn:
+			stats.GamesDrawn++
+		}
+
+		// Create-only when nothing is stored, so a concurrent first write conflicts too
+		version := versions[userID]
+		if version == "" {
+			version = "*"
+		}
+		value, _ := json.Marshal(stats)
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{
+			{
+				Collection:      periodStatsCollection,
+				Key:             leaderboardID,
+				UserID:          userID,
+				Value:           string(value),
+				Version:         version,
+				PermissionRead:  1,
+				PermissionWrite: 0,
+			},
+		})
+		if err == nil {
+			return stats, nil
+		}
+		if attempt+1 >= statsWriteAttempts {
+			return nil, fmt.Errorf("failed to update period stats: %w", err)
+		}
+		logger.WithField("user_id", userID).Debug("Period stats write conflict, retrying: %v", err)
+	}
+}
+
+// periodEnds returns when each resetting leaderboard's current period ends,
+// which is the expiry Nakama gives records written now
+func periodEnds(ctx context.Context, nk runtime.NakamaModule, leaderboardIDs []string) (map[string]int64, error) {
+	leaderboards, err := nk.LeaderboardsGetId(ctx, leaderboardIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leaderboards: %w", err)
+	}
+	ends := make(map[string]int64, len(leaderboards))
+	for _, leaderboard := range leaderboards {
+		ends[leaderboard.GetId()] = int64(leaderboard.GetNextReset())
+	}
+	return ends, nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+const (
+	// In-flight match state (system-owned, keyed by match ID) so games survive a restart
+	activeMatchesCollection = "active_matches"
+)
+
+// SavedMatch represents the persisted state of an in-flight match. Presences
+// aren't saved: players reconnect to the resumed match instance.
+type SavedMatch struct {
+	MatchID             string            `json:"match_id"`
+	ResumedAs           string            `json:"resumed_as,omitempty"` // match that took over after a restart
+	Mode                string            `json:"mode"`
+	Ranked              bool              `json:"ranked"`
+	RotationLeaderboard string            `json:"rotation_leaderboard,omitempty"`
+	Size                int               `json:"size"`
+	WinLength           int               `json:"win_length"`
+	Board               [][]string        `json:"board,omitempty"`     // small boards
+	BoardRLE            string            `json:"board_rle,omitempty"` // boards of compactBoardSize and up, run-length encoded
+	Turn                string            `json:"turn"`
+	Winner              string            `json:"winner,omitempty"`
+	State               string            `json:"state"`
+	Players             map[string]string `json:"players"`
+	MoveCount           int               `json:"move_count"`
+	Moves               []MoveRecord      `json:"moves"`
+	CreatedAt           int64             `json:"created_at"`
+	HintBudget          int               `json:"hint_budget"`
+	HintsUsed           map[string]int    `json:"hints_used,omitempty"`
+	UndoLimit           int               `json:"undo_limit"`
+	UndosUsed           map[string]int    `json:"undos_used,omitempty"`
+	Bots                map[string]bool   `json:"bots,omitempty"`
+	BotDifficulty       string            `json:"bot_difficulty,omitempty"`
+	BotLevel            int               `json:"bot_level,omitempty"`
+	TurnSeconds         int               `json:"turn_seconds"`
+	AfkSeconds          int               `json:"afk_seconds"`
+	ClockSeconds        int               `json:"clock_seconds,omitempty"`
+	Clocks              map[string]int64  `json:"clocks,omitempty"` // ticks left on each game clock
+	TurnTimeouts        map[string]int    `json:"turn_timeouts,omitempty"`
+	Round               int               `json:"round"`
+	BestOf              int               `json:"best_of"`
+	SeriesGame          int               `json:"series_game"`
+	SeriesWins          map[string]int    `json:"series_wins,omitempty"`
+	Chat                []ChatMessage     `json:"chat,omitempty"`
+	Public              bool              `json:"public,omitempty"`
+	SavedAt             int64             `json:"saved_at"`
+}
+
+// ResumeMatchRequest represents resume_match request
+type ResumeMatchRequest struct {
+	MatchID string `json:"match_id"`
+}
+
+// Latest unsaved state per match ID; a nil value means the saved state should be
+// deleted. Only the newest state of each match is written, so a burst of moves
+// costs one storage write.
+var (
+	pendingSaves      = make(map[string][]byte)
+	pendingSavesMutex sync.Mutex
+	pendingSavesReady = make(chan struct{}, 1)
+
+	// Serializes resumes so both players of a match land in the same new instance
+	resumeMutex sync.Mutex
+)
+
+// InitPersistence starts the match state writer and registers the resume RPC
+func InitPersistence(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	go runMatchStateWriter(logger, nk)
+
+	if err := initializer.RegisterRpc("resume_match", resumeMatchRPC); err != nil {
+		return fmt.Errorf("failed to register resume_match RPC: %w", err)
+	}
+
+	logger.Info("Match state persistence initialized")
+	return nil
+}
+
+// saveMatchState queues the match's current state to be persisted. Finished
+// matches have their saved state removed instead.
+func saveMatchState(match *TTTMatch) {
+	if match.SimulationID != "" || match.ID == "" {
+		return
+	}
+
+	var value []byte
+	if match.State != GameStateFinished || seriesPending(match) {
+		value, _ = json.Marshal(savedMatchOf(match))
+	}
+
+	pendingSavesMutex.Lock()
+	pendingSaves[match.ID] = value
+	if value == nil && match.RestoredFrom != "" {
+		// The forwarding record of the match this one resumed is no longer needed
+		pendingSaves[match.RestoredFrom] = nil
+	}
+	pendingSavesMutex.Unlock()
+
+	select {
+	case pendingSavesReady <- struct{}{}:
+	default:
+	}
+}
+
+// runMatchStateWriter flushes queued match states to storage outside the match loop
+func runMatchStateWriter(logger runtime.Logger, nk runtime.NakamaModule) {
+	for range pendingSavesReady {
+		pendingSavesMutex.Lock()
+		batch := pendingSaves
+		pendingSaves = make(map[string][]byte)
+		pendingSavesMutex.Unlock()
+
+		recoverInto(logger, nk, "save_match_state", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), resultTimeout)
+			defer cancel()
+			flushMatchStates(ctx, logger, nk, batch)
+		})
+	}
+}
+
+// flushMatchStates writes and deletes a batch of saved match states
+func flushMatchStates(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, batch map[string][]byte) {
+	writes := make([]*runtime.StorageWrite, 0, len(batch))
+	deletes := make([]*runtime.StorageDelete, 0)
+	for matchID, value := range batch {
+		if value == nil {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: activeMatchesCollection, Key: matchID})
+			continue
+		}
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      activeMatchesCollection,
+			Key:             matchID,
+			Value:           string(value),
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		})
+	}
+
+	if len(writes) > 0 {
+		if _, err := storageWrite(ctx, nk, writes); err != nil {
+			logger.Error("Failed to save state of %d matches: %v", len(writes), err)
+		}
+	}
+	if len(deletes) > 0 {
+		if err := nk.StorageDelete(ctx, deletes); err != nil {
+			logger.Warn("Failed to delete state of %d finished matches: %v", len(deletes), err)
+		}
+	}
+}
+
+// savedMatchOf copies the persistable state of a match
+func savedMatchOf(match *TTTMatch) *SavedMatch {
+	turnSeconds, afkSeconds, clockSeconds := 0, 0, 0
+	if match.TickRate > 0 {
+		turnSeconds = int(match.TurnTicks) / match.TickRate
+		afkSeconds = int(match.AfkTicks) / match.TickRate
+		clockSeconds = int(match.ClockTicks) / match.TickRate
+	}
+	saved := &SavedMatch{
+		MatchID:             match.ID,
+		Mode:                match.Mode,
+		Ranked:              match.Ranked,
+		RotationLeaderboard: match.RotationLeaderboard,
+		Size:                match.Size,
+		WinLength:           match.WinLength,
+		Turn:                match.Turn,
+		Winner:              match.Winner,
+		State:               match.State,
+		Players:             match.Players,
+		MoveCount:           match.MoveCount,
+		Moves:               match.Moves,
+		CreatedAt:           match.CreatedAt,
+		HintBudget:          match.HintBudget,
+		HintsUsed:           match.HintsUsed,
+		UndoLimit:           match.UndoLimit,
+		UndosUsed:           match.UndosUsed,
+		Bots:                match.Bots,
+		BotDifficulty:       match.BotDifficulty,
+		BotLevel:            match.BotLevel,
+		TurnSeconds:         turnSeconds,
+		AfkSeconds:          afkSeconds,
+		ClockSeconds:        clockSeconds,
+		Clocks:              match.Clocks,
+		TurnTimeouts:        match.TurnTimeouts,
+		Round:               match.Round,
+		BestOf:              match.BestOf,
+		SeriesGame:          match.SeriesGame,
+		SeriesWins:          match.SeriesWins,
+		Chat:                match.Chat,
+		Public:              match.Public,
+		SavedAt:             time.Now().Unix(),
+	}
+	if match.Size >= compactBoardSize {
+		saved.BoardRLE = match.Board.RunLength()
+	} else {
+		saved.Board = match.Board.Rows()
+	}
+	return saved
+}
+
+// restoreMatch copies saved state into a freshly initialized match. The series
+// break, if any, restarts from the new match's first tick.
+func restoreMatch(match *TTTMatch, saved *SavedMatch) {
+	match.Mode = saved.Mode
+	match.Ranked = saved.Ranked
+	match.RotationLeaderboard = saved.RotationLeaderboard
+	match.Size = saved.Size
+	match.WinLength = saved.WinLength
+	match.Board = rules.FromRows(saved.Board)
+	if saved.BoardRLE != "" {
+		// Checked when the saved match was loaded
+		match.Board, _ = rules.FromRunLength(saved.Size, saved.BoardRLE)
+	}
+	match.Board.WinLength = saved.WinLength
+	match.Turn = saved.Turn
+	match.Winner = saved.Winner
+	match.State = saved.State
+	match.Players = saved.Players
+	match.MoveCount = saved.MoveCount
+	match.Moves = saved.Moves
+	match.CreatedAt = saved.CreatedAt
+	match.HintBudget = saved.HintBudget
+	match.UndoLimit = saved.UndoLimit
+	match.BotDifficulty = saved.BotDifficulty
+	match.BotLevel = saved.BotLevel
+	match.TurnTicks = int64(saved.TurnSeconds * match.TickRate)
+	match.AfkTicks = int64(saved.AfkSeconds * match.TickRate)
+	match.ClockTicks = int64(saved.ClockSeconds * match.TickRate)
+	match.Round = saved.Round
+	match.BestOf = saved.BestOf
+	match.Public = saved.Public
+	match.SeriesGame = saved.SeriesGame
+	if saved.HintsUsed != nil {
+		match.HintsUsed = saved.HintsUsed
+	}
+	if saved.UndosUsed != nil {
+		match.UndosUsed = saved.UndosUsed
+	}
+	if saved.Bots != nil {
+		match.Bots = saved.Bots
+	}
+	if saved.TurnTimeouts != nil {
+		match.TurnTimeouts = saved.TurnTimeouts
+	}
+	if saved.SeriesWins != nil {
+		match.SeriesWins = saved.SeriesWins
+	}
+	if saved.Clocks != nil {
+		match.Clocks = saved.Clocks
+	}
+	if saved.Chat != nil {
+		match.Chat = saved.Chat
+	}
+	if match.Moves == nil {
+		match.Moves = []MoveRecord{}
+	}
+	if match.State == GameStateFinished && match.BestOf > 1 {
+		match.NextGameTick = int64(seriesBreakSeconds * match.TickRate)
+	}
+}
+
+// loadSavedMatch reads a match's saved state, returning nil if there is none
+func loadSavedMatch(ctx context.Context, nk runtime.NakamaModule, matchID string) (*SavedMatch, string, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: activeMatchesCollection, Key: matchID},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read saved match: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, "", nil
+	}
+
+	var saved SavedMatch
+	if err := json.Unmarshal([]byte(objects[0].Value), &saved); err != nil {
+		return nil, "", fmt.Errorf("failed to parse saved match: %w", err)
+	}
+	if saved.BoardRLE != "" {
+		if _, err := rules.FromRunLength(saved.Size, saved.BoardRLE); err != nil {
+			return nil, "", fmt.Errorf("failed to parse saved match board: %w", err)
+		}
+	}
+	return &saved, objects[0].Version, nil
+}
+
+// resumeMatchRPC returns the match a player should rejoin. If the original match
+// is gone (e.g. the node restarted), a new match is created from its saved state.
+func resumeMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request ResumeMatchRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if request.MatchID == "" {
+		return "", rpcError(CodeInvalidArgument, "match_id is required")
+	}
+
+	resumeMutex.Lock()
+	defer resumeMutex.Unlock()
+
+	saved, version, err := loadSavedMatch(ctx, nk, request.MatchID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if saved == nil {
+		return "", rpcErrorf(CodeNotFound, "no saved state for match %s", request.MatchID)
+	}
+	if _, seated := saved.Players[userID]; !seated {
+		return "", rpcError(CodePermissionDenied, "not a player in this match")
+	}
+
+	// The other player may already have resumed it
+	if saved.ResumedAs != "" {
+		return rpcOK(map[string]interface{}{"match_id": saved.ResumedAs, "resumed": true})
+	}
+
+	// Nothing to resume if the original match is still running
+	if live, err := nk.MatchGet(ctx, request.MatchID); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to look up match: %v", err)
+	} else if live != nil {
+		return rpcOK(map[string]interface{}{"match_id": request.MatchID, "resumed": false})
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+		"mode":         saved.Mode,
+		"restore_from": request.MatchID,
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to create match: %v", err)
+	}
+
+	// Leave a forwarding record so the other player joins the same match
+	saved.ResumedAs = matchID
+	value, _ := json.Marshal(saved)
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      activeMatchesCollection,
+			Key:             request.MatchID,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Warn("Failed to record that match %s resumed as %s: %v", request.MatchID, matchID, err)
+	}
+
+	logger.Info("Resumed match %s as %s", request.MatchID, matchID)
+	return rpcOK(map[string]interface{}{"match_id": matchID, "resumed": true})
+}
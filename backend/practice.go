@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-user record of practice games against adaptive bots
+	botPracticeCollection = "bot_practice"
+	botPracticeKey        = "adaptive"
+
+	// Adaptive bot strength: level 1 plays at random, the top level plays
+	// every move with the solver
+	minBotLevel      = 1
+	maxBotLevel      = 10
+	startingBotLevel = 5
+
+	botPracticeWriteAttempts = 3
+)
+
+// BotPractice represents a player's results against adaptive bots and the
+// level their next adaptive bot plays at
+type BotPractice struct {
+	Level  int `json:"level"`
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+}
+
+// loadBotPractice reads a player's practice record and its storage version.
+// Players who never practised start at startingBotLevel.
+func loadBotPractice(ctx context.Context, nk runtime.NakamaModule, userID string) (*BotPractice, string, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: botPracticeCollection, Key: botPracticeKey, UserID: userID},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read bot practice: %w", err)
+	}
+
+	practice := &BotPractice{Level: startingBotLevel}
+	if len(objects) == 0 {
+		return practice, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), practice); err != nil {
+		return nil, "", fmt.Errorf("failed to parse bot practice: %w", err)
+	}
+	practice.Level = clampBotLevel(practice.Level)
+	return practice, objects[0].Version, nil
+}
+
+// recordBotPractice applies a finished adaptive bot game to the human player's
+// practice record. A win raises the next bot's level and a loss lowers it, so
+// the level settles where the player wins about half their games.
+func recordBotPractice(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	for userID, symbol := range match.Players {
+		if match.Bots[userID] {
+			continue
+		}
+		result := resultFor(match, symbol)
+
+		for attempt := 0; ; attempt++ {
+			practice, version, err := loadBotPractice(ctx, nk, userID)
+			if err != nil {
+				logger.Warn("Failed to update bot practice of %s: %v", userID, err)
+				break
+			}
+			practice.apply(result)
+
+			value, _ := json.Marshal(practice)
+			_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{
+				{
+					Collection:      botPracticeCollection,
+					Key:             botPracticeKey,
+					UserID:          userID,
+					Value:           string(value),
+					Version:         version,
+					PermissionRead:  1,
+					PermissionWrite: 0,
+				},
+			})
+			if err == nil {
+				break
+			}
+			// Another game for this player finished first; redo the update on top of it
+			if attempt+1 >= botPracticeWriteAttempts {
+				logger.Warn("Failed to update bot practice of %s: %v", userID, err)
+				break
+			}
+		}
+	}
+}
+
+// apply counts a result and moves the level one step towards an even game
+func (p *BotPractice) apply(result string) {
+	switch result {
+	case ResultWin:
+		p.Wins++
+		p.Level = clampBotLevel(p.Level + 1)
+	case ResultLoss:
+		p.Losses++
+		p.Level = clampBotLevel(p.Level - 1)
+	default:
+		p.Draws++
+	}
+}
+
+// clampBotLevel keeps a level within the adaptive range
+func clampBotLevel(level int) int {
+	return min(max(level, minBotLevel), maxBotLevel)
+}
+
+// adaptiveMoveDifficulty picks how an adaptive bot at level plays its next
+// move: with the solver, at a chance rising with the level, or else at random
+func adaptiveMoveDifficulty(level int) string {
+	strength := float64(clampBotLevel(level)-minBotLevel) / float64(maxBotLevel-minBotLevel)
+	if rand.Float64() < strength {
+		return BotHard
+	}
+	return BotEasy
+}
+
+// adaptiveBotIdentity returns the fixed difficulty of the bot persona an
+// adaptive bot at level appears as
+func adaptiveBotIdentity(level int) string {
+	switch {
+	case level <= 3:
+		return BotEasy
+	case level <= 7:
+		return BotMedium
+	default:
+		return BotHard
+	}
+}
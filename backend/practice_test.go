@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBotPracticeLevelFollowsResults(t *testing.T) {
+	practice := BotPractice{Level: startingBotLevel}
+	practice.apply(ResultWin)
+	practice.apply(ResultWin)
+	practice.apply(ResultDraw)
+	practice.apply(ResultLoss)
+	if practice.Level != startingBotLevel+1 || practice.Wins != 2 || practice.Losses != 1 || practice.Draws != 1 {
+		t.Errorf("got %+v after two wins, a draw, and a loss", practice)
+	}
+
+	practice.Level = maxBotLevel
+	practice.apply(ResultWin)
+	if practice.Level != maxBotLevel {
+		t.Errorf("level rose past the top to %d", practice.Level)
+	}
+	practice.Level = minBotLevel
+	practice.apply(ResultLoss)
+	if practice.Level != minBotLevel {
+		t.Errorf("level fell past the bottom to %d", practice.Level)
+	}
+}
+
+func TestAdaptiveMoveDifficultyAtTheEnds(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if got := adaptiveMoveDifficulty(minBotLevel); got != BotEasy {
+			t.Fatalf("lowest level played a %s move", got)
+		}
+		if got := adaptiveMoveDifficulty(maxBotLevel); got != BotHard {
+			t.Fatalf("top level played a %s move", got)
+		}
+	}
+}
+
+func TestRecordBotPracticeCountsOnlyThePerson(t *testing.T) {
+	nk := newMemoryNakama()
+	match := &TTTMatch{
+		BotDifficulty: BotAdaptive,
+		Winner:        PlayerX,
+		Players:       map[string]string{"user-1": PlayerX, "bot": PlayerO},
+		Bots:          map[string]bool{"bot": true},
+	}
+	recordBotPractice(context.Background(), discardLogger{}, nk, match)
+	recordBotPractice(context.Background(), discardLogger{}, nk, match)
+
+	practice, _, err := loadBotPractice(context.Background(), nk, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if practice.Level != startingBotLevel+2 || practice.Wins != 2 {
+		t.Errorf("got %+v after two wins, want level %d", practice, startingBotLevel+2)
+	}
+	if bot, _, _ := loadBotPractice(context.Background(), nk, "bot"); bot.Wins+bot.Losses != 0 {
+		t.Error("the bot's results were recorded")
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Invite code -> match lookup, owned by the system user
+	privateMatchCollection = "private_matches"
+
+	// Invite codes skip look-alike characters (0/O, 1/I) so they can be read aloud
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	inviteCodeLength   = 6
+	inviteCodeAttempts = 5
+)
+
+// PrivateMatchRequest represents create_private_match request
+type PrivateMatchRequest struct {
+	Mode   string `json:"mode"`
+	BestOf int    `json:"best_of,omitempty"` // play a best-of-N series instead of a single game
+}
+
+// JoinPrivateMatchRequest represents join_private_match request
+type JoinPrivateMatchRequest struct {
+	Code string `json:"code"`
+}
+
+// PrivateMatchResponse represents a private match and its invite code
+type PrivateMatchResponse struct {
+	MatchID string `json:"match_id"`
+	Code    string `json:"code"`
+	Mode    string `json:"mode"`
+	Host    string `json:"host"`
+}
+
+// PrivateMatchRecord represents the stored invite code entry
+type PrivateMatchRecord struct {
+	MatchID   string `json:"match_id"`
+	Mode      string `json:"mode"`
+	Host      string `json:"host"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// InitPrivateMatches registers the private match RPCs
+func InitPrivateMatches(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("create_private_match", createPrivateMatchRPC); err != nil {
+		return fmt.Errorf("failed to register create_private_match RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("join_private_match", joinPrivateMatchRPC); err != nil {
+		return fmt.Errorf("failed to register join_private_match RPC: %w", err)
+	}
+
+	logger.Info("Private matches initialized")
+	return nil
+}
+
+// createPrivateMatchRPC creates a casual match that can only be found by its invite code
+func createPrivateMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	request := PrivateMatchRequest{Mode: GameModeClassic}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.Mode == "" {
+		request.Mode = GameModeClassic
+	}
+	if !isQueueableMode(request.Mode, time.Now()) {
+		return "", rpcErrorf(CodeInvalidArgument, "mode %s is not available", request.Mode)
+	}
+	if request.BestOf == 0 {
+		request.BestOf = 1
+	}
+	if request.BestOf < 1 || request.BestOf > maxBestOf || request.BestOf%2 == 0 {
+		return "", rpcErrorf(CodeInvalidArgument, "best_of must be an odd number from 1 to %d", maxBestOf)
+	}
+
+	record := PrivateMatchRecord{
+		Mode:      request.Mode,
+		Host:      userID,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	// Reserve a code before creating the match, which releases it when it ends
+	code, version, err := claimInviteCode(ctx, nk, record)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to reserve invite code: %v", err)
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+		"mode":         request.Mode,
+		"ranked":       false,
+		"private_code": code,
+		"best_of":      request.BestOf,
+	})
+	if err != nil {
+		releaseInviteCode(ctx, logger, nk, code)
+		return "", rpcErrorf(CodeUnavailable, "failed to create match: %v", err)
+	}
+
+	record.MatchID = matchID
+	value, _ := json.Marshal(record)
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      privateMatchCollection,
+			Key:             code,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		releaseInviteCode(ctx, logger, nk, code)
+		return "", rpcErrorf(CodeUnavailable, "failed to store invite code: %v", err)
+	}
+
+	logger.Info("Created private %s match %s with code %s", request.Mode, matchID, code)
+	return rpcOK(PrivateMatchResponse{
+		MatchID: matchID,
+		Code:    code,
+		Mode:    request.Mode,
+		Host:    userID,
+	})
+}
+
+// joinPrivateMatchRPC resolves an invite code to the match the caller should join
+func joinPrivateMatchRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request JoinPrivateMatchRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	code := normalizeInviteCode(request.Code)
+	if code == "" {
+		return "", rpcError(CodeInvalidArgument, "code is required")
+	}
+
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: privateMatchCollection, Key: code},
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to look up invite code: %v", err)
+	}
+	if len(objects) == 0 {
+		return "", rpcErrorf(CodeNotFound, "no private match with code %s", code)
+	}
+
+	var record PrivateMatchRecord
+	if err := json.Unmarshal([]byte(objects[0].Value), &record); err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to parse invite code: %v", err)
+	}
+	if record.MatchID == "" {
+		return "", rpcError(CodeUnavailable, "private match is still being created")
+	}
+
+	match, err := nk.MatchGet(ctx, record.MatchID)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to look up match: %v", err)
+	}
+	if match == nil {
+		// The match ended without cleaning up after itself
+		releaseInviteCode(ctx, logger, nk, code)
+		return "", rpcErrorf(CodeNotFound, "private match %s has ended", code)
+	}
+	if userID != record.Host && match.GetSize() >= 2 {
+		return "", rpcErrorf(CodeFailedPrecondition, "private match %s is full", code)
+	}
+
+	logger.Info("User %s joining private match %s with code %s", userID, record.MatchID, code)
+	return rpcOK(PrivateMatchResponse{
+		MatchID: record.MatchID,
+		Code:    code,
+		Mode:    record.Mode,
+		Host:    record.Host,
+	})
+}
+
+// claimInviteCode reserves an unused invite code, returning it with its storage version
+func claimInviteCode(ctx context.Context, nk runtime.NakamaModule, record PrivateMatchRecord) (string, string, error) {
+	value, _ := json.Marshal(record)
+
+	var lastErr error
+	for attempt := 0; attempt < inviteCodeAttempts; attempt++ {
+		code, err := newInviteCode()
+		if err != nil {
+			return "", "", err
+		}
+
+		// Version "*" only succeeds if the code isn't taken yet
+		acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+			{
+				Collection:      privateMatchCollection,
+				Key:             code,
+				Value:           string(value),
+				Version:         "*",
+				PermissionRead:  0,
+				PermissionWrite: 0,
+			},
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return code, acks[0].GetVersion(), nil
+	}
+
+	return "", "", fmt.Errorf("no free code after %d attempts: %w", inviteCodeAttempts, lastErr)
+}
+
+// releaseInviteCode frees an invite code so it can be handed out again
+func releaseInviteCode(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, code string) {
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{
+		{Collection: privateMatchCollection, Key: code},
+	}); err != nil {
+		logger.Warn("Failed to release invite code %s: %v", code, err)
+	}
+}
+
+// newInviteCode returns a random invite code
+func newInviteCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := 0; i < inviteCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate invite code: %w", err)
+		}
+		code.WriteByte(inviteCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// normalizeInviteCode accepts codes typed in lower case or with separators
+func normalizeInviteCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-user public profile
+	profilesCollection = "profiles"
+	profileKey         = "profile"
+
+	maxDisplayNameLength = 24
+	maxBioLength         = 160
+
+	// Match signal delivering a joined player's profile card
+	SignalProfile = "profile"
+)
+
+var (
+	// Avatar IDs name client-side assets
+	avatarIDPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+	// ISO 3166-1 alpha-2 country codes
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// Profile represents a player's customizable profile
+type Profile struct {
+	DisplayName   string `json:"display_name,omitempty"`
+	AvatarID      string `json:"avatar_id,omitempty"`
+	Bio           string `json:"bio,omitempty"`
+	Country       string `json:"country,omitempty"`
+	PreferredMode string `json:"preferred_mode,omitempty"`
+}
+
+// ProfileCard represents the part of a profile shown next to a player's name
+type ProfileCard struct {
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarID    string `json:"avatar_id,omitempty"`
+}
+
+// UpdateProfileRequest represents update_profile request. Omitted fields are
+// left unchanged and empty strings clear them.
+type UpdateProfileRequest struct {
+	DisplayName   *string `json:"display_name,omitempty"`
+	AvatarID      *string `json:"avatar_id,omitempty"`
+	Bio           *string `json:"bio,omitempty"`
+	Country       *string `json:"country,omitempty"`
+	PreferredMode *string `json:"preferred_mode,omitempty"`
+}
+
+// InitProfiles registers the profile RPCs
+func InitProfiles(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_profile", getProfileRPC); err != nil {
+		return fmt.Errorf("failed to register get_profile RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("update_profile", updateProfileRPC); err != nil {
+		return fmt.Errorf("failed to register update_profile RPC: %w", err)
+	}
+
+	logger.Info("Profiles initialized")
+	return nil
+}
+
+// getProfileRPC returns a player's profile, the caller's if no user_id is given
+func getProfileRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request struct {
+		UserID string `json:"user_id"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.UserID == "" {
+		request.UserID, _ = ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	}
+	if request.UserID == "" {
+		return "", rpcError(CodeInvalidArgument, "user_id is required")
+	}
+
+	users, err := nk.UsersGetId(ctx, []string{request.UserID}, nil)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to look up user: %v", err)
+	}
+	if len(users) == 0 {
+		return "", rpcErrorf(CodeNotFound, "user %s not found", request.UserID)
+	}
+
+	profile, _, err := loadProfile(ctx, nk, request.UserID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	practice, _, err := loadBotPractice(ctx, nk, request.UserID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+
+	return rpcOK(map[string]interface{}{
+		"user_id":      request.UserID,
+		"username":     users[0].Username,
+		"profile":      profile,
+		"bot_practice": practice,
+	})
+}
+
+// updateProfileRPC changes the caller's profile
+func updateProfileRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request UpdateProfileRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	profile, version, err := loadProfile(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+
+	if request.DisplayName != nil {
+		name := strings.TrimSpace(*request.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayNameLength {
+			return "", rpcErrorf(CodeInvalidArgument, "display_name must be at most %d characters", maxDisplayNameLength)
+		}
+		profile.DisplayName = name
+	}
+	if request.AvatarID != nil {
+		if *request.AvatarID != "" && !avatarIDPattern.MatchString(*request.AvatarID) {
+			return "", rpcError(CodeInvalidArgument, "avatar_id must be 1-32 lowercase letters, digits, or underscores")
+		}
+		profile.AvatarID = *request.AvatarID
+	}
+	if request.Bio != nil {
+		bio := strings.TrimSpace(*request.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return "", rpcErrorf(CodeInvalidArgument, "bio must be at most %d characters", maxBioLength)
+		}
+		profile.Bio = bio
+	}
+	if request.Country != nil {
+		country := strings.ToUpper(*request.Country)
+		if country != "" && !countryPattern.MatchString(country) {
+			return "", rpcError(CodeInvalidArgument, "country must be an ISO 3166-1 alpha-2 code")
+		}
+		profile.Country = country
+	}
+	if request.PreferredMode != nil {
+		if *request.PreferredMode != "" {
+			if _, ok := lookupGameMode(*request.PreferredMode); !ok {
+				return "", rpcErrorf(CodeInvalidArgument, "unknown mode %s", *request.PreferredMode)
+			}
+		}
+		profile.PreferredMode = *request.PreferredMode
+	}
+
+	value, _ := json.Marshal(profile)
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      profilesCollection,
+			Key:             profileKey,
+			UserID:          userID,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  2,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return "", rpcErrorf(CodeAborted, "failed to store profile, try again: %v", err)
+	}
+
+	// Mirror the display name onto the account so friend lists and other Nakama APIs show it
+	if request.DisplayName != nil && profile.DisplayName != "" {
+		if err := nk.AccountUpdateId(ctx, userID, "", nil, profile.DisplayName, "", "", "", ""); err != nil {
+			logger.Warn("Failed to update account display name: %v", err)
+		}
+	}
+
+	return rpcOK(profile)
+}
+
+// loadPlayerProfile reads a player's profile card outside the match loop and
+// signals it to the match, which adds it to its state broadcasts
+func loadPlayerProfile(logger runtime.Logger, nk runtime.NakamaModule, matchID, userID string) {
+	if isBotAccount(userID) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+	defer cancel()
+
+	profile, _, err := loadProfile(ctx, nk, userID)
+	if err != nil {
+		logger.Warn("Failed to load profile of %s: %v", userID, err)
+		return
+	}
+	card := profile.card()
+	if card == (ProfileCard{}) {
+		return
+	}
+
+	signal, _ := json.Marshal(MatchSignalData{
+		Type:    SignalProfile,
+		UserIDs: []string{userID},
+		Profile: &card,
+	})
+	if _, err := nk.MatchSignal(ctx, matchID, string(signal)); err != nil {
+		logger.Warn("Failed to send profile of %s to match %s: %v", userID, matchID, err)
+	}
+}
+
+// attachProfiles fills in the display name and avatar of leaderboard entries
+func attachProfiles(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, entries []LeaderboardEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	userIDs := make([]string, len(entries))
+	for i, entry := range entries {
+		userIDs[i] = entry.UserID
+	}
+
+	profiles, err := loadProfiles(ctx, nk, userIDs)
+	if err != nil {
+		logger.Warn("Failed to load profiles for leaderboard: %v", err)
+		return
+	}
+	for i := range entries {
+		if profile, ok := profiles[entries[i].UserID]; ok {
+			entries[i].DisplayName = profile.DisplayName
+			entries[i].AvatarID = profile.AvatarID
+		}
+	}
+}
+
+// loadProfile reads a player's profile and its storage version ("*" if none is stored)
+func loadProfile(ctx context.Context, nk runtime.NakamaModule, userID string) (*Profile, string, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: profilesCollection, Key: profileKey, UserID: userID},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read profile: %w", err)
+	}
+	if len(objects) == 0 {
+		return &Profile{}, "*", nil
+	}
+
+	var profile Profile
+	if err := json.Unmarshal([]byte(objects[0].Value), &profile); err != nil {
+		return nil, "", fmt.Errorf("failed to parse profile: %w", err)
+	}
+	return &profile, objects[0].Version, nil
+}
+
+// loadProfiles reads the profiles of several players in one storage call.
+// Players without a stored profile are left out.
+func loadProfiles(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]*Profile, error) {
+	reads := make([]*runtime.StorageRead, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != "" && !isBotAccount(userID) {
+			reads = append(reads, &runtime.StorageRead{Collection: profilesCollection, Key: profileKey, UserID: userID})
+		}
+	}
+	profiles := make(map[string]*Profile, len(reads))
+	if len(reads) == 0 {
+		return profiles, nil
+	}
+
+	objects, err := storageRead(ctx, nk, reads)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	for _, object := range objects {
+		var profile Profile
+		if err := json.Unmarshal([]byte(object.Value), &profile); err == nil {
+			profiles[object.UserId] = &profile
+		}
+	}
+	return profiles, nil
+}
+
+// card returns the profile fields shown next to the player's name
+func (p *Profile) card() ProfileCard {
+	return ProfileCard{DisplayName: p.DisplayName, AvatarID: p.AvatarID}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+// Match protocol versions, passed as the "protocol_version" join metadata
+const (
+	// Clients that send no protocol_version shipped before versioning. From
+	// the server they understand only opcodes 1-5, as JSON.
+	ProtocolV1 = 1
+	// Adds hints, announcements, acks, rematches, game over summaries, chat,
+	// AFK warnings and undo (opcodes 9-19), protobuf encoding, and
+	// protocol_version in state
+	ProtocolV2 = 2
+	// Sends large boards (compactBoardSize and up) as board_rle, a run-length
+	// string, instead of board
+	ProtocolV3 = 3
+
+	currentProtocolVersion = ProtocolV3
+
+	// Smallest board sent and saved run-length encoded
+	compactBoardSize = 7
+)
+
+// Wire encodings a client may ask for with the "encoding" join metadata
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// opcodeVersions holds the protocol version that introduced each server
+// message after ProtocolV1. Clients speaking an older version don't get them.
+var opcodeVersions = map[int64]int{
+	OpcodeHint:         ProtocolV2,
+	OpcodeAnnouncement: ProtocolV2,
+	OpcodeAck:          ProtocolV2,
+	OpcodeRematchOffer: ProtocolV2,
+	OpcodeGameOver:     ProtocolV2,
+	OpcodeChat:         ProtocolV2,
+	OpcodeEmote:        ProtocolV2,
+	OpcodeChatHistory:  ProtocolV2,
+	OpcodeAfkWarning:   ProtocolV2,
+	OpcodeUndoRequest:  ProtocolV2,
+}
+
+// ClientProtocol represents how a client joined a match: the protocol version
+// the server speaks to it and the wire encoding it asked for
+type ClientProtocol struct {
+	Version  int
+	Encoding string
+}
+
+// latestClient is assumed for users with no negotiated protocol
+var latestClient = ClientProtocol{Version: currentProtocolVersion, Encoding: EncodingJSON}
+
+// adaptable is implemented by payloads whose shape depends on the recipient's
+// protocol version
+type adaptable interface {
+	forProtocol(version int) sequenced
+}
+
+func (s *StateData) forProtocol(version int) sequenced {
+	adapted := *s
+	adapted.ProtocolVersion = version
+	if version >= ProtocolV3 && s.Size >= compactBoardSize {
+		adapted.BoardRLE = rules.FromRows(s.Board).RunLength()
+		adapted.Board = nil
+	}
+	return &adapted
+}
+
+// joinProtocol reads the protocol version and encoding a client asked for when
+// joining. Clients newer than the server are spoken to in the current version,
+// which state tells them. Protobuf clients postdate versioning, so without a
+// version they speak ProtocolV2.
+func joinProtocol(metadata map[string]string) (ClientProtocol, string) {
+	client := ClientProtocol{Version: ProtocolV1, Encoding: EncodingJSON}
+
+	switch encoding := metadata["encoding"]; encoding {
+	case "", EncodingJSON:
+	case EncodingProtobuf:
+		client.Encoding = EncodingProtobuf
+		client.Version = ProtocolV2
+	default:
+		return ClientProtocol{}, "Unsupported encoding"
+	}
+
+	if value, ok := metadata["protocol_version"]; ok {
+		version, err := strconv.Atoi(value)
+		if err != nil || version < ProtocolV1 {
+			return ClientProtocol{}, "Unsupported protocol version"
+		}
+		if version > currentProtocolVersion {
+			version = currentProtocolVersion
+		}
+		if client.Encoding == EncodingProtobuf && version < ProtocolV2 {
+			return ClientProtocol{}, "Protobuf encoding needs protocol version 2"
+		}
+		client.Version = version
+	}
+	return client, ""
+}
+
+// clientProtocol returns how a user joined the match
+func clientProtocol(match *TTTMatch, userID string) ClientProtocol {
+	if client, ok := match.Clients[userID]; ok {
+		return client
+	}
+	return latestClient
+}
+
+// clientGroups groups recipients by how they joined. nil recipients mean
+// everyone in the match; if they all joined the same way, their group is nil
+// too, so the message goes out as a single broadcast.
+func clientGroups(match *TTTMatch, presences []runtime.Presence) map[ClientProtocol][]runtime.Presence {
+	everyone := presences == nil
+	if everyone {
+		presences = make([]runtime.Presence, 0, len(match.Presences)+len(match.Spectators))
+		for _, presence := range match.Presences {
+			presences = append(presences, presence)
+		}
+		for _, presence := range match.Spectators {
+			presences = append(presences, presence)
+		}
+	}
+
+	groups := make(map[ClientProtocol][]runtime.Presence)
+	for _, presence := range presences {
+		client := clientProtocol(match, presence.GetUserId())
+		groups[client] = append(groups[client], presence)
+	}
+	if everyone && len(groups) == 1 {
+		for client := range groups {
+			groups[client] = nil
+		}
+	}
+	return groups
+}
+
+// encodeFor encodes a payload for clients that joined a given way, or returns
+// nil if the opcode is newer than their protocol version
+func encodeFor(client ClientProtocol, opcode int64, payload sequenced) []byte {
+	if client.Version < opcodeVersions[opcode] {
+		return nil
+	}
+	if message, ok := payload.(adaptable); ok {
+		payload = message.forProtocol(client.Version)
+	}
+	if client.Encoding == EncodingProtobuf {
+		if message, ok := payload.(protoMessage); ok {
+			return message.marshalProto()
+		}
+	}
+	return encodePayload(payload)
+}
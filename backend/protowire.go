@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoMessage is implemented by payloads with a protobuf encoding, defined in
+// proto/match.proto. Payloads without one are sent as JSON to every client.
+type protoMessage interface {
+	marshalProto() []byte
+}
+
+// decodeMove parses a move in the encoding the sender joined with
+func decodeMove(match *TTTMatch, message runtime.MatchData) (MoveData, error) {
+	var move MoveData
+	if clientProtocol(match, message.GetUserId()).Encoding == EncodingProtobuf {
+		err := move.unmarshalProto(message.GetData())
+		return move, err
+	}
+	err := json.Unmarshal(message.GetData(), &move)
+	return move, err
+}
+
+var errMalformedProto = errors.New("malformed protobuf message")
+
+func (m *MoveData) unmarshalProto(data []byte) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errMalformedProto
+		}
+		data = data[n:]
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			m.Row, data = int(int32(value)), data[n:]
+		case num == 2 && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			m.Col, data = int(int32(value)), data[n:]
+		case num == 3 && typ == protowire.BytesType:
+			value, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			m.Symbol, data = value, data[n:]
+		case num == 4 && typ == protowire.BytesType:
+			value, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			m.RequestID, data = value, data[n:]
+		default:
+			// Skip fields from newer clients
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+func (s *StateData) marshalProto() []byte {
+	// Sized for the whole message up front, with one scratch buffer reused for
+	// every nested move record, so encoding doesn't reallocate as it grows
+	b := make([]byte, 0, 256+len(s.Board)*len(s.Board)+32*len(s.Moves))
+	var record []byte
+	b = appendString(b, 1, boardCells(s.Board))
+	b = appendString(b, 2, s.Turn)
+	b = appendString(b, 3, s.Winner)
+	b = appendInt(b, 4, int64(s.Size))
+	b = appendInt(b, 5, int64(s.WinLength))
+	b = appendString(b, 6, s.Mode)
+	b = appendBool(b, 7, s.Ranked)
+	for _, userID := range sortedKeys(s.Players) {
+		b = appendMapEntry(b, 8, userID, appendString(nil, 2, s.Players[userID]))
+	}
+	for _, userID := range sortedKeys(s.Cosmetics) {
+		cosmetics := s.Cosmetics[userID]
+		value := appendString(nil, 1, cosmetics.BoardTheme)
+		value = appendString(value, 2, cosmetics.PieceSkin)
+		b = appendMapEntry(b, 9, userID, appendMessage(nil, 2, value))
+	}
+	for _, userID := range sortedKeys(s.Profiles) {
+		profile := s.Profiles[userID]
+		value := appendString(nil, 1, profile.DisplayName)
+		value = appendString(value, 2, profile.AvatarID)
+		b = appendMapEntry(b, 10, userID, appendMessage(nil, 2, value))
+	}
+	b = appendString(b, 11, s.Checksum)
+	b = appendInt(b, 12, int64(s.TurnLeft))
+	b = appendInt(b, 13, int64(s.Spectators))
+	if s.Series != nil {
+		series := appendInt(nil, 1, int64(s.Series.BestOf))
+		series = appendInt(series, 2, int64(s.Series.Game))
+		for _, userID := range sortedKeys(s.Series.Wins) {
+			series = appendMapEntry(series, 3, userID, appendInt(nil, 2, int64(s.Series.Wins[userID])))
+		}
+		b = appendMessage(b, 14, series)
+	}
+	for _, move := range s.Moves {
+		record = appendInt(record[:0], 1, int64(move.Number))
+		record = appendString(record, 2, move.Symbol)
+		record = appendInt(record, 3, int64(move.Row))
+		record = appendInt(record, 4, int64(move.Col))
+		record = appendString(record, 5, move.Player)
+		b = appendMessage(b, 15, record)
+	}
+	b = appendString(b, 16, s.First)
+	b = appendString(b, 17, s.Reason)
+	for _, userID := range sortedKeys(s.Clocks) {
+		b = appendMapEntry(b, 18, userID, appendInt(nil, 2, s.Clocks[userID]))
+	}
+	b = appendInt(b, 19, s.Seq)
+	b = appendInt(b, 20, int64(s.ProtocolVersion))
+	return appendString(b, 21, s.BoardRLE)
+}
+
+func (e *ErrorData) marshalProto() []byte {
+	b := appendString(nil, 1, e.Code)
+	b = appendString(b, 2, e.Msg)
+	b = appendString(b, 3, e.RequestID)
+	b = appendInt(b, 4, e.RetryAfterMs)
+	return appendInt(b, 5, e.Seq)
+}
+
+func (a *AckData) marshalProto() []byte {
+	b := appendString(nil, 1, a.RequestID)
+	return appendInt(b, 2, a.Seq)
+}
+
+func (g *GameOverData) marshalProto() []byte {
+	b := appendString(nil, 1, g.Winner)
+	b = appendString(b, 2, g.WinnerID)
+	b = appendString(b, 3, g.Reason)
+	for _, userID := range sortedKeys(g.Results) {
+		result := g.Results[userID]
+		value := appendString(nil, 1, result.Result)
+		value = appendInt(value, 2, result.ScoreDelta)
+		value = appendInt(value, 3, result.Rating)
+		value = appendBool(value, 4, result.Placement)
+		b = appendMapEntry(b, 4, userID, appendMessage(nil, 2, value))
+	}
+	b = appendBool(b, 5, g.RematchAvailable)
+	return appendInt(b, 6, g.Seq)
+}
+
+func (a *AfkWarningData) marshalProto() []byte {
+	b := appendInt(nil, 1, int64(a.SecondsLeft))
+	return appendInt(b, 2, a.Seq)
+}
+
+func (u *UndoData) marshalProto() []byte {
+	b := appendString(nil, 1, u.RequestedBy)
+	b = appendInt(b, 2, int64(u.Remaining))
+	return appendInt(b, 3, u.Seq)
+}
+
+// boardCells packs the board rows into one row-major string, "." for empty cells
+func boardCells(board [][]string) string {
+	var cells strings.Builder
+	for _, row := range board {
+		for _, cell := range row {
+			if cell == Empty {
+				cells.WriteByte('.')
+			} else {
+				cells.WriteString(cell)
+			}
+		}
+	}
+	return cells.String()
+}
+
+// The append helpers skip zero values, as proto3 does
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendInt(b []byte, num protowire.Number, value int64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(value))
+}
+
+func appendBool(b []byte, num protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(value))
+}
+
+// appendMessage appends an encoded submessage; unlike scalars it is written
+// even when empty, so the field is present
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// appendMapEntry appends one map entry, given its key and its already encoded
+// value field (field 2)
+func appendMapEntry(b []byte, num protowire.Number, key string, value []byte) []byte {
+	entry := appendString(nil, 1, key)
+	return appendMessage(b, num, append(entry, value...))
+}
+
+// sortedKeys returns a map's keys in order, so encoding is deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// notifyTurnIfAway tells the player to move that it's their turn if they aren't
+// connected to the match, e.g. because the app went to the background. The
+// notification is persistent, so it reaches them when they reconnect and can
+// be forwarded by a push provider.
+func notifyTurnIfAway(logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	userID := playerWithSymbol(match, match.Turn)
+	if userID == "" || match.Bots[userID] || match.State != GameStatePlaying {
+		return
+	}
+	if _, connected := match.Presences[userID]; connected {
+		return
+	}
+
+	go sendTurnNotification(logger, nk, userID, match.ID, match.Mode)
+}
+
+// sendTurnNotification sends a your-turn notification unless the player turned them off
+func sendTurnNotification(logger runtime.Logger, nk runtime.NakamaModule, userID, matchID, mode string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+	defer cancel()
+
+	settings, err := GetUserSettings(ctx, nk, userID)
+	if err != nil {
+		logger.Warn("Failed to read notification settings of %s: %v", userID, err)
+		return
+	}
+	if !settings.TurnNotifications {
+		return
+	}
+
+	if err := notificationsSend(ctx, nk, []*runtime.NotificationSend{
+		{
+			UserID:  userID,
+			Subject: "Your Turn",
+			Content: map[string]interface{}{
+				"type":     "your_turn",
+				"match_id": matchID,
+				"mode":     mode,
+			},
+			Code:       NotificationYourTurn,
+			Persistent: true,
+		},
+	}); err != nil {
+		logger.Warn("Failed to notify %s of their turn in match %s: %v", userID, matchID, err)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-user quest progress
+	questsCollection = "quests"
+	questsKey        = "progress"
+
+	// Quest periods
+	QuestDaily  = "daily"
+	QuestWeekly = "weekly"
+
+	// Events that advance quests
+	QuestEventLogin = "login"
+	QuestEventPlay  = "play"
+	QuestEventWin   = "win"
+	QuestEventDraw  = "draw"
+
+	// Active quests drawn from each pool per period
+	dailyQuestCount  = 3
+	weeklyQuestCount = 2
+
+	// Wallet currency granted by quest rewards
+	walletCoins = "coins"
+
+	// Progress writes retried after losing a concurrent update
+	questWriteAttempts = 3
+)
+
+// QuestDefinition represents an objective in a quest pool
+type QuestDefinition struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description"`
+	Event       string      `json:"event"`
+	Mode        string      `json:"mode,omitempty"` // only games of this mode count; empty for any
+	Target      int         `json:"target"`
+	Reward      QuestReward `json:"reward"`
+}
+
+// QuestReward represents what completing a quest grants
+type QuestReward struct {
+	Score int64 `json:"score,omitempty"` // added to the weekly leaderboard
+	Coins int64 `json:"coins,omitempty"` // added to the wallet
+}
+
+// QuestStatus represents a player's progress on an active quest
+type QuestStatus struct {
+	QuestDefinition
+	Period    string `json:"period"`
+	Progress  int    `json:"progress"`
+	Completed bool   `json:"completed"`
+	EndsAt    int64  `json:"ends_at"`
+}
+
+// QuestProgress represents the stored quest progress of a player. Counts belong
+// to the periods recorded alongside them and are reset when a period rolls over.
+type QuestProgress struct {
+	DailyPeriod  int64           `json:"daily_period"`
+	WeeklyPeriod int64           `json:"weekly_period"`
+	Counts       map[string]int  `json:"counts"`
+	Completed    map[string]bool `json:"completed"`
+	LastLoginDay int64           `json:"last_login_day"` // login quests count days, not sessions
+}
+
+// Quest pools; each period rotates through them so everyone gets the same quests
+var (
+	dailyQuestPool = []QuestDefinition{
+		{ID: "daily_login", Description: "Log in", Event: QuestEventLogin, Target: 1, Reward: QuestReward{Coins: 10}},
+		{ID: "daily_win_3", Description: "Win 3 games", Event: QuestEventWin, Target: 3, Reward: QuestReward{Score: 5, Coins: 30}},
+		{ID: "daily_play_5", Description: "Play 5 games", Event: QuestEventPlay, Target: 5, Reward: QuestReward{Coins: 20}},
+		{ID: "daily_draw", Description: "Draw a game", Event: QuestEventDraw, Target: 1, Reward: QuestReward{Coins: 15}},
+		{ID: "daily_advanced", Description: "Play an advanced game", Event: QuestEventPlay, Mode: GameModeAdvanced, Target: 1, Reward: QuestReward{Coins: 20}},
+	}
+	weeklyQuestPool = []QuestDefinition{
+		{ID: "weekly_win_15", Description: "Win 15 games", Event: QuestEventWin, Target: 15, Reward: QuestReward{Score: 25, Coins: 150}},
+		{ID: "weekly_play_30", Description: "Play 30 games", Event: QuestEventPlay, Target: 30, Reward: QuestReward{Coins: 100}},
+		{ID: "weekly_advanced_win_5", Description: "Win 5 advanced games", Event: QuestEventWin, Mode: GameModeAdvanced, Target: 5, Reward: QuestReward{Score: 15, Coins: 120}},
+		{ID: "weekly_login_5", Description: "Log in on 5 days", Event: QuestEventLogin, Target: 5, Reward: QuestReward{Coins: 80}},
+	}
+)
+
+// InitQuests registers the quest RPCs
+func InitQuests(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_quests", getQuestsRPC); err != nil {
+		return fmt.Errorf("failed to register get_quests RPC: %w", err)
+	}
+
+	logger.Info("Quests initialized")
+	return nil
+}
+
+// getQuestsRPC returns the caller's active daily and weekly quests with progress
+func getQuestsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	now := time.Now()
+	progress, _, err := loadQuestProgress(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	progress.rollOver(now)
+
+	quests := make([]QuestStatus, 0, dailyQuestCount+weeklyQuestCount)
+	for _, quest := range activeQuests(now) {
+		quests = append(quests, progress.status(quest, now))
+	}
+	return rpcOK(map[string]interface{}{"quests": quests})
+}
+
+// activeQuest represents a quest definition active in a given period
+type activeQuest struct {
+	QuestDefinition
+	Period string
+}
+
+// activeQuests returns the daily and weekly quests active at the given time
+func activeQuests(now time.Time) []activeQuest {
+	quests := make([]activeQuest, 0, dailyQuestCount+weeklyQuestCount)
+	for _, quest := range rotateQuests(dailyQuestPool, dailyQuestCount, dailyPeriod(now)) {
+		quests = append(quests, activeQuest{quest, QuestDaily})
+	}
+	for _, quest := range rotateQuests(weeklyQuestPool, weeklyQuestCount, weeklyPeriod(now)) {
+		quests = append(quests, activeQuest{quest, QuestWeekly})
+	}
+	return quests
+}
+
+// rotateQuests picks count consecutive quests from a pool, starting further along each period
+func rotateQuests(pool []QuestDefinition, count int, period int64) []QuestDefinition {
+	if count > len(pool) {
+		count = len(pool)
+	}
+	quests := make([]QuestDefinition, count)
+	for i := range quests {
+		quests[i] = pool[int((period*int64(count)+int64(i))%int64(len(pool)))]
+	}
+	return quests
+}
+
+// dailyPeriod returns the index of the UTC day containing now
+func dailyPeriod(now time.Time) int64 {
+	return int64(now.Sub(rotationEpoch) / (24 * time.Hour))
+}
+
+// weeklyPeriod returns the index of the week containing now, aligned with the mode rotation
+func weeklyPeriod(now time.Time) int64 {
+	return int64(now.Sub(rotationEpoch) / rotationPeriod)
+}
+
+// periodEnd returns when the period a quest belongs to ends
+func periodEnd(period string, now time.Time) int64 {
+	if period == QuestWeekly {
+		return rotationEpoch.Add(time.Duration(weeklyPeriod(now)+1) * rotationPeriod).Unix()
+	}
+	return rotationEpoch.Add(time.Duration(dailyPeriod(now)+1) * 24 * time.Hour).Unix()
+}
+
+// rollOver clears progress left over from earlier days and weeks
+func (p *QuestProgress) rollOver(now time.Time) {
+	if p.Counts == nil {
+		p.Counts = make(map[string]int)
+	}
+	if p.Completed == nil {
+		p.Completed = make(map[string]bool)
+	}
+
+	if p.DailyPeriod != dailyPeriod(now) {
+		p.clear(dailyQuestPool)
+		p.DailyPeriod = dailyPeriod(now)
+	}
+	if p.WeeklyPeriod != weeklyPeriod(now) {
+		p.clear(weeklyQuestPool)
+		p.WeeklyPeriod = weeklyPeriod(now)
+	}
+}
+
+// clear drops the progress on every quest in a pool
+func (p *QuestProgress) clear(pool []QuestDefinition) {
+	for _, quest := range pool {
+		delete(p.Counts, quest.ID)
+		delete(p.Completed, quest.ID)
+	}
+}
+
+// status returns the player's progress on an active quest
+func (p *QuestProgress) status(quest activeQuest, now time.Time) QuestStatus {
+	return QuestStatus{
+		QuestDefinition: quest.QuestDefinition,
+		Period:          quest.Period,
+		Progress:        p.Counts[quest.ID],
+		Completed:       p.Completed[quest.ID],
+		EndsAt:          periodEnd(quest.Period, now),
+	}
+}
+
+// RecordQuestEvents advances the player's active quests matching the events and
+// grants the rewards of any quest this completes. mode is empty for events that
+// aren't tied to a game.
+func RecordQuestEvents(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, mode string, events ...string) error {
+	now := time.Now()
+
+	var completed []QuestDefinition
+	for attempt := 0; ; attempt++ {
+		progress, version, err := loadQuestProgress(ctx, nk, userID)
+		if err != nil {
+			return err
+		}
+		progress.rollOver(now)
+
+		completed = completed[:0]
+		changed := false
+		counted := progress.countedEvents(events, now)
+		for _, quest := range activeQuests(now) {
+			if progress.Completed[quest.ID] || !questMatches(quest.QuestDefinition, mode, counted) {
+				continue
+			}
+			progress.Counts[quest.ID]++
+			changed = true
+			if progress.Counts[quest.ID] >= quest.Target {
+				progress.Completed[quest.ID] = true
+				completed = append(completed, quest.QuestDefinition)
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		err = writeQuestProgress(ctx, nk, userID, progress, version)
+		if err == nil {
+			break
+		}
+		// Another result for this player landed first; redo the update on top of it
+		if attempt+1 >= questWriteAttempts {
+			return err
+		}
+	}
+
+	for _, quest := range completed {
+		if err := grantQuestReward(ctx, nk, userID, quest); err != nil {
+			logger.Error("Failed to grant reward for quest %s to %s: %v", quest.ID, userID, err)
+			continue
+		}
+		logger.WithField("user_id", userID).Info("Completed quest %s", quest.ID)
+	}
+	return nil
+}
+
+// questMatches reports whether any of the events advances the quest
+func questMatches(quest QuestDefinition, mode string, events []string) bool {
+	if quest.Mode != "" && quest.Mode != mode {
+		return false
+	}
+	for _, event := range events {
+		if event == quest.Event {
+			return true
+		}
+	}
+	return false
+}
+
+// countedEvents returns the events that count towards quests, dropping logins
+// after the player's first one of the day
+func (p *QuestProgress) countedEvents(events []string, now time.Time) []string {
+	counted := make([]string, 0, len(events))
+	for _, event := range events {
+		if event == QuestEventLogin {
+			if p.LastLoginDay == dailyPeriod(now) {
+				continue
+			}
+			p.LastLoginDay = dailyPeriod(now)
+		}
+		counted = append(counted, event)
+	}
+	return counted
+}
+
+// grantQuestReward pays out a completed quest
+func grantQuestReward(ctx context.Context, nk runtime.NakamaModule, userID string, quest QuestDefinition) error {
+	if quest.Reward.Coins > 0 {
+		metadata := map[string]interface{}{"reason": "quest", "quest_id": quest.ID}
+		if _, _, err := nk.WalletUpdate(ctx, userID, map[string]int64{walletCoins: quest.Reward.Coins}, metadata, true); err != nil {
+			return fmt.Errorf("failed to update wallet: %w", err)
+		}
+	}
+	if quest.Reward.Score > 0 {
+		username := ""
+		if users, err := nk.UsersGetId(ctx, []string{userID}, nil); err == nil && len(users) > 0 {
+			username = users[0].Username
+		}
+		if _, err := leaderboardRecordWrite(ctx, nk, config.WeeklyLeaderboardID, userID, username, quest.Reward.Score, 0, nil, nil); err != nil {
+			return fmt.Errorf("failed to add quest score: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadQuestProgress reads a player's quest progress and its storage version
+func loadQuestProgress(ctx context.Context, nk runtime.NakamaModule, userID string) (*QuestProgress, string, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: questsCollection, Key: questsKey, UserID: userID},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read quest progress: %w", err)
+	}
+
+	progress := &QuestProgress{}
+	if len(objects) == 0 {
+		// Only succeeds if nobody created the progress in the meantime
+		return progress, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), progress); err != nil {
+		return nil, "", fmt.Errorf("failed to parse quest progress: %w", err)
+	}
+	return progress, objects[0].Version, nil
+}
+
+// writeQuestProgress stores quest progress if it is unchanged since it was read at version
+func writeQuestProgress(ctx context.Context, nk runtime.NakamaModule, userID string, progress *QuestProgress, version string) error {
+	value, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to marshal quest progress: %w", err)
+	}
+
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      questsCollection,
+			Key:             questsKey,
+			UserID:          userID,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to write quest progress: %w", err)
+	}
+	return nil
+}
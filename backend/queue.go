@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Queue entries live in storage, owned by the queued player, so the queue
+	// survives restarts and is shared by every Nakama node
+	matchmakingQueueCollection = "matchmaking_queue"
+	matchmakingQueueKey        = "entry"
+
+	// Most entries read per queue scan
+	maxQueueScan = 1000
+	queuePage    = 100
+
+	// How far back queue departures count towards the estimated wait
+	departureWindow = 10 * time.Minute
+
+	// How long an entry may sit in the queue before it is dropped
+	defaultQueueEntryTTL = 5 * time.Minute
+)
+
+// Recent times players left the queue for a match, by mode. Each node only sees
+// the pairings it made, which is enough for an estimate.
+var (
+	queueDepartures      = make(map[string][]time.Time)
+	queueDeparturesMutex sync.Mutex
+)
+
+// MatchmakingQueue represents a player waiting for a match
+type MatchmakingQueue struct {
+	UserID    string    `json:"user_id"`
+	Mode      string    `json:"mode"`
+	Size      int       `json:"size,omitempty"`
+	WinLength int       `json:"win_length,omitempty"`
+	Casual    bool      `json:"casual,omitempty"` // entries from before the casual queue are ranked
+	PartyID   string    `json:"party_id,omitempty"`
+	Partner   string    `json:"partner,omitempty"` // the other member of a queued party
+	Rating    int64     `json:"rating"`
+	Ticket    string    `json:"ticket"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Storage version the entry was read at; claiming deletes only this version
+	version string
+}
+
+// listQueue reads every queued player, across all nodes
+func listQueue(ctx context.Context, nk runtime.NakamaModule) ([]*MatchmakingQueue, error) {
+	entries := make([]*MatchmakingQueue, 0)
+	cursor := ""
+	for len(entries) < maxQueueScan {
+		objects, next, err := nk.StorageList(ctx, "", "", matchmakingQueueCollection, queuePage, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list matchmaking queue: %w", err)
+		}
+		for _, object := range objects {
+			var entry MatchmakingQueue
+			if err := json.Unmarshal([]byte(object.Value), &entry); err != nil {
+				continue
+			}
+			entry.version = object.Version
+			entries = append(entries, &entry)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return entries, nil
+}
+
+// enqueue adds a player's queue entry, replacing any earlier one, so a player
+// is never queued twice. The entry keeps the version written, so claiming it
+// fails once the player queues again.
+func enqueue(ctx context.Context, nk runtime.NakamaModule, entry *MatchmakingQueue) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue entry: %w", err)
+	}
+
+	acks, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      matchmakingQueueCollection,
+			Key:             matchmakingQueueKey,
+			UserID:          entry.UserID,
+			Value:           string(value),
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write queue entry: %w", err)
+	}
+	if len(acks) > 0 {
+		entry.version = acks[0].GetVersion()
+	}
+	return nil
+}
+
+// stillQueued reports whether an entry is still in the queue as written, not
+// replaced by the player queueing again or claimed for a match
+func stillQueued(ctx context.Context, nk runtime.NakamaModule, entry *MatchmakingQueue) bool {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: matchmakingQueueCollection, Key: matchmakingQueueKey, UserID: entry.UserID},
+	})
+	return err == nil && len(objects) > 0 && objects[0].Version == entry.version
+}
+
+// dequeue removes a player from the queue, whether or not they were queued
+func dequeue(ctx context.Context, nk runtime.NakamaModule, userID string) error {
+	if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{
+		{Collection: matchmakingQueueCollection, Key: matchmakingQueueKey, UserID: userID},
+	}); err != nil {
+		return fmt.Errorf("failed to delete queue entry: %w", err)
+	}
+	return nil
+}
+
+// claimQueueEntries takes entries off the queue together, returning false if any
+// of them changed or was claimed by another node since it was read. The deletes
+// are applied in one transaction, so either all entries are claimed or none are.
+func claimQueueEntries(ctx context.Context, nk runtime.NakamaModule, entries ...*MatchmakingQueue) bool {
+	deletes := make([]*runtime.StorageDelete, len(entries))
+	for i, entry := range entries {
+		deletes[i] = &runtime.StorageDelete{
+			Collection: matchmakingQueueCollection,
+			Key:        matchmakingQueueKey,
+			UserID:     entry.UserID,
+			Version:    entry.version,
+		}
+	}
+	return nk.StorageDelete(ctx, deletes) == nil
+}
+
+// queueEntryExpired reports whether an entry has waited longer than config.QueueTTL
+func queueEntryExpired(entry *MatchmakingQueue, now time.Time) bool {
+	return config.QueueTTL > 0 && now.Sub(entry.Timestamp) > config.QueueTTL
+}
+
+// isOnline reports whether a user has a session on any node. Every session joins
+// the user's notification stream, so an empty stream means they disconnected.
+func isOnline(nk runtime.NakamaModule, userID string) (bool, error) {
+	presences, err := nk.StreamUserList(streamModeNotifications, userID, "", "", true, true)
+	if err != nil {
+		return false, fmt.Errorf("failed to list presences: %w", err)
+	}
+	return len(presences) > 0, nil
+}
+
+// pruneQueue drops expired entries and entries of players who are offline, and
+// returns the rest. Entries whose presence can't be checked are kept.
+func pruneQueue(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, queue []*MatchmakingQueue, now time.Time) []*MatchmakingQueue {
+	live := make([]*MatchmakingQueue, 0, len(queue))
+	for _, entry := range queue {
+		if reason := staleReason(logger, nk, entry, now); reason != "" {
+			dropQueueEntry(ctx, logger, nk, entry, reason)
+			continue
+		}
+		live = append(live, entry)
+	}
+	return live
+}
+
+// staleReason returns why an entry should leave the queue, or "" if it is still live
+func staleReason(logger runtime.Logger, nk runtime.NakamaModule, entry *MatchmakingQueue, now time.Time) string {
+	if queueEntryExpired(entry, now) {
+		return "expired"
+	}
+	online, err := isOnline(nk, entry.UserID)
+	if err != nil {
+		logger.Warn("Failed to check whether queued user %s is online: %v", entry.UserID, err)
+		return ""
+	}
+	if !online {
+		return "offline"
+	}
+	return ""
+}
+
+// dropQueueEntry removes a stale entry, unless the player has requeued since it was read
+func dropQueueEntry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, entry *MatchmakingQueue, reason string) {
+	if claimQueueEntries(ctx, nk, entry) {
+		logger.WithFields(map[string]interface{}{"user_id": entry.UserID, "mode": entry.Mode}).Info("Dropped %s queue entry after %s", reason, time.Since(entry.Timestamp).Round(time.Second))
+	}
+}
+
+// board returns the size and win length the player queued for. Entries queued
+// before variants existed play the mode's own board.
+func (q *MatchmakingQueue) board() (int, int) {
+	gameMode, _ := lookupGameMode(q.Mode)
+	size, winLength, err := boardVariant(gameMode, q.Size, q.WinLength)
+	if err != nil {
+		return gameMode.Size, gameMode.WinLength
+	}
+	return size, winLength
+}
+
+// queueName returns the queue the player joined, QueueRanked or QueueCasual
+func (q *MatchmakingQueue) queueName() string {
+	if q.Casual {
+		return QueueCasual
+	}
+	return QueueRanked
+}
+
+// sameVariant reports whether two queued players want the same queue, mode and
+// board. Parties only meet other parties.
+func (q *MatchmakingQueue) sameVariant(other *MatchmakingQueue) bool {
+	if q.Mode != other.Mode || q.Casual != other.Casual || (q.Partner == "") != (other.Partner == "") {
+		return false
+	}
+	size, winLength := q.board()
+	otherSize, otherWinLength := other.board()
+	return size == otherSize && winLength == otherWinLength
+}
+
+// queueEntry adapts a queue entry to runtime.MatchmakerEntry, so queue pairings
+// and native matchmaker pairings both go through handleMatchmakerMatched
+type queueEntry struct {
+	*MatchmakingQueue
+}
+
+func (e queueEntry) GetPresence() runtime.Presence { return queuePresence{userID: e.UserID} }
+func (e queueEntry) GetTicket() string             { return e.Ticket }
+func (e queueEntry) GetPartyId() string            { return "" }
+
+func (e queueEntry) GetProperties() map[string]interface{} {
+	size, winLength := e.board()
+	return map[string]interface{}{
+		"mode":       e.Mode,
+		"queue":      e.queueName(),
+		"size":       float64(size),
+		"win_length": float64(winLength),
+		"rating":     float64(e.Rating),
+	}
+}
+
+// queuePresence is the presence of a queued player, who has no session in the queue
+type queuePresence struct {
+	userID string
+}
+
+func (p queuePresence) GetUserId() string                 { return p.userID }
+func (p queuePresence) GetSessionId() string              { return "" }
+func (p queuePresence) GetNodeId() string                 { return "" }
+func (p queuePresence) GetHidden() bool                   { return false }
+func (p queuePresence) GetPersistence() bool              { return false }
+func (p queuePresence) GetUsername() string               { return "" }
+func (p queuePresence) GetStatus() string                 { return "" }
+func (p queuePresence) GetReason() runtime.PresenceReason { return runtime.PresenceReasonUnknown }
+
+// recordDepartures notes that players of a mode left the queue for a match
+func recordDepartures(mode string, players int, now time.Time) {
+	queueDeparturesMutex.Lock()
+	defer queueDeparturesMutex.Unlock()
+
+	departures := trimDepartures(queueDepartures[mode], now)
+	for i := 0; i < players; i++ {
+		departures = append(departures, now)
+	}
+	queueDepartures[mode] = departures
+}
+
+// estimatedWait predicts how long until a player at the given 1-based queue
+// position is matched, from how quickly players left the queue recently.
+// It returns false when there is too little recent data to tell.
+func estimatedWait(mode string, position int, now time.Time) (time.Duration, bool) {
+	queueDeparturesMutex.Lock()
+	departures := trimDepartures(queueDepartures[mode], now)
+	queueDepartures[mode] = departures
+	queueDeparturesMutex.Unlock()
+
+	if len(departures) < 2 {
+		return 0, false
+	}
+	span := now.Sub(departures[0])
+	if span <= 0 {
+		return 0, false
+	}
+	perPlayer := span / time.Duration(len(departures))
+	return perPlayer * time.Duration(position), true
+}
+
+// trimDepartures drops departures older than departureWindow
+func trimDepartures(departures []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-departureWindow)
+	for len(departures) > 0 && departures[0].Before(cutoff) {
+		departures = departures[1:]
+	}
+	return departures
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Buckets a limiter tracks before it sweeps out the ones that have refilled
+const rateLimiterSweepSize = 10000
+
+// Per-user limits on this node; each allows a burst, then refills at a steady rate
+var (
+	authLimiter        = newRateLimiter(0.2, 5) // auth RPCs, refresh_session, and link_account together
+	matchmakingLimiter = newRateLimiter(0.5, 5) // start_matchmaking
+	leaderboardLimiter = newRateLimiter(1, 10)  // leaderboard views
+	analysisLimiter    = newRateLimiter(1, 5)   // analyze_position
+	moveLimiter        = newRateLimiter(5, 10)  // OpcodeMove
+	chatLimiter        = newRateLimiter(0.5, 5) // OpcodeChat and OpcodeEmote together
+	hintLimiter        = newRateLimiter(0.5, 3) // OpcodeHintRequest
+)
+
+// RateLimitDetails represents the details of a rate limited RPC error
+type RateLimitDetails struct {
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// tokenBucket holds one key's remaining allowance
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is a token-bucket limiter shared by everything limited on the same key
+type rateLimiter struct {
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter returns a limiter allowing burst actions at once and perSecond after that
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token for key, returning false and how long until one is
+// available if the bucket is empty
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= rateLimiterSweepSize {
+			l.sweep(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled, which behave the same as missing ones
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// withRateLimit rejects calls once the caller has used up their allowance on limiter
+func withRateLimit(limiter *rateLimiter, fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if ok, retryAfter := limiter.allow(rateLimitKey(ctx)); !ok {
+			return "", rpcErrorDetails(CodeResourceExhausted, "rate limited, try again later", RateLimitDetails{
+				RetryAfterMs: retryAfter.Milliseconds() + 1,
+			})
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
+
+// rateLimitKey identifies the caller: their user ID, or their address for calls
+// made before authenticating
+func rateLimitKey(ctx context.Context) string {
+	if userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); ok && userID != "" {
+		return userID
+	}
+	clientIP, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string)
+	return "ip:" + clientIP
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Rating every player starts from
+	defaultRating = 1200
+)
+
+// expectedScore returns the Elo expected score (0..1) of a player against an opponent
+func expectedScore(rating, opponentRating int64) float64 {
+	return 1 / (1 + math.Pow(10, float64(opponentRating-rating)/400))
+}
+
+// ratingDelta returns the rating change for a result of 1 (win), 0.5 (draw), or 0 (loss)
+func ratingDelta(rating, opponentRating int64, result float64, kFactor int) int64 {
+	return int64(math.Round(float64(kFactor) * (result - expectedScore(rating, opponentRating))))
+}
+
+// scoreGame sets a game's rating change and returns the leaderboard points it
+// earns. Active events (e.g. double points weekend) boost gains, never losses,
+// and streak bonuses add to them, but both only count towards points: the
+// rating moves by the plain delta, so ratings stay zero-sum. Unrated games,
+// including every bot's, score points but carry no rating change.
+func scoreGame(result GameResult, delta int64, multiplier float64, bonus int64) (GameResult, int64) {
+	if result.Rated {
+		result.RatingDelta = delta
+	}
+	points := delta
+	if points > 0 && multiplier != 1 {
+		points = int64(math.Round(float64(points) * multiplier))
+	}
+	return result, points + bonus
+}
+
+// PlayerRating represents a player's rating going into a game
+type PlayerRating struct {
+	Rating      int64
+	Provisional bool // still in placements
+}
+
+// kFactor returns the largest rating change the player can see in one game
+func (r PlayerRating) kFactor() int {
+	if r.Provisional {
+		return config.PlacementKFactor
+	}
+	return config.EloKFactor
+}
+
+// loadRatings returns the current rating of each user, reading all stats in one call.
+// Bots use their roster rating and players without stats start at defaultRating.
+func loadRatings(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]int64, error) {
+	players, err := loadPlayerRatings(ctx, nk, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	ratings := make(map[string]int64, len(players))
+	for userID, player := range players {
+		ratings[userID] = player.Rating
+	}
+	return ratings, nil
+}
+
+// loadPlayerRatings is loadRatings with each player's placement status. Bots
+// are never provisional.
+func loadPlayerRatings(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]PlayerRating, error) {
+	ratings := make(map[string]PlayerRating, len(userIDs))
+	people := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if profile, ok := botProfile(userID); ok {
+			ratings[userID] = PlayerRating{Rating: int64(profile.Rating)}
+			continue
+		}
+		people = append(people, userID)
+	}
+
+	stats, _, err := loadUserStats(ctx, nk, people)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ratings: %w", err)
+	}
+	for userID, userStats := range stats {
+		ratings[userID] = PlayerRating{Rating: userStats.Rating, Provisional: userStats.provisional()}
+	}
+	return ratings, nil
+}
+
+// setOperator overrides a leaderboard's operator so a write replaces the score
+var setOperator = int(api.Operator_SET)
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestScoreGameStreakWinMovesRatingByEloDelta(t *testing.T) {
+	stats := UserStats{Rating: 1500, RatedGamesPlayed: config.PlacementGames}
+	player := PlayerRating{Rating: stats.Rating}
+	delta := ratingDelta(player.Rating, 1400, 1, player.kFactor())
+	bonus := streakBonus(5)
+	if bonus == 0 {
+		t.Fatal("expected a fifth straight win to earn a streak bonus")
+	}
+
+	result, points := scoreGame(GameResult{Won: true, Ranked: true, Rated: true}, delta, 2, bonus)
+	stats.apply(result)
+
+	if got := stats.Rating - 1500; got != delta {
+		t.Errorf("rating changed by %d, want the Elo delta %d", got, delta)
+	}
+	if want := 2*delta + bonus; points != want {
+		t.Errorf("points = %d, want %d", points, want)
+	}
+}
+
+func TestScoreGameMultiplierNeverBoostsLosses(t *testing.T) {
+	result, points := scoreGame(GameResult{Lost: true, Ranked: true, Rated: true}, -12, 2, 0)
+	if result.RatingDelta != -12 || points != -12 {
+		t.Errorf("got rating delta %d and %d points, want -12 and -12", result.RatingDelta, points)
+	}
+}
+
+func TestScoreGameKeepsRatingsZeroSum(t *testing.T) {
+	winner := UserStats{Rating: 1300, RatedGamesPlayed: config.PlacementGames}
+	loser := UserStats{Rating: 1300, RatedGamesPlayed: config.PlacementGames}
+	k := PlayerRating{Rating: 1300}.kFactor()
+
+	won, _ := scoreGame(GameResult{Won: true, Ranked: true, Rated: true}, ratingDelta(1300, 1300, 1, k), 3, streakBonus(10))
+	lost, _ := scoreGame(GameResult{Lost: true, Ranked: true, Rated: true}, ratingDelta(1300, 1300, 0, k), 3, 0)
+	winner.apply(won)
+	loser.apply(lost)
+
+	if total := winner.Rating + loser.Rating; total != 2600 {
+		t.Errorf("ratings sum to %d after the game, want 2600", total)
+	}
+}
+
+func TestScoreGameUnratedHasNoRatingDelta(t *testing.T) {
+	result, points := scoreGame(GameResult{Won: true, Ranked: true}, 25, 1, 0)
+	if result.RatingDelta != 0 || points != 25 {
+		t.Errorf("got rating delta %d and %d points, want 0 and 25", result.RatingDelta, points)
+	}
+}
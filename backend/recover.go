@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"runtime/debug"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// rpcFunc is the signature of a registered RPC handler
+type rpcFunc func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error)
+
+// recoveringInitializer registers every RPC behind a panic guard and a deadline,
+// so one bad or slow request can't take the module down or hang, and times it
+type recoveringInitializer struct {
+	runtime.Initializer
+}
+
+// RegisterRpc registers fn wrapped with panic recovery, latency metrics, and rpcTimeout
+func (i recoveringInitializer) RegisterRpc(id string, fn func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error)) error {
+	return i.Initializer.RegisterRpc(id, recoverRPC(id, withRPCMetrics(id, withRPCTimeout(fn))))
+}
+
+// recoverRPC wraps an RPC handler so panics are logged and reported as internal errors
+func recoverRPC(id string, fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (response string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				rpcLogger(ctx, logger).WithField("rpc", id).Error("RPC panicked: %v\n%s", r, debug.Stack())
+				nk.MetricsCounterAdd("rpc_panics", map[string]string{"rpc": id}, 1)
+				response, err = "", rpcError(CodeInternal, "internal error")
+			}
+		}()
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
+
+// recoverInto runs fn, returning false if it panicked. The panic and its stack
+// are logged so the caller can skip the bad input and carry on.
+func recoverInto(logger runtime.Logger, nk runtime.NakamaModule, scope string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Recovered panic in %s: %v\n%s", scope, r, debug.Stack())
+			nk.MetricsCounterAdd("handler_panics", map[string]string{"scope": scope}, 1)
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
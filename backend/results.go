@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Result recording worker pool
+	resultQueueSize = 256
+	resultWorkers   = 4
+	resultTimeout   = 30 * time.Second
+
+	// Idempotency keys for recorded matches (system-owned, keyed by match ID)
+	matchResultsCollection = "match_results"
+
+	// Match signal delivering a finished game's recorded results
+	SignalGameOver = "game_over"
+)
+
+// resultJob is a finished match waiting to have its results recorded
+type resultJob struct {
+	handler *TTTMatchHandler
+	logger  runtime.Logger
+	match   *TTTMatch
+}
+
+// resultQueue buffers finished matches so MatchLoop never waits on storage
+var resultQueue = make(chan resultJob, resultQueueSize)
+
+// InitResults starts the result-recording workers
+func InitResults(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	for i := 0; i < resultWorkers; i++ {
+		go runResultWorker(nk)
+	}
+
+	logger.Info("Result recording workers started: %d", resultWorkers)
+	return nil
+}
+
+// runResultWorker records queued match results outside the match loop
+func runResultWorker(nk runtime.NakamaModule) {
+	for job := range resultQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), resultTimeout)
+		recoverInto(job.logger, nk, "record_results", func() {
+			job.handler.recordResults(ctx, job.logger, nk, job.match)
+		})
+		cancel()
+	}
+}
+
+// enqueueResults hands a finished match to the worker pool, returning false if the queue is full
+func enqueueResults(handler *TTTMatchHandler, logger runtime.Logger, match *TTTMatch) bool {
+	select {
+	case resultQueue <- resultJob{handler: handler, logger: logger, match: snapshotMatch(match)}:
+		return true
+	default:
+		return false
+	}
+}
+
+// deferResults waits in the background for room on the result queue, recording
+// directly only if none frees up within resultTimeout
+func deferResults(handler *TTTMatchHandler, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	job := resultJob{handler: handler, logger: logger, match: snapshotMatch(match)}
+	go func() {
+		select {
+		case resultQueue <- job:
+		case <-time.After(resultTimeout):
+			ctx, cancel := context.WithTimeout(context.Background(), resultTimeout)
+			defer cancel()
+			recoverInto(job.logger, nk, "record_results", func() {
+				job.handler.recordResults(ctx, job.logger, nk, job.match)
+			})
+		}
+	}()
+}
+
+// snapshotMatch copies the parts of a finished match needed to record results,
+// so later changes to the live match state can't race with the workers
+func snapshotMatch(match *TTTMatch) *TTTMatch {
+	snapshot := &TTTMatch{
+		ID:                  match.ID,
+		Mode:                match.Mode,
+		Ranked:              match.Ranked,
+		Public:              match.Public,
+		PrivateCode:         match.PrivateCode,
+		AllowSelfPlay:       match.AllowSelfPlay,
+		Size:                match.Size,
+		WinLength:           match.WinLength,
+		RotationLeaderboard: match.RotationLeaderboard,
+		Winner:              match.Winner,
+		EndReason:           match.EndReason,
+		MoveCount:           match.MoveCount,
+		CreatedAt:           match.CreatedAt,
+		SimulationID:        match.SimulationID,
+		BotDifficulty:       match.BotDifficulty,
+		BotLevel:            match.BotLevel,
+		Round:               match.Round,
+		Players:             make(map[string]string, len(match.Players)),
+		Bots:                make(map[string]bool, len(match.Bots)),
+	}
+	for userID, symbol := range match.Players {
+		snapshot.Players[userID] = symbol
+	}
+	for userID, bot := range match.Bots {
+		snapshot.Bots[userID] = bot
+	}
+	return snapshot
+}
+
+// claimMatchResult writes the match's idempotency key, returning false if another
+// recording of the same match already claimed it
+func claimMatchResult(ctx context.Context, nk runtime.NakamaModule, match *TTTMatch) (bool, error) {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: matchResultsCollection, Key: resultKey(match)},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check match result: %w", err)
+	}
+	if len(objects) > 0 {
+		return false, nil
+	}
+
+	value, _ := json.Marshal(map[string]interface{}{
+		"winner":      match.Winner,
+		"recorded_at": time.Now().Unix(),
+	})
+
+	// Version "*" only succeeds if the key doesn't exist yet
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      matchResultsCollection,
+			Key:             resultKey(match),
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		// Lost a race with another writer, or storage failed; tell them apart
+		objects, readErr := storageRead(ctx, nk, []*runtime.StorageRead{
+			{Collection: matchResultsCollection, Key: resultKey(match)},
+		})
+		if readErr == nil && len(objects) > 0 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim match result: %w", err)
+	}
+	return true, nil
+}
+
+// sendGameOver signals a finished game's recorded results to the match, which
+// broadcasts them as the game over summary
+func sendGameOver(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch, results map[string]PlayerResult) {
+	signal, _ := json.Marshal(MatchSignalData{
+		Type:    SignalGameOver,
+		Round:   match.Round,
+		Results: results,
+	})
+	if _, err := nk.MatchSignal(ctx, match.ID, string(signal)); err != nil {
+		// The match may have ended before its results were recorded
+		logger.Debug("Failed to send game over summary to match %s: %v", match.ID, err)
+	}
+}
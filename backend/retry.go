@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Retry policy for Nakama API calls
+	retryAttempts  = 4
+	retryBaseDelay = 50 * time.Millisecond
+	retryMaxDelay  = time.Second
+
+	// Upper bound on a single backend call attempt
+	backendCallTimeout = 2 * time.Second
+
+	// Circuit breaker: open after this many consecutive failed calls, for this long
+	breakerThreshold = 5
+	breakerCooldown  = 10 * time.Second
+)
+
+// errCircuitOpen is returned without calling the backend while a breaker is open
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// circuitBreaker tracks consecutive failures of one backend operation
+type circuitBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Circuit breakers by operation name
+var (
+	breakers     = make(map[string]*circuitBreaker)
+	breakerMutex sync.Mutex
+)
+
+// withRetry runs fn with exponential backoff, giving up after retryAttempts or
+// while the operation's circuit breaker is open. Each attempt gets its own
+// backendCallTimeout. Persistent failures are counted in the
+// backend_call_failures metric.
+func withRetry(ctx context.Context, nk runtime.NakamaModule, op string, fn func(ctx context.Context) error) error {
+	return withAttempts(ctx, nk, op, retryAttempts, fn)
+}
+
+// withAttempts is withRetry with a given number of attempts. A single attempt
+// suits calls that aren't idempotent: an attempt that times out may still have
+// been applied, so repeating it could apply it twice.
+func withAttempts(ctx context.Context, nk runtime.NakamaModule, op string, attempts int, fn func(ctx context.Context) error) error {
+	if breakerOpen(op) {
+		nk.MetricsCounterAdd("backend_circuit_open", map[string]string{"op": op}, 1)
+		return fmt.Errorf("%s: %w", op, errCircuitOpen)
+	}
+
+	delay := retryBaseDelay
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, backendCallTimeout)
+		err = fn(attemptCtx)
+		cancel()
+		if err == nil {
+			breakerSuccess(op)
+			return nil
+		}
+		// The backend answered; the call itself can't succeed as made
+		if !retryable(err) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			breakerFailure(op)
+			nk.MetricsCounterAdd("backend_call_failures", map[string]string{"op": op}, 1)
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+
+	breakerFailure(op)
+	nk.MetricsCounterAdd("backend_call_failures", map[string]string{"op": op}, 1)
+	return err
+}
+
+// retryable reports whether an error may be transient. Rejected storage writes
+// (a version conflict or missing permission) fail the same way every time and
+// say nothing about the backend's health, so they are neither retried nor
+// counted towards the breaker.
+func retryable(err error) bool {
+	return !errors.Is(err, runtime.ErrStorageRejectedVersion) && !errors.Is(err, runtime.ErrStorageRejectedPermission)
+}
+
+// breakerOpen reports whether calls for an operation are currently short-circuited
+func breakerOpen(op string) bool {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+	breaker, ok := breakers[op]
+	return ok && time.Now().Before(breaker.openUntil)
+}
+
+// breakerSuccess resets an operation's failure count
+func breakerSuccess(op string) {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+	if breaker, ok := breakers[op]; ok {
+		breaker.failures = 0
+	}
+}
+
+// breakerFailure records a failed call and opens the breaker past the threshold
+func breakerFailure(op string) {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+	breaker, ok := breakers[op]
+	if !ok {
+		breaker = &circuitBreaker{}
+		breakers[op] = breaker
+	}
+	breaker.failures++
+	if breaker.failures >= breakerThreshold {
+		breaker.openUntil = time.Now().Add(breakerCooldown)
+		breaker.failures = 0
+	}
+}
+
+// storageRead is nk.StorageRead with retries
+func storageRead(ctx context.Context, nk runtime.NakamaModule, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	var objects []*api.StorageObject
+	op := "storage_read"
+	if len(reads) > 0 {
+		op += ":" + reads[0].Collection
+	}
+	err := withRetry(ctx, nk, op, func(ctx context.Context) error {
+		var err error
+		objects, err = nk.StorageRead(ctx, reads)
+		return err
+	})
+	return objects, err
+}
+
+// storageWrite is nk.StorageWrite with retries. Each collection has its own
+// breaker, so failures writing one kind of object don't hold up the others.
+func storageWrite(ctx context.Context, nk runtime.NakamaModule, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	var acks []*api.StorageObjectAck
+	op := "storage_write"
+	if len(writes) > 0 {
+		op += ":" + writes[0].Collection
+	}
+	err := withRetry(ctx, nk, op, func(ctx context.Context) error {
+		var err error
+		acks, err = nk.StorageWrite(ctx, writes)
+		return err
+	})
+	return acks, err
+}
+
+// leaderboardRecordWrite is nk.LeaderboardRecordWrite, with retries when the
+// write sets the score. Leaderboards increment by default, and an increment
+// that times out may still land, so those writes are attempted once.
+func leaderboardRecordWrite(ctx context.Context, nk runtime.NakamaModule, id, ownerID, username string, score, subscore int64, metadata map[string]interface{}, overrideOperator *int) (*api.LeaderboardRecord, error) {
+	attempts := 1
+	if overrideOperator != nil && *overrideOperator == setOperator {
+		attempts = retryAttempts
+	}
+	var record *api.LeaderboardRecord
+	err := withAttempts(ctx, nk, "leaderboard_record_write:"+id, attempts, func(ctx context.Context) error {
+		var err error
+		record, err = nk.LeaderboardRecordWrite(ctx, id, ownerID, username, score, subscore, metadata, overrideOperator)
+		return err
+	})
+	return record, err
+}
+
+// notificationsSend is nk.NotificationsSend with retries
+func notificationsSend(ctx context.Context, nk runtime.NakamaModule, notifications []*runtime.NotificationSend) error {
+	return withRetry(ctx, nk, "notifications_send", func(ctx context.Context) error {
+		return nk.NotificationsSend(ctx, notifications)
+	})
+}
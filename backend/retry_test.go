@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// countingNakama counts the metrics withRetry reports; other calls are unused
+type countingNakama struct {
+	runtime.NakamaModule
+	counters map[string]int64
+}
+
+func (n *countingNakama) MetricsCounterAdd(name string, tags map[string]string, delta int64) {
+	n.counters[name] += delta
+}
+
+func TestWithRetryDoesNotRetryOrCountVersionConflicts(t *testing.T) {
+	nk := &countingNakama{counters: map[string]int64{}}
+	op := "test_conflict"
+
+	for i := 0; i < breakerThreshold*2; i++ {
+		calls := 0
+		err := withRetry(context.Background(), nk, op, func(context.Context) error {
+			calls++
+			return runtime.ErrStorageRejectedVersion
+		})
+		if !errors.Is(err, runtime.ErrStorageRejectedVersion) {
+			t.Fatalf("got %v, want the version conflict", err)
+		}
+		if calls != 1 {
+			t.Fatalf("conflict was attempted %d times, want 1", calls)
+		}
+	}
+	if breakerOpen(op) {
+		t.Error("conflicts opened the circuit breaker")
+	}
+	if nk.counters["backend_call_failures"] != 0 {
+		t.Errorf("conflicts counted as %d backend failures", nk.counters["backend_call_failures"])
+	}
+}
+
+func TestWithAttemptsMakesOneAttemptForNonIdempotentCalls(t *testing.T) {
+	nk := &countingNakama{counters: map[string]int64{}}
+	calls := 0
+	err := withAttempts(context.Background(), nk, "test_incr", 1, func(context.Context) error {
+		calls++
+		return context.DeadlineExceeded
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("got %v after %d attempts, want an error after 1", err, calls)
+	}
+}
+
+func TestBreakersAreKeyedByOperation(t *testing.T) {
+	nk := &countingNakama{counters: map[string]int64{}}
+	for i := 0; i < breakerThreshold; i++ {
+		_ = withAttempts(context.Background(), nk, "test_failing", 1, func(context.Context) error {
+			return errors.New("unavailable")
+		})
+	}
+	if !breakerOpen("test_failing") {
+		t.Fatal("expected the failing operation's breaker to open")
+	}
+	if breakerOpen("test_healthy") {
+		t.Error("one operation's failures opened another's breaker")
+	}
+}
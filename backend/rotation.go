@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Limited-time modes
+	GameModeGravity = "gravity" // pieces drop to the lowest empty cell of a column
+	GameModeWild    = "wild"    // either player may place X or O; completing a line wins
+	GameModeMisere  = "misere"  // completing a line loses
+
+	// Rotation storage and leaderboards
+	rotationArchiveCollection = "rotation_archive"
+	rotationLeaderboardPrefix = "ttt_rotation_"
+	rotationArchiveSize       = 100
+	rotationPeriod            = 7 * 24 * time.Hour
+)
+
+// rotationModes is the weekly schedule: every limited mode in registry order
+var rotationModes = limitedModes()
+
+// rotationEpoch anchors the weekly schedule to a Monday at midnight UTC
+var rotationEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Rotation describes the limited-time mode active during one period
+type Rotation struct {
+	Mode          string `json:"mode"`
+	Period        int64  `json:"period"`
+	StartsAt      int64  `json:"starts_at"`
+	EndsAt        int64  `json:"ends_at"`
+	LeaderboardID string `json:"leaderboard_id"`
+}
+
+// RotationArchive represents the final standings of a finished rotation
+type RotationArchive struct {
+	Rotation   Rotation           `json:"rotation"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	ArchivedAt int64              `json:"archived_at"`
+}
+
+// InitRotation initializes the limited-time mode rotation
+func InitRotation(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_current_rotation", getCurrentRotationRPC); err != nil {
+		return fmt.Errorf("failed to register get_current_rotation RPC: %w", err)
+	}
+
+	if err := ensureRotation(ctx, logger, nk); err != nil {
+		return fmt.Errorf("failed to prepare rotation: %w", err)
+	}
+
+	logger.Info("Mode rotation initialized")
+	return nil
+}
+
+// getCurrentRotationRPC returns the active limited-time mode
+func getCurrentRotationRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := ensureRotation(ctx, logger, nk); err != nil {
+		logger.Error("Failed to prepare rotation: %v", err)
+	}
+
+	return rpcOK(currentRotation(time.Now()))
+}
+
+// rotationAt returns the rotation for the given period index
+func rotationAt(period int64) Rotation {
+	mode := rotationModes[int(period%int64(len(rotationModes)))]
+	start := rotationEpoch.Add(time.Duration(period) * rotationPeriod)
+	return Rotation{
+		Mode:          mode,
+		Period:        period,
+		StartsAt:      start.Unix(),
+		EndsAt:        start.Add(rotationPeriod).Unix(),
+		LeaderboardID: fmt.Sprintf("%s%s_%d", rotationLeaderboardPrefix, mode, period),
+	}
+}
+
+// currentRotation returns the rotation active at the given time
+func currentRotation(now time.Time) Rotation {
+	return rotationAt(int64(now.Sub(rotationEpoch) / rotationPeriod))
+}
+
+// isRotationMode reports whether a mode is one of the limited-time modes
+func isRotationMode(mode string) bool {
+	gameMode, ok := gameModesByName[mode]
+	return ok && gameMode.Limited
+}
+
+// limitedModes returns the names of the registered limited-time modes
+func limitedModes() []string {
+	names := make([]string, 0, len(gameModes))
+	for _, mode := range gameModes {
+		if mode.Limited {
+			names = append(names, mode.Name)
+		}
+	}
+	return names
+}
+
+// ensureRotation creates the current rotation leaderboard and archives the previous one
+func ensureRotation(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	current := currentRotation(time.Now())
+
+	existing, err := nk.LeaderboardsGetId(ctx, []string{current.LeaderboardID})
+	if err != nil {
+		return fmt.Errorf("failed to check rotation leaderboard: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	metadata := map[string]interface{}{
+		"description": "Limited-time mode: " + current.Mode,
+		"ends_at":     current.EndsAt,
+	}
+	if err := nk.LeaderboardCreate(ctx, current.LeaderboardID, true, "desc", "incr", "", metadata, true); err != nil {
+		return fmt.Errorf("failed to create rotation leaderboard: %w", err)
+	}
+	logger.Info("Created rotation leaderboard: %s", current.LeaderboardID)
+
+	if current.Period > 0 {
+		archiveRotation(ctx, logger, nk, rotationAt(current.Period-1))
+	}
+	return nil
+}
+
+// archiveRotation snapshots a finished rotation's standings to storage and removes its leaderboard
+func archiveRotation(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, rotation Rotation) {
+	existing, err := nk.LeaderboardsGetId(ctx, []string{rotation.LeaderboardID})
+	if err != nil || len(existing) == 0 {
+		return
+	}
+
+	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, rotation.LeaderboardID, nil, rotationArchiveSize, "", 0)
+	if err != nil {
+		logger.Error("Failed to read rotation leaderboard %s: %v", rotation.LeaderboardID, err)
+		return
+	}
+
+	archive := RotationArchive{
+		Rotation:   rotation,
+		Entries:    make([]LeaderboardEntry, len(records)),
+		ArchivedAt: time.Now().Unix(),
+	}
+	for i, record := range records {
+		archive.Entries[i] = LeaderboardEntry{
+			UserID:   record.OwnerId,
+			Username: record.Username.GetValue(),
+			Score:    record.Score,
+			Rank:     int(record.Rank),
+		}
+	}
+
+	value, _ := json.Marshal(archive)
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      rotationArchiveCollection,
+			Key:             rotation.LeaderboardID,
+			Value:           string(value),
+			PermissionRead:  2,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Error("Failed to archive rotation %s: %v", rotation.LeaderboardID, err)
+		return
+	}
+
+	if err := nk.LeaderboardDelete(ctx, rotation.LeaderboardID); err != nil {
+		logger.Error("Failed to delete rotation leaderboard %s: %v", rotation.LeaderboardID, err)
+	}
+	logger.Info("Archived rotation %s with %d entries", rotation.LeaderboardID, len(records))
+}
+
+// UpdateRotationLeaderboard records a score on a limited-time mode leaderboard
+func UpdateRotationLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, leaderboardID, userID string, score int64) error {
+	username := ""
+	if users, err := nk.UsersGetId(ctx, []string{userID}, nil); err == nil && len(users) > 0 {
+		username = users[0].Username
+	}
+
+	if _, err := leaderboardRecordWrite(ctx, nk, leaderboardID, userID, username, score, 0, nil, nil); err != nil {
+		return fmt.Errorf("failed to update rotation leaderboard: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// gRPC status codes used for RPC errors
+const (
+	CodeInvalidArgument    = 3
+	CodeNotFound           = 5
+	CodeAlreadyExists      = 6
+	CodePermissionDenied   = 7
+	CodeResourceExhausted  = 8
+	CodeFailedPrecondition = 9
+	CodeAborted            = 10
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+	CodeUnauthenticated    = 16
+)
+
+// Error reasons: a stable name for why an RPC failed, sent alongside the gRPC
+// code. Clients branch on the reason rather than the message, which is for
+// people and may change. Each code has a default reason; banned, in_match and
+// invalid_payload narrow permission_denied, failed_precondition and
+// invalid_argument.
+const (
+	ReasonInvalidPayload     = "invalid_payload"     // the payload isn't valid JSON for the request
+	ReasonInvalidArgument    = "invalid_argument"    // a field is missing or out of range
+	ReasonUnauthenticated    = "unauthenticated"     // no session, or it expired
+	ReasonNotFound           = "not_found"           // the match, player, party, or item doesn't exist
+	ReasonAlreadyExists      = "already_exists"      // e.g. a username or identity already taken
+	ReasonPermissionDenied   = "permission_denied"   // not allowed for this caller, e.g. admin RPCs
+	ReasonBanned             = "banned"              // the caller is banned or suspended; details carry the ban
+	ReasonInMatch            = "in_match"            // the caller is already playing a match; details carry its match_id
+	ReasonRateLimited        = "rate_limited"        // too many calls; details carry retry_after_ms
+	ReasonFailedPrecondition = "failed_precondition" // not possible in the current state, e.g. not your turn
+	ReasonConflict           = "conflict"            // a concurrent change won; retrying may succeed
+	ReasonInternal           = "internal"            // a server bug
+	ReasonUnavailable        = "unavailable"         // storage or another backend failed; retry later
+)
+
+// codeReasons is the default reason for each code
+var codeReasons = map[int]string{
+	CodeInvalidArgument:    ReasonInvalidArgument,
+	CodeNotFound:           ReasonNotFound,
+	CodeAlreadyExists:      ReasonAlreadyExists,
+	CodePermissionDenied:   ReasonPermissionDenied,
+	CodeResourceExhausted:  ReasonRateLimited,
+	CodeFailedPrecondition: ReasonFailedPrecondition,
+	CodeAborted:            ReasonConflict,
+	CodeInternal:           ReasonInternal,
+	CodeUnavailable:        ReasonUnavailable,
+	CodeUnauthenticated:    ReasonUnauthenticated,
+}
+
+// rpcTimeout bounds the backend calls made while serving one RPC
+const rpcTimeout = 10 * time.Second
+
+// RPCResponse represents the standard envelope for every RPC response
+type RPCResponse struct {
+	OK    bool        `json:"ok"`
+	Data  interface{} `json:"data,omitempty"`
+	Error *RPCError   `json:"error,omitempty"`
+}
+
+// RPCError represents an RPC error inside the envelope
+type RPCError struct {
+	Code    int         `json:"code"`
+	Reason  string      `json:"reason"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"` // machine-readable context, e.g. a ban's expiry
+}
+
+// rpcOK wraps data in a successful response envelope
+func rpcOK(data interface{}) (string, error) {
+	responseBytes, err := json.Marshal(RPCResponse{OK: true, Data: data})
+	if err != nil {
+		return "", rpcError(CodeInternal, "failed to marshal response")
+	}
+	return string(responseBytes), nil
+}
+
+// rpcError builds a runtime error carrying a failed response envelope as its message
+func rpcError(code int, message string) error {
+	return rpcErrorDetails(code, message, nil)
+}
+
+// rpcErrorDetails builds a failed response envelope with structured details
+func rpcErrorDetails(code int, message string, details interface{}) error {
+	return rpcErrorReason(code, codeReasons[code], message, details)
+}
+
+// rpcErrorReason builds a failed response envelope with a reason narrower than
+// the code's default
+func rpcErrorReason(code int, reason, message string, details interface{}) error {
+	responseBytes, err := json.Marshal(RPCResponse{
+		OK:    false,
+		Error: &RPCError{Code: code, Reason: reason, Message: message, Details: details},
+	})
+	if err != nil {
+		return runtime.NewError(message, code)
+	}
+	return runtime.NewError(string(responseBytes), code)
+}
+
+// rpcErrorf builds a failed response envelope from a format string
+func rpcErrorf(code int, format string, v ...interface{}) error {
+	return rpcError(code, fmt.Sprintf(format, v...))
+}
+
+// invalidPayload reports a payload that couldn't be parsed
+func invalidPayload(err error) error {
+	return rpcErrorReason(CodeInvalidArgument, ReasonInvalidPayload, fmt.Sprintf("invalid request format: %v", err), nil)
+}
+
+// requireAdmin rejects calls made from client sessions. Admin RPCs must be invoked
+// server-to-server with the runtime HTTP key, which carries no user ID.
+func requireAdmin(ctx context.Context) error {
+	if userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); ok && userID != "" {
+		return rpcError(CodePermissionDenied, "admin access required")
+	}
+	return nil
+}
+
+// withRPCTimeout runs an RPC with a deadline on its context, so a slow backend
+// call fails the request instead of hanging it
+func withRPCTimeout(fn rpcFunc) rpcFunc {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+		defer cancel()
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
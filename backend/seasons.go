@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// The season leaderboard (config.SeasonLeaderboardID) holds rating gained
+	// during the season and resets on the 1st at 00:00 UTC
+	seasonResetSchedule = "0 0 1 * *"
+
+	// Final standings of each season (system-owned, keyed by season ID)
+	seasonArchiveCollection = "season_archive"
+	seasonArchiveSize       = 100
+
+	// Badges players earned, one object per player
+	badgesCollection = "badges"
+	badgesKey        = "badges"
+)
+
+// SeasonRewardTier represents the reward for finishing a season at or above a rank
+type SeasonRewardTier struct {
+	MaxRank int    `json:"max_rank"`
+	Coins   int64  `json:"coins"`
+	Badge   string `json:"badge"`
+}
+
+// seasonRewardTiers are checked in order; a player gets the first tier they reach
+var seasonRewardTiers = []SeasonRewardTier{
+	{MaxRank: 1, Coins: 1000, Badge: "season_champion"},
+	{MaxRank: 10, Coins: 500, Badge: "season_top_10"},
+	{MaxRank: 100, Coins: 100, Badge: "season_top_100"},
+}
+
+// Season represents one monthly season
+type Season struct {
+	ID       string `json:"id"` // YYYY-MM
+	StartsAt int64  `json:"starts_at"`
+	EndsAt   int64  `json:"ends_at"`
+}
+
+// SeasonArchive represents the final standings of a finished season
+type SeasonArchive struct {
+	Season     Season             `json:"season"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	ArchivedAt int64              `json:"archived_at"`
+}
+
+// Badge represents a badge a player earned
+type Badge struct {
+	ID       string `json:"id"`
+	SeasonID string `json:"season_id,omitempty"`
+	EventID  string `json:"event_id,omitempty"`
+	EarnedAt int64  `json:"earned_at"`
+}
+
+// InitSeasons creates the season leaderboard and registers the season RPCs.
+// Seasons are archived and rewarded by onSeasonReset when the board resets.
+func InitSeasons(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_current_season", getCurrentSeasonRPC); err != nil {
+		return fmt.Errorf("failed to register get_current_season RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_season_history", getSeasonHistoryRPC); err != nil {
+		return fmt.Errorf("failed to register get_season_history RPC: %w", err)
+	}
+
+	if err := createSeasonLeaderboard(ctx, logger, nk); err != nil {
+		return err
+	}
+
+	logger.Info("Seasons initialized")
+	return nil
+}
+
+// createSeasonLeaderboard creates the season leaderboard if it doesn't exist
+func createSeasonLeaderboard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	existing, err := nk.LeaderboardsGetId(ctx, []string{config.SeasonLeaderboardID})
+	if err != nil {
+		return fmt.Errorf("failed to check season leaderboard: %w", err)
+	}
+	if len(existing) == 0 {
+		metadata := map[string]interface{}{"description": "Monthly season"}
+		if err := nk.LeaderboardCreate(ctx, config.SeasonLeaderboardID, true, "desc", "incr", seasonResetSchedule, metadata, true); err != nil {
+			return fmt.Errorf("failed to create season leaderboard: %w", err)
+		}
+		logger.Info("Created season leaderboard: %s", config.SeasonLeaderboardID)
+	}
+	return nil
+}
+
+// seasonAt returns the season containing the given time
+func seasonAt(t time.Time) Season {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return Season{
+		ID:       start.Format("2006-01"),
+		StartsAt: start.Unix(),
+		EndsAt:   start.AddDate(0, 1, 0).Unix(),
+	}
+}
+
+// getCurrentSeasonRPC returns the current season with its top standings and the caller's record
+func getCurrentSeasonRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, config.SeasonLeaderboardID, nil, 10, "", 0)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to get season standings: %v", err)
+	}
+	entries := seasonEntries(records)
+	attachProfiles(ctx, logger, nk, entries)
+
+	response := map[string]interface{}{
+		"season":  seasonAt(time.Now()),
+		"rewards": seasonRewardTiers,
+	}
+	if userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userID != "" {
+		if record, err := playerRecord(ctx, nk, config.SeasonLeaderboardID, userID); err == nil && record != nil {
+			response["me"] = seasonEntries([]*api.LeaderboardRecord{record})[0]
+		}
+		anonymizeEntries(ctx, logger, nk, userID, entries)
+	}
+	response["entries"] = entries
+	return rpcOK(response)
+}
+
+// getSeasonHistoryRPC returns the archived final standings of past seasons,
+// in season order, or of one season when season_id is given
+func getSeasonHistoryRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request struct {
+		SeasonID string `json:"season_id"`
+		Limit    int    `json:"limit"`
+		Cursor   string `json:"cursor"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			return "", invalidPayload(err)
+		}
+	}
+	if request.Limit <= 0 || request.Limit > 12 {
+		request.Limit = 12
+	}
+
+	if request.SeasonID != "" {
+		objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+			{Collection: seasonArchiveCollection, Key: request.SeasonID},
+		})
+		if err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to read season archive: %v", err)
+		}
+		if len(objects) == 0 {
+			return "", rpcErrorf(CodeNotFound, "no archive for season %s", request.SeasonID)
+		}
+		var archive SeasonArchive
+		if err := json.Unmarshal([]byte(objects[0].Value), &archive); err != nil {
+			return "", rpcErrorf(CodeInternal, "failed to parse season archive: %v", err)
+		}
+		return rpcOK(map[string]interface{}{"seasons": []SeasonArchive{archive}})
+	}
+
+	objects, cursor, err := nk.StorageList(ctx, "", "", seasonArchiveCollection, request.Limit, request.Cursor)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to list season archives: %v", err)
+	}
+	archives := make([]SeasonArchive, 0, len(objects))
+	for _, object := range objects {
+		var archive SeasonArchive
+		if err := json.Unmarshal([]byte(object.Value), &archive); err == nil {
+			archives = append(archives, archive)
+		}
+	}
+	return rpcOK(map[string]interface{}{"seasons": archives, "cursor": cursor})
+}
+
+// onSeasonReset archives the season that just ended and rewards its top players.
+// Other leaderboards resetting are ignored.
+func onSeasonReset(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, leaderboard *api.Leaderboard, reset int64) error {
+	if leaderboard.GetId() != config.SeasonLeaderboardID {
+		return nil
+	}
+
+	// The period that just ended expired at the reset time
+	season := seasonAt(time.Unix(reset-1, 0))
+	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, config.SeasonLeaderboardID, nil, seasonArchiveSize, "", reset)
+	if err != nil {
+		return fmt.Errorf("failed to read final standings of season %s: %w", season.ID, err)
+	}
+
+	archive := SeasonArchive{
+		Season:     season,
+		Entries:    seasonEntries(records),
+		ArchivedAt: time.Now().Unix(),
+	}
+	value, _ := json.Marshal(archive)
+
+	// Version "*" only succeeds for the first archive of a season, so rewards are granted once
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      seasonArchiveCollection,
+			Key:             season.ID,
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  2,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Warn("Season %s was already archived: %v", season.ID, err)
+		return nil
+	}
+
+	for _, entry := range archive.Entries {
+		grantSeasonReward(ctx, logger, nk, season, entry)
+	}
+	logger.Info("Archived season %s with %d entries", season.ID, len(archive.Entries))
+	return nil
+}
+
+// grantSeasonReward pays out the reward tier a player's final rank reached, if any
+func grantSeasonReward(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, season Season, entry LeaderboardEntry) {
+	var tier *SeasonRewardTier
+	for i := range seasonRewardTiers {
+		if entry.Rank <= seasonRewardTiers[i].MaxRank {
+			tier = &seasonRewardTiers[i]
+			break
+		}
+	}
+	if tier == nil || isBotAccount(entry.UserID) {
+		return
+	}
+	userLogger := logger.WithFields(map[string]interface{}{"user_id": entry.UserID, "season": season.ID})
+
+	metadata := map[string]interface{}{"reason": "season", "season_id": season.ID, "rank": entry.Rank}
+	if _, _, err := nk.WalletUpdate(ctx, entry.UserID, map[string]int64{walletCoins: tier.Coins}, metadata, true); err != nil {
+		userLogger.Error("Failed to grant season coins: %v", err)
+	}
+	if err := awardBadge(ctx, nk, entry.UserID, Badge{ID: tier.Badge, SeasonID: season.ID, EarnedAt: time.Now().Unix()}); err != nil {
+		userLogger.Error("Failed to award season badge: %v", err)
+	}
+
+	if err := notificationsSend(ctx, nk, []*runtime.NotificationSend{
+		{
+			UserID:  entry.UserID,
+			Subject: "Season Reward",
+			Content: map[string]interface{}{
+				"type":      "season_reward",
+				"season_id": season.ID,
+				"rank":      entry.Rank,
+				"coins":     tier.Coins,
+				"badge":     tier.Badge,
+			},
+			Code:       NotificationSeasonReward,
+			Persistent: true,
+		},
+	}); err != nil {
+		userLogger.Warn("Failed to notify player of season reward: %v", err)
+	}
+}
+
+// awardBadge adds a badge to a player's collection. A badge already earned for
+// the same season or event isn't added again.
+func awardBadge(ctx context.Context, nk runtime.NakamaModule, userID string, badge Badge) error {
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: badgesCollection, Key: badgesKey, UserID: userID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read badges: %w", err)
+	}
+
+	var badges []Badge
+	version := "*"
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), &badges); err != nil {
+			return fmt.Errorf("failed to parse badges: %w", err)
+		}
+		version = objects[0].Version
+	}
+	for _, earned := range badges {
+		if earned.ID == badge.ID && earned.SeasonID == badge.SeasonID && earned.EventID == badge.EventID {
+			return nil
+		}
+	}
+	badges = append(badges, badge)
+
+	value, _ := json.Marshal(badges)
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      badgesCollection,
+			Key:             badgesKey,
+			UserID:          userID,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  2,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to write badges: %w", err)
+	}
+	return nil
+}
+
+// seasonEntries converts season leaderboard records with the results in their metadata
+func seasonEntries(records []*api.LeaderboardRecord) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, len(records))
+	for i, record := range records {
+		entries[i], _ = recordEntry(record)
+	}
+	return entries
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Longest series a match may be created with
+	maxBestOf = 7
+	// Seconds between games of a series so players can see the result
+	seriesBreakSeconds = 3
+)
+
+// SeriesData represents the score of a best-of-N series in state broadcasts
+type SeriesData struct {
+	BestOf int            `json:"best_of"`
+	Game   int            `json:"game"` // 1-based game number within the series
+	Wins   map[string]int `json:"wins"` // userID -> games won
+}
+
+// bestOfParam reads the best_of match parameter, falling back to a single game
+// unless it is an odd number no larger than maxBestOf
+func bestOfParam(logger runtime.Logger, params map[string]interface{}) int {
+	bestOf := intParam(params, "best_of", 1)
+	if bestOf < 1 || bestOf > maxBestOf || bestOf%2 == 0 {
+		logger.Warn("Invalid best_of %d, playing a single game", bestOf)
+		return 1
+	}
+	return bestOf
+}
+
+// winsNeeded returns the game wins that decide a series
+func winsNeeded(match *TTTMatch) int {
+	return match.BestOf/2 + 1
+}
+
+// seriesState returns the series score for broadcasts, or nil for single games
+func seriesState(match *TTTMatch) *SeriesData {
+	if match.BestOf <= 1 {
+		return nil
+	}
+	return &SeriesData{
+		BestOf: match.BestOf,
+		Game:   match.SeriesGame,
+		Wins:   match.SeriesWins,
+	}
+}
+
+// endGame is called when a game finishes. It records results once the match is
+// decided; in an undecided series it tallies the game and schedules the next one.
+// A forfeit ends the whole series.
+func (h *TTTMatchHandler) endGame(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch, forfeit bool) {
+	recordGameFinished(nk, match)
+	if match.BestOf > 1 && !forfeit {
+		if match.Winner != "" {
+			for userID, symbol := range match.Players {
+				if symbol == match.Winner {
+					match.SeriesWins[userID]++
+					if match.SeriesWins[userID] >= winsNeeded(match) {
+						logger.WithField("user_id", userID).Info("Series won %d games to best of %d", match.SeriesWins[userID], match.BestOf)
+						h.finishGame(ctx, logger, nk, match)
+						return
+					}
+				}
+			}
+		}
+
+		// Draws don't count, so the series goes on until someone reaches winsNeeded
+		match.NextGameTick = match.Tick + int64(seriesBreakSeconds*match.TickRate)
+		logger.Info("Game %d of series finished, next game in %ds", match.SeriesGame, seriesBreakSeconds)
+		return
+	}
+
+	h.finishGame(ctx, logger, nk, match)
+}
+
+// seriesPending reports whether the finished game is a break within a series
+func seriesPending(match *TTTMatch) bool {
+	return match.NextGameTick > 0
+}
+
+// startNextSeriesGame resets the board for the next game of a series, with symbols swapped
+func (h *TTTMatchHandler) startNextSeriesGame(logger runtime.Logger, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	for userID, symbol := range match.Players {
+		match.Players[userID] = opponentOf(symbol)
+	}
+	resetGame(match)
+	match.SeriesGame++
+
+	logger.Info("Starting game %d of best of %d", match.SeriesGame, match.BestOf)
+	h.broadcastState(dispatcher, match, nil)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-user settings storage
+	settingsCollection = "user_settings"
+	settingsKey        = "settings"
+
+	// Name shown in place of players who enabled streamer mode
+	AnonymousName = "Anonymous"
+)
+
+// UserSettings represents per-user preferences
+type UserSettings struct {
+	StreamerMode bool `json:"streamer_mode"`
+	// Accept challenges from any player rather than only from friends
+	ChallengesFromAnyone bool `json:"challenges_from_anyone"`
+	// Notify the player when it's their turn while they're away from the match,
+	// and when the matchmaker finds them an opponent; both are on by default
+	TurnNotifications       bool `json:"turn_notifications"`
+	MatchFoundNotifications bool `json:"match_found_notifications"`
+}
+
+// defaultUserSettings returns the settings of a player who never changed them
+func defaultUserSettings() *UserSettings {
+	return &UserSettings{
+		TurnNotifications:       true,
+		MatchFoundNotifications: true,
+	}
+}
+
+// InitSettings initializes user settings RPCs
+func InitSettings(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_settings", getSettingsRPC); err != nil {
+		return fmt.Errorf("failed to register get_settings RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("update_settings", updateSettingsRPC); err != nil {
+		return fmt.Errorf("failed to register update_settings RPC: %w", err)
+	}
+
+	logger.Info("User settings system initialized")
+	return nil
+}
+
+// getSettingsRPC returns the caller's settings
+func getSettingsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	settings, err := GetUserSettings(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	return rpcOK(settings)
+}
+
+// updateSettingsRPC stores the caller's settings
+func updateSettingsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	// Settings left out of the request keep their defaults
+	settings := defaultUserSettings()
+	if err := json.Unmarshal([]byte(payload), settings); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to marshal settings: %v", err)
+	}
+
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      settingsCollection,
+			Key:             settingsKey,
+			UserID:          userID,
+			Value:           string(value),
+			PermissionRead:  1,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to store settings: %v", err)
+	}
+
+	logger.Info("Updated settings for user %s: streamer_mode=%v challenges_from_anyone=%v turn_notifications=%v match_found_notifications=%v",
+		userID, settings.StreamerMode, settings.ChallengesFromAnyone, settings.TurnNotifications, settings.MatchFoundNotifications)
+	return rpcOK(settings)
+}
+
+// GetUserSettings reads a user's settings, returning defaults if none are stored
+func GetUserSettings(ctx context.Context, nk runtime.NakamaModule, userID string) (*UserSettings, error) {
+	settings, err := getUsersSettings(ctx, nk, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	return settings[userID], nil
+}
+
+// getUsersSettings reads the settings of several users in a single storage call
+func getUsersSettings(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]*UserSettings, error) {
+	settings := make(map[string]*UserSettings, len(userIDs))
+	if len(userIDs) == 0 {
+		return settings, nil
+	}
+
+	reads := make([]*runtime.StorageRead, len(userIDs))
+	for i, userID := range userIDs {
+		settings[userID] = defaultUserSettings()
+		reads[i] = &runtime.StorageRead{
+			Collection: settingsCollection,
+			Key:        settingsKey,
+			UserID:     userID,
+		}
+	}
+
+	objects, err := storageRead(ctx, nk, reads)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user settings: %w", err)
+	}
+
+	for _, object := range objects {
+		// Settings stored before a field existed keep its default
+		stored := defaultUserSettings()
+		if err := json.Unmarshal([]byte(object.Value), stored); err == nil {
+			settings[object.UserId] = stored
+		}
+	}
+	return settings, nil
+}
+
+// anonymizeEntries hides the identity of streamer-mode players from everyone but themselves
+func anonymizeEntries(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, viewerID string, entries []LeaderboardEntry) {
+	userIDs := make([]string, len(entries))
+	for i, entry := range entries {
+		userIDs[i] = entry.UserID
+	}
+
+	settings, err := getUsersSettings(ctx, nk, userIDs)
+	if err != nil {
+		logger.Warn("Failed to load streamer settings for leaderboard: %v", err)
+		return
+	}
+
+	for i := range entries {
+		if entries[i].UserID != viewerID && settings[entries[i].UserID].StreamerMode {
+			entries[i].Username = AnonymousName
+			entries[i].UserID = ""
+			entries[i].DisplayName = ""
+			entries[i].AvatarID = ""
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-user owned and equipped cosmetics
+	cosmeticsCollection = "cosmetics"
+	cosmeticsKey        = "inventory"
+
+	// Cosmetic slots; a player equips at most one item per slot
+	ItemBoardTheme = "board_theme"
+	ItemPieceSkin  = "piece_skin" // drawn for the player's pieces, whether they play X or O
+
+	// Match signal delivering a joined player's equipped cosmetics
+	SignalCosmetics = "cosmetics"
+)
+
+// ShopItem represents a cosmetic for sale
+type ShopItem struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"` // in wallet coins
+
+	// Limited items are only sold during a live event or a season
+	Event  string `json:"event,omitempty"`  // LiveEvent ID
+	Season string `json:"season,omitempty"` // season ID, YYYY-MM
+}
+
+// ShopOffer represents a catalog item with whether it can be bought right now
+type ShopOffer struct {
+	ShopItem
+	Available bool `json:"available"`
+}
+
+// Cosmetics represents the items a player has equipped
+type Cosmetics struct {
+	BoardTheme string `json:"board_theme,omitempty"`
+	PieceSkin  string `json:"piece_skin,omitempty"`
+}
+
+// Inventory represents the stored cosmetics of a player
+type Inventory struct {
+	Owned    []string  `json:"owned"`
+	Equipped Cosmetics `json:"equipped"`
+}
+
+// ShopItemRequest represents buy_item and equip_item requests
+type ShopItemRequest struct {
+	ItemID string `json:"item_id"`
+	Type   string `json:"type,omitempty"` // equip_item with an empty item_id unequips this slot
+}
+
+// shopCatalog lists every cosmetic for sale
+var shopCatalog = []ShopItem{
+	{ID: "theme_midnight", Type: ItemBoardTheme, Name: "Midnight", Price: 100},
+	{ID: "theme_chalkboard", Type: ItemBoardTheme, Name: "Chalkboard", Price: 150},
+	{ID: "theme_neon", Type: ItemBoardTheme, Name: "Neon", Price: 250},
+	{ID: "skin_classic_ink", Type: ItemPieceSkin, Name: "Classic Ink", Price: 80},
+	{ID: "skin_pixel", Type: ItemPieceSkin, Name: "Pixel", Price: 150},
+	{ID: "skin_gold", Type: ItemPieceSkin, Name: "Gold", Price: 400},
+	{ID: "theme_winter_festival", Type: ItemBoardTheme, Name: "Winter Festival", Price: 200, Event: "winter_festival"},
+	{ID: "skin_frost", Type: ItemPieceSkin, Name: "Frost", Price: 300, Season: "2026-12"},
+}
+
+// shopItemsByID indexes the catalog
+var shopItemsByID = indexShopItems(shopCatalog)
+
+// InitShop registers the cosmetic shop RPCs
+func InitShop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("get_shop", getShopRPC); err != nil {
+		return fmt.Errorf("failed to register get_shop RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("buy_item", buyItemRPC); err != nil {
+		return fmt.Errorf("failed to register buy_item RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("equip_item", equipItemRPC); err != nil {
+		return fmt.Errorf("failed to register equip_item RPC: %w", err)
+	}
+
+	logger.Info("Shop initialized")
+	return nil
+}
+
+// getShopRPC returns the catalog with the caller's inventory and coin balance
+func getShopRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	inventory, _, err := loadInventory(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	coins, err := walletCoinBalance(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	events, err := loadEvents(ctx, nk)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+
+	now := time.Now().Unix()
+	offers := make([]ShopOffer, len(shopCatalog))
+	for i, item := range shopCatalog {
+		available, _ := itemWindowStatus(item, events, now)
+		offers[i] = ShopOffer{ShopItem: item, Available: available}
+	}
+
+	return rpcOK(map[string]interface{}{
+		"items":    offers,
+		"owned":    inventory.Owned,
+		"equipped": inventory.Equipped,
+		"legacy":   legacyItems(inventory.Owned, events, now),
+		"coins":    coins,
+	})
+}
+
+// buyItemRPC spends wallet coins on a cosmetic
+func buyItemRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request ShopItemRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	item, ok := shopItemsByID[request.ItemID]
+	if !ok {
+		return "", rpcErrorf(CodeNotFound, "no item %q in the shop", request.ItemID)
+	}
+
+	// Limited items can only be bought inside their event or season
+	events, err := loadEvents(ctx, nk)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	now := time.Now().Unix()
+	if available, _ := itemWindowStatus(item, events, now); !available {
+		return "", rpcErrorf(CodeFailedPrecondition, "item %s is not on sale right now", item.ID)
+	}
+
+	inventory, version, err := loadInventory(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+	if inventory.owns(item.ID) {
+		return "", rpcErrorf(CodeAlreadyExists, "item %s is already owned", item.ID)
+	}
+
+	// Nakama rejects wallet updates that would leave a negative balance
+	metadata := map[string]interface{}{"reason": "shop", "item_id": item.ID}
+	if _, _, err := nk.WalletUpdate(ctx, userID, map[string]int64{walletCoins: -item.Price}, metadata, true); err != nil {
+		return "", rpcErrorf(CodeFailedPrecondition, "not enough coins for %s (costs %d)", item.ID, item.Price)
+	}
+
+	inventory.Owned = append(inventory.Owned, item.ID)
+	if err := writeInventory(ctx, nk, userID, inventory, version); err != nil {
+		// Don't keep the coins for an item the player didn't get
+		refund := map[string]interface{}{"reason": "shop_refund", "item_id": item.ID}
+		if _, _, refundErr := nk.WalletUpdate(ctx, userID, map[string]int64{walletCoins: item.Price}, refund, true); refundErr != nil {
+			logger.Error("Failed to refund %d coins to %s for %s: %v", item.Price, userID, item.ID, refundErr)
+		}
+		return "", rpcErrorf(CodeAborted, "failed to store purchase, try again: %v", err)
+	}
+
+	logger.Info("User %s bought %s for %d coins", userID, item.ID, item.Price)
+	return rpcOK(inventory)
+}
+
+// equipItemRPC equips an owned cosmetic in its slot, or empties a slot
+func equipItemRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+
+	var request ShopItemRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	inventory, version, err := loadInventory(ctx, nk, userID)
+	if err != nil {
+		return "", rpcError(CodeUnavailable, err.Error())
+	}
+
+	slot := request.Type
+	if request.ItemID != "" {
+		item, ok := shopItemsByID[request.ItemID]
+		if !ok {
+			return "", rpcErrorf(CodeNotFound, "no item %q in the shop", request.ItemID)
+		}
+		if !inventory.owns(item.ID) {
+			return "", rpcErrorf(CodePermissionDenied, "item %s is not owned", item.ID)
+		}
+		slot = item.Type
+	}
+
+	switch slot {
+	case ItemBoardTheme:
+		inventory.Equipped.BoardTheme = request.ItemID
+	case ItemPieceSkin:
+		inventory.Equipped.PieceSkin = request.ItemID
+	default:
+		return "", rpcErrorf(CodeInvalidArgument, "type must be %s or %s", ItemBoardTheme, ItemPieceSkin)
+	}
+
+	if err := writeInventory(ctx, nk, userID, inventory, version); err != nil {
+		return "", rpcErrorf(CodeAborted, "failed to equip item, try again: %v", err)
+	}
+	return rpcOK(inventory)
+}
+
+// loadPlayerCosmetics reads a player's equipped cosmetics outside the match loop
+// and signals them to the match, which adds them to its state broadcasts
+func loadPlayerCosmetics(logger runtime.Logger, nk runtime.NakamaModule, matchID, userID string) {
+	if isBotAccount(userID) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backendCallTimeout)
+	defer cancel()
+
+	inventory, _, err := loadInventory(ctx, nk, userID)
+	if err != nil {
+		logger.Warn("Failed to load cosmetics of %s: %v", userID, err)
+		return
+	}
+	if inventory.Equipped == (Cosmetics{}) {
+		return
+	}
+
+	signal, _ := json.Marshal(MatchSignalData{
+		Type:      SignalCosmetics,
+		UserIDs:   []string{userID},
+		Cosmetics: &inventory.Equipped,
+	})
+	if _, err := nk.MatchSignal(ctx, matchID, string(signal)); err != nil {
+		logger.Warn("Failed to send cosmetics of %s to match %s: %v", userID, matchID, err)
+	}
+}
+
+// loadInventory reads a player's cosmetics and their storage version
+func loadInventory(ctx context.Context, nk runtime.NakamaModule, userID string) (*Inventory, string, error) {
+	inventories, versions, err := loadInventories(ctx, nk, []string{userID})
+	if err != nil {
+		return nil, "", err
+	}
+	return inventories[userID], versions[userID], nil
+}
+
+// loadInventories reads the cosmetics of several players in one storage call.
+// Players without stored cosmetics get an empty inventory and version "*".
+func loadInventories(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]*Inventory, map[string]string, error) {
+	inventories := make(map[string]*Inventory, len(userIDs))
+	versions := make(map[string]string, len(userIDs))
+	reads := make([]*runtime.StorageRead, len(userIDs))
+	for i, userID := range userIDs {
+		inventories[userID] = &Inventory{Owned: []string{}}
+		versions[userID] = "*"
+		reads[i] = &runtime.StorageRead{Collection: cosmeticsCollection, Key: cosmeticsKey, UserID: userID}
+	}
+
+	objects, err := storageRead(ctx, nk, reads)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read cosmetics: %w", err)
+	}
+	for _, object := range objects {
+		var inventory Inventory
+		if err := json.Unmarshal([]byte(object.Value), &inventory); err != nil {
+			continue
+		}
+		if inventory.Owned == nil {
+			inventory.Owned = []string{}
+		}
+		inventories[object.UserId] = &inventory
+		versions[object.UserId] = object.Version
+	}
+	return inventories, versions, nil
+}
+
+// writeInventory stores a player's cosmetics if they are unchanged since read at version
+func writeInventory(ctx context.Context, nk runtime.NakamaModule, userID string, inventory *Inventory, version string) error {
+	value, err := json.Marshal(inventory)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cosmetics: %w", err)
+	}
+
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection:      cosmeticsCollection,
+			Key:             cosmeticsKey,
+			UserID:          userID,
+			Value:           string(value),
+			Version:         version,
+			PermissionRead:  2, // opponents' clients may render equipped items
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to write cosmetics: %w", err)
+	}
+	return nil
+}
+
+// walletCoinBalance returns a player's coin balance
+func walletCoinBalance(ctx context.Context, nk runtime.NakamaModule, userID string) (int64, error) {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read account: %w", err)
+	}
+
+	var wallet map[string]int64
+	if account.GetWallet() != "" {
+		if err := json.Unmarshal([]byte(account.GetWallet()), &wallet); err != nil {
+			return 0, fmt.Errorf("failed to parse wallet: %w", err)
+		}
+	}
+	return wallet[walletCoins], nil
+}
+
+// owns reports whether the inventory holds an item
+func (i *Inventory) owns(itemID string) bool {
+	for _, owned := range i.Owned {
+		if owned == itemID {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyItems returns the owned limited items whose event or season is over.
+// Legacy items stay owned and equippable; they just can't be bought anymore.
+func legacyItems(owned []string, events []LiveEvent, now int64) []string {
+	legacy := []string{}
+	for _, itemID := range owned {
+		item, ok := shopItemsByID[itemID]
+		if !ok {
+			continue
+		}
+		if _, expired := itemWindowStatus(item, events, now); expired {
+			legacy = append(legacy, itemID)
+		}
+	}
+	return legacy
+}
+
+// itemWindowStatus reports whether an item is on sale at now, and whether its
+// sale window has closed for good. Items without an event or season are always
+// on sale; an event item whose event is no longer scheduled has expired.
+func itemWindowStatus(item ShopItem, events []LiveEvent, now int64) (available, expired bool) {
+	var startAt, endAt int64
+	switch {
+	case item.Event != "":
+		scheduled := false
+		for _, event := range events {
+			if event.ID == item.Event {
+				startAt, endAt, scheduled = event.StartAt, event.EndAt, true
+				break
+			}
+		}
+		if !scheduled {
+			return false, true
+		}
+	case item.Season != "":
+		start, err := time.Parse("2006-01", item.Season)
+		if err != nil {
+			return false, true
+		}
+		season := seasonAt(start)
+		startAt, endAt = season.StartsAt, season.EndsAt
+	default:
+		return true, false
+	}
+	return startAt <= now && now < endAt, now >= endAt
+}
+
+// indexShopItems maps item IDs to catalog entries
+func indexShopItems(items []ShopItem) map[string]ShopItem {
+	index := make(map[string]ShopItem, len(items))
+	for _, item := range items {
+		index[item.ID] = item
+	}
+	return index
+}
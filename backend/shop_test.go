@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// scheduleEvents stores an event schedule and drops the cached one
+func scheduleEvents(t *testing.T, nk runtime.NakamaModule, events ...LiveEvent) {
+	t.Helper()
+	payload, _ := json.Marshal(map[string]interface{}{"events": events})
+	if _, err := setEventsRPC(context.Background(), discardLogger{}, nil, nk, string(payload)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		eventsMutex.Lock()
+		eventsCacheLoaded = time.Time{}
+		eventsMutex.Unlock()
+	})
+}
+
+func TestItemWindowStatus(t *testing.T) {
+	now := time.Date(2026, 12, 15, 0, 0, 0, 0, time.UTC).Unix()
+	events := []LiveEvent{
+		{ID: "running", StartAt: now - 60, EndAt: now + 60},
+		{ID: "upcoming", StartAt: now + 60, EndAt: now + 120},
+		{ID: "over", StartAt: now - 120, EndAt: now - 60},
+	}
+
+	tests := []struct {
+		item      ShopItem
+		available bool
+		expired   bool
+	}{
+		{ShopItem{ID: "plain"}, true, false},
+		{ShopItem{ID: "running", Event: "running"}, true, false},
+		{ShopItem{ID: "upcoming", Event: "upcoming"}, false, false},
+		{ShopItem{ID: "over", Event: "over"}, false, true},
+		{ShopItem{ID: "unscheduled", Event: "unscheduled"}, false, true},
+		{ShopItem{ID: "this_season", Season: "2026-12"}, true, false},
+		{ShopItem{ID: "next_season", Season: "2027-01"}, false, false},
+		{ShopItem{ID: "last_season", Season: "2026-11"}, false, true},
+	}
+	for _, test := range tests {
+		available, expired := itemWindowStatus(test.item, events, now)
+		if available != test.available || expired != test.expired {
+			t.Errorf("%s: got available %v expired %v, want %v %v", test.item.ID, available, expired, test.available, test.expired)
+		}
+	}
+}
+
+func TestBuyEventItemOnlyWhileEventRuns(t *testing.T) {
+	nk := newMemoryNakama()
+	ctx := sessionContext("user-1", "alice")
+	nk.WalletUpdate(ctx, "user-1", map[string]int64{walletCoins: 1000}, nil, false)
+	payload := `{"item_id": "theme_winter_festival"}`
+	now := time.Now().Unix()
+
+	scheduleEvents(t, nk, LiveEvent{ID: "winter_festival", StartAt: now - 7200, EndAt: now - 3600})
+	_, err := buyItemRPC(ctx, discardLogger{}, nil, nk, payload)
+	var rpcErr *runtime.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeFailedPrecondition {
+		t.Fatalf("bought an item after its event ended: %v", err)
+	}
+
+	scheduleEvents(t, nk, LiveEvent{ID: "winter_festival", StartAt: now - 3600, EndAt: now + 3600})
+	if _, err := buyItemRPC(ctx, discardLogger{}, nil, nk, payload); err != nil {
+		t.Fatalf("failed to buy an item during its event: %v", err)
+	}
+
+	scheduleEvents(t, nk, LiveEvent{ID: "winter_festival", StartAt: now - 7200, EndAt: now - 3600})
+	inventory, _, err := loadInventory(ctx, nk, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ := loadEvents(ctx, nk)
+	if legacy := legacyItems(inventory.Owned, events, now); len(legacy) != 1 || legacy[0] != "theme_winter_festival" {
+		t.Errorf("expected the event item to be legacy after the event, got %v", legacy)
+	}
+}
+
+func TestEventBadgeAwardedOncePerEvent(t *testing.T) {
+	nk := newMemoryNakama()
+	ctx := context.Background()
+	now := time.Now().Unix()
+	scheduleEvents(t, nk,
+		LiveEvent{ID: "spring_cup", StartAt: now - 3600, EndAt: now + 3600, Badge: "spring_cup_winner"},
+		LiveEvent{ID: "autumn_cup", StartAt: now - 7200, EndAt: now - 3600, Badge: "autumn_cup_winner"},
+	)
+
+	awardEventBadges(ctx, discardLogger{}, nk, "user-1")
+	awardEventBadges(ctx, discardLogger{}, nk, "user-1")
+
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{Collection: badgesCollection, Key: badgesKey, UserID: "user-1"},
+	})
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("expected a badges object, got %v (%v)", objects, err)
+	}
+	var badges []Badge
+	if err := json.Unmarshal([]byte(objects[0].Value), &badges); err != nil {
+		t.Fatal(err)
+	}
+	if len(badges) != 1 || badges[0].ID != "spring_cup_winner" || badges[0].EventID != "spring_cup" {
+		t.Errorf("expected only the running event's badge once, got %+v", badges)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Simulation limits
+	simulationCollection = "simulation_runs"
+	maxSimulatedMatches  = 1000
+	maxSimulationRate    = 50.0 // matches started per second
+	simulationTimeout    = 5 * time.Minute
+)
+
+// SimulateMatchesRequest represents simulate_matches request
+type SimulateMatchesRequest struct {
+	Count  int     `json:"count"`
+	Rate   float64 `json:"rate"`
+	Mode   string  `json:"mode"`
+	Ranked *bool   `json:"ranked,omitempty"`
+}
+
+// SimulationReport represents the outcome of a simulation run
+type SimulationReport struct {
+	ID           string  `json:"id"`
+	Mode         string  `json:"mode"`
+	Ranked       bool    `json:"ranked"`
+	Requested    int     `json:"requested"`
+	Started      int     `json:"started"`
+	Completed    int     `json:"completed"`
+	Unfinished   int     `json:"unfinished"`
+	CreateErrors int     `json:"create_errors"`
+	RecordErrors int     `json:"record_errors"`
+	Throughput   float64 `json:"throughput"` // completed matches per second
+	DurationMs   int64   `json:"duration_ms"`
+	StartedAt    int64   `json:"started_at"`
+	FinishedAt   int64   `json:"finished_at,omitempty"`
+}
+
+// simulationRun tracks an in-progress simulation
+type simulationRun struct {
+	report SimulationReport
+}
+
+// Active simulation runs
+var (
+	simulations     = make(map[string]*simulationRun)
+	simulationMutex sync.Mutex
+)
+
+// InitSimulation initializes the self-play simulation RPCs
+func InitSimulation(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("simulate_matches", simulateMatchesRPC); err != nil {
+		return fmt.Errorf("failed to register simulate_matches RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_simulation_report", getSimulationReportRPC); err != nil {
+		return fmt.Errorf("failed to register get_simulation_report RPC: %w", err)
+	}
+
+	logger.Info("Simulation system initialized")
+	return nil
+}
+
+// simulateMatchesRPC starts N bot-vs-bot matches at the given rate (admin only)
+func simulateMatchesRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request SimulateMatchesRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	if request.Count <= 0 || request.Count > maxSimulatedMatches {
+		return "", rpcErrorf(CodeInvalidArgument, "count must be between 1 and %d", maxSimulatedMatches)
+	}
+	if request.Rate <= 0 || request.Rate > maxSimulationRate {
+		request.Rate = maxSimulationRate
+	}
+	if mode, ok := gameModesByName[request.Mode]; !ok || mode.Limited {
+		request.Mode = GameModeClassic
+	}
+	// Simulations are casual unless asked otherwise, so they stay off the leaderboards
+	ranked := false
+	if request.Ranked != nil {
+		ranked = *request.Ranked
+	}
+
+	run := &simulationRun{
+		report: SimulationReport{
+			ID:        fmt.Sprintf("sim_%d", time.Now().UnixNano()),
+			Mode:      request.Mode,
+			Ranked:    ranked,
+			Requested: request.Count,
+			StartedAt: time.Now().Unix(),
+		},
+	}
+
+	simulationMutex.Lock()
+	simulations[run.report.ID] = run
+	simulationMutex.Unlock()
+
+	// The run outlives this RPC call, so it must not use the request context
+	go runSimulation(context.Background(), logger, nk, run, request)
+
+	logger.Info("Started simulation %s: %d %s matches at %.1f/s", run.report.ID, request.Count, request.Mode, request.Rate)
+	return rpcOK(map[string]interface{}{
+		"simulation_id": run.report.ID,
+		"count":         request.Count,
+		"rate":          request.Rate,
+	})
+}
+
+// getSimulationReportRPC returns the progress or final report of a simulation (admin only)
+func getSimulationReportRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	var request struct {
+		ID string `json:"simulation_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	simulationMutex.Lock()
+	run, ok := simulations[request.ID]
+	var report SimulationReport
+	if ok {
+		report = run.report
+	}
+	simulationMutex.Unlock()
+	if ok {
+		return rpcOK(report)
+	}
+
+	// Finished runs are kept in storage
+	objects, err := storageRead(ctx, nk, []*runtime.StorageRead{
+		{Collection: simulationCollection, Key: request.ID},
+	})
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to read simulation report: %v", err)
+	}
+	if len(objects) == 0 {
+		return "", rpcError(CodeNotFound, "simulation not found")
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), &report); err != nil {
+		return "", rpcErrorf(CodeInternal, "failed to decode simulation report: %v", err)
+	}
+	return rpcOK(report)
+}
+
+// runSimulation creates the requested matches, waits for them to finish, and stores the report
+func runSimulation(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, run *simulationRun, request SimulateMatchesRequest) {
+	started := time.Now()
+	interval := time.Duration(float64(time.Second) / request.Rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := 0; i < request.Count; i++ {
+		// Pair two roster bots so results attribute to real bot identities
+		bots, err := randomBotPair()
+		if err == nil {
+			_, err = nk.MatchCreate(ctx, "ttt_match", map[string]interface{}{
+				"mode":          run.report.Mode,
+				"ranked":        run.report.Ranked,
+				"bots":          bots,
+				"simulation_id": run.report.ID,
+			})
+		}
+
+		simulationMutex.Lock()
+		if err != nil {
+			run.report.CreateErrors++
+		} else {
+			run.report.Started++
+		}
+		simulationMutex.Unlock()
+
+		if err != nil {
+			logger.Error("Simulation %s failed to create match: %v", run.report.ID, err)
+		}
+		<-ticker.C
+	}
+
+	// Wait for the started matches to finish
+	deadline := time.Now().Add(simulationTimeout)
+	for time.Now().Before(deadline) {
+		simulationMutex.Lock()
+		done := run.report.Completed >= run.report.Started
+		simulationMutex.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	simulationMutex.Lock()
+	elapsed := time.Since(started)
+	run.report.Unfinished = run.report.Started - run.report.Completed
+	run.report.DurationMs = elapsed.Milliseconds()
+	run.report.Throughput = float64(run.report.Completed) / elapsed.Seconds()
+	run.report.FinishedAt = time.Now().Unix()
+	report := run.report
+	delete(simulations, run.report.ID)
+	simulationMutex.Unlock()
+
+	value, _ := json.Marshal(report)
+	if _, err := storageWrite(ctx, nk, []*runtime.StorageWrite{
+		{
+			Collection:      simulationCollection,
+			Key:             report.ID,
+			Value:           string(value),
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		logger.Error("Failed to store simulation report %s: %v", report.ID, err)
+	}
+
+	logger.Info("Simulation %s finished: %d/%d completed, %d create errors, %d record errors, %.2f matches/s",
+		report.ID, report.Completed, report.Requested, report.CreateErrors, report.RecordErrors, report.Throughput)
+}
+
+// recordSimulatedMatch is called by the match handler when a simulated game ends
+func recordSimulatedMatch(simulationID string, failures int) {
+	simulationMutex.Lock()
+	defer simulationMutex.Unlock()
+
+	run, ok := simulations[simulationID]
+	if !ok {
+		return
+	}
+	run.report.Completed++
+	run.report.RecordErrors += failures
+}
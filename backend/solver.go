@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+const (
+	// Boards with at most this many empty cells are solved exactly
+	exactSearchLimit = 9
+	// Search depth for heuristic analysis of larger boards
+	heuristicDepth = 3
+	// Positions one analysis may visit, shared evenly between the candidate
+	// moves. Past its share a move's subtree is scored by the heuristic, so a
+	// search costs tens of milliseconds on any board size.
+	searchNodeLimit = 200000
+
+	minAnalysisSize = 3
+	maxAnalysisSize = 7
+
+	// Shortest line that can win; anything less is trivial
+	minWinLength = 3
+
+	winScore = 1000
+)
+
+// AnalyzePositionRequest represents analyze_position request
+type AnalyzePositionRequest struct {
+	Board     [][]string `json:"board"`
+	Turn      string     `json:"turn"`
+	WinLength int        `json:"win_length,omitempty"` // defaults to a full line
+}
+
+// PositionAnalysis represents the solver's verdict for a position
+type PositionAnalysis struct {
+	BestMoves  []MoveData `json:"best_moves"`
+	Evaluation float64    `json:"evaluation"` // -1 (losing) .. 1 (winning) for the side to move
+	Exact      bool       `json:"exact"`
+	Winner     string     `json:"winner,omitempty"`
+}
+
+// InitSolver initializes position analysis
+func InitSolver(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("analyze_position", withRateLimit(analysisLimiter, analyzePositionRPC)); err != nil {
+		return fmt.Errorf("failed to register analyze_position RPC: %w", err)
+	}
+
+	logger.Info("Position solver initialized")
+	return nil
+}
+
+// analyzePositionRPC returns the best moves and evaluation for a board state
+func analyzePositionRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var request AnalyzePositionRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+
+	if err := validateBoard(request.Board); err != nil {
+		return "", rpcError(CodeInvalidArgument, err.Error())
+	}
+	if request.Turn != PlayerX && request.Turn != PlayerO {
+		return "", rpcError(CodeInvalidArgument, "turn must be X or O")
+	}
+
+	if request.WinLength != 0 && (request.WinLength < minWinLength || request.WinLength > len(request.Board)) {
+		return "", rpcErrorf(CodeInvalidArgument, "win_length must be between %d and %d", minWinLength, len(request.Board))
+	}
+
+	// Hints are off in ranked play, so the solver is too for anyone in a ranked game
+	if userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userID != "" {
+		matchID, label, err := activeMatchLabel(ctx, nk, userID)
+		if err != nil {
+			return "", rpcErrorf(CodeUnavailable, "failed to check for an active match: %v", err)
+		}
+		if label != nil && label.Ranked {
+			return "", rpcErrorReason(CodeFailedPrecondition, ReasonInMatch, "analysis is unavailable during a ranked match", map[string]interface{}{
+				"match_id": matchID,
+			})
+		}
+	}
+
+	board := rules.FromRows(request.Board)
+	board.WinLength = request.WinLength
+	return rpcOK(analyzePosition(board, request.Turn))
+}
+
+// validateBoard checks that a client-supplied board is square and holds only known symbols
+func validateBoard(board [][]string) error {
+	size := len(board)
+	if size < minAnalysisSize || size > maxAnalysisSize {
+		return fmt.Errorf("board size must be between %d and %d", minAnalysisSize, maxAnalysisSize)
+	}
+	for _, row := range board {
+		if len(row) != size {
+			return fmt.Errorf("board must be square")
+		}
+		for _, cell := range row {
+			if cell != Empty && cell != PlayerX && cell != PlayerO {
+				return fmt.Errorf("invalid cell value %q", cell)
+			}
+		}
+	}
+	return nil
+}
+
+// analyzePosition searches the position for the side to move
+func analyzePosition(board rules.Board, turn string) PositionAnalysis {
+	analysis := PositionAnalysis{BestMoves: []MoveData{}}
+
+	if winner := rules.Winner(board); winner != "" {
+		analysis.Winner = winner
+		analysis.Exact = true
+		if winner == turn {
+			analysis.Evaluation = 1
+		} else {
+			analysis.Evaluation = -1
+		}
+		return analysis
+	}
+
+	moves := emptyCells(board)
+	if len(moves) == 0 {
+		analysis.Exact = true
+		return analysis
+	}
+
+	// Work on a copy so the caller's board is never mutated
+	search := newSearch(rules.Copy(board))
+
+	depth := heuristicDepth
+	analysis.Exact = len(moves) <= exactSearchLimit
+	if analysis.Exact {
+		depth = len(moves)
+	}
+
+	best := math.MinInt32
+	piece := symbolCell(turn)
+	for _, move := range moves {
+		search.nodes = searchNodeLimit / len(moves)
+		cell := move.Row*board.Size + move.Col
+		search.board.Cells[cell] = piece
+		score := 0
+		if search.wins(cell, piece) {
+			score = winScore - 1
+		} else {
+			score = -search.negamax(opponentCell(piece), depth-1, 1, math.MinInt32+1, math.MaxInt32)
+		}
+		search.board.Cells[cell] = rules.CellEmpty
+
+		if score > best {
+			best = score
+			analysis.BestMoves = []MoveData{move}
+		} else if score == best {
+			analysis.BestMoves = append(analysis.BestMoves, move)
+		}
+	}
+
+	// A search cut short by its node budget is only a heuristic
+	analysis.Exact = analysis.Exact && !search.truncated
+	analysis.Evaluation = normalizeScore(best)
+	return analysis
+}
+
+// search is one position analysis: the board being searched, the winning
+// lines of its shape, and the nodes left in the current move's budget
+type search struct {
+	board     rules.Board
+	lines     *boardLineSet
+	nodes     int
+	truncated bool // the budget ran out somewhere, so the result isn't exact
+}
+
+// newSearch prepares to search a board
+func newSearch(board rules.Board) *search {
+	return &search{board: board, lines: linesFor(board.Size, board.LineLength())}
+}
+
+// negamax scores the board for turn, the side to move, using alpha-beta
+// pruning. The previous move didn't win; that is checked before recursing.
+func (s *search) negamax(turn byte, depth, ply, alpha, beta int) int {
+	if depth <= 0 {
+		return s.lines.evaluate(s.board.Cells, turn)
+	}
+	if s.nodes <= 0 {
+		s.truncated = true
+		return s.lines.evaluate(s.board.Cells, turn)
+	}
+	s.nodes--
+
+	best := math.MinInt32
+	played := false
+	cells := s.board.Cells
+	for cell := range cells {
+		if cells[cell] != rules.CellEmpty {
+			continue
+		}
+		played = true
+
+		cells[cell] = turn
+		score := 0
+		if s.wins(cell, turn) {
+			// Prefer faster wins and slower losses
+			score = winScore - (ply + 1)
+		} else {
+			score = -s.negamax(opponentCell(turn), depth-1, ply+1, -beta, -alpha)
+		}
+		cells[cell] = rules.CellEmpty
+
+		if score > best {
+			best = score
+		}
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	if !played {
+		return 0
+	}
+	return best
+}
+
+// wins reports whether the piece just placed on cell completes a line
+func (s *search) wins(cell int, piece byte) bool {
+	cells := s.board.Cells
+	for _, line := range s.lines.through[cell] {
+		won := true
+		for _, other := range s.lines.lines[line] {
+			if cells[other] != piece {
+				won = false
+				break
+			}
+		}
+		if won {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateBoard is a heuristic that rewards lines only one player can still complete
+func evaluateBoard(board rules.Board, turn string) int {
+	return linesFor(board.Size, board.LineLength()).evaluate(board.Cells, symbolCell(turn))
+}
+
+// evaluate scores cells for turn by the lines only one player can still complete
+func (set *boardLineSet) evaluate(cells []byte, turn byte) int {
+	score := 0
+	for _, line := range set.lines {
+		mine, theirs := 0, 0
+		for _, cell := range line {
+			switch cells[cell] {
+			case rules.CellEmpty:
+			case turn:
+				mine++
+			default:
+				theirs++
+			}
+		}
+		if theirs == 0 && mine > 0 {
+			score += mine * mine
+		} else if mine == 0 && theirs > 0 {
+			score -= theirs * theirs
+		}
+	}
+	return score
+}
+
+// normalizeScore maps a search score into the -1..1 evaluation range
+func normalizeScore(score int) float64 {
+	if score >= winScore-maxAnalysisSize*maxAnalysisSize {
+		return 1
+	}
+	if score <= -(winScore - maxAnalysisSize*maxAnalysisSize) {
+		return -1
+	}
+	return math.Tanh(float64(score) / 10)
+}
+
+// boardLineSet represents every run of k cells that can win on a square
+// board, as cell indices, with the lines through each cell
+type boardLineSet struct {
+	lines   [][]int
+	through [][]int // cell -> indices into lines
+}
+
+// boardLineSets caches the lines of each board shape by [size, k]; they are
+// built once and only read afterwards
+var boardLineSets sync.Map
+
+// linesFor returns the winning lines of a size x size board won by k in a row
+func linesFor(size, k int) *boardLineSet {
+	key := [2]int{size, k}
+	if set, ok := boardLineSets.Load(key); ok {
+		return set.(*boardLineSet)
+	}
+	set, _ := boardLineSets.LoadOrStore(key, boardLines(size, k))
+	return set.(*boardLineSet)
+}
+
+// boardLines builds every run of k cells that can win on a square board:
+// horizontal, vertical, and both diagonals
+func boardLines(size, k int) *boardLineSet {
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	set := &boardLineSet{
+		lines:   make([][]int, 0, 4*size*size),
+		through: make([][]int, size*size),
+	}
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			for _, d := range directions {
+				endRow, endCol := row+d[0]*(k-1), col+d[1]*(k-1)
+				if endRow >= size || endCol < 0 || endCol >= size {
+					continue
+				}
+				line := make([]int, k)
+				for i := range line {
+					line[i] = (row+d[0]*i)*size + col + d[1]*i
+					set.through[line[i]] = append(set.through[line[i]], len(set.lines))
+				}
+				set.lines = append(set.lines, line)
+			}
+		}
+	}
+	return set
+}
+
+// emptyCells lists the empty cells of a board in row-major order
+func emptyCells(board rules.Board) []MoveData {
+	moves := make([]MoveData, 0, len(board.Cells))
+	for i, cell := range board.Cells {
+		if cell == rules.CellEmpty {
+			moves = append(moves, MoveData{Row: i / board.Size, Col: i % board.Size})
+		}
+	}
+	return moves
+}
+
+// opponentOf returns the other player's symbol
+func opponentOf(symbol string) string {
+	return rules.Opponent(symbol)
+}
+
+// symbolCell returns the cell byte of a player's symbol
+func symbolCell(symbol string) byte {
+	if symbol == PlayerO {
+		return rules.CellO
+	}
+	return rules.CellX
+}
+
+// opponentCell returns the other player's cell byte
+func opponentCell(cell byte) byte {
+	if cell == rules.CellX {
+		return rules.CellO
+	}
+	return rules.CellX
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"tictac.com/tic/internal/rules"
+)
+
+// openingBoard returns a size x size board won by k in a row, with X in the
+// centre and O beside it
+func openingBoard(size, k int) rules.Board {
+	board := rules.NewBoardK(size, k)
+	board.Set(size/2, size/2, PlayerX)
+	board.Set(size/2, size/2+1, PlayerO)
+	return board
+}
+
+func TestAnalyzePositionSolvesEmptyClassicBoardAsADraw(t *testing.T) {
+	analysis := analyzePosition(rules.NewBoard(3), PlayerX)
+	if !analysis.Exact || analysis.Evaluation != 0 || len(analysis.BestMoves) != 9 {
+		t.Errorf("got exact %v, evaluation %v, %d best moves; want an exact draw with every move best",
+			analysis.Exact, analysis.Evaluation, len(analysis.BestMoves))
+	}
+}
+
+func TestAnalyzePositionTakesTheWinOnLargeBoards(t *testing.T) {
+	board := openingBoard(7, 4)
+	board.Set(0, 0, PlayerX)
+	board.Set(0, 1, PlayerX)
+	board.Set(0, 2, PlayerX)
+	board.Set(6, 6, PlayerO)
+	board.Set(5, 6, PlayerO)
+
+	analysis := analyzePosition(board, PlayerX)
+	if len(analysis.BestMoves) != 1 || analysis.BestMoves[0] != (MoveData{Row: 0, Col: 3}) || analysis.Evaluation != 1 {
+		t.Errorf("got best moves %v, evaluation %v; want the winning (0,3)", analysis.BestMoves, analysis.Evaluation)
+	}
+}
+
+func TestAnalyzePositionBlocksTheOpponentsWin(t *testing.T) {
+	board := rules.NewBoardK(5, 4)
+	board.Set(4, 0, PlayerO)
+	board.Set(4, 1, PlayerO)
+	board.Set(4, 2, PlayerO)
+	board.Set(0, 0, PlayerX)
+	board.Set(1, 1, PlayerX)
+	board.Set(0, 4, PlayerX)
+
+	analysis := analyzePosition(board, PlayerX)
+	if len(analysis.BestMoves) != 1 || analysis.BestMoves[0] != (MoveData{Row: 4, Col: 3}) {
+		t.Errorf("got best moves %v, want the block at (4,3)", analysis.BestMoves)
+	}
+}
+
+func TestAnalyzePositionStaysWithinItsNodeBudget(t *testing.T) {
+	// An exact search of this many empty cells would never finish; the budget
+	// cuts it short and says so
+	board := openingBoard(7, 7)
+	search := newSearch(board)
+	search.nodes = searchNodeLimit
+	search.negamax(rules.CellX, 47, 1, -winScore*2, winScore*2)
+	if !search.truncated || search.nodes != 0 {
+		t.Errorf("got truncated %v with %d nodes left, want the budget spent", search.truncated, search.nodes)
+	}
+}
+
+func BenchmarkAnalyzePosition(b *testing.B) {
+	for _, tc := range []struct{ size, k int }{{3, 3}, {5, 4}, {7, 3}, {7, 5}} {
+		b.Run(fmt.Sprintf("%dx%d_k%d", tc.size, tc.size, tc.k), func(b *testing.B) {
+			board := openingBoard(tc.size, tc.k)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				analyzePosition(board, PlayerX)
+			}
+		})
+	}
+}
+
+func TestAnalyzePositionIsUnavailableDuringRankedMatches(t *testing.T) {
+	nk := newMemoryNakama()
+	ctx := sessionContext("user-1", "ada")
+	recordSeat(discardLogger{}, nk, "ranked-match", "user-1")
+	payload := `{"board": [["X", "", ""], ["", "O", ""], ["", "", ""]], "turn": "X"}`
+
+	nk.labels["ranked-match"] = `{"state": "playing", "ranked": true}`
+	_, err := analyzePositionRPC(ctx, discardLogger{}, nil, nk, payload)
+	var rpcErr *runtime.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeFailedPrecondition {
+		t.Errorf("got %v during a ranked match, want a failed precondition", err)
+	}
+
+	nk.labels["ranked-match"] = `{"state": "playing", "ranked": false}`
+	if _, err := analyzePositionRPC(ctx, discardLogger{}, nil, nk, payload); err != nil {
+		t.Errorf("got %v during a casual match, want an analysis", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Per-user statistics
+	userStatsCollection = "user_stats"
+	userStatsKey        = "stats"
+
+	// Current user_stats schema. Version 0 objects predate the field and were
+	// written as loosely typed maps; version 1 objects predate placements and
+	// count every ranked game as rated. Both are migrated when read.
+	userStatsSchemaVersion = 2
+)
+
+// UserStats represents the stored user_stats object
+type UserStats struct {
+	SchemaVersion int    `json:"schema_version"`
+	Username      string `json:"username,omitempty"`
+	CreatedAt     int64  `json:"created_at,omitempty"`
+	Rating        int64  `json:"rating"`
+	TotalScore    int64  `json:"total_score"` // score from before Elo ratings
+
+	// Ranked games
+	GamesPlayed int `json:"games_played"`
+	GamesWon    int `json:"games_won"`
+	GamesLost   int `json:"games_lost"`
+	GamesDrawn  int `json:"games_drawn"`
+
+	// Ranked games that moved the rating; the first few are placements
+	RatedGamesPlayed int `json:"rated_games_played"`
+
+	// Casual games never affect the rating
+	CasualGamesPlayed int `json:"casual_games_played"`
+	CasualGamesWon    int `json:"casual_games_won"`
+	CasualGamesLost   int `json:"casual_games_lost"`
+	CasualGamesDrawn  int `json:"casual_games_drawn"`
+
+	// Consecutive ranked results; a draw ends both streaks
+	WinStreak        int `json:"win_streak"`
+	LossStreak       int `json:"loss_streak"`
+	LongestWinStreak int `json:"longest_win_streak"`
+}
+
+// newUserStats returns the stats of a player who hasn't played yet
+func newUserStats() *UserStats {
+	return &UserStats{SchemaVersion: userStatsSchemaVersion, Rating: defaultRating}
+}
+
+// decodeUserStats parses a stored user_stats object, migrating older schemas
+func decodeUserStats(value string) (*UserStats, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal([]byte(value), &header); err != nil {
+		return nil, fmt.Errorf("failed to parse user stats: %w", err)
+	}
+	if header.SchemaVersion == 0 {
+		return decodeUserStatsV0(value)
+	}
+
+	stats := newUserStats()
+	if err := json.Unmarshal([]byte(value), stats); err != nil {
+		return nil, fmt.Errorf("failed to parse user stats: %w", err)
+	}
+	if header.SchemaVersion == 1 {
+		stats.RatedGamesPlayed = stats.GamesPlayed
+	}
+	return stats, nil
+}
+
+// decodeUserStatsV0 parses a version 0 object, a loosely typed map whose
+// counters are JSON numbers of any form and whose fields may be missing.
+// Players without a rating rate as new.
+func decodeUserStatsV0(value string) (*UserStats, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse user stats: %w", err)
+	}
+	number := func(key string) int {
+		n, _ := fields[key].(float64)
+		return int(n)
+	}
+
+	stats := newUserStats()
+	stats.Username, _ = fields["username"].(string)
+	stats.CreatedAt = int64(number("created_at"))
+	if _, ok := fields["rating"].(float64); ok {
+		stats.Rating = int64(number("rating"))
+	}
+	stats.TotalScore = int64(number("total_score"))
+	stats.GamesPlayed = number("games_played")
+	stats.GamesWon = number("games_won")
+	stats.GamesLost = number("games_lost")
+	stats.GamesDrawn = number("games_drawn")
+	stats.RatedGamesPlayed = stats.GamesPlayed
+	stats.CasualGamesPlayed = number("casual_games_played")
+	stats.CasualGamesWon = number("casual_games_won")
+	stats.CasualGamesLost = number("casual_games_lost")
+	stats.CasualGamesDrawn = number("casual_games_drawn")
+	stats.WinStreak = number("win_streak")
+	stats.LossStreak = number("loss_streak")
+	stats.LongestWinStreak = number("longest_win_streak")
+	return stats, nil
+}
+
+// loadUserStats reads the stats of several players in one storage call, with
+// each object's version for a conditional write back. Players without stored
+// stats, or whose stats can't be parsed, get new stats.
+func loadUserStats(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]*UserStats, map[string]string, error) {
+	stats := make(map[string]*UserStats, len(userIDs))
+	versions := make(map[string]string, len(userIDs))
+	reads := make([]*runtime.StorageRead, 0, len(userIDs))
+	for _, userID := range userIDs {
+		stats[userID] = newUserStats()
+		versions[userID] = "*"
+		reads = append(reads, &runtime.StorageRead{Collection: userStatsCollection, Key: userStatsKey, UserID: userID})
+	}
+	if len(reads) == 0 {
+		return stats, versions, nil
+	}
+
+	objects, err := storageRead(ctx, nk, reads)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read user stats: %w", err)
+	}
+	for _, object := range objects {
+		versions[object.UserId] = object.Version
+		if decoded, err := decodeUserStats(object.Value); err == nil {
+			stats[object.UserId] = decoded
+		}
+	}
+	return stats, versions, nil
+}
+
+// writeUserStats stores a player's stats if they are unchanged since read at version
+func writeUserStats(ctx context.Context, nk runtime.NakamaModule, userID string, stats *UserStats, version string) error {
+	stats.SchemaVersion = userStatsSchemaVersion
+	value, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection: userStatsCollection,
+			Key:        userStatsKey,
+			UserID:     userID,
+			Value:      string(value),
+			Version:    version,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to update user stats: %w", err)
+	}
+	return nil
+}
+
+// apply adds a game to the counters. Ranked games also advance the streaks and
+// move rated players' ratings.
+func (s *UserStats) apply(result GameResult) {
+	if !result.Ranked {
+		s.CasualGamesPlayed++
+		switch {
+		case result.Won:
+			s.CasualGamesWon++
+		case result.Lost:
+			s.CasualGamesLost++
+		case result.Drawn:
+			s.CasualGamesDrawn++
+		}
+		return
+	}
+
+	s.GamesPlayed++
+	switch {
+	case result.Won:
+		s.GamesWon++
+	case result.Lost:
+		s.GamesLost++
+	case result.Drawn:
+		s.GamesDrawn++
+	}
+	s.updateStreaks(result.Won, result.Lost)
+	if result.Rated {
+		s.RatedGamesPlayed++
+		s.Rating += result.RatingDelta
+	}
+}
+
+// provisional reports whether the player is still playing their placement games
+func (s *UserStats) provisional() bool {
+	return s.RatedGamesPlayed < config.PlacementGames
+}
+
+// placementGamesPlayed returns how many of their placement games the player has played
+func (s *UserStats) placementGamesPlayed() int {
+	return min(s.RatedGamesPlayed, config.PlacementGames)
+}
+
+// playerStats converts stored stats into the get_player_stats view
+func (s *UserStats) playerStats(userID string) *PlayerStats {
+	return &PlayerStats{
+		UserID:           userID,
+		Username:         s.Username,
+		Score:            s.Rating,
+		GamesWon:         s.GamesWon,
+		GamesLost:        s.GamesLost,
+		GamesDrawn:       s.GamesDrawn,
+		GamesPlayed:      s.GamesPlayed,
+		CreatedAt:        s.CreatedAt,
+		WinStreak:        s.WinStreak,
+		LossStreak:       s.LossStreak,
+		LongestWinStreak: s.LongestWinStreak,
+
+		Provisional:          s.provisional(),
+		PlacementGamesPlayed: s.placementGamesPlayed(),
+		PlacementGames:       config.PlacementGames,
+	}
+}
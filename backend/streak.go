@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Ranked wins in a row before streak bonuses start
+	streakBonusThreshold = 2
+	// Bonus leaderboard points for each win past the threshold
+	streakBonusPoints = 2
+)
+
+// streakBonus returns the bonus points for a win that extends a streak to winStreak wins
+func streakBonus(winStreak int) int64 {
+	if winStreak <= streakBonusThreshold {
+		return 0
+	}
+	return streakBonusPoints
+}
+
+// loadWinStreaks returns each user's current ranked win streak, reading all stats in one call
+func loadWinStreaks(ctx context.Context, nk runtime.NakamaModule, userIDs []string) (map[string]int, error) {
+	people := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if !isBotAccount(userID) {
+			people = append(people, userID)
+		}
+	}
+
+	stats, _, err := loadUserStats(ctx, nk, people)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read win streaks: %w", err)
+	}
+	streaks := make(map[string]int, len(stats))
+	for userID, userStats := range stats {
+		streaks[userID] = userStats.WinStreak
+	}
+	return streaks, nil
+}
+
+// updateStreaks advances the ranked win and loss streaks for a result. Draws end both.
+func (s *UserStats) updateStreaks(won, lost bool) {
+	switch {
+	case won:
+		s.WinStreak, s.LossStreak = s.WinStreak+1, 0
+	case lost:
+		s.WinStreak, s.LossStreak = 0, s.LossStreak+1
+	default:
+		s.WinStreak, s.LossStreak = 0, 0
+	}
+	if s.WinStreak > s.LongestWinStreak {
+		s.LongestWinStreak = s.WinStreak
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Telemetry event types
+const (
+	TelemetryMatchCreated  = "match_created"
+	TelemetryPlayerJoined  = "player_joined"
+	TelemetryMoveMade      = "move_made"
+	TelemetryMatchFinished = "match_finished"
+)
+
+// Telemetry sinks, chosen with TELEMETRY_SINK
+const (
+	TelemetrySinkStorage = "storage" // one object per batch in the telemetry collection
+	TelemetrySinkWebhook = "webhook" // batches POSTed as JSON to TELEMETRY_WEBHOOK_URL
+	TelemetrySinkNakama  = "nakama"  // Nakama events, for the server's registered event handlers
+)
+
+const (
+	// Batches written by the storage sink (system-owned). Keys start with the
+	// time of the flush, so listing the collection returns them oldest first.
+	telemetryCollection = "telemetry"
+
+	// Events waiting to be flushed; once full, new events are dropped so
+	// matches never wait on the sink
+	telemetryBufferSize = 4096
+	// Events are flushed once this many are waiting, or after the interval
+	telemetryBatchSize     = 200
+	telemetryFlushInterval = 10 * time.Second
+)
+
+// TelemetryEvent represents one analytics event about a match
+type TelemetryEvent struct {
+	Type       string                 `json:"type"`
+	MatchID    string                 `json:"match_id"`
+	Mode       string                 `json:"mode"`
+	UserID     string                 `json:"user_id,omitempty"`
+	Timestamp  int64                  `json:"timestamp"` // unix milliseconds
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// telemetryBatch represents the JSON body the storage and webhook sinks write
+type telemetryBatch struct {
+	Events []TelemetryEvent `json:"events"`
+}
+
+// telemetrySink is implemented by the destinations events can be flushed to
+type telemetrySink interface {
+	send(ctx context.Context, events []TelemetryEvent) error
+}
+
+// telemetryEvents buffers events for the flusher; nil while telemetry is off
+var telemetryEvents chan TelemetryEvent
+
+// InitTelemetry starts flushing match telemetry to the configured sink
+func InitTelemetry(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	sink := newTelemetrySink(nk, config.TelemetrySink, config.TelemetryWebhookURL)
+	if sink == nil {
+		logger.Info("Telemetry disabled")
+		return nil
+	}
+
+	telemetryEvents = make(chan TelemetryEvent, telemetryBufferSize)
+	go runTelemetryFlusher(logger, nk, sink)
+
+	logger.Info("Telemetry initialized with %s sink", config.TelemetrySink)
+	return nil
+}
+
+// validateTelemetryConfig checks the sink is known and the webhook sink has a URL
+func validateTelemetryConfig(cfg Config) error {
+	switch cfg.TelemetrySink {
+	case "", TelemetrySinkStorage, TelemetrySinkNakama:
+	case TelemetrySinkWebhook:
+		if !validWebhookURL(cfg.TelemetryWebhookURL) {
+			return fmt.Errorf("TELEMETRY_WEBHOOK_URL must be an http(s) URL for the webhook sink")
+		}
+	default:
+		return fmt.Errorf("invalid TELEMETRY_SINK %q: must be %s, %s, or %s", cfg.TelemetrySink, TelemetrySinkStorage, TelemetrySinkWebhook, TelemetrySinkNakama)
+	}
+	return nil
+}
+
+// newTelemetrySink returns the sink with the given name, or nil for none
+func newTelemetrySink(nk runtime.NakamaModule, name, webhookURL string) telemetrySink {
+	switch name {
+	case TelemetrySinkStorage:
+		return &storageTelemetrySink{nk: nk}
+	case TelemetrySinkWebhook:
+		return &webhookTelemetrySink{nk: nk, url: webhookURL, client: &http.Client{Timeout: backendCallTimeout}}
+	case TelemetrySinkNakama:
+		return &nakamaTelemetrySink{nk: nk}
+	default:
+		return nil
+	}
+}
+
+// emitTelemetry queues an event about a match without blocking. Simulated
+// matches aren't real play, so they emit nothing.
+func emitTelemetry(match *TTTMatch, eventType, userID string, properties map[string]interface{}) {
+	if telemetryEvents == nil || match.SimulationID != "" {
+		return
+	}
+	event := TelemetryEvent{
+		Type:       eventType,
+		MatchID:    match.ID,
+		Mode:       match.Mode,
+		UserID:     userID,
+		Timestamp:  time.Now().UnixMilli(),
+		Properties: properties,
+	}
+	select {
+	case telemetryEvents <- event:
+	default:
+		telemetryDropped.Add(1)
+	}
+}
+
+// telemetryDropped counts events dropped since the last flush because the buffer was full
+var telemetryDropped atomic.Int64
+
+// runTelemetryFlusher sends buffered events to the sink in batches. A batch the
+// sink fails to take is logged and dropped; telemetry is best effort.
+func runTelemetryFlusher(logger runtime.Logger, nk runtime.NakamaModule, sink telemetrySink) {
+	ticker := time.NewTicker(telemetryFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]TelemetryEvent, 0, telemetryBatchSize)
+	flush := func() {
+		if dropped := telemetryDropped.Swap(0); dropped > 0 {
+			logger.Warn("Dropped %d telemetry events while the buffer was full", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		recoverInto(logger, nk, "telemetry_flush", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			defer cancel()
+			if err := sink.send(ctx, batch); err != nil {
+				logger.Error("Failed to flush %d telemetry events: %v", len(batch), err)
+			}
+		})
+		batch = make([]TelemetryEvent, 0, telemetryBatchSize)
+	}
+
+	for {
+		select {
+		case event := <-telemetryEvents:
+			batch = append(batch, event)
+			if len(batch) >= telemetryBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// storageTelemetrySink writes each batch as one storage object
+type storageTelemetrySink struct {
+	nk runtime.NakamaModule
+}
+
+func (s *storageTelemetrySink) send(ctx context.Context, events []TelemetryEvent) error {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	value, err := json.Marshal(telemetryBatch{Events: events})
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry batch: %w", err)
+	}
+
+	// Version "*" never overwrites an earlier batch
+	if _, err := storageWrite(ctx, s.nk, []*runtime.StorageWrite{
+		{
+			Collection:      telemetryCollection,
+			Key:             fmt.Sprintf("%019d_%s", time.Now().UnixNano(), hex.EncodeToString(suffix)),
+			Value:           string(value),
+			Version:         "*",
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to write telemetry batch: %w", err)
+	}
+	return nil
+}
+
+// webhookTelemetrySink POSTs each batch as JSON to an analytics endpoint
+type webhookTelemetrySink struct {
+	nk     runtime.NakamaModule
+	url    string
+	client *http.Client
+}
+
+func (s *webhookTelemetrySink) send(ctx context.Context, events []TelemetryEvent) error {
+	body, err := json.Marshal(telemetryBatch{Events: events})
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry batch: %w", err)
+	}
+
+	return withRetry(ctx, s.nk, "telemetry_webhook", func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := s.client.Do(request)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("telemetry webhook returned %s", response.Status)
+		}
+		return nil
+	})
+}
+
+// nakamaTelemetrySink hands each event to Nakama's event pipeline, where the
+// server's registered event handlers (and any analytics they forward to) see it
+type nakamaTelemetrySink struct {
+	nk runtime.NakamaModule
+}
+
+func (s *nakamaTelemetrySink) send(ctx context.Context, events []TelemetryEvent) error {
+	for _, event := range events {
+		// Nakama event properties are strings, so other values go as JSON
+		properties := map[string]string{"match_id": event.MatchID, "mode": event.Mode}
+		if event.UserID != "" {
+			properties["user_id"] = event.UserID
+		}
+		for key, value := range event.Properties {
+			if text, ok := value.(string); ok {
+				properties[key] = text
+				continue
+			}
+			encoded, _ := json.Marshal(value)
+			properties[key] = string(encoded)
+		}
+
+		if err := s.nk.Event(ctx, &api.Event{
+			Name:       event.Type,
+			Properties: properties,
+			Timestamp:  timestamppb.New(time.UnixMilli(event.Timestamp)),
+		}); err != nil {
+			return fmt.Errorf("failed to send %s event: %w", event.Type, err)
+		}
+	}
+	return nil
+}
+
+// telemetryMatchCreated emits match_created. Like the matches_created metric,
+// it skips matches restored after a restart.
+func telemetryMatchCreated(match *TTTMatch) {
+	if match.RestoredFrom != "" {
+		return
+	}
+	emitTelemetry(match, TelemetryMatchCreated, "", map[string]interface{}{
+		"ranked":     match.Ranked,
+		"size":       match.Size,
+		"win_length": match.WinLength,
+		"best_of":    match.BestOf,
+		"private":    match.PrivateCode != "",
+	})
+}
+
+// telemetryPlayerJoined emits player_joined when a player takes or retakes their seat
+func telemetryPlayerJoined(match *TTTMatch, userID string, rejoin bool) {
+	emitTelemetry(match, TelemetryPlayerJoined, userID, map[string]interface{}{
+		"symbol":   match.Players[userID],
+		"rejoin":   rejoin,
+		"protocol": clientProtocol(match, userID).Version,
+	})
+}
+
+// telemetryMoveMade emits move_made for a move just played
+func telemetryMoveMade(match *TTTMatch, move MoveRecord) {
+	emitTelemetry(match, TelemetryMoveMade, move.Player, map[string]interface{}{
+		"number": move.Number,
+		"symbol": move.Symbol,
+		"row":    move.Row,
+		"col":    move.Col,
+		"round":  match.Round,
+	})
+}
+
+// telemetryMatchFinished emits match_finished with the duration of the game
+// that decided the match and each player's result
+func telemetryMatchFinished(match *TTTMatch) {
+	summary := gameOverData(match, nil)
+	results := make(map[string]string, len(match.Players))
+	for userID, symbol := range match.Players {
+		results[userID] = resultFor(match, symbol)
+	}
+	emitTelemetry(match, TelemetryMatchFinished, "", map[string]interface{}{
+		"winner_id":   summary.WinnerID,
+		"reason":      summary.Reason,
+		"results":     results,
+		"moves":       match.MoveCount,
+		"duration_ms": time.Since(time.Unix(match.CreatedAt, 0)).Milliseconds(),
+		"ranked":      match.Ranked,
+		"round":       match.Round,
+	})
+}
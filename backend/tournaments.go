@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const (
+	// Tournament points per ranked game between two enrolled players
+	tournamentWinPoints  = 3
+	tournamentDrawPoints = 1
+
+	// Scores a player may post per tournament period
+	tournamentMaxScores = 1000000
+)
+
+// TournamentDefinition represents a recurring tournament
+type TournamentDefinition struct {
+	ID            string
+	Title         string
+	Description   string
+	Category      int
+	Mode          string // only ranked games of this mode count; empty for any mode
+	ResetSchedule string // cron expression for when each period starts
+	Duration      int    // seconds each period stays open
+}
+
+// TournamentInfo represents a tournament in list_tournaments
+type TournamentInfo struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Mode        string `json:"mode,omitempty"`
+	Size        uint32 `json:"size"`
+	CanEnter    bool   `json:"can_enter"`
+	Joined      bool   `json:"joined"`
+	StartActive uint32 `json:"start_active"` // when the current period opened
+	EndActive   uint32 `json:"end_active"`   // when the current period closes
+	NextReset   uint32 `json:"next_reset"`
+}
+
+// TournamentRequest represents join_tournament and get_tournament_records requests
+type TournamentRequest struct {
+	TournamentID string `json:"tournament_id"`
+	Limit        int    `json:"limit,omitempty"`
+	Cursor       string `json:"cursor,omitempty"`
+}
+
+// tournaments are created at startup if they don't exist yet
+var tournaments = []TournamentDefinition{
+	{
+		ID:            "ttt_daily_blitz",
+		Title:         "Daily Blitz",
+		Description:   "Classic games all day; most points by midnight UTC wins",
+		Category:      1,
+		Mode:          GameModeClassic,
+		ResetSchedule: "0 0 * * *",
+		Duration:      24 * 60 * 60,
+	},
+	{
+		ID:            "ttt_weekly_championship",
+		Title:         "Weekly Championship",
+		Description:   "Ranked games in any mode from Monday to Sunday",
+		Category:      2,
+		ResetSchedule: "0 0 * * 1",
+		Duration:      7 * 24 * 60 * 60,
+	},
+}
+
+// InitTournaments creates the recurring tournaments and registers their RPCs
+func InitTournaments(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("list_tournaments", listTournamentsRPC); err != nil {
+		return fmt.Errorf("failed to register list_tournaments RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("join_tournament", joinTournamentRPC); err != nil {
+		return fmt.Errorf("failed to register join_tournament RPC: %w", err)
+	}
+
+	if err := initializer.RegisterRpc("get_tournament_records", getTournamentRecordsRPC); err != nil {
+		return fmt.Errorf("failed to register get_tournament_records RPC: %w", err)
+	}
+
+	if err := initializer.RegisterTournamentEnd(onTournamentEnd); err != nil {
+		return fmt.Errorf("failed to register tournament end handler: %w", err)
+	}
+
+	if err := createTournaments(ctx, logger, nk); err != nil {
+		return fmt.Errorf("failed to create tournaments: %w", err)
+	}
+
+	logger.Info("Tournaments initialized")
+	return nil
+}
+
+// onTournamentEnd runs when a tournament period closes, announcing its winners
+func onTournamentEnd(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, tournament *api.Tournament, end, reset int64) error {
+	logger.Info("Tournament %s period ended", tournament.GetId())
+	announceTournamentWinner(ctx, logger, nk, tournament, end)
+	return nil
+}
+
+// createTournaments creates any missing recurring tournament
+func createTournaments(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	existing, err := nk.TournamentsGetId(ctx, tournamentIDs())
+	if err != nil {
+		return fmt.Errorf("failed to check tournaments: %w", err)
+	}
+	found := make(map[string]bool, len(existing))
+	for _, tournament := range existing {
+		found[tournament.Id] = true
+	}
+
+	for _, definition := range tournaments {
+		if found[definition.ID] {
+			continue
+		}
+		metadata := map[string]interface{}{"mode": definition.Mode}
+		// Starts now, never ends, unlimited participants, players must join
+		if err := nk.TournamentCreate(ctx, definition.ID, true, "desc", "incr", definition.ResetSchedule, metadata,
+			definition.Title, definition.Description, definition.Category, 0, 0, definition.Duration, 0, tournamentMaxScores, true, true); err != nil {
+			return fmt.Errorf("failed to create tournament %s: %w", definition.ID, err)
+		}
+		logger.Info("Created tournament: %s", definition.ID)
+	}
+	return nil
+}
+
+// listTournamentsRPC returns the recurring tournaments and whether the caller joined them
+func listTournamentsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+
+	existing, err := nk.TournamentsGetId(ctx, tournamentIDs())
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to get tournaments: %v", err)
+	}
+
+	infos := make([]TournamentInfo, 0, len(existing))
+	for _, tournament := range existing {
+		definition, _ := lookupTournament(tournament.Id)
+		info := TournamentInfo{
+			ID:          tournament.Id,
+			Title:       tournament.Title,
+			Description: tournament.Description,
+			Mode:        definition.Mode,
+			Size:        tournament.Size,
+			CanEnter:    tournament.CanEnter,
+			StartActive: tournament.StartActive,
+			EndActive:   tournament.EndActive,
+			NextReset:   tournament.NextReset,
+		}
+		if userID != "" {
+			if joined, err := tournamentEnrolled(ctx, nk, tournament.Id, []string{userID}); err == nil {
+				info.Joined = joined[userID]
+			}
+		}
+		infos = append(infos, info)
+	}
+	return rpcOK(map[string]interface{}{"tournaments": infos})
+}
+
+// joinTournamentRPC enrolls the caller in a tournament's current period
+func joinTournamentRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", rpcError(CodeUnauthenticated, "user not authenticated")
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+
+	var request TournamentRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if _, ok := lookupTournament(request.TournamentID); !ok {
+		return "", rpcErrorf(CodeNotFound, "no tournament %q", request.TournamentID)
+	}
+
+	if err := nk.TournamentJoin(ctx, request.TournamentID, userID, username); err != nil {
+		return "", rpcErrorf(CodeFailedPrecondition, "failed to join tournament: %v", err)
+	}
+
+	logger.Info("User %s joined tournament %s", userID, request.TournamentID)
+	return rpcOK(map[string]interface{}{"tournament_id": request.TournamentID, "joined": true})
+}
+
+// getTournamentRecordsRPC returns a page of a tournament's current standings
+func getTournamentRecordsRPC(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	logger = rpcLogger(ctx, logger)
+
+	var request TournamentRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return "", invalidPayload(err)
+	}
+	if _, ok := lookupTournament(request.TournamentID); !ok {
+		return "", rpcErrorf(CodeNotFound, "no tournament %q", request.TournamentID)
+	}
+	if request.Limit <= 0 || request.Limit > 100 {
+		request.Limit = 10
+	}
+
+	records, _, prev, next, err := nk.TournamentRecordsList(ctx, request.TournamentID, nil, request.Limit, request.Cursor, 0)
+	if err != nil {
+		return "", rpcErrorf(CodeUnavailable, "failed to get tournament records: %v", err)
+	}
+
+	entries := make([]LeaderboardEntry, len(records))
+	for i, record := range records {
+		entries[i] = LeaderboardEntry{
+			UserID:   record.OwnerId,
+			Username: record.Username.GetValue(),
+			Score:    record.Score,
+			Rank:     int(record.Rank),
+		}
+	}
+	return leaderboardResponse(ctx, logger, nk, leaderboardPage{Entries: entries, NextCursor: next, PrevCursor: prev}, false)
+}
+
+// recordTournamentResults credits a ranked game to every open tournament both
+// players joined and whose mode it was played in
+func recordTournamentResults(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch) {
+	userIDs := make([]string, 0, len(match.Players))
+	for userID := range match.Players {
+		if isBotAccount(userID) {
+			return
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if len(userIDs) != 2 {
+		return
+	}
+
+	usernames := make(map[string]string, len(userIDs))
+	if users, err := nk.UsersGetId(ctx, userIDs, nil); err == nil {
+		for _, user := range users {
+			usernames[user.Id] = user.Username
+		}
+	}
+
+	for _, definition := range tournaments {
+		if definition.Mode != "" && definition.Mode != match.Mode {
+			continue
+		}
+		enrolled, err := tournamentEnrolled(ctx, nk, definition.ID, userIDs)
+		if err != nil {
+			logger.Warn("Failed to check enrollment in tournament %s: %v", definition.ID, err)
+			continue
+		}
+		if !enrolled[userIDs[0]] || !enrolled[userIDs[1]] {
+			continue
+		}
+
+		for _, userID := range userIDs {
+			points := int64(0)
+			switch match.Winner {
+			case match.Players[userID]:
+				points = tournamentWinPoints
+			case "":
+				points = tournamentDrawPoints
+			}
+			// Subscore counts games, so ties on points go to whoever played more
+			if _, err := nk.TournamentRecordWrite(ctx, definition.ID, userID, usernames[userID], points, 1, nil, nil); err != nil {
+				logger.Warn("Failed to record tournament %s result for %s: %v", definition.ID, userID, err)
+			}
+		}
+	}
+}
+
+// tournamentEnrolled reports which of the users joined the tournament's current period.
+// Joining creates a record, so enrolled players are the ones with a record.
+func tournamentEnrolled(ctx context.Context, nk runtime.NakamaModule, tournamentID string, userIDs []string) (map[string]bool, error) {
+	_, ownerRecords, _, _, err := nk.TournamentRecordsList(ctx, tournamentID, userIDs, 1, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	enrolled := make(map[string]bool, len(ownerRecords))
+	for _, record := range ownerRecords {
+		enrolled[record.OwnerId] = true
+	}
+	return enrolled, nil
+}
+
+// lookupTournament returns the definition of a recurring tournament
+func lookupTournament(id string) (TournamentDefinition, bool) {
+	for _, definition := range tournaments {
+		if definition.ID == id {
+			return definition, true
+		}
+	}
+	return TournamentDefinition{}, false
+}
+
+// tournamentIDs returns the IDs of every recurring tournament
+func tournamentIDs() []string {
+	ids := make([]string, len(tournaments))
+	for i, definition := range tournaments {
+		ids[i] = definition.ID
+	}
+	return ids
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Moves each player may take back per game with their opponent's consent;
+// matches may set undo_limit, 0 disabling undo
+const defaultUndoLimit = 1
+
+// UndoData represents an undo request relayed to the match
+type UndoData struct {
+	RequestedBy string `json:"requested_by"`
+	Remaining   int    `json:"remaining"` // undos the requester has left after this one
+	Seq         int64  `json:"seq"`
+}
+
+// UndoRequestData represents an undo request or acceptance from a client
+type UndoRequestData struct {
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (u *UndoData) setSeq(seq int64) { u.Seq = seq }
+
+// handleUndo asks the opponent to let the sender take back their last move, or
+// accepts the opponent's pending request. A request lapses once anyone moves.
+func (h *TTTMatchHandler) handleUndo(logger runtime.Logger, dispatcher runtime.MatchDispatcher, match *TTTMatch, message runtime.MatchData) {
+	// The payload is optional and only carries a request ID
+	var request UndoRequestData
+	_ = json.Unmarshal(message.GetData(), &request)
+	requestID := request.RequestID
+
+	if match.State != GameStatePlaying {
+		h.sendError(dispatcher, match, message, requestID, ErrNotPlaying, "Game is not in playing state")
+		return
+	}
+
+	userID := message.GetUserId()
+	if _, exists := match.Players[userID]; !exists {
+		h.sendError(dispatcher, match, message, requestID, ErrNotInMatch, "Player not in match")
+		return
+	}
+
+	if message.GetOpCode() == OpcodeUndoAccept {
+		if match.UndoRequest == "" || match.UndoRequest == userID {
+			h.sendError(dispatcher, match, message, requestID, ErrUndoUnavailable, "No undo request to accept")
+			return
+		}
+		h.undoLastMove(logger, dispatcher, match)
+		return
+	}
+
+	if len(match.Bots) > 0 {
+		h.sendError(dispatcher, match, message, requestID, ErrUndoUnavailable, "Undo is not available against bots")
+		return
+	}
+	if match.UndosUsed[userID] >= match.UndoLimit {
+		h.sendError(dispatcher, match, message, requestID, ErrUndoUnavailable, "No undos remaining")
+		return
+	}
+	if n := len(match.Moves); n == 0 || match.Moves[n-1].Player != userID {
+		h.sendError(dispatcher, match, message, requestID, ErrUndoUnavailable, "Only your own last move can be taken back")
+		return
+	}
+	if match.UndoRequest == userID {
+		h.sendError(dispatcher, match, message, requestID, ErrUndoUnavailable, "Undo already requested")
+		return
+	}
+
+	match.UndoRequest = userID
+	h.send(dispatcher, match, OpcodeUndoRequest, &UndoData{
+		RequestedBy: userID,
+		Remaining:   match.UndoLimit - match.UndosUsed[userID] - 1,
+	}, nil)
+}
+
+// undoLastMove takes back the last move for the player who requested it,
+// giving them the turn again
+func (h *TTTMatchHandler) undoLastMove(logger runtime.Logger, dispatcher runtime.MatchDispatcher, match *TTTMatch) {
+	requester := match.UndoRequest
+	match.UndoRequest = ""
+
+	last := match.Moves[len(match.Moves)-1]
+	match.Board.Set(last.Row, last.Col, "")
+	match.Moves = match.Moves[:len(match.Moves)-1]
+	match.MoveCount--
+	match.Turn = match.Players[requester]
+	match.TurnStartTick = match.Tick
+	match.UndosUsed[requester]++
+
+	logger.WithField("user_id", requester).Info("Took back move %d", last.Number)
+	h.broadcastState(dispatcher, match, nil)
+}
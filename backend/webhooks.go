@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Webhook event types
+const (
+	WebhookMatchCompleted   = "match.completed"
+	WebhookLeaderboardReset = "leaderboard.reset"
+	WebhookPlayerBanned     = "player.banned"
+)
+
+const (
+	// Delivery policy: attempts per endpoint, with the delay doubling from
+	// webhookBaseDelay up to webhookMaxDelay between them
+	webhookAttempts  = 5
+	webhookBaseDelay = 2 * time.Second
+	webhookMaxDelay  = time.Minute
+	webhookTimeout   = 5 * time.Second
+
+	// Deliveries in progress, retries included; events beyond it are dropped
+	// so a dead endpoint can't pile up goroutines
+	webhookMaxInFlight = 64
+
+	// Standings included with a leaderboard reset
+	webhookResetStandings = 10
+
+	metricWebhookFailures = "webhook_failures" // counter, by event; deliveries that gave up
+)
+
+// WebhookPayload represents the signed JSON body POSTed for every event
+type WebhookPayload struct {
+	ID        string      `json:"id"` // stable per event, so receivers can drop duplicates
+	Event     string      `json:"event"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// MatchCompletedWebhook represents the data of a match.completed event
+type MatchCompletedWebhook struct {
+	MatchID  string                  `json:"match_id"`
+	Mode     string                  `json:"mode"`
+	Ranked   bool                    `json:"ranked"`
+	Round    int                     `json:"round"`
+	WinnerID string                  `json:"winner_id,omitempty"`
+	Reason   string                  `json:"reason"`
+	Moves    int                     `json:"moves"`
+	Players  map[string]string       `json:"players"` // userID -> username
+	Results  map[string]PlayerResult `json:"results"` // userID -> that player's outcome
+}
+
+// LeaderboardResetWebhook represents the data of a leaderboard.reset event
+type LeaderboardResetWebhook struct {
+	LeaderboardID string             `json:"leaderboard_id"`
+	ResetAt       int64              `json:"reset_at"`
+	Standings     []LeaderboardEntry `json:"standings"` // final top of the period that ended
+}
+
+// PlayerBannedWebhook represents the data of a player.banned event
+type PlayerBannedWebhook struct {
+	UserID    string `json:"user_id"`
+	Kind      string `json:"kind"` // ban or suspension
+	Reason    string `json:"reason"`
+	BannedAt  int64  `json:"banned_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// webhookSlots limits deliveries in progress to webhookMaxInFlight
+var webhookSlots = make(chan struct{}, webhookMaxInFlight)
+
+// webhookClient sends every webhook request
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// InitWebhooks reports the webhook endpoints events will be delivered to
+func InitWebhooks(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if len(config.WebhookURLs) == 0 {
+		logger.Info("Webhooks disabled")
+		return nil
+	}
+
+	logger.Info("Webhooks initialized with %d endpoints", len(config.WebhookURLs))
+	return nil
+}
+
+// parseWebhookURLs reads the comma-separated WEBHOOK_URLS setting
+func parseWebhookURLs(value string) ([]string, error) {
+	var urls []string
+	for _, raw := range strings.Split(value, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !validWebhookURL(raw) {
+			return nil, fmt.Errorf("invalid WEBHOOK_URLS entry %q: must be an http(s) URL", raw)
+		}
+		urls = append(urls, raw)
+	}
+	return urls, nil
+}
+
+// validWebhookURL reports whether raw is an absolute http(s) URL
+func validWebhookURL(raw string) bool {
+	target, err := url.Parse(raw)
+	return err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != ""
+}
+
+// sendWebhook delivers an event to every configured endpoint in the background
+func sendWebhook(logger runtime.Logger, nk runtime.NakamaModule, event, id string, data interface{}) {
+	if len(config.WebhookURLs) == 0 {
+		return
+	}
+	body, err := json.Marshal(WebhookPayload{ID: id, Event: event, Timestamp: time.Now().Unix(), Data: data})
+	if err != nil {
+		logger.Error("Failed to marshal %s webhook: %v", event, err)
+		return
+	}
+
+	for _, target := range config.WebhookURLs {
+		startWebhookDelivery(logger, nk, target, event, body, func(timestamp int64) map[string]string {
+			return map[string]string{
+				"X-Webhook-Event":     event,
+				"X-Webhook-ID":        id,
+				"X-Webhook-Timestamp": strconv.FormatInt(timestamp, 10),
+				"X-Webhook-Signature": "sha256=" + webhookSignature(config.WebhookSecret, timestamp, body),
+			}
+		})
+	}
+}
+
+// webhookSignature signs a body as HMAC-SHA256 of "<timestamp>.<body>" with the
+// shared secret, so receivers can check both the sender and the body's age
+func webhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// startWebhookDelivery POSTs a body to one endpoint in a goroutine, retrying with
+// backoff. headers is called for every attempt, so signatures carry its time.
+func startWebhookDelivery(logger runtime.Logger, nk runtime.NakamaModule, target, event string, body []byte, headers func(timestamp int64) map[string]string) {
+	select {
+	case webhookSlots <- struct{}{}:
+	default:
+		logger.Warn("Too many webhook deliveries in progress, dropping %s to %s", event, target)
+		nk.MetricsCounterAdd(metricWebhookFailures, map[string]string{"event": event}, 1)
+		return
+	}
+
+	go func() {
+		defer func() { <-webhookSlots }()
+		recoverInto(logger, nk, "webhook_delivery", func() {
+			if err := deliverWebhook(target, body, headers); err != nil {
+				logger.Error("Failed to deliver %s webhook to %s: %v", event, target, err)
+				nk.MetricsCounterAdd(metricWebhookFailures, map[string]string{"event": event}, 1)
+			}
+		})
+	}()
+}
+
+// deliverWebhook POSTs a body until the endpoint accepts it. Network errors, 429,
+// and 5xx responses are retried, honouring Retry-After; other responses are final.
+func deliverWebhook(target string, body []byte, headers func(timestamp int64) map[string]string) error {
+	delay := webhookBaseDelay
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		var retryAfter time.Duration
+		var retry bool
+		retryAfter, retry, err = postWebhook(target, body, headers(time.Now().Unix()))
+		if err == nil || !retry || attempt == webhookAttempts {
+			break
+		}
+
+		wait := max(delay, retryAfter)
+		time.Sleep(min(wait, webhookMaxDelay))
+		delay = min(delay*2, webhookMaxDelay)
+	}
+	return err
+}
+
+// postWebhook makes one delivery attempt, reporting whether a failure is worth
+// retrying and how long the endpoint asked to wait first
+func postWebhook(target string, body []byte, headers map[string]string) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, true, err
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode <= 299:
+		return 0, false, nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		seconds, _ := strconv.Atoi(response.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, true, fmt.Errorf("endpoint returned %s", response.Status)
+	default:
+		return 0, false, fmt.Errorf("endpoint returned %s", response.Status)
+	}
+}
+
+// notifyMatchCompleted sends match.completed for a match whose results were
+// just recorded. It runs on the result workers, after the results are claimed,
+// so each match is announced once.
+func notifyMatchCompleted(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, match *TTTMatch, results map[string]PlayerResult) {
+	if len(config.WebhookURLs) == 0 {
+		return
+	}
+	summary := gameOverData(match, results)
+	data := MatchCompletedWebhook{
+		MatchID:  match.ID,
+		Mode:     match.Mode,
+		Ranked:   match.Ranked,
+		Round:    match.Round,
+		WinnerID: summary.WinnerID,
+		Reason:   summary.Reason,
+		Moves:    match.MoveCount,
+		Players:  make(map[string]string, len(match.Players)),
+		Results:  summary.Results,
+	}
+
+	userIDs := make([]string, 0, len(match.Players))
+	for userID := range match.Players {
+		data.Players[userID] = ""
+		userIDs = append(userIDs, userID)
+	}
+	if users, err := nk.UsersGetId(ctx, userIDs, nil); err != nil {
+		logger.Warn("Failed to look up players of match %s for webhooks: %v", match.ID, err)
+	} else {
+		for _, user := range users {
+			data.Players[user.Id] = user.Username
+		}
+	}
+
+	sendWebhook(logger, nk, WebhookMatchCompleted, resultKey(match), data)
+}
+
+// notifyLeaderboardReset sends leaderboard.reset with the final standings of
+// the period that just ended
+func notifyLeaderboardReset(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, leaderboardID string, reset int64) {
+	if len(config.WebhookURLs) == 0 {
+		return
+	}
+	data := LeaderboardResetWebhook{LeaderboardID: leaderboardID, ResetAt: reset, Standings: []LeaderboardEntry{}}
+	records, _, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, nil, webhookResetStandings, "", reset)
+	if err != nil {
+		logger.Warn("Failed to read final standings of %s for webhooks: %v", leaderboardID, err)
+	} else {
+		for _, record := range records {
+			data.Standings = append(data.Standings, LeaderboardEntry{
+				UserID:   record.OwnerId,
+				Username: record.Username.GetValue(),
+				Score:    record.Score,
+				Rank:     int(record.Rank),
+			})
+		}
+	}
+
+	sendWebhook(logger, nk, WebhookLeaderboardReset, fmt.Sprintf("%s:%d", leaderboardID, reset), data)
+}
+
+// notifyPlayerBanned sends player.banned for a ban or suspension just stored
+func notifyPlayerBanned(logger runtime.Logger, nk runtime.NakamaModule, userID string, ban Ban) {
+	sendWebhook(logger, nk, WebhookPlayerBanned, fmt.Sprintf("%s:%d", userID, ban.BannedAt), PlayerBannedWebhook{
+		UserID:    userID,
+		Kind:      ban.Kind,
+		Reason:    ban.Reason,
+		BannedAt:  ban.BannedAt,
+		ExpiresAt: ban.ExpiresAt,
+	})
+}
@@ -157,11 +157,21 @@ export class NakamaService {
     }
 
     const response = await this.client.rpc(this.session, rpcName, payload);
-    if (typeof response.payload === 'string') {
-      return JSON.parse(response.payload);
-    } else {
-      return response.payload || {};
+    const envelope = typeof response.payload === 'string'
+      ? JSON.parse(response.payload)
+      : (response.payload || {});
+    return this.unwrapRpcEnvelope(envelope);
+  }
+
+  // Unwrap the server's standard RPC envelope ({ ok, data, error })
+  private unwrapRpcEnvelope(envelope: any): any {
+    if (envelope && typeof envelope.ok === 'boolean') {
+      if (!envelope.ok) {
+        throw new Error(envelope.error?.message || 'RPC failed');
+      }
+      return envelope.data ?? {};
     }
+    return envelope;
   }
 
   // Join a match
@@ -444,7 +454,7 @@ export class NakamaService {
       });
 
       // Parse the response
-      const matchmakingResponse = JSON.parse(response.payload || '{}');
+      const matchmakingResponse = this.unwrapRpcEnvelope(JSON.parse(response.payload || '{}'));
       console.log("=== Parsed Matchmaking Response ===", matchmakingResponse);
 
       // Check if we got a match ID (match was created) or a ticket (waiting for opponent)